@@ -22,6 +22,7 @@ import (
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/gafka/telemetry/influxdb"
+	"github.com/funkygao/gafka/telemetry/prometheus"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/golib/signal"
@@ -45,8 +46,11 @@ func init() {
 	flag.StringVar(&Options.InfluxAddr, "influxaddr", "", "influxdb server addr")
 	flag.StringVar(&Options.ManagerType, "man", "dummy", "manager type <dummy|mysql>")
 	flag.StringVar(&Options.InfluxDbname, "influxdb", "", "influxdb db name")
+	flag.StringVar(&Options.Reporter, "reporter", "influxdb", "telemetry reporter <influxdb|prometheus>")
+	flag.StringVar(&Options.PrometheusAddr, "promaddr", ":9066", "prometheus /metrics listen addr")
 	flag.StringVar(&Options.ListenAddr, "addr", ":9065", "monitor http server addr")
 	flag.StringVar(&Options.HintedHandoffDir, "hhdirs", "hh", "hinted handoff dirs separated by comma")
+	flag.Float64Var(&Options.RebalanceThreshold, "imbalance", 0.2, "rebalance job queues when imbalance can be reduced by more than this ratio")
 	flag.Parse()
 
 	if Options.ShowVersion {
@@ -87,12 +91,28 @@ func Main() {
 	meta.Default.Start()
 	log.Trace("meta store[%s] started", meta.Default.Name())
 
-	if Options.InfluxAddr != "" && Options.InfluxDbname != "" {
-		rc, err := influxdb.NewConfig(Options.InfluxAddr, Options.InfluxDbname, "", "", time.Minute)
+	switch Options.Reporter {
+	case "influxdb":
+		if Options.InfluxAddr != "" && Options.InfluxDbname != "" {
+			rc, err := influxdb.NewConfig(Options.InfluxAddr, Options.InfluxDbname, "", "", time.Minute)
+			if err != nil {
+				panic(err)
+			}
+			telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+		}
+
+	case "prometheus":
+		rc, err := prometheus.NewConfig(Options.PrometheusAddr)
 		if err != nil {
 			panic(err)
 		}
-		telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+		telemetry.Default = prometheus.New(metrics.DefaultRegistry, rc)
+
+	default:
+		panic("invalid reporter: " + Options.Reporter)
+	}
+
+	if telemetry.Default != nil {
 		go func() {
 			log.Info("telemetry[%s] started", telemetry.Default.Name())
 
@@ -110,7 +130,7 @@ func Main() {
 	}
 	log.Trace("pub store[%s] started", store.DefaultPubStore.Name())
 
-	c := controller.New(zkzone, Options.ListenAddr, Options.ManagerType)
+	c := controller.New(zkzone, Options.ListenAddr, Options.ManagerType, Options.RebalanceThreshold)
 
 	cfg := disk.DefaultConfig()
 	cfg.Dirs = strings.Split(Options.HintedHandoffDir, ",")
@@ -8,7 +8,11 @@ var Options struct {
 	LogRotateSize    int
 	InfluxAddr       string
 	InfluxDbname     string
+	Reporter         string
+	PrometheusAddr   string
 	ListenAddr       string
 	ManagerType      string
 	HintedHandoffDir string
+
+	RebalanceThreshold float64
 }
@@ -37,6 +37,91 @@ func assignResourcesToActors(actors zk.ActorList, resources zk.ResourceList) (de
 	return
 }
 
+// assignWeightedResourcesToActors assigns heavier resources first, each to the actor
+// with the least load so far. Resources absent from weights weigh defaultWeight.
+func assignWeightedResourcesToActors(actors zk.ActorList, resources zk.ResourceList,
+	weights map[string]float64) (decision map[string]zk.ResourceList) {
+	decision = make(map[string]zk.ResourceList)
+
+	rLen, aLen := len(resources), len(actors)
+	if aLen == 0 || rLen == 0 {
+		return
+	}
+
+	sort.Sort(actors)
+	sorted := weightedResources{resources: make(zk.ResourceList, rLen), weights: weights}
+	copy(sorted.resources, resources)
+	sort.Sort(sorted)
+
+	loads := make([]float64, aLen)
+	for _, resource := range sorted.resources {
+		lightest := 0
+		for i := 1; i < aLen; i++ {
+			if loads[i] < loads[lightest] {
+				lightest = i
+			}
+		}
+
+		loads[lightest] += resourceWeight(weights, resource)
+		decision[actors[lightest]] = append(decision[actors[lightest]], resource)
+	}
+	return
+}
+
+// imbalance is how much the heaviest actor exceeds the average load, 0 means perfectly balanced.
+func imbalance(actors zk.ActorList, decision map[string]zk.ResourceList, weights map[string]float64) float64 {
+	if len(actors) == 0 {
+		return 0
+	}
+
+	var total, heaviest float64
+	for _, actor := range actors {
+		var load float64
+		for _, resource := range decision[actor] {
+			load += resourceWeight(weights, resource)
+		}
+
+		total += load
+		if load > heaviest {
+			heaviest = load
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return heaviest/(total/float64(len(actors))) - 1
+}
+
+func resourceWeight(weights map[string]float64, resource string) float64 {
+	if w, present := weights[resource]; present {
+		return w
+	}
+	return defaultWeight
+}
+
+// weightedResources sorts resources by weight desc, then by name.
+type weightedResources struct {
+	resources zk.ResourceList
+	weights   map[string]float64
+}
+
+func (this weightedResources) Len() int {
+	return len(this.resources)
+}
+
+func (this weightedResources) Less(i, j int) bool {
+	wi, wj := resourceWeight(this.weights, this.resources[i]), resourceWeight(this.weights, this.resources[j])
+	if wi != wj {
+		return wi > wj
+	}
+	return this.resources[i] < this.resources[j]
+}
+
+func (this weightedResources) Swap(i, j int) {
+	this.resources[i], this.resources[j] = this.resources[j], this.resources[i]
+}
+
 func min(a, b int) int {
 	if a > b {
 		return b
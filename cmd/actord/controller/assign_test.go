@@ -2,6 +2,7 @@ package controller
 
 import (
 	"testing"
+	"time"
 
 	"github.com/funkygao/assert"
 	"github.com/funkygao/gafka/zk"
@@ -34,3 +35,63 @@ func TestAssignResourcesToActors_ActorMoreThanJobQueues(t *testing.T) {
 	assert.Equal(t, 0, len(decision["2"]))
 	assert.Equal(t, 1, len(decision["1"]))
 }
+
+func TestAssignWeightedResourcesToActors(t *testing.T) {
+	jobs := zk.ResourceList([]string{"a", "b", "c", "d", "e"})
+	actors := zk.ActorList([]string{"2", "1"})
+	weights := map[string]float64{"a": 10, "b": 4, "c": 3, "d": 2}
+
+	decision := assignWeightedResourcesToActors(actors, jobs, weights)
+	t.Logf("%+v", decision)
+	assert.Equal(t, zk.ResourceList{"a"}, decision["1"])
+	assert.Equal(t, zk.ResourceList{"b", "c", "d", "e"}, decision["2"])
+	assert.Equal(t, 0., imbalance(actors, decision, weights))
+
+	// input order does not matter
+	jobs = zk.ResourceList([]string{"e", "d", "c", "b", "a"})
+	assert.Equal(t, decision, assignWeightedResourcesToActors(actors, jobs, weights))
+}
+
+func TestAssignWeightedResourcesToActors_NoWeights(t *testing.T) {
+	jobs := zk.ResourceList([]string{"a", "b", "c", "d", "e"})
+	actors := zk.ActorList([]string{"1", "2"})
+
+	decision := assignWeightedResourcesToActors(actors, jobs, nil)
+	assert.Equal(t, 3, len(decision["1"]))
+	assert.Equal(t, 2, len(decision["2"]))
+
+	decision = assignWeightedResourcesToActors(actors, zk.ResourceList{}, nil)
+	assert.Equal(t, 0, len(decision))
+}
+
+func TestImbalance(t *testing.T) {
+	actors := zk.ActorList([]string{"1", "2"})
+	weights := map[string]float64{"a": 10, "b": 3, "c": 2, "d": 3, "e": 2}
+
+	// even by count, but actor 1 carries 15 of 20
+	decision := assignResourcesToActors(actors, zk.ResourceList([]string{"a", "b", "c", "d", "e"}))
+	assert.Equal(t, 0.5, imbalance(actors, decision, weights))
+	assert.Equal(t, 0., imbalance(actors, nil, weights))
+}
+
+func TestJobQueueWeights(t *testing.T) {
+	now := time.Now()
+	jobQueues := zk.ResourceList([]string{"hot", "idle", "vip", "batch", "stale"})
+	stats := map[string]zk.JobQueueStat{
+		"hot":   {Backlog: 5000, DueRate: 4, Mtime: now.Unix()},
+		"vip":   {Backlog: 0, DueRate: 1, Mtime: now.Unix()},
+		"batch": {Backlog: 3000, DueRate: 0, Mtime: now.Unix()},
+		"stale": {Backlog: 1e6, DueRate: 100, Mtime: now.Add(-time.Hour).Unix()},
+	}
+	priorities := map[string]string{"app_vip": zk.PriorityHigh, "app_batch": zk.PriorityLow}
+	appidOf := func(jobQueue string) string {
+		return "app_" + jobQueue
+	}
+
+	weights := jobQueueWeights(jobQueues, stats, priorities, appidOf, now)
+	assert.Equal(t, 10., weights["hot"])
+	assert.Equal(t, 1., weights["idle"])
+	assert.Equal(t, 8., weights["vip"])
+	assert.Equal(t, 1., weights["batch"])
+	assert.Equal(t, 1., weights["stale"])
+}
@@ -33,6 +33,8 @@ type controller struct {
 	quiting      chan struct{}
 	auditor      log.Logger
 
+	rebalanceThreshold float64
+
 	ListenAddr string `json:"addr"`
 	Version    string `json:"version"`
 
@@ -43,7 +45,7 @@ type controller struct {
 	shortId string // cache
 }
 
-func New(zkzone *zk.ZkZone, listenAddr string, managerType string) Controller {
+func New(zkzone *zk.ZkZone, listenAddr string, managerType string, rebalanceThreshold float64) Controller {
 	// mysql cluster config
 	b, err := zkzone.KatewayJobClusterConfig()
 	if err != nil {
@@ -60,6 +62,8 @@ func New(zkzone *zk.ZkZone, listenAddr string, managerType string) Controller {
 		mc:           mysql.New(mcc),
 		ListenAddr:   listenAddr,
 		Version:      gafka.BuildId,
+
+		rebalanceThreshold: rebalanceThreshold,
 	}
 	this.ident, err = this.generateIdent()
 	if err != nil {
@@ -104,6 +108,7 @@ func (this *controller) RunForever() (err error) {
 
 	jobDispatchQuit := make(chan struct{})
 	go this.dispatchJobQueues(jobDispatchQuit)
+	go this.balanceJobQueues()
 
 	webhookDispatchQuit := make(chan struct{})
 	go this.dispatchWebhooks(webhookDispatchQuit)
@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/funkygao/gafka/cmd/actord/executor"
 	log "github.com/funkygao/log4go"
 )
 
@@ -19,5 +21,9 @@ func (this *controller) statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf8")
 	w.Header().Set("Server", "actord")
 
-	w.Write(this.Bytes())
+	output := make(map[string]interface{})
+	json.Unmarshal(this.Bytes(), &output)
+	output["webhooks"] = executor.WebhookStats()
+	b, _ := json.Marshal(output)
+	w.Write(b)
 }
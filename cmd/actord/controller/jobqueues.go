@@ -38,8 +38,14 @@ REBALANCE:
 		}
 		this.ActorN.Set(int32(len(actors)))
 
+		weights, weightChanges, err := this.orchestrator.WatchJobWeights()
+		if err != nil {
+			// assign evenly
+			log.Error("watch job weights: %s", err)
+		}
+
 		log.Info("deciding: found %d job queues, %d actors", len(jobQueues), len(actors))
-		decision := assignResourcesToActors(actors, jobQueues)
+		decision := assignWeightedResourcesToActors(actors, jobQueues, weights)
 		myJobQueues := decision[this.Id()]
 
 		if len(myJobQueues) == 0 {
@@ -72,6 +78,12 @@ REBALANCE:
 			close(executorStopper)
 			wg.Wait()
 
+		case <-weightChanges:
+			log.Info("rebalance due to job queue weights changes")
+
+			close(executorStopper)
+			wg.Wait()
+
 		case <-actorChanges:
 			log.Info("rebalance due to actor changes")
 
@@ -127,7 +139,7 @@ func (this *controller) invokeJobExexutor(jobQueue string, wg *sync.WaitGroup, s
 		log.Error(err)
 	}
 
-	exe := executor.NewJobExecutor(this.shortId, cluster, jobQueue, this.mc, stopper, this.auditor)
+	exe := executor.NewJobExecutor(this.shortId, cluster, jobQueue, this.mc, this.orchestrator, stopper, this.auditor)
 	exe.Run()
 
 }
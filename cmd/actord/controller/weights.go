@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/zk"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	defaultWeight = 1.
+
+	// a job queue weighs 1 + backlog/backlogUnit + due jobs per second, scaled by its app priority
+	backlogUnit = 1000.
+
+	staleJobQueueStat    = time.Minute * 5
+	jobRebalanceInterval = time.Minute
+)
+
+var priorityFactors = map[string]float64{
+	zk.PriorityHigh:   4,
+	zk.PriorityNormal: 1,
+	zk.PriorityLow:    0.25,
+}
+
+// jobQueueWeights calculates the weight of each job queue from its load and app priority.
+// Stale stats are ignored because the queue might have no owner to report it.
+func jobQueueWeights(jobQueues zk.ResourceList, stats map[string]zk.JobQueueStat,
+	priorities map[string]string, appidOf func(jobQueue string) string, now time.Time) map[string]float64 {
+	weights := make(map[string]float64, len(jobQueues))
+	for _, jobQueue := range jobQueues {
+		w := defaultWeight
+		if stat, present := stats[jobQueue]; present && now.Unix()-stat.Mtime < int64(staleJobQueueStat.Seconds()) {
+			w += float64(stat.Backlog)/backlogUnit + stat.DueRate
+		}
+
+		if factor, present := priorityFactors[priorities[appidOf(jobQueue)]]; present {
+			w *= factor
+		}
+
+		// 2 decimals is precise enough, and keeps the snapshot stable
+		weights[jobQueue] = math.Ceil(w*100) / 100
+	}
+	return weights
+}
+
+// balanceJobQueues runs on every actor, but only the leader(the smallest actor id) publishes
+// a new weights snapshot when the load imbalance can be reduced by more than the threshold.
+func (this *controller) balanceJobQueues() {
+	tick := time.NewTicker(jobRebalanceInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-this.quiting:
+			return
+
+		case now := <-tick.C:
+			actors := make(zk.ActorList, 0)
+			for actor := range this.orchestrator.ChildrenWithData(zk.PubsubActors) {
+				actors = append(actors, actor)
+			}
+			sort.Sort(actors)
+			if len(actors) == 0 || actors[0] != this.Id() {
+				continue
+			}
+
+			jobQueues := make(zk.ResourceList, 0)
+			for jobQueue := range this.orchestrator.ChildrenWithData(zk.PubsubJobQueues) {
+				jobQueues = append(jobQueues, jobQueue)
+			}
+
+			oldWeights, err := this.orchestrator.JobWeights()
+			if err != nil {
+				log.Error("job weights: %s", err)
+				continue
+			}
+
+			weights := jobQueueWeights(jobQueues, this.orchestrator.JobQueueStats(),
+				this.orchestrator.AppPriorities(), manager.Default.TopicAppid, now)
+			current := assignWeightedResourcesToActors(actors, jobQueues, oldWeights)
+			optimal := assignWeightedResourcesToActors(actors, jobQueues, weights)
+			before, after := imbalance(actors, current, weights), imbalance(actors, optimal, weights)
+			if before-after <= this.rebalanceThreshold {
+				continue
+			}
+
+			log.Info("job queues imbalance %.2f -> %.2f, rebalancing", before, after)
+			if err = this.orchestrator.SetJobWeights(weights); err != nil {
+				log.Error("job weights: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package executor
+
+import (
+	"errors"
+)
+
+var (
+	errStopped     = errors.New("executor stopped")
+	errCircuitOpen = errors.New("circuit open")
+)
@@ -11,12 +11,15 @@ import (
 	jm "github.com/funkygao/gafka/cmd/kateway/job/mysql"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/zk"
 	log "github.com/funkygao/log4go"
 )
 
 const (
 	LagWarnThreshold   = 3  // in sec
 	HandlerConcurrentN = 10 // FIXME breaks the delivery order guarantee
+
+	statReportInterval = time.Minute
 )
 
 // JobExecutor polls a single JobQueue and handle each Job.
@@ -24,6 +27,7 @@ type JobExecutor struct {
 	parentId       string // controller short id
 	cluster, topic string
 	mc             *mysql.MysqlCluster
+	orchestrator   *zk.Orchestrator
 	stopper        <-chan struct{}
 	dueJobs        chan job.JobItem
 	auditor        log.Logger
@@ -35,16 +39,17 @@ type JobExecutor struct {
 	ident string
 }
 
-func NewJobExecutor(parentId, cluster, topic string, mc *mysql.MysqlCluster,
+func NewJobExecutor(parentId, cluster, topic string, mc *mysql.MysqlCluster, orchestrator *zk.Orchestrator,
 	stopper <-chan struct{}, auditor log.Logger) *JobExecutor {
 	this := &JobExecutor{
-		parentId: parentId,
-		cluster:  cluster,
-		topic:    topic,
-		mc:       mc,
-		stopper:  stopper,
-		dueJobs:  make(chan job.JobItem, 200),
-		auditor:  auditor,
+		parentId:     parentId,
+		cluster:      cluster,
+		topic:        topic,
+		mc:           mc,
+		orchestrator: orchestrator,
+		stopper:      stopper,
+		dueJobs:      make(chan job.JobItem, 200),
+		auditor:      auditor,
 	}
 
 	return this
@@ -68,7 +73,15 @@ func (this *JobExecutor) Run() {
 		item job.JobItem
 		tick = time.NewTicker(time.Second)
 		sql  = fmt.Sprintf("SELECT job_id,payload,ctime,due_time FROM %s WHERE due_time<=?", this.table)
+
+		statTick  = time.NewTicker(statReportInterval)
+		statSince = time.Now()
+		dueJobsN  int64
 	)
+	defer func() {
+		tick.Stop()
+		statTick.Stop()
+	}()
 
 	for i := 0; i < HandlerConcurrentN; i++ {
 		wg.Add(1)
@@ -82,6 +95,10 @@ func (this *JobExecutor) Run() {
 			wg.Wait()
 			return
 
+		case now := <-statTick.C:
+			this.reportStat(dueJobsN, now.Sub(statSince))
+			statSince, dueJobsN = now, 0
+
 		case now := <-tick.C:
 			rows, err := this.mc.Query(jm.AppPool, this.topic, this.aid, sql, now.Unix())
 			if err != nil {
@@ -98,6 +115,7 @@ func (this *JobExecutor) Run() {
 					}
 
 					this.dueJobs <- item
+					dueJobsN++
 				} else {
 					log.Error("%s: %s", this.ident, err)
 				}
@@ -113,6 +131,36 @@ func (this *JobExecutor) Run() {
 
 }
 
+// reportStat saves the load of the job queue for weighted job queue assignment.
+func (this *JobExecutor) reportStat(dueJobsN int64, elapsed time.Duration) {
+	stat := zk.JobQueueStat{
+		DueRate: float64(dueJobsN) / elapsed.Seconds(),
+		Mtime:   time.Now().Unix(),
+	}
+
+	sql := fmt.Sprintf("SELECT COUNT(*) FROM %s", this.table)
+	rows, err := this.mc.Query(jm.AppPool, this.topic, this.aid, sql)
+	if err != nil {
+		log.Error("%s: %v", this.ident, err)
+		return
+	}
+	for rows.Next() {
+		err = rows.Scan(&stat.Backlog)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		log.Error("%s: %v", this.ident, err)
+		return
+	}
+
+	if err = this.orchestrator.UpdateJobQueueStat(this.topic, stat); err != nil {
+		log.Error("%s: %v", this.ident, err)
+	}
+}
+
 // TODO batch DELETE/INSERT for better performance.
 func (this *JobExecutor) handleDueJobs(wg *sync.WaitGroup) {
 	defer wg.Done()
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +16,9 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/gateway"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/mpool"
+	"github.com/funkygao/gafka/sla"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/golib/breaker"
 	"github.com/funkygao/kafka-cg/consumergroup"
@@ -24,6 +27,13 @@ import (
 
 const (
 	groupName = "_webhook"
+
+	webhookMaxRetries     = 5
+	webhookBuryMaxRetries = 10
+	webhookBackoffBase    = time.Millisecond * 200
+	webhookBackoffMax     = time.Second * 10
+	webhookRetryRatio     = 0.2 // each push earns 0.2 retry
+	webhookRetryReserve   = 10
 )
 
 type WebhookExecutor struct {
@@ -34,11 +44,14 @@ type WebhookExecutor struct {
 	auditor        log.Logger
 
 	appid, appSignature, userAgent string
+	deadTopic                      string
 
 	circuits   map[string]*breaker.Consecutive
+	budgets    map[string]*retryBudget
 	fetcher    *consumergroup.ConsumerGroup
 	msgCh      chan *sarama.ConsumerMessage
-	httpClient *http.Client // it has builtin pooling
+	gaveUp     chan struct{} // closed when a message can be neither delivered nor buried
+	httpClient *http.Client  // it has builtin pooling
 }
 
 func NewWebhookExecutor(parentId, cluster, topic string, endpoints []string,
@@ -52,7 +65,9 @@ func NewWebhookExecutor(parentId, cluster, topic string, endpoints []string,
 		auditor:   auditor,
 		userAgent: fmt.Sprintf("actor.%s", gafka.BuildId),
 		msgCh:     make(chan *sarama.ConsumerMessage, 20),
+		gaveUp:    make(chan struct{}),
 		circuits:  make(map[string]*breaker.Consecutive, len(endpoints)),
+		budgets:   make(map[string]*retryBudget, len(endpoints)),
 		httpClient: &http.Client{
 			Timeout: time.Second * 4,
 			Transport: &http.Transport{
@@ -72,6 +87,7 @@ func NewWebhookExecutor(parentId, cluster, topic string, endpoints []string,
 			RetryTimeout:     time.Second * 5,
 			FailureAllowance: 5,
 		}
+		this.budgets[ep] = newRetryBudget(webhookRetryRatio, webhookRetryReserve)
 	}
 
 	return this
@@ -95,6 +111,16 @@ func (this *WebhookExecutor) Run() {
 		log.Warn("%s/%s invalid app signature", this.topic, this.appid)
 	}
 
+	// undeliverable messages can't be committed without the dead letter topic
+	if this.deadTopic = this.deadLetterTopic(); this.deadTopic == "" {
+		log.Warn("invalid topic: %s", this.topic)
+		return
+	}
+	if err := this.ensureDeadLetterTopic(); err != nil {
+		log.Error("%s stopped: %s", this.topic, err)
+		return
+	}
+
 	cf := consumergroup.NewConfig()
 	cf.Net.DialTimeout = time.Second * 10
 	cf.Net.WriteTimeout = time.Second * 10
@@ -128,12 +154,24 @@ func (this *WebhookExecutor) Run() {
 			wg.Wait()
 			return
 
+		case <-this.gaveUp:
+			// leave the group with the message uncommitted, it is consumed again
+			// when the webhook is claimed after next rebalance
+			log.Error("%s stopped: dead letter topic %s unavailable", this.topic, this.deadTopic)
+			wg.Wait()
+			cg.Close()
+			return
+
 		case err := <-cg.Errors():
 			log.Error("%s %s", this.topic, err)
 			// TODO
 
 		case msg := <-cg.Messages():
-			this.msgCh <- msg
+			select {
+			case this.msgCh <- msg:
+			case <-this.gaveUp:
+			case <-this.stopper:
+			}
 		}
 
 	}
@@ -149,8 +187,18 @@ func (this *WebhookExecutor) pump(wg *sync.WaitGroup) {
 			return
 
 		case msg := <-this.msgCh:
+			var failed []string
 			for _, ep := range this.endpoints {
-				this.pushToEndpoint(msg, ep)
+				if err := this.deliver(msg, ep); err == errStopped {
+					// not committed, will be delivered again after rebalance
+					return
+				} else if err != nil {
+					failed = append(failed, ep)
+				}
+			}
+
+			if len(failed) > 0 && !this.bury(msg, failed) {
+				return
 			}
 
 			this.fetcher.CommitUpto(msg)
@@ -159,12 +207,106 @@ func (this *WebhookExecutor) pump(wg *sync.WaitGroup) {
 
 }
 
-func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri string) (ok bool) {
+// deliver pushes a message to an endpoint with exponential backoff retries within the retry budget.
+func (this *WebhookExecutor) deliver(msg *sarama.ConsumerMessage, uri string) (err error) {
+	this.budgets[uri].deposit()
+
+	for retries := 0; ; retries++ {
+		t0 := time.Now()
+		if err = this.pushToEndpoint(msg, uri); err == nil {
+			updateEndpointStat(this.topic, uri, func(stat *EndpointStat) {
+				stat.Delivered++
+				stat.LatencyMs = int64(time.Since(t0) / time.Millisecond)
+			})
+			return
+		}
+
+		endpointFailed(this.topic, uri, err)
+
+		if retries >= webhookMaxRetries || !this.budgets[uri].withdraw() {
+			log.Warn("%s %s gave up after %d retries: %s", this.topic, uri, retries, err)
+			return
+		}
+
+		select {
+		case <-this.stopper:
+			return errStopped
+		case <-time.After(backoff(retries, webhookBackoffBase, webhookBackoffMax)):
+		}
+
+		updateEndpointStat(this.topic, uri, func(stat *EndpointStat) {
+			stat.Retries++
+		})
+	}
+}
+
+// bury parks an undeliverable message in the dead letter topic of the webhook.
+// A parked message is the only copy once committed, if it can't be parked after
+// webhookBuryMaxRetries the executor gives up without committing it.
+func (this *WebhookExecutor) bury(msg *sarama.ConsumerMessage, failedEndpoints []string) bool {
+	for retries := 0; ; retries++ {
+		partition, offset, err := store.DefaultPubStore.SyncPub(this.cluster, this.deadTopic, msg.Key, msg.Value)
+		if err == nil {
+			this.auditor.Trace("%s/%d %d -> %s/%d %d endpoints:%+v",
+				this.topic, msg.Partition, msg.Offset, this.deadTopic, partition, offset, failedEndpoints)
+
+			for _, ep := range failedEndpoints {
+				updateEndpointStat(this.topic, ep, func(stat *EndpointStat) {
+					stat.DeadLettered++
+				})
+			}
+			return true
+		}
+
+		log.Error("%s/%d %d bury %s #%d: %s", this.topic, msg.Partition, msg.Offset, this.deadTopic, retries, err)
+
+		if retries >= webhookBuryMaxRetries {
+			log.Critical("%s/%d %d bury %s gave up after %d retries, webhook stopped",
+				this.topic, msg.Partition, msg.Offset, this.deadTopic, retries)
+
+			for _, ep := range failedEndpoints {
+				updateEndpointStat(this.topic, ep, func(stat *EndpointStat) {
+					stat.BuryFailures++
+				})
+			}
+			close(this.gaveUp)
+			return false
+		}
+
+		select {
+		case <-this.stopper:
+			return false
+		case <-time.After(backoff(retries, webhookBackoffBase, webhookBackoffMax)):
+		}
+	}
+}
+
+// deadLetterTopic is the dead letter shadow topic of the webhook group, empty if
+// the raw topic is not appid.topic.ver with optional obfuscation cookie.
+func (this *WebhookExecutor) deadLetterTopic() string {
+	parts := strings.Split(this.topic, ".")
+	if len(parts) < 3 || len(parts) > 4 {
+		return ""
+	}
+
+	return manager.Default.ShadowTopic(sla.SlaKeyDeadLetterTopic, this.appid, parts[0], parts[1], parts[2], groupName)
+}
+
+func (this *WebhookExecutor) ensureDeadLetterTopic() error {
+	err := meta.Default.ZkCluster(this.cluster).AddTopic(this.deadTopic, sla.DefaultSla())
+	if err != nil && !zk.IsTopicError(err, zk.ErrTopicExists) {
+		return err
+	}
+
+	return nil
+}
+
+func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri string) error {
 	log.Debug("%s sending[%s] %s", this.topic, uri, string(msg.Value))
 
 	if this.circuits[uri].Open() {
 		log.Warn("%s %s circuit open", this.topic, uri)
-		return false
+		return errCircuitOpen
 	}
 
 	body := mpool.BytesBufferGet()
@@ -177,7 +319,7 @@ func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri str
 	req, err := http.NewRequest("POST", uri, body)
 	if err != nil {
 		this.circuits[uri].Fail()
-		return false
+		return err
 	}
 
 	req.Header.Set(gateway.HttpHeaderOffset, strconv.FormatInt(msg.Offset, 10))
@@ -188,7 +330,7 @@ func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri str
 	if err != nil {
 		log.Error("%s %s %s", this.topic, uri, err)
 		this.circuits[uri].Fail()
-		return false
+		return err
 	}
 
 	io.Copy(ioutil.Discard, response.Body)
@@ -197,10 +339,12 @@ func (this *WebhookExecutor) pushToEndpoint(msg *sarama.ConsumerMessage, uri str
 	if response.StatusCode >= 300 {
 		this.circuits[uri].Fail()
 		log.Error("%s %s response: %s", this.topic, uri, http.StatusText(response.StatusCode))
-		return
+		return fmt.Errorf("response: %s", response.Status)
 	}
 
+	this.circuits[uri].Succeed()
+
 	// audit
 	log.Info("pushed %s/%d %d", this.topic, msg.Partition, msg.Offset)
-	return true
+	return nil
 }
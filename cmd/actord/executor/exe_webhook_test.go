@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	log "github.com/funkygao/log4go"
+)
+
+type webhookManager struct {
+	manager.Manager
+}
+
+func (this *webhookManager) ShadowTopic(shadow, myAppid, hisAppid, topic, ver, group string) string {
+	return hisAppid + "." + topic + "." + ver + "." + myAppid + "." + group + "." + shadow
+}
+
+type webhookPubStore struct {
+	store.PubStore
+
+	mu     sync.Mutex
+	down   bool
+	topics []string
+}
+
+func (this *webhookPubStore) SyncPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.down {
+		return 0, 0, errors.New("kafka down")
+	}
+
+	this.topics = append(this.topics, topic)
+	return 0, int64(len(this.topics) - 1), nil
+}
+
+func newTestWebhookExecutor(endpoints []string, stopper chan struct{}) *WebhookExecutor {
+	auditor := log.NewDefaultLogger(log.TRACE)
+	auditor.DeleteFilter("stdout")
+	this := NewWebhookExecutor("1", "c1", "app1.foobar.v1", endpoints, stopper, auditor)
+	this.appid = "app1"
+	this.deadTopic = this.deadLetterTopic()
+	return this
+}
+
+func TestWebhookDeadLetterTopic(t *testing.T) {
+	oldManager := manager.Default
+	defer func() { manager.Default = oldManager }()
+	manager.Default = &webhookManager{}
+
+	this := newTestWebhookExecutor(nil, nil)
+	assert.Equal(t, "app1.foobar.v1.app1._webhook.dead", this.deadTopic)
+
+	this.topic = "app1.foobar.v10.123"
+	assert.Equal(t, "app1.foobar.v10.app1._webhook.dead", this.deadLetterTopic())
+
+	this.topic = "foobar"
+	assert.Equal(t, "", this.deadLetterTopic())
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	oldManager := manager.Default
+	defer func() { manager.Default = oldManager }()
+	manager.Default = &webhookManager{}
+
+	var (
+		mu       sync.Mutex
+		failures = 2
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, "7", r.Header.Get("X-Offset"))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer endpoint.Close()
+
+	this := newTestWebhookExecutor([]string{endpoint.URL}, make(chan struct{}))
+	msg := &sarama.ConsumerMessage{Value: []byte("hello"), Offset: 7}
+	assert.Equal(t, nil, this.deliver(msg, endpoint.URL))
+
+	stat := WebhookStats()[this.topic][endpoint.URL]
+	assert.Equal(t, int64(1), stat.Delivered)
+	assert.Equal(t, int64(2), stat.Failures)
+	assert.Equal(t, int64(2), stat.Retries)
+
+	// retry budget exhausted: give up at once
+	failures = 1
+	this.budgets[endpoint.URL] = newRetryBudget(0, 0)
+	assert.NotEqual(t, nil, this.deliver(msg, endpoint.URL))
+	assert.Equal(t, int64(3), WebhookStats()[this.topic][endpoint.URL].Failures)
+}
+
+func TestWebhookBury(t *testing.T) {
+	oldManager, oldStore := manager.Default, store.DefaultPubStore
+	defer func() { manager.Default, store.DefaultPubStore = oldManager, oldStore }()
+	manager.Default = &webhookManager{}
+	ps := &webhookPubStore{}
+	store.DefaultPubStore = ps
+
+	stopper := make(chan struct{})
+	this := newTestWebhookExecutor([]string{"http://ep1"}, stopper)
+	msg := &sarama.ConsumerMessage{Value: []byte("hello")}
+	assert.Equal(t, true, this.bury(msg, []string{"http://ep1"}))
+	assert.Equal(t, []string{"app1.foobar.v1.app1._webhook.dead"}, ps.topics)
+	assert.Equal(t, int64(1), WebhookStats()[this.topic]["http://ep1"].DeadLettered)
+
+	// never committed if not parked
+	ps.down = true
+	close(stopper)
+	assert.Equal(t, false, this.bury(msg, []string{"http://ep1"}))
+	assert.Equal(t, 1, len(ps.topics))
+}
@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"sync"
+	"time"
+)
+
+// retryBudget caps retries to a ratio of requests, so that a broken endpoint
+// will not be flooded by retries.
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64 // retries earned by each request
+	max     float64 // also the initial balance
+	balance float64
+}
+
+func newRetryBudget(ratio float64, max int) *retryBudget {
+	return &retryBudget{ratio: ratio, max: float64(max), balance: float64(max)}
+}
+
+// deposit is called on each request.
+func (this *retryBudget) deposit() {
+	this.mu.Lock()
+	this.balance += this.ratio
+	if this.balance > this.max {
+		this.balance = this.max
+	}
+	this.mu.Unlock()
+}
+
+// withdraw is called before each retry, false means the budget is exhausted.
+func (this *retryBudget) withdraw() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.balance < 1 {
+		return false
+	}
+
+	this.balance--
+	return true
+}
+
+// backoff returns the exponential wait before the nth retry(0 based).
+func backoff(retry int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < retry && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5, 2)
+	assert.Equal(t, true, b.withdraw())
+	assert.Equal(t, true, b.withdraw())
+	assert.Equal(t, false, b.withdraw())
+
+	b.deposit()
+	assert.Equal(t, false, b.withdraw())
+	b.deposit()
+	assert.Equal(t, true, b.withdraw())
+
+	// never exceeds max
+	for i := 0; i < 100; i++ {
+		b.deposit()
+	}
+	assert.Equal(t, true, b.withdraw())
+	assert.Equal(t, true, b.withdraw())
+	assert.Equal(t, false, b.withdraw())
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := time.Millisecond*200, time.Second*2
+	assert.Equal(t, base, backoff(0, base, max))
+	assert.Equal(t, base*2, backoff(1, base, max))
+	assert.Equal(t, base*8, backoff(3, base, max))
+	assert.Equal(t, max, backoff(4, base, max))
+	assert.Equal(t, max, backoff(100, base, max))
+}
@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"sync"
+	"time"
+)
+
+// EndpointStat is the delivery metrics of a webhook endpoint since actord started.
+type EndpointStat struct {
+	Delivered    int64  `json:"delivered"`
+	Failures     int64  `json:"failures"` // failed attempts
+	Retries      int64  `json:"retries"`
+	DeadLettered int64  `json:"dead"`
+	BuryFailures int64  `json:"bury_failures"` // gave up burying, webhook stopped
+	LatencyMs    int64  `json:"latency_ms"`    // of the last delivery
+	LastError    string `json:"last_error,omitempty"`
+	LastErrorAt  int64  `json:"last_error_at,omitempty"`
+}
+
+var webhookStats = struct {
+	sync.Mutex
+	m map[string]map[string]*EndpointStat // topic:endpoint:stat
+}{m: make(map[string]map[string]*EndpointStat)}
+
+func updateEndpointStat(topic, endpoint string, fn func(stat *EndpointStat)) {
+	webhookStats.Lock()
+	defer webhookStats.Unlock()
+
+	if _, present := webhookStats.m[topic]; !present {
+		webhookStats.m[topic] = make(map[string]*EndpointStat)
+	}
+	stat, present := webhookStats.m[topic][endpoint]
+	if !present {
+		stat = &EndpointStat{}
+		webhookStats.m[topic][endpoint] = stat
+	}
+
+	fn(stat)
+}
+
+func endpointFailed(topic, endpoint string, err error) {
+	updateEndpointStat(topic, endpoint, func(stat *EndpointStat) {
+		stat.Failures++
+		stat.LastError = err.Error()
+		stat.LastErrorAt = time.Now().Unix()
+	})
+}
+
+// WebhookStats returns a snapshot of {topic: {endpoint: stat}}.
+func WebhookStats() map[string]map[string]EndpointStat {
+	webhookStats.Lock()
+	defer webhookStats.Unlock()
+
+	r := make(map[string]map[string]EndpointStat, len(webhookStats.m))
+	for topic, endpoints := range webhookStats.m {
+		r[topic] = make(map[string]EndpointStat, len(endpoints))
+		for ep, stat := range endpoints {
+			r[topic][ep] = *stat
+		}
+	}
+	return r
+}
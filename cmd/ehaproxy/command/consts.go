@@ -4,6 +4,7 @@ const (
 	defaultPrefix  = "/var/wd/ehaproxy"
 	defaultLogfile = "ehaproxy.log"
 	configFile     = ".haproxy.cf"
+	lastGoodConfig = ".haproxy.cf.last"
 	haproxyPidFile = "haproxy.pid"
 
 	dashboardPortHead = 10910
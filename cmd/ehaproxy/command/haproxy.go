@@ -1,11 +1,15 @@
 package command
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"text/template"
 
+	gio "github.com/funkygao/golib/io"
 	log "github.com/funkygao/log4go"
 )
 
@@ -23,6 +27,7 @@ type BackendServers struct {
 	Sub       []Backend
 	Man       []Backend
 	Dashboard []Backend
+	Processes []int // haproxy process ids, starting from 1
 }
 
 func (this *BackendServers) reset() {
@@ -30,6 +35,7 @@ func (this *BackendServers) reset() {
 	this.Sub = make([]Backend, 0)
 	this.Man = make([]Backend, 0)
 	this.Dashboard = make([]Backend, 0)
+	this.Processes = make([]int, 0)
 }
 
 func (this *BackendServers) empty() bool {
@@ -49,6 +55,8 @@ type Backend struct {
 	Port string
 }
 
+// createConfigFile renders and validates the config, the active config is kept as
+// the last good one for rollback.
 func (this *Start) createConfigFile(servers BackendServers) error {
 	log.Info("backends: Pub#%d Sub#%d %+v", len(servers.Pub), len(servers.Sub), servers)
 
@@ -73,41 +81,86 @@ func (this *Start) createConfigFile(servers BackendServers) error {
 		return err
 	}
 
+	if output, err := exec.Command(this.command, "-c", "-f", tmpFile).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid config: %v %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if _, err = os.Stat(configFile); err == nil {
+		if err = os.Rename(configFile, lastGoodConfig); err != nil {
+			return err
+		}
+	}
+
 	return os.Rename(tmpFile, configFile)
 }
 
-func (this *Start) reloadHAproxy() (err error) {
-	var cmd *exec.Cmd = nil
-	waitStartCh := make(chan struct{})
+// rollbackConfigFile restores the last good config.
+func (this *Start) rollbackConfigFile() error {
+	return os.Rename(lastGoodConfig, configFile)
+}
+
+// reloadHAproxy starts a new haproxy generation that takes over the listening sockets,
+// old processes are told to finish their sessions and quit.
+//
+// With -x the listener fds are fetched from the old generation through its stats socket
+// instead of being rebound, so no connection is refused in between. The pub/sub/man
+// listeners are bound to every process, process 1 is enough to hand them all over.
+func (this *Start) reloadHAproxy(oldPids []int) error {
+	args := []string{"-f", configFile}
 	if this.starting {
 		log.Info("haproxy starting")
-		cmd = exec.Command(this.command, "-f", configFile) // TODO use absolute path
-		this.starting = false
+	} else {
+		socket := statsSocket(this.root, 1)
+		if _, err := os.Stat(socket); err == nil {
+			args = append(args, "-x", socket)
+		} else {
+			// no socket to fetch the listeners from, the new generation rebinds them
+			log.Warn("%s not found, reloading without listener handover", socket)
+		}
+
+		args = append(args, "-sf")
+		for _, pid := range oldPids {
+			args = append(args, strconv.Itoa(pid))
+		}
+		log.Info("haproxy reloading: %s %s", this.command, strings.Join(args, " "))
+	}
 
-		go func() {
-			<-waitStartCh
-			log.Info("haproxy started")
-			if err := cmd.Wait(); err != nil {
-				log.Error("haproxy: %v", err)
-			}
-		}()
+	// haproxy runs in daemon mode, it returns after the processes are forked
+	output, err := exec.Command(this.command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if this.starting {
+		this.starting = false
+		log.Info("haproxy started")
 	} else {
-		shellScript := fmt.Sprintf("%s -f %s/%s -sf `cat %s/%s`",
-			this.command, this.root, configFile, this.root, haproxyPidFile)
-		log.Info("haproxy reloading: %s", shellScript)
-		cmd = exec.Command("/bin/sh", "-c", shellScript)
-		go func() {
-			<-waitStartCh
-			log.Info("haproxy reloaded")
-			if err := cmd.Wait(); err != nil {
-				log.Error("haproxy: %v", err)
-			}
-		}()
+		log.Info("haproxy reloaded")
 	}
+	return nil
+}
 
-	if err = cmd.Start(); err == nil {
-		waitStartCh <- struct{}{} // should close
+// haproxyPids returns pids of the current haproxy generation.
+func haproxyPids() []int {
+	f, err := os.Open(haproxyPidFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var pids []int
+	reader := bufio.NewReader(f)
+	for {
+		l, err := gio.ReadLine(reader)
+		if err != nil {
+			// EOF
+			break
+		}
+
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(l))); err == nil {
+			pids = append(pids, pid)
+		}
 	}
 
-	return err
+	return pids
 }
@@ -71,6 +71,7 @@ func init() {
 	}
 }
 
+// GET /v1/status?history=1
 // TODO auth
 func (this *Start) statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf8")
@@ -104,7 +105,18 @@ func (this *Start) statusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	wg.Wait()
 
-	b, _ := json.Marshal(aggStats)
+	// reload counts in the same shape as backend stats so that haproxyMetrics can consume it
+	aggStats["reload"] = this.reloads.counts()
+
+	var b []byte
+	if r.URL.Query().Get("history") == "1" {
+		b, _ = json.Marshal(map[string]interface{}{
+			"stats":   aggStats,
+			"reloads": this.reloads.records(),
+		})
+	} else {
+		b, _ = json.Marshal(aggStats)
+	}
 	w.Write(b)
 }
 
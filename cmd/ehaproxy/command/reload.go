@@ -0,0 +1,149 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const maxReloadHistory = 50
+
+type reloadRecord struct {
+	At         time.Time `json:"at"`
+	Elapsed    string    `json:"elapsed"`
+	Pub        int       `json:"pub"`
+	Sub        int       `json:"sub"`
+	Man        int       `json:"man"`
+	OldPids    []int     `json:"old_pids,omitempty"`
+	Err        string    `json:"err,omitempty"`
+	RolledBack bool      `json:"rollback,omitempty"`
+}
+
+// reloads keeps haproxy reload history and the old generations being drained.
+type reloads struct {
+	mu       sync.Mutex
+	history  []reloadRecord // newest last
+	ok       int64
+	fail     int64
+	rollback int64
+	draining map[int]time.Time // old haproxy pid: deadline
+	command  string            // haproxy executable, to recognize our processes
+}
+
+func newReloads(command string) *reloads {
+	return &reloads{
+		command:  command,
+		history:  make([]reloadRecord, 0, maxReloadHistory),
+		draining: make(map[int]time.Time),
+	}
+}
+
+func (this *reloads) record(r reloadRecord) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	switch {
+	case r.Err == "":
+		this.ok++
+	case r.RolledBack:
+		this.fail++
+		this.rollback++
+	default:
+		this.fail++
+	}
+
+	if len(this.history) == maxReloadHistory {
+		this.history = this.history[1:]
+	}
+	this.history = append(this.history, r)
+}
+
+// drain gives the old haproxy processes a deadline to finish their sessions,
+// those still alive after the deadline are stopped hard.
+func (this *reloads) drain(pids []int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	this.mu.Lock()
+	for _, pid := range pids {
+		this.draining[pid] = deadline
+	}
+	this.mu.Unlock()
+
+	time.AfterFunc(timeout, func() {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+
+		for _, pid := range pids {
+			delete(this.draining, pid)
+			if !processAlive(pid) {
+				continue
+			}
+
+			// the pid might have been reused by another process after haproxy quit
+			if !isCommand(pid, this.command) {
+				log.Warn("pid %d is no longer haproxy, leave it alone", pid)
+				continue
+			}
+
+			log.Warn("haproxy[%d] not drained within %s, stopping it", pid, timeout)
+			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+				log.Error("haproxy[%d]: %v", pid, err)
+			}
+		}
+	})
+}
+
+// counts returns reload counters in the same shape as the backend stats.
+func (this *reloads) counts() map[string]int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var draining int64
+	for pid := range this.draining {
+		if processAlive(pid) {
+			draining++
+		}
+	}
+
+	r := map[string]int64{
+		"ok":       this.ok,
+		"fail":     this.fail,
+		"rollback": this.rollback,
+		"draining": draining,
+	}
+	if len(this.history) > 0 {
+		r["last"] = this.history[len(this.history)-1].At.Unix()
+	}
+	return r
+}
+
+func (this *reloads) records() []reloadRecord {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return append([]reloadRecord(nil), this.history...)
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// isCommand checks whether the process is running the executable through /proc/<pid>/cmdline.
+func isCommand(pid int, command string) bool {
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(cmdline) == 0 {
+		return false
+	}
+
+	// args are separated by NUL
+	argv0 := cmdline
+	if i := bytes.IndexByte(cmdline, 0); i >= 0 {
+		argv0 = cmdline[:i]
+	}
+	return filepath.Base(string(argv0)) == filepath.Base(command)
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestReloadsRecord(t *testing.T) {
+	r := newReloads("haproxy")
+	for i := 0; i < maxReloadHistory+10; i++ {
+		r.record(reloadRecord{Pub: i})
+	}
+	r.record(reloadRecord{Err: "invalid config"})
+	r.record(reloadRecord{Err: "bind failed", RolledBack: true})
+
+	counts := r.counts()
+	assert.Equal(t, int64(maxReloadHistory+10), counts["ok"])
+	assert.Equal(t, int64(2), counts["fail"])
+	assert.Equal(t, int64(1), counts["rollback"])
+	assert.Equal(t, int64(0), counts["draining"])
+
+	records := r.records()
+	assert.Equal(t, maxReloadHistory, len(records))
+	assert.Equal(t, 12, records[0].Pub)
+	assert.Equal(t, "bind failed", records[len(records)-1].Err)
+}
+
+func TestReloadsDrain(t *testing.T) {
+	old := exec.Command("sleep", "10")
+	assert.Equal(t, nil, old.Start())
+	exited := make(chan struct{})
+	go func() {
+		old.Wait()
+		close(exited)
+	}()
+
+	r := newReloads("/bin/sleep")
+	r.drain([]int{old.Process.Pid}, time.Millisecond*50)
+	assert.Equal(t, int64(1), r.counts()["draining"])
+
+	select {
+	case <-exited:
+	case <-time.After(time.Second * 2):
+		old.Process.Kill()
+		t.Fatal("old generation not stopped after drain timeout")
+	}
+	assert.Equal(t, int64(0), r.counts()["draining"])
+}
+
+func TestReloadsDrainOtherProcess(t *testing.T) {
+	// pid reused by a process that is not haproxy
+	other := exec.Command("sleep", "1")
+	assert.Equal(t, nil, other.Start())
+	defer other.Wait()
+
+	r := newReloads("/usr/local/ehaproxy/sbin/haproxy")
+	r.drain([]int{other.Process.Pid}, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, true, processAlive(other.Process.Pid))
+	assert.Equal(t, true, isCommand(other.Process.Pid, "sleep"))
+	assert.Equal(t, false, isCommand(other.Process.Pid, "haproxy"))
+}
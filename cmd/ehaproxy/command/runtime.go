@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// statsSocket is the admin socket of a haproxy process, see the templates.
+func statsSocket(root string, process int) string {
+	return fmt.Sprintf("%s/haproxy.%d.sock", root, process)
+}
+
+// runtimeCommand executes a command on haproxy runtime api through the stats socket.
+func runtimeCommand(socket, cmd string) (string, error) {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	if _, err = conn.Write([]byte(cmd + "\n")); err != nil {
+		return "", err
+	}
+
+	// haproxy closes the conn after the response in non-interactive mode
+	b, err := ioutil.ReadAll(conn)
+	return strings.TrimSpace(string(b)), err
+}
+
+// setServerWeight sets weight of a server in percentage of its configured weight
+// on every haproxy process, each process has its own weight table.
+func setServerWeight(root string, processes int, proxy, server string, percent int) error {
+	cmd := fmt.Sprintf("set weight %s/%s %d%%", proxy, server, percent)
+	for i := 1; i <= processes; i++ {
+		output, err := runtimeCommand(statsSocket(root, i), cmd)
+		if err != nil {
+			return err
+		}
+		if output != "" {
+			// set weight replies nothing on success
+			return fmt.Errorf("%s: %s", cmd, output)
+		}
+	}
+
+	return nil
+}
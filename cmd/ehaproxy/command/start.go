@@ -1,7 +1,6 @@
 package command
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -19,13 +17,14 @@ import (
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/diagnostics/agent"
 	"github.com/funkygao/gafka/registry"
+	eurekar "github.com/funkygao/gafka/registry/eureka"
 	zkr "github.com/funkygao/gafka/registry/zk"
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/gafka/telemetry/influxdb"
+	"github.com/funkygao/gafka/telemetry/prometheus"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/gocli"
-	gio "github.com/funkygao/golib/io"
 	"github.com/funkygao/golib/locking"
 	"github.com/funkygao/golib/signal"
 	log "github.com/funkygao/log4go"
@@ -53,9 +52,14 @@ type Start struct {
 	monitorServer   *http.Server
 	httpAddr        string
 
+	registry      string
+	eurekaServers string
+
 	haproxyStatsUrl string
 	influxdbAddr    string
 	influxdbDbName  string
+	reporter        string
+	promAddr        string
 
 	quitCh, closed chan struct{}
 	zkzone         *zk.ZkZone
@@ -63,6 +67,12 @@ type Start struct {
 
 	withF5   bool
 	f5Notify sync.Once
+
+	weightInterval time.Duration
+	weighter       *weighter
+
+	drainTimeout time.Duration
+	reloads      *reloads
 }
 
 func (this *Start) Run(args []string) (exitCode int) {
@@ -80,7 +90,13 @@ func (this *Start) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&this.haproxyStatsUrl, "statsurl", "", "")
 	cmdFlags.StringVar(&this.influxdbAddr, "influxaddr", "", "")
 	cmdFlags.StringVar(&this.influxdbDbName, "influxdb", "", "")
+	cmdFlags.StringVar(&this.reporter, "reporter", "influxdb", "")
+	cmdFlags.StringVar(&this.promAddr, "promaddr", ":10895", "")
 	cmdFlags.StringVar(&this.httpAddr, "addr", ":10894", "monitor http server addr")
+	cmdFlags.StringVar(&this.registry, "registry", "zk", "")
+	cmdFlags.StringVar(&this.eurekaServers, "eureka", "", "")
+	cmdFlags.DurationVar(&this.weightInterval, "weight", 0, "")
+	cmdFlags.DurationVar(&this.drainTimeout, "drain", time.Minute*5, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -108,15 +124,33 @@ func (this *Start) Run(args []string) (exitCode int) {
 
 	this.setupLogging(this.logfile, "info", "panic")
 	this.starting = true
+	this.reloads = newReloads(this.command)
 	this.startedAt = time.Now()
 
-	if this.haproxyStatsUrl != "" &&
-		this.influxdbAddr != "" && this.influxdbDbName != "" {
-		rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", time.Minute)
-		if err != nil {
-			panic(err)
+	if this.haproxyStatsUrl != "" {
+		switch this.reporter {
+		case "influxdb":
+			if this.influxdbAddr != "" && this.influxdbDbName != "" {
+				rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", time.Minute)
+				if err != nil {
+					panic(err)
+				}
+				telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+			}
+
+		case "prometheus":
+			rc, err := prometheus.NewConfig(this.promAddr)
+			if err != nil {
+				panic(err)
+			}
+			telemetry.Default = prometheus.New(metrics.DefaultRegistry, rc)
+
+		default:
+			panic("invalid reporter: " + this.reporter)
 		}
-		telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+	}
+
+	if telemetry.Default != nil {
 		go func() {
 			log.Info("telemetry started: %s", telemetry.Default.Name())
 
@@ -187,12 +221,27 @@ func (this *Start) main() {
 		panic("someone stealing my events")
 	}
 
-	registry.Default = zkr.New(this.zkzone)
+	switch this.registry {
+	case "zk":
+		registry.Default = zkr.New(this.zkzone)
+
+	case "eureka":
+		registry.Default = eurekar.New(eurekar.DefaultConfig(this.zone, strings.Split(this.eurekaServers, ",")...))
 
-	log.Info("ehaproxy[%s] starting...", gafka.BuildId)
+	default:
+		panic("invalid registry: " + this.registry)
+	}
+
+	log.Info("ehaproxy[%s] starting with registry %s...", gafka.BuildId, registry.Default.Name())
 	go this.runMonitorServer(this.httpAddr)
 
-	zkConnected := false
+	if this.weightInterval > 0 {
+		this.weighter = newWeighter(this, this.weightInterval)
+		go this.weighter.start()
+	}
+
+	// eureka registry does not depend on zk session
+	zkConnected := this.registry != "zk"
 	for {
 		instances, instancesChange, err := registry.Default.WatchInstances()
 		if err != nil {
@@ -248,7 +297,7 @@ func (this *Start) reload(kwInstances []string) {
 	}
 	servers.reset()
 	for _, kwNode := range kwInstances {
-		data, _, err := this.zkzone.Conn().Get(kwNode)
+		data, err := registry.Default.InstanceData(kwNode)
 		if err != nil {
 			log.Error("%s: %v", kwNode, err)
 			continue
@@ -302,6 +351,7 @@ func (this *Start) reload(kwInstances []string) {
 			Port: fmt.Sprintf("%d", dashboardPortHead+i),
 			Name: fmt.Sprintf("%d", i+1), // process id starts from 1
 		})
+		servers.Processes = append(servers.Processes, i+1)
 	}
 
 	if servers.empty() {
@@ -314,37 +364,73 @@ func (this *Start) reload(kwInstances []string) {
 		return
 	}
 
-	this.lastServers = servers
-	if err := this.createConfigFile(servers); err != nil {
-		log.Error(err)
+	if err := this.applyServers(servers); err != nil {
+		log.Error("reloading haproxy: %v", err)
 		return
 	}
 
-	if err := this.reloadHAproxy(); err != nil {
-		log.Error("reloading haproxy: %v", err)
-		panic(err)
-	}
+	this.lastServers = servers
 }
 
-func (this *Start) shutdown() {
-	// kill haproxy
-	log.Info("killling haproxy processes")
+// applyServers reloads haproxy with the servers, rolling back to the last good config on failure.
+func (this *Start) applyServers(servers BackendServers) (err error) {
+	t0 := time.Now()
+	oldPids := haproxyPids()
+	if this.starting {
+		oldPids = nil
+	}
+	r := reloadRecord{
+		At:      t0,
+		Pub:     len(servers.Pub),
+		Sub:     len(servers.Sub),
+		Man:     len(servers.Man),
+		OldPids: oldPids,
+	}
+	defer func() {
+		r.Elapsed = time.Since(t0).String()
+		if err != nil {
+			r.Err = err.Error()
+		}
+		this.reloads.record(r)
+	}()
 
-	f, e := os.Open(haproxyPidFile)
-	if e != nil {
-		log.Error("shutdown %v", e)
+	if err = this.createConfigFile(servers); err != nil {
+		// active config untouched
 		return
 	}
 
-	reader := bufio.NewReader(f)
-	for {
-		l, e := gio.ReadLine(reader)
-		if e != nil {
-			// EOF
-			break
+	if err = this.reloadHAproxy(oldPids); err != nil {
+		if this.starting {
+			// nothing to roll back to, and nothing serving
+			panic(err)
+		}
+
+		// the old generation keeps serving because it is only signaled after the new one starts
+		if e := this.rollbackConfigFile(); e != nil {
+			log.Error("rollback config: %v", e)
+		} else {
+			r.RolledBack = true
+			log.Warn("rolled back to last good config")
 		}
+		return
+	}
+
+	if len(oldPids) > 0 {
+		this.reloads.drain(oldPids, this.drainTimeout)
+	}
+
+	if this.weighter != nil {
+		this.weighter.reset(servers)
+	}
 
-		pid, _ := strconv.Atoi(string(l))
+	return
+}
+
+func (this *Start) shutdown() {
+	// kill haproxy
+	log.Info("killling haproxy processes")
+
+	for _, pid := range haproxyPids() {
 		p := &os.Process{
 			Pid: pid,
 		}
@@ -383,10 +469,32 @@ Options:
     -statsurl url
       haproxy stats url
 
+    -drain timeout
+      Old haproxy processes still serving sessions after timeout of a reload are stopped.
+      Default 5m.
+
+    -weight interval
+      Adjust backend weights by kateway live load through haproxy runtime api every interval.
+      Default 0, disabled.
+
+    -registry zk|eureka
+      Default zk
+
+    -eureka urls
+      Eureka service urls separated by comma, e,g. http://localhost:8761/eureka
+
     -influxaddr addr
 
     -influxdb dbName
 
+    -reporter influxdb|prometheus
+      Telemetry reporter of the haproxy stats, requires -statsurl.
+      Default influxdb.
+
+    -promaddr addr
+      Listen addr of prometheus /metrics.
+      Default :10895
+
     -forwardfor
       Default false.
       If true, haproxy will add X-Forwarded-For http header.
@@ -3,8 +3,12 @@ global
     log 127.0.0.1 local1 notice
     log 127.0.0.1 local2 info
     log 127.0.0.1 local3 warning
-    stats bind-process {{.CpuNum}}
-    stats socket /tmp/haproxy.sock mode 0600 level admin
+    stats socket /tmp/haproxy.sock mode 0600 level admin process {{.CpuNum}}
+    # each process has its own runtime api socket for weight adjustment,
+    # the listeners are handed over to the next generation through them on reload
+{{range .Processes}}
+    stats socket {{$.HaproxyRoot}}/haproxy.{{.}}.sock mode 0600 level admin expose-fd listeners process {{.}}
+{{end}}
 
     maxconn  51200
     ulimit-n 102434
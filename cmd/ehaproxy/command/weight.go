@@ -0,0 +1,260 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	maxWeight        = 100 // in percentage of the configured weight
+	minWeight        = 10  // never drain a live backend completely, it might be the last one
+	weightUnknown    = -1  // load not available, keep the current weight
+	weightStepDown   = 20  // drain degraded backend gradually
+	weightStepUp     = 25
+	latencyThreshold = 50. // pub latency p95 in ms above which a backend is degraded
+	loadTolerance    = 2.  // backend with load above tolerance x median is degraded
+)
+
+// backendLoad is the live load reported by kateway GET /v1/load.
+type backendLoad struct {
+	Goroutines  int64   `json:"goroutines"`
+	PubConns    int64   `json:"pubconn"`
+	SubConns    int64   `json:"subconn"`
+	PubInflight int64   `json:"pubinflight"` // pub, job and xa requests being handled
+	PubLatency  float64 `json:"pub_latency_p95"`
+}
+
+// weighter adjusts haproxy backend weights according to live kateway load
+// through the runtime api, without reloading haproxy.
+type weighter struct {
+	ctx *Start
+
+	interval time.Duration
+	client   http.Client
+
+	mu      sync.Mutex
+	servers BackendServers
+	weights map[string]int // proxy/server: weight
+}
+
+func newWeighter(ctx *Start, interval time.Duration) *weighter {
+	return &weighter{
+		ctx:      ctx,
+		interval: interval,
+		client:   http.Client{Timeout: time.Second * 3},
+		weights:  make(map[string]int),
+	}
+}
+
+// reset is called after haproxy reload, when all weights are restored to the configured.
+func (this *weighter) reset(servers BackendServers) {
+	this.mu.Lock()
+	this.servers = servers
+	this.weights = make(map[string]int)
+	this.mu.Unlock()
+}
+
+func (this *weighter) start() {
+	log.Info("backend weighter started with interval %s", this.interval)
+
+	tick := time.NewTicker(this.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-this.ctx.quitCh:
+			log.Info("backend weighter stopped")
+			return
+
+		case <-tick.C:
+			this.adjust()
+		}
+	}
+}
+
+func (this *weighter) adjust() {
+	this.mu.Lock()
+	servers := this.servers
+	this.mu.Unlock()
+
+	loads := make(map[string]*backendLoad, len(servers.Man))
+	for _, be := range servers.Man {
+		// nil load means unreachable
+		id := be.Name[1:]
+		load, err := this.fetch(be.Addr)
+		if err != nil {
+			log.Warn("backend[%s] %s: %v", id, be.Addr, err)
+		}
+		loads[id] = load
+	}
+
+	this.apply(servers.CpuNum, "pub", servers.Pub, pubTargets(loads))
+	this.apply(servers.CpuNum, "sub", servers.Sub, subTargets(loads))
+}
+
+func (this *weighter) fetch(manAddr string) (*backendLoad, error) {
+	resp, err := this.client.Get(fmt.Sprintf("http://%s/v1/load", manAddr))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var load backendLoad
+	if err = json.NewDecoder(resp.Body).Decode(&load); err != nil {
+		return nil, err
+	}
+	return &load, nil
+}
+
+func (this *weighter) apply(processes int, proxy string, backends []Backend, targets map[string]int) {
+	for _, be := range backends {
+		key := proxy + "/" + be.Name
+
+		this.mu.Lock()
+		current, present := this.weights[key]
+		this.mu.Unlock()
+		if !present {
+			current = maxWeight
+		}
+
+		target, present := targets[be.Name[1:]]
+		if !present {
+			// kateway without man server: nothing known about its load
+			target = maxWeight
+		}
+		if target == weightUnknown {
+			// man server unreachable, it might be a network glitch of ours: keep as is
+			continue
+		}
+
+		next := stepWeight(current, target)
+		if next == current {
+			continue
+		}
+
+		if err := setServerWeight(this.ctx.root, processes, proxy, be.Name, next); err != nil {
+			log.Error("%s weight %d%% -> %d%%: %v", key, current, next, err)
+			continue
+		}
+
+		log.Info("%s weight %d%% -> %d%%, target %d%%", key, current, next, target)
+
+		this.mu.Lock()
+		this.weights[key] = next
+		this.mu.Unlock()
+	}
+}
+
+// stepWeight moves weight towards target by at most one step.
+func stepWeight(current, target int) int {
+	switch {
+	case target < current-weightStepDown:
+		return current - weightStepDown
+	case target > current+weightStepUp:
+		return current + weightStepUp
+	default:
+		return target
+	}
+}
+
+// pubTargets derives target pub weight of each kateway id from pub latency,
+// pub connections, inflight pub requests and goroutines.
+func pubTargets(loads map[string]*backendLoad) map[string]int {
+	conns := make([]float64, 0, len(loads))
+	inflights := make([]float64, 0, len(loads))
+	goroutines := make([]float64, 0, len(loads))
+	for _, load := range loads {
+		if load != nil {
+			conns = append(conns, float64(load.PubConns))
+			inflights = append(inflights, float64(load.PubInflight))
+			goroutines = append(goroutines, float64(load.Goroutines))
+		}
+	}
+	medianConns, medianInflights, medianGoroutines := median(conns), median(inflights), median(goroutines)
+
+	r := make(map[string]int, len(loads))
+	for id, load := range loads {
+		if load == nil {
+			r[id] = weightUnknown
+			continue
+		}
+
+		factor := 1.
+		if load.PubLatency > latencyThreshold {
+			factor *= latencyThreshold / load.PubLatency
+		}
+		factor *= relativeFactor(float64(load.PubConns), medianConns)
+		factor *= relativeFactor(float64(load.PubInflight), medianInflights)
+		factor *= relativeFactor(float64(load.Goroutines), medianGoroutines)
+		r[id] = targetWeight(factor)
+	}
+	return r
+}
+
+// subTargets derives target sub weight of each kateway id from sub connections and goroutines.
+func subTargets(loads map[string]*backendLoad) map[string]int {
+	conns := make([]float64, 0, len(loads))
+	goroutines := make([]float64, 0, len(loads))
+	for _, load := range loads {
+		if load != nil {
+			conns = append(conns, float64(load.SubConns))
+			goroutines = append(goroutines, float64(load.Goroutines))
+		}
+	}
+	medianConns, medianGoroutines := median(conns), median(goroutines)
+
+	r := make(map[string]int, len(loads))
+	for id, load := range loads {
+		if load == nil {
+			r[id] = weightUnknown
+			continue
+		}
+
+		factor := relativeFactor(float64(load.SubConns), medianConns) *
+			relativeFactor(float64(load.Goroutines), medianGoroutines)
+		r[id] = targetWeight(factor)
+	}
+	return r
+}
+
+// targetWeight converts a load factor in (0, 1] to weight, bounded by minWeight.
+func targetWeight(factor float64) int {
+	w := int(factor * maxWeight)
+	if w < minWeight {
+		return minWeight
+	}
+	return w
+}
+
+// relativeFactor punishes a value that exceeds the tolerance of the median.
+func relativeFactor(v, median float64) float64 {
+	limit := median * loadTolerance
+	if limit <= 0 || v <= limit {
+		return 1
+	}
+
+	return limit / v
+}
+
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+
+	sort.Float64s(vals)
+	n := len(vals)
+	if n%2 == 1 {
+		return vals[n/2]
+	}
+	return (vals[n/2-1] + vals[n/2]) / 2
+}
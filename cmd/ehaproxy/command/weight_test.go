@@ -0,0 +1,97 @@
+package command
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestStepWeight(t *testing.T) {
+	assert.Equal(t, 80, stepWeight(100, 0))
+	assert.Equal(t, 90, stepWeight(100, 90))
+	assert.Equal(t, 45, stepWeight(20, 100))
+	assert.Equal(t, 100, stepWeight(80, 100))
+	assert.Equal(t, 50, stepWeight(50, 50))
+
+	// drained gradually
+	w := maxWeight
+	for i := 0; i < 5; i++ {
+		w = stepWeight(w, 0)
+	}
+	assert.Equal(t, 0, w)
+}
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 0., median(nil))
+	assert.Equal(t, 2., median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 3, 2}))
+}
+
+func TestTargets(t *testing.T) {
+	loads := map[string]*backendLoad{
+		"1": {Goroutines: 1000, PubConns: 100, SubConns: 100, PubInflight: 10, PubLatency: 5},
+		"2": {Goroutines: 1100, PubConns: 120, SubConns: 90, PubInflight: 12, PubLatency: 100},  // slow pub
+		"3": {Goroutines: 4000, PubConns: 110, SubConns: 800, PubInflight: 11, PubLatency: 10},  // overloaded
+		"4": {Goroutines: 1000, PubConns: 100, SubConns: 100, PubInflight: 44, PubLatency: 5},   // pub piling up
+		"5": {Goroutines: 1000, PubConns: 100, SubConns: 100, PubInflight: 12, PubLatency: 1e4}, // pub stuck
+		"6": nil,                                                                                // unreachable
+	}
+
+	pub := pubTargets(loads)
+	assert.Equal(t, 100, pub["1"])
+	assert.Equal(t, 50, pub["2"])
+	assert.Equal(t, 50, pub["3"])
+	assert.Equal(t, 54, pub["4"])
+	assert.Equal(t, minWeight, pub["5"])
+	assert.Equal(t, weightUnknown, pub["6"])
+
+	sub := subTargets(loads)
+	assert.Equal(t, 100, sub["1"])
+	assert.Equal(t, 100, sub["2"])
+	assert.Equal(t, 12, sub["3"])
+	assert.Equal(t, weightUnknown, sub["6"])
+}
+
+func TestSetServerWeight(t *testing.T) {
+	root, err := ioutil.TempDir("", "ehaproxy")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(root)
+
+	// fake haproxy processes
+	cmds := make(chan string, 10)
+	for i := 1; i <= 2; i++ {
+		ln, err := net.Listen("unix", statsSocket(root, i))
+		assert.Equal(t, nil, err)
+		defer ln.Close()
+
+		go func(ln net.Listener) {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				cmds <- line
+				if line != "set weight pub/p1 60%\n" {
+					conn.Write([]byte("No such server.\n\n"))
+				}
+				conn.Close()
+			}
+		}(ln)
+	}
+
+	assert.Equal(t, nil, setServerWeight(root, 2, "pub", "p1", 60))
+	assert.Equal(t, "set weight pub/p1 60%\n", <-cmds)
+	assert.Equal(t, "set weight pub/p1 60%\n", <-cmds)
+
+	err = setServerWeight(root, 2, "pub", "p9", 60)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "set weight pub/p9 60%: No such server.", err.Error())
+
+	assert.NotEqual(t, nil, setServerWeight(root, 3, "pub", "p1", 60))
+}
@@ -1,23 +1,673 @@
 package command
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/columnize"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/gofmt"
 )
 
+// kateway audit log line: [%d %T] [%L] (%S) %M
+const auditTimeLayout = "01/02/06 15:04:05 MST"
+
+var (
+	auditTimeRe = regexp.MustCompile(`^\[(\d\d/\d\d/\d\d \d\d:\d\d:\d\d[^\]]*)\]`)
+
+	// pub[appid] remote(realIp) {appid.topic.ver UA:ua} {P:partition O:offset} a=async
+	pubAuditRe = regexp.MustCompile(`pub\[([^\]]+)\] .*\{([^ {}]+) UA:.*\} \{P:(\d+) O:(\d+)\}`)
+
+	// xa=[appid] remote(realIp) {rawTopic UA:ua} xid:xid {P:partition O:offset}, xa committed
+	xaAuditRe = regexp.MustCompile(`xa=\[([^\]]+)\] .*\{([^ {}]+) UA:.*\} xid:\S+ \{P:(\d+) O:(\d+)\}`)
+
+	// queue[hhdir/cluster/rawTopic] {P:partition O:offset}, hinted handoff delivered by disk
+	// hh[cluster/rawTopic] {P:partition O:offset}, hinted handoff delivered by kafka
+	hhAuditRe = regexp.MustCompile(`(?:queue|hh)\[([^\]]+)\] \{P:(\d+) O:(\d+)\}`)
+
+	// sub[myAppid/group] remote(realIp) {T:topic/partition O:offset} dack=delayedAck
+	subAuditRe = regexp.MustCompile(`sub\[([^/\]]+)/([^\]]+)\] .*\{T:([^/ ]+)/(\d+) O:(\d+)\}`)
+)
+
+type auditPartition struct {
+	topic     string // logical topic: appid.topic.ver
+	partition int32
+}
+
+type auditRecord struct {
+	t time.Time
+	auditPartition
+	offset int64
+	group  string // kafka consumer group of sub
+}
+
+func parseAuditTime(line string) (time.Time, bool) {
+	m := auditTimeRe.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation(auditTimeLayout, m[1], time.Local)
+	return t, err == nil
+}
+
+func parsePubAudit(line string) (r auditRecord, ok bool) {
+	if r.t, ok = parseAuditTime(line); !ok {
+		return
+	}
+
+	var partition, offset string
+	if m := pubAuditRe.FindStringSubmatch(line); m != nil {
+		r.topic, partition, offset = m[2], m[3], m[4]
+	} else if m = xaAuditRe.FindStringSubmatch(line); m != nil {
+		r.topic, partition, offset = logicalTopic(m[2]), m[3], m[4]
+	} else if m = hhAuditRe.FindStringSubmatch(line); m != nil {
+		r.topic, partition, offset = logicalTopic(filepath.Base(m[1])), m[2], m[3]
+	} else {
+		return r, false
+	}
+
+	return r, r.parsePosition(partition, offset)
+}
+
+func parseSubAudit(line string) (r auditRecord, ok bool) {
+	if r.t, ok = parseAuditTime(line); !ok {
+		return
+	}
+
+	m := subAuditRe.FindStringSubmatch(line)
+	if m == nil {
+		return r, false
+	}
+
+	// kateway consumes with group myAppid.group
+	r.group = m[1] + "." + m[2]
+	r.topic = logicalTopic(m[3])
+	return r, r.parsePosition(m[4], m[5])
+}
+
+func (this *auditRecord) parsePosition(partition, offset string) bool {
+	p, err := strconv.ParseInt(partition, 10, 32)
+	if err != nil {
+		return false
+	}
+	this.partition = int32(p)
+
+	this.offset, err = strconv.ParseInt(offset, 10, 64)
+	return err == nil
+}
+
+// logicalTopic strips the obfuscation suffix of raw kafka topic appid.topic.ver.cookie
+// which kateway uses since v10, while pub audit logs appid.topic.ver.
+func logicalTopic(rawTopic string) string {
+	parts := strings.Split(rawTopic, ".")
+	if len(parts) < 4 {
+		return rawTopic
+	}
+
+	ver, cookie := parts[len(parts)-2], parts[len(parts)-1]
+	if len(ver) <= 2 || ver[0] != 'v' {
+		return rawTopic
+	}
+	if _, err := strconv.Atoi(cookie); err != nil {
+		return rawTopic
+	}
+
+	return strings.Join(parts[:len(parts)-1], ".")
+}
+
+// offsetRange is the offsets [begin, end).
+type offsetRange struct {
+	begin, end int64
+}
+
+// offsetRanges is sorted disjoint offset ranges, kafka offsets are mostly contiguous
+// so that millions of offsets take a few ranges.
+type offsetRanges []offsetRange
+
+func (this *offsetRanges) add(offset int64) {
+	r := *this
+	n := len(r)
+	if n == 0 || offset > r[n-1].end {
+		*this = append(r, offsetRange{offset, offset + 1})
+		return
+	}
+	if offset == r[n-1].end {
+		r[n-1].end++
+		return
+	}
+
+	// out of order: find the first range ending at or after offset
+	i := sort.Search(n, func(i int) bool { return r[i].end >= offset })
+	switch {
+	case offset >= r[i].begin && offset < r[i].end:
+		// duplicated
+
+	case offset == r[i].end:
+		r[i].end++
+		if i+1 < n && r[i+1].begin == r[i].end {
+			r[i].end = r[i+1].end
+			*this = append(r[:i+1], r[i+2:]...)
+		}
+
+	case offset+1 == r[i].begin:
+		r[i].begin--
+
+	default:
+		r = append(r, offsetRange{})
+		copy(r[i+1:], r[i:])
+		r[i] = offsetRange{offset, offset + 1}
+		*this = r
+	}
+}
+
+func (this offsetRanges) count() (n int64) {
+	for _, r := range this {
+		n += r.end - r.begin
+	}
+	return
+}
+
+// intersect returns the offsets both in this and that.
+func (this offsetRanges) intersect(that offsetRanges) offsetRanges {
+	var r offsetRanges
+	for i, j := 0, 0; i < len(this) && j < len(that); {
+		begin, end := this[i].begin, this[i].end
+		if that[j].begin > begin {
+			begin = that[j].begin
+		}
+		if that[j].end < end {
+			end = that[j].end
+		}
+		if begin < end {
+			r = append(r, offsetRange{begin, end})
+		}
+
+		if this[i].end < that[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return r
+}
+
+// subtract returns the offsets in this but not in that.
+func (this offsetRanges) subtract(that offsetRanges) offsetRanges {
+	var r offsetRanges
+	j := 0
+	for _, x := range this {
+		for j < len(that) && that[j].end <= x.begin {
+			j++
+		}
+
+		begin := x.begin
+		for k := j; k < len(that) && that[k].begin < x.end; k++ {
+			if that[k].begin > begin {
+				r = append(r, offsetRange{begin, that[k].begin})
+			}
+			begin = that[k].end
+		}
+		if begin < x.end {
+			r = append(r, offsetRange{begin, x.end})
+		}
+	}
+	return r
+}
+
+// below returns the offsets less than offset.
+func (this offsetRanges) below(offset int64) offsetRanges {
+	return this.intersect(offsetRanges{{math.MinInt64, offset}})
+}
+
+type partitionOffsets struct {
+	oldest, newest int64
+}
+
+// auditReport reconciles the messages of a topic published in the window
+// against what a consumer group consumed.
+type auditReport struct {
+	appid, topic, group string
+	audited             bool // group consumed all the partitions through kateway with sub audit
+
+	published int64
+	consumed  int64 // published messages delivered to the group
+	expired   int64 // published, never consumed and purged by retention
+	skipped   int64 // published, never consumed but the group committed beyond
+	pending   int64 // published, not consumed yet
+	rewinds   int64 // deliveries at or before an offset already delivered
+	lag       int64
+}
+
+func (this auditReport) hasGap() bool {
+	return this.group == "" || this.expired > 0 || this.skipped > 0 || this.rewinds > 0
+}
+
+func (this auditReport) flags() string {
+	var r []string
+	if this.group == "" {
+		r = append(r, "no consumer")
+	}
+	if this.expired > 0 {
+		r = append(r, "expired")
+	}
+	if this.skipped > 0 {
+		r = append(r, "skipped")
+	}
+	if this.rewinds > 0 {
+		r = append(r, "rewind")
+	}
+	return strings.Join(r, ",")
+}
+
+type auditReports []auditReport
+
+func (s auditReports) Len() int      { return len(s) }
+func (s auditReports) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s auditReports) Less(i, j int) bool {
+	if s[i].appid != s[j].appid {
+		return s[i].appid < s[j].appid
+	}
+	if s[i].topic != s[j].topic {
+		return s[i].topic < s[j].topic
+	}
+	return s[i].group < s[j].group
+}
+
+type groupPartition struct {
+	group string
+	auditPartition
+}
+
+type delivery struct {
+	t      int64 // unix nano
+	offset int64
+}
+
+type deliveries []delivery
+
+func (s deliveries) Len() int           { return len(s) }
+func (s deliveries) Less(i, j int) bool { return s[i].t < s[j].t }
+func (s deliveries) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// auditLedger accumulates the audit records of all kateway instances.
+type auditLedger struct {
+	published  map[auditPartition]*offsetRanges
+	deliveries map[groupPartition]deliveries
+}
+
+func newAuditLedger() *auditLedger {
+	return &auditLedger{
+		published:  make(map[auditPartition]*offsetRanges),
+		deliveries: make(map[groupPartition]deliveries),
+	}
+}
+
+func (this *auditLedger) addPub(r auditRecord) {
+	offsets, present := this.published[r.auditPartition]
+	if !present {
+		offsets = &offsetRanges{}
+		this.published[r.auditPartition] = offsets
+	}
+	offsets.add(r.offset)
+}
+
+func (this *auditLedger) addSub(r auditRecord) {
+	gp := groupPartition{r.group, r.auditPartition}
+	this.deliveries[gp] = append(this.deliveries[gp], delivery{r.t.UnixNano(), r.offset})
+}
+
+// topics returns the published logical topics.
+func (this *auditLedger) topics() []string {
+	seen := make(map[string]bool)
+	var r []string
+	for tp := range this.published {
+		if !seen[tp.topic] {
+			seen[tp.topic] = true
+			r = append(r, tp.topic)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// reconcile builds the report of each topic and consumer group from the audit records
+// and kafka offsets, committed is the zk committed offsets keyed by consumer group.
+//
+// A partition without sub audit of a group, e.g. consumed outside kateway, takes the messages
+// below the committed offset as consumed. Sub audit logs must be collected from all the
+// kateway instances: deliveries of a partition by an instance whose logs are missing
+// are reported as skipped.
+func (this *auditLedger) reconcile(offsets map[auditPartition]partitionOffsets,
+	committed map[string]map[auditPartition]int64) []auditReport {
+	delivered := make(map[groupPartition]offsetRanges, len(this.deliveries))
+	rewinds := make(map[string]map[string]int64) // topic:group:rewinds
+	for gp, ds := range this.deliveries {
+		// log files are not necessarily in time order
+		sort.Stable(ds)
+
+		var (
+			ranges       offsetRanges
+			maxDelivered int64
+		)
+		for i, d := range ds {
+			if i > 0 && d.offset <= maxDelivered {
+				if _, present := rewinds[gp.topic]; !present {
+					rewinds[gp.topic] = make(map[string]int64)
+				}
+				rewinds[gp.topic][gp.group]++
+			}
+
+			ranges.add(d.offset)
+			if d.offset > maxDelivered {
+				maxDelivered = d.offset
+			}
+		}
+		delivered[gp] = ranges
+	}
+
+	// partitions of each topic
+	published := make(map[string][]auditPartition)
+	for tp := range this.published {
+		published[tp.topic] = append(published[tp.topic], tp)
+	}
+
+	// groups of each topic
+	groups := make(map[string]map[string]bool)
+	addGroup := func(topic, group string) {
+		if _, present := groups[topic]; !present {
+			groups[topic] = make(map[string]bool)
+		}
+		groups[topic][group] = true
+	}
+	for gp := range delivered {
+		addGroup(gp.topic, gp.group)
+	}
+	for group, partitions := range committed {
+		for tp := range partitions {
+			if _, present := published[tp.topic]; present {
+				addGroup(tp.topic, group)
+			}
+		}
+	}
+
+	var reports auditReports
+	for topic, partitions := range published {
+		appid := topic
+		if i := strings.IndexByte(topic, '.'); i > 0 {
+			appid = topic[:i]
+		}
+
+		if len(groups[topic]) == 0 {
+			report := auditReport{appid: appid, topic: topic}
+			for _, tp := range partitions {
+				report.published += this.published[tp].count()
+			}
+			reports = append(reports, report)
+			continue
+		}
+
+		for group := range groups[topic] {
+			report := auditReport{appid: appid, topic: topic, group: group, audited: true}
+			report.rewinds = rewinds[topic][group]
+
+			for _, tp := range partitions {
+				pubOffsets := *this.published[tp]
+				report.published += pubOffsets.count()
+
+				committedOffset, hasCommitted := committed[group][tp]
+				offset, hasOffsets := offsets[tp]
+				if hasCommitted && hasOffsets {
+					report.lag += offset.newest - committedOffset
+				}
+
+				var consumed offsetRanges
+				if deliveredOffsets, audited := delivered[groupPartition{group, tp}]; audited {
+					consumed = pubOffsets.intersect(deliveredOffsets)
+				} else {
+					report.audited = false
+					if hasCommitted {
+						// zk offset is the next message to consume
+						consumed = pubOffsets.below(committedOffset)
+					}
+				}
+				report.consumed += consumed.count()
+
+				rest := pubOffsets.subtract(consumed)
+				if hasOffsets {
+					expired := rest.below(offset.oldest)
+					report.expired += expired.count()
+					rest = rest.subtract(expired)
+				}
+				if hasCommitted {
+					skipped := rest.below(committedOffset)
+					report.skipped += skipped.count()
+					rest = rest.subtract(skipped)
+				}
+				report.pending += rest.count()
+			}
+
+			reports = append(reports, report)
+		}
+	}
+
+	sort.Sort(reports)
+	return reports
+}
+
 type Audit struct {
 	Ui  cli.Ui
 	Cmd string
+
+	zone, cluster string
+	topicPattern  string
+	since         time.Duration
+	pubLogs       string
+	subLogs       string
+	gapsOnly      bool
 }
 
 func (this *Audit) Run(args []string) (exitCode int) {
+	cmdFlags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.StringVar(&this.topicPattern, "t", "", "")
+	cmdFlags.DurationVar(&this.since, "since", time.Hour*24, "")
+	cmdFlags.StringVar(&this.pubLogs, "pub", "audit/pub_audit.log*", "")
+	cmdFlags.StringVar(&this.subLogs, "sub", "audit/sub_audit.log*", "")
+	cmdFlags.BoolVar(&this.gapsOnly, "gap", false, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if validateArgs(this, this.Ui).
+		require("-c").
+		invalid(args) {
+		return 2
+	}
+
+	from := time.Now().Add(-this.since)
+	ledger := newAuditLedger()
+	if err := this.loadAuditLogs(this.pubLogs, parsePubAudit, from, ledger.addPub); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	if err := this.loadAuditLogs(this.subLogs, parseSubAudit, from, ledger.addSub); err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+	if len(ledger.published) == 0 {
+		this.Ui.Warnf("no pub audit since %s, is kateway -auditpub on?", from.Format("01-02 15:04:05"))
+		return
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	zkcluster := zkzone.NewCluster(this.cluster)
+	offsets, committed, err := this.kafkaOffsets(zkcluster, ledger.topics())
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	this.showReports(ledger.reconcile(offsets, committed))
 	return
 }
 
+// loadAuditLogs feeds the records since from in the log files matching any of the comma
+// separated glob patterns to add.
+func (this *Audit) loadAuditLogs(patterns string, parse func(string) (auditRecord, bool),
+	from time.Time, add func(auditRecord)) error {
+	var files []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		matches, err := filepath.Glob(strings.TrimSpace(pattern))
+		if err != nil {
+			return err
+		}
+
+		files = append(files, matches...)
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			r, ok := parse(scanner.Text())
+			if !ok || r.t.Before(from) || !patternMatched(r.topic, this.topicPattern) {
+				continue
+			}
+
+			add(r)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	return nil
+}
+
+// kafkaOffsets returns the oldest/newest offsets of partitions of the topics published in the
+// window and the zk committed offsets of their consumer groups.
+func (this *Audit) kafkaOffsets(zkcluster *zk.ZkCluster, topics []string) (map[auditPartition]partitionOffsets,
+	map[string]map[auditPartition]int64, error) {
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer kfk.Close()
+
+	rawTopics, err := kfk.Topics()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := make(map[string]string, len(rawTopics)) // logical:raw
+	for _, t := range rawTopics {
+		raw[logicalTopic(t)] = t
+	}
+
+	offsets := make(map[auditPartition]partitionOffsets)
+	committed := make(map[string]map[auditPartition]int64)
+	for _, topic := range topics {
+		rawTopic, present := raw[topic]
+		if !present {
+			this.Ui.Warnf("%s not found in %s", topic, this.cluster)
+			continue
+		}
+
+		partitions, err := kfk.Partitions(rawTopic)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, partitionId := range partitions {
+			oldest, err := kfk.GetOffset(rawTopic, partitionId, sarama.OffsetOldest)
+			if err != nil {
+				return nil, nil, err
+			}
+			newest, err := kfk.GetOffset(rawTopic, partitionId, sarama.OffsetNewest)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			offsets[auditPartition{topic, partitionId}] = partitionOffsets{oldest, newest}
+		}
+
+		consumerGroups, err := zkcluster.ConsumerGroupsOfTopic(rawTopic)
+		if err != nil {
+			return nil, nil, err
+		}
+		for group, metas := range consumerGroups {
+			if _, present := committed[group]; !present {
+				committed[group] = make(map[auditPartition]int64)
+			}
+
+			for _, m := range metas {
+				partitionId, err := strconv.Atoi(m.PartitionId)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				committed[group][auditPartition{topic, int32(partitionId)}] = m.ConsumerOffset
+			}
+		}
+	}
+
+	return offsets, committed, nil
+}
+
+func (this *Audit) showReports(reports []auditReport) {
+	lines := []string{"AppId|Topic|Group|Published|Consumed|Expired|Skipped|Pending|Rewinds|Lag|Gap"}
+	var gaps int
+	for _, r := range reports {
+		if r.hasGap() {
+			gaps++
+		} else if this.gapsOnly {
+			continue
+		}
+
+		group, consumed := r.group, gofmt.Comma(r.consumed)
+		if group == "" {
+			group, consumed = "-", "-"
+		} else if !r.audited {
+			// partitions consumed outside kateway are judged by committed offset
+			group += "*"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s",
+			r.appid, r.topic, group, gofmt.Comma(r.published), consumed,
+			gofmt.Comma(r.expired), gofmt.Comma(r.skipped), gofmt.Comma(r.pending),
+			gofmt.Comma(r.rewinds), gofmt.Comma(r.lag), r.flags()))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	if gaps > 0 {
+		this.Ui.Warnf("%d/%d streams with gaps in the last %s, * means partitions without sub audit", gaps, len(reports), this.since)
+	} else {
+		this.Ui.Infof("%d streams reconciled in the last %s", len(reports), this.since)
+	}
+}
+
 func (*Audit) Synopsis() string {
-	return "Audit of the message streams TODO"
+	return "Audit of the message streams from pub to sub"
 }
 
 func (this *Audit) Help() string {
@@ -26,6 +676,40 @@ Usage: %s audit [options]
 
     %s
 
-`, this.Cmd, this.Synopsis())
+    Reconcile messages published through kateway against the consumer groups
+    by kateway pub/sub audit logs and kafka offsets.
+
+Options:
+
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -t topic pattern
+
+    -since duration
+      Audit window. Default 24h.
+
+    -pub globs
+      Comma separated kateway pub audit logs, enabled by kateway -auditpub.
+      Default audit/pub_audit.log*
+
+    -sub globs
+      Comma separated kateway sub audit logs, enabled by kateway -auditsub.
+      Default audit/sub_audit.log*
+      Collect the logs of all kateway instances, e.g. k1/audit/sub_audit.log*,k2/audit/sub_audit.log*
+      otherwise messages delivered by the missing instances are reported as skipped.
+
+    -gap
+      Only display streams with gaps.
+
+    Gaps:
+      expired  published but purged by retention before consumed
+      skipped  published but never delivered while the group committed beyond
+      rewind   delivered again at or before an offset already delivered
+      no consumer
+
+`, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
 	return strings.TrimSpace(help)
 }
@@ -0,0 +1,175 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseAuditLines(t *testing.T) {
+	r, ok := parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (gateway.(*pubServer).pubHandler:228) pub[app1] 10.1.1.1:5432(10.2.2.2) {app1.foobar.v1 UA:curl/7.1} {P:3 O:1024} a=false")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app1.foobar.v1", r.topic)
+	assert.Equal(t, int32(3), r.partition)
+	assert.Equal(t, int64(1024), r.offset)
+	assert.Equal(t, 22, r.t.Hour())
+	assert.Equal(t, time.June, r.t.Month())
+
+	r, ok = parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (disk.(*queue).pump:63) queue[hh/trade/app1.foobar.v10.123] {P:0 O:7}")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app1.foobar.v10", r.topic)
+	assert.Equal(t, int64(7), r.offset)
+
+	r, ok = parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (gateway.(*pubServer).xa_commit:221) xa=[app1] 10.1.1.1:5432(10.2.2.2) {app1.foobar.v10.123 UA:curl/7.1} xid:12 {P:1 O:8}")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app1.foobar.v10", r.topic)
+	assert.Equal(t, int32(1), r.partition)
+	assert.Equal(t, int64(8), r.offset)
+
+	r, ok = parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (kafka.(*Service).deliver:130) hh[trade/app1.foobar.v10.123] {P:2 O:9}")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app1.foobar.v10", r.topic)
+	assert.Equal(t, int32(2), r.partition)
+	assert.Equal(t, int64(9), r.offset)
+
+	// prepared only, not published yet
+	_, ok = parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (x) xa+[app1] 10.1.1.1(10.2.2.2) {topic:foobar ver:v1 UA:curl} xid:12")
+	assert.Equal(t, false, ok)
+
+	r, ok = parseSubAudit("[06/16/16 22:45:02 CST] [TRAC] (gateway.(*subServer).pumpMessages:466) sub[app2/group1] 10.1.1.1:5432(10.2.2.2) {T:app1.foobar.v10.123/2 O:99} dack=false")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "app2.group1", r.group)
+	assert.Equal(t, "app1.foobar.v10", r.topic)
+	assert.Equal(t, int32(2), r.partition)
+	assert.Equal(t, int64(99), r.offset)
+
+	_, ok = parsePubAudit("[06/16/16 22:45:01 CST] [TRAC] (x) +job[app1] 10.1.1.1(10.2.2.2) {topic:foobar ver:v1 UA:curl} due:1 id:2")
+	assert.Equal(t, false, ok)
+	_, ok = parseSubAudit("garbage")
+	assert.Equal(t, false, ok)
+}
+
+func TestLogicalTopic(t *testing.T) {
+	assert.Equal(t, "app1.foobar.v1", logicalTopic("app1.foobar.v1"))
+	assert.Equal(t, "app1.foobar.v10", logicalTopic("app1.foobar.v10.123"))
+	assert.Equal(t, "a.b.c.d", logicalTopic("a.b.c.d"))
+	assert.Equal(t, "__consumer_offsets", logicalTopic("__consumer_offsets"))
+}
+
+func TestOffsetRanges(t *testing.T) {
+	var r offsetRanges
+	for _, o := range []int64{5, 6, 7, 10, 11, 7, 3, 9, 8, 1} {
+		r.add(o)
+	}
+	assert.Equal(t, offsetRanges{{1, 2}, {3, 4}, {5, 12}}, r)
+	assert.Equal(t, int64(9), r.count())
+	r.add(2)
+	r.add(4)
+	assert.Equal(t, offsetRanges{{1, 12}}, r)
+
+	a := offsetRanges{{0, 10}, {20, 30}}
+	b := offsetRanges{{5, 25}, {28, 29}}
+	assert.Equal(t, offsetRanges{{5, 10}, {20, 25}, {28, 29}}, a.intersect(b))
+	assert.Equal(t, offsetRanges{{0, 5}, {25, 28}, {29, 30}}, a.subtract(b))
+	assert.Equal(t, offsetRanges{{0, 10}, {20, 22}}, a.below(22))
+	assert.Equal(t, offsetRanges(nil), a.below(0))
+	assert.Equal(t, a, a.subtract(nil))
+}
+
+func TestReconcileAudit(t *testing.T) {
+	now := time.Now()
+	tp := auditPartition{"app1.foobar.v1", 0}
+	pub := func(offset int64) auditRecord {
+		return auditRecord{t: now, auditPartition: tp, offset: offset}
+	}
+	sub := func(group string, offset int64, sec int) auditRecord {
+		return auditRecord{t: now.Add(time.Duration(sec) * time.Second), auditPartition: tp, offset: offset, group: group}
+	}
+
+	pubs := []auditRecord{pub(10), pub(11), pub(12), pub(13), pub(14)}
+	subs := []auditRecord{
+		// out of order in log files, rewinds to 11 after 12
+		sub("app2.g1", 12, 3), sub("app2.g1", 10, 1), sub("app2.g1", 11, 2), sub("app2.g1", 11, 4),
+		sub("app3.g2", 14, 1),
+	}
+	offsets := map[auditPartition]partitionOffsets{tp: {oldest: 12, newest: 15}}
+	committed := map[string]map[auditPartition]int64{
+		"app2.g1": {tp: 13},
+		"app3.g2": {tp: 15},
+		"app4.g3": {tp: 14}, // not consumed through kateway
+	}
+
+	ledger := newAuditLedger()
+	for _, r := range pubs {
+		ledger.addPub(r)
+	}
+	for _, r := range subs {
+		ledger.addSub(r)
+	}
+	reports := ledger.reconcile(offsets, committed)
+	assert.Equal(t, 3, len(reports))
+
+	g1 := reports[0]
+	assert.Equal(t, "app1", g1.appid)
+	assert.Equal(t, "app2.g1", g1.group)
+	assert.Equal(t, true, g1.audited)
+	assert.Equal(t, int64(5), g1.published)
+	assert.Equal(t, int64(3), g1.consumed)
+	assert.Equal(t, int64(0), g1.expired)
+	assert.Equal(t, int64(0), g1.skipped)
+	assert.Equal(t, int64(2), g1.pending)
+	assert.Equal(t, int64(1), g1.rewinds)
+	assert.Equal(t, int64(2), g1.lag)
+	assert.Equal(t, "rewind", g1.flags())
+
+	g2 := reports[1]
+	assert.Equal(t, "app3.g2", g2.group)
+	assert.Equal(t, int64(1), g2.consumed)
+	assert.Equal(t, int64(2), g2.expired) // 10, 11 below oldest
+	assert.Equal(t, int64(2), g2.skipped) // 12, 13 committed but never delivered
+	assert.Equal(t, int64(0), g2.pending)
+	assert.Equal(t, "expired,skipped", g2.flags())
+
+	g3 := reports[2]
+	assert.Equal(t, "app4.g3", g3.group)
+	assert.Equal(t, false, g3.audited)
+	assert.Equal(t, int64(4), g3.consumed)
+	assert.Equal(t, int64(1), g3.pending)
+	assert.Equal(t, false, g3.hasGap())
+
+	// published without any consumer group
+	ledger = newAuditLedger()
+	for _, r := range pubs {
+		ledger.addPub(r)
+	}
+	reports = ledger.reconcile(offsets, nil)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, int64(5), reports[0].published)
+	assert.Equal(t, true, reports[0].hasGap())
+	assert.Equal(t, "no consumer", reports[0].flags())
+}
+
+func TestReconcileAuditPartitionWithoutSubAudit(t *testing.T) {
+	now := time.Now()
+	tp0, tp1 := auditPartition{"app1.foobar.v1", 0}, auditPartition{"app1.foobar.v1", 1}
+	ledger := newAuditLedger()
+	for o := int64(0); o < 10; o++ {
+		ledger.addPub(auditRecord{t: now, auditPartition: tp0, offset: o})
+		ledger.addPub(auditRecord{t: now, auditPartition: tp1, offset: o})
+	}
+	for o := int64(0); o < 10; o++ {
+		// partition 1 delivered by a kateway whose logs are not collected
+		ledger.addSub(auditRecord{t: now, auditPartition: tp0, offset: o, group: "app2.g1"})
+	}
+
+	offsets := map[auditPartition]partitionOffsets{tp0: {0, 10}, tp1: {0, 10}}
+	committed := map[string]map[auditPartition]int64{"app2.g1": {tp0: 10, tp1: 10}}
+	reports := ledger.reconcile(offsets, committed)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, false, reports[0].audited)
+	assert.Equal(t, int64(20), reports[0].published)
+	assert.Equal(t, int64(20), reports[0].consumed)
+	assert.Equal(t, int64(0), reports[0].skipped)
+	assert.Equal(t, false, reports[0].hasGap())
+}
@@ -103,6 +103,12 @@ type Balance struct {
 	skipKafkaInternal bool
 	byCluster         bool
 
+	planFile, execFile, abortFile string
+	threshold                     float64
+	maxMoves, waveMoves           int
+	waveSize                      int64
+	throttle                      time.Duration
+
 	loadAvgMap   map[string]float64
 	loadAvgReady chan struct{}
 
@@ -135,10 +141,50 @@ func (this *Balance) Run(args []string) (exitCode int) {
 	cmdFlags.Int64Var(&this.atLeastTps, "over", 0, "")
 	cmdFlags.IntVar(&diskFullThreshold, "d", 85, "")
 	cmdFlags.BoolVar(&this.detailMode, "l", false, "")
+	cmdFlags.StringVar(&this.planFile, "plan", "", "")
+	cmdFlags.StringVar(&this.execFile, "exec", "", "")
+	cmdFlags.StringVar(&this.abortFile, "abort", "", "")
+	cmdFlags.Float64Var(&this.threshold, "threshold", 0.1, "")
+	cmdFlags.IntVar(&this.maxMoves, "maxmoves", 50, "")
+	cmdFlags.IntVar(&this.waveMoves, "wave", 5, "")
+	cmdFlags.Int64Var(&this.waveSize, "wavesize", 0, "")
+	cmdFlags.DurationVar(&this.throttle, "throttle", time.Minute, "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if validateArgs(this, this.Ui).
+		on("-plan", "-c").
+		requireAdminRights("-exec", "-abort").
+		invalid(args) {
+		return 2
+	}
+
+	if this.planFile != "" && this.interval < time.Second {
+		this.Ui.Error("-i must be at least 1s to sample partitions load")
+		return 2
+	}
+
+	switch {
+	case this.planFile != "":
+		swallow(this.generatePlan(this.planFile))
+		return
+
+	case this.abortFile != "":
+		swallow(this.abortPlan(this.abortFile))
+		return
+
+	case this.execFile != "":
+		yes, _ := this.Ui.Ask(fmt.Sprintf("execute the reassignment plan %s? [Y/N]", this.execFile))
+		if !strings.EqualFold(yes, "y") {
+			this.Ui.Output("bye")
+			return
+		}
+
+		swallow(this.executePlan(this.execFile))
+		return
+	}
+
 	this.brokerHosts = make(map[string]struct{})
 	this.brokerModelMap = make(map[string]*brokerModel)
 	this.brokerModelReady = make(chan struct{})
@@ -747,6 +793,32 @@ Options:
     -skipk
       Skip kafka internal topic: __consumer_offsets. True by default.
 
+    -plan file
+      Generate a reassignment plan of cluster -c that moves the least data and save it to file.
+      Partition load is sampled in -i interval, size is the retained messages.
+
+    -threshold ratio
+      Brokers whose load is within average*(1+ratio) are balanced. Default 0.1.
+
+    -maxmoves n
+      At most n partition moves in the plan. Default 50.
+
+    -exec file
+      Execute or resume the plan through zk:/admin/reassign_partitions in waves.
+
+    -wave n
+      At most n partition moves per wave. Default 5.
+
+    -wavesize messages
+      At most so many retained messages moved per wave. 0 means unlimited.
+
+    -throttle duration
+      Pause between waves. Default 1m.
+
+    -abort file
+      Stop executing the plan after the ongoing wave completes.
+      It creates file.abort, remove it to execute the plan again.
+
 `, this.Cmd, this.Synopsis(), ctx.ZkDefaultZone())
 	return strings.TrimSpace(help)
 }
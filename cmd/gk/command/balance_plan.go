@@ -0,0 +1,513 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/columnize"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/golib/gofmt"
+)
+
+// partitionLoad is the load of a topic partition used to plan the rebalance.
+type partitionLoad struct {
+	topic     string
+	partition int32
+	replicas  []int32
+	size      int64 // retained messages, the proxy of bytes to move
+	tps       int64
+}
+
+// weight of each replica of the partition on its broker: followers fetch the
+// same bytes as the leader, and idle partitions are still spread by count.
+func (p partitionLoad) weight() int64 {
+	return p.tps + 1
+}
+
+func (p partitionLoad) hasReplica(brokerId int32) bool {
+	for _, r := range p.replicas {
+		if r == brokerId {
+			return true
+		}
+	}
+	return false
+}
+
+type partitionMove struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	From      []int32 `json:"from"`
+	To        []int32 `json:"to"`
+	Size      int64   `json:"size"` // retained messages
+}
+
+// balancePlan is an executable reassignment plan persisted as json, the
+// executing progress is saved in it so that it can be resumed.
+// Only the executing gk writes the plan, abort is marked in a separate file.
+type balancePlan struct {
+	Version   int             `json:"version"`
+	Zone      string          `json:"zone"`
+	Cluster   string          `json:"cluster"`
+	CreatedAt time.Time       `json:"created_at"`
+	Moves     []partitionMove `json:"moves"`
+
+	Done     int `json:"done"`     // number of moves completed
+	Inflight int `json:"inflight"` // number of moves submitted to controller but not completed
+}
+
+func loadBalancePlan(fn string) (*balancePlan, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &balancePlan{}
+	if err = json.Unmarshal(b, plan); err != nil {
+		return nil, err
+	}
+	if plan.Cluster == "" || plan.Done+plan.Inflight > len(plan.Moves) {
+		return nil, fmt.Errorf("invalid plan: %s", fn)
+	}
+	return plan, nil
+}
+
+func balancePlanAbortFile(fn string) string {
+	return fn + ".abort"
+}
+
+func balancePlanAborted(fn string) bool {
+	_, err := os.Stat(balancePlanAbortFile(fn))
+	return err == nil
+}
+
+func (this *balancePlan) save(fn string) error {
+	b, err := json.MarshalIndent(this, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// write and rename so that a crash never leaves a torn plan
+	tmp := fn + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+// nextWave returns the pending moves of the next wave: at most n moves and at most
+// maxSize retained messages in total unless a single move is bigger.
+func (this *balancePlan) nextWave(n int, maxSize int64) []partitionMove {
+	pending := this.Moves[this.Done+this.Inflight:]
+	var size int64
+	for i, m := range pending {
+		if i == n || (i > 0 && maxSize > 0 && size+m.Size > maxSize) {
+			return pending[:i]
+		}
+		size += m.Size
+	}
+	return pending
+}
+
+func (this *balancePlan) messagesMoved() (n int64) {
+	for _, m := range this.Moves {
+		n += m.Size
+	}
+	return
+}
+
+type brokerLoad struct {
+	id   int32
+	load int64
+}
+
+type brokerLoads []brokerLoad
+
+func (s brokerLoads) Len() int      { return len(s) }
+func (s brokerLoads) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s brokerLoads) Less(i, j int) bool {
+	if s[i].load != s[j].load {
+		return s[i].load < s[j].load
+	}
+	return s[i].id < s[j].id
+}
+
+// planBalance moves replicas off the most loaded broker while its load is over the
+// average by more than threshold, at most maxMoves partitions and each partition once.
+//
+// Among the replicas whose move narrows the gap between the most and a less loaded
+// broker, the one bringing most load relief per retained message wins, so that
+// the data moved is minimised. The replaced broker keeps its position in the
+// replica list, so preferred leadership moves along with it.
+func planBalance(brokerIds []int32, partitions []partitionLoad, threshold float64, maxMoves int) []partitionMove {
+	if len(brokerIds) < 2 {
+		return nil
+	}
+
+	// replicas are updated as planned, keep the input intact
+	partitions = append([]partitionLoad(nil), partitions...)
+
+	loads := make(map[int32]int64, len(brokerIds))
+	for _, id := range brokerIds {
+		loads[id] = 0
+	}
+	var total int64
+	for _, p := range partitions {
+		for _, r := range p.replicas {
+			loads[r] += p.weight()
+			total += p.weight()
+		}
+	}
+	avg := float64(total) / float64(len(loads))
+
+	sortedLoads := func() brokerLoads {
+		r := make(brokerLoads, 0, len(loads))
+		for id, load := range loads {
+			r = append(r, brokerLoad{id, load})
+		}
+		sort.Sort(r)
+		return r
+	}
+
+	moves := make([]partitionMove, 0)
+	moved := make(map[int]bool)
+	for len(moves) < maxMoves {
+		brokers := sortedLoads()
+		src := brokers[len(brokers)-1]
+		if float64(src.load) <= avg*(1+threshold) {
+			break
+		}
+
+		best, bestDst := -1, int32(-1)
+		for _, dst := range brokers[:len(brokers)-1] {
+			gap := src.load - dst.load
+			for i, p := range partitions {
+				if moved[i] || p.weight() >= gap || !p.hasReplica(src.id) || p.hasReplica(dst.id) {
+					continue
+				}
+
+				if best < 0 {
+					best = i
+					continue
+				}
+
+				// relief per message: w/(size+1), bigger is better
+				b := partitions[best]
+				l := float64(p.weight()) * float64(b.size+1)
+				r := float64(b.weight()) * float64(p.size+1)
+				if l > r || (l == r && p.weight() > b.weight()) {
+					best = i
+				}
+			}
+
+			if best >= 0 {
+				bestDst = dst.id
+				break
+			}
+		}
+		if best < 0 {
+			// no move narrows the gap
+			break
+		}
+
+		p := &partitions[best]
+		to := make([]int32, len(p.replicas))
+		for i, r := range p.replicas {
+			if r == src.id {
+				r = bestDst
+			}
+			to[i] = r
+		}
+
+		moves = append(moves, partitionMove{
+			Topic:     p.topic,
+			Partition: p.partition,
+			From:      p.replicas,
+			To:        to,
+			Size:      p.size,
+		})
+		loads[src.id] -= p.weight()
+		loads[bestDst] += p.weight()
+		p.replicas = to
+		moved[best] = true
+	}
+
+	return moves
+}
+
+// collectPartitionLoads samples the newest offsets of all partitions twice in interval
+// to get the tps, and takes the retained messages as partition size.
+func (this *Balance) collectPartitionLoads(zkcluster *zk.ZkCluster) ([]int32, []partitionLoad, error) {
+	var brokerIds []int32
+	for id := range zkcluster.Brokers() {
+		brokerId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		brokerIds = append(brokerIds, int32(brokerId))
+	}
+	sort.Sort(int32Slice(brokerIds))
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer kfk.Close()
+
+	topics, err := zkcluster.Topics()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(topics)
+
+	var partitions []partitionLoad
+	newest := make([]int64, 0)
+	for _, topic := range topics {
+		if this.skipKafkaInternal && topic == "__consumer_offsets" {
+			continue
+		}
+
+		assignment, err := zkcluster.ReplicaAssignment(topic)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partitionIds := make([]int32, 0, len(assignment))
+		for partitionId := range assignment {
+			partitionIds = append(partitionIds, partitionId)
+		}
+		sort.Sort(int32Slice(partitionIds))
+
+		for _, partitionId := range partitionIds {
+			oldestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetOldest)
+			if err != nil {
+				return nil, nil, err
+			}
+			newestOffset, err := kfk.GetOffset(topic, partitionId, sarama.OffsetNewest)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			partitions = append(partitions, partitionLoad{
+				topic:     topic,
+				partition: partitionId,
+				replicas:  assignment[partitionId],
+				size:      newestOffset - oldestOffset,
+			})
+			newest = append(newest, newestOffset)
+		}
+	}
+
+	time.Sleep(this.interval)
+	for i := range partitions {
+		p := &partitions[i]
+		newestOffset, err := kfk.GetOffset(p.topic, p.partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.tps = int64(float64(newestOffset-newest[i]) / this.interval.Seconds())
+	}
+
+	return brokerIds, partitions, nil
+}
+
+func (this *Balance) generatePlan(fn string) error {
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	zkcluster := zkzone.NewCluster(this.cluster)
+
+	this.Ui.Outputf("sampling partitions load of %s in %s...", this.cluster, this.interval)
+	brokerIds, partitions, err := this.collectPartitionLoads(zkcluster)
+	if err != nil {
+		return err
+	}
+
+	plan := &balancePlan{
+		Version:   1,
+		Zone:      this.zone,
+		Cluster:   this.cluster,
+		CreatedAt: time.Now(),
+		Moves:     planBalance(brokerIds, partitions, this.threshold, this.maxMoves),
+	}
+	if len(plan.Moves) == 0 {
+		this.Ui.Info("already balanced, nothing to move")
+		return nil
+	}
+
+	this.showMoves(plan.Moves)
+	if err = plan.save(fn); err != nil {
+		return err
+	}
+
+	this.Ui.Infof("%d moves of %s messages saved to %s", len(plan.Moves), gofmt.Comma(plan.messagesMoved()), fn)
+	return nil
+}
+
+func (this *Balance) showMoves(moves []partitionMove) {
+	lines := []string{"#|Topic|Partition|From|To|Messages"}
+	for i, m := range moves {
+		lines = append(lines, fmt.Sprintf("%d|%s|%d|%+v|%+v|%s",
+			i+1, m.Topic, m.Partition, m.From, m.To, gofmt.Comma(m.Size)))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+// executePlan applies the pending moves wave by wave through zk:/admin/reassign_partitions,
+// it waits for each wave to complete and throttles between waves.
+func (this *Balance) executePlan(fn string) error {
+	plan, err := loadBalancePlan(fn)
+	if err != nil {
+		return err
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(plan.Zone, ctx.ZoneZkAddrs(plan.Zone)))
+	zkcluster := zkzone.NewCluster(plan.Cluster)
+
+	for {
+		if plan.Inflight > 0 {
+			// resume: wait for the wave submitted by last run
+			if err = this.awaitWave(zkcluster, plan); err != nil {
+				return err
+			}
+
+			plan.Done += plan.Inflight
+			plan.Inflight = 0
+			if err = plan.save(fn); err != nil {
+				return err
+			}
+
+			this.Ui.Infof("%d/%d moves done", plan.Done, len(plan.Moves))
+
+			if plan.Done < len(plan.Moves) && !balancePlanAborted(fn) {
+				time.Sleep(this.throttle)
+			}
+		}
+
+		// abort might be issued by another gk process
+		if balancePlanAborted(fn) {
+			this.Ui.Warnf("plan aborted, %d/%d moves done", plan.Done, len(plan.Moves))
+			return nil
+		}
+
+		wave := plan.nextWave(this.waveMoves, this.waveSize)
+		if len(wave) == 0 {
+			this.Ui.Infof("plan completed, %d moves of %s messages", len(plan.Moves), gofmt.Comma(plan.messagesMoved()))
+			return nil
+		}
+
+		partitions, err := this.pendingReassignments(zkcluster, wave)
+		if err != nil {
+			return err
+		}
+
+		if len(partitions) > 0 {
+			if err = zkcluster.ReassignPartitions(partitions); err != nil {
+				return err
+			}
+		}
+
+		plan.Inflight = len(wave)
+		if err = plan.save(fn); err != nil {
+			return err
+		}
+
+		this.Ui.Outputf("%s wave of %d moves submitted", time.Now().Format("15:04:05"), len(wave))
+		this.showMoves(wave)
+	}
+}
+
+// pendingReassignments skips the moves whose partition is already on target
+// or changed since the plan was made.
+func (this *Balance) pendingReassignments(zkcluster *zk.ZkCluster, wave []partitionMove) ([]zk.PartitionReplicas, error) {
+	var r []zk.PartitionReplicas
+	for _, m := range wave {
+		assignment, err := zkcluster.ReplicaAssignment(m.Topic)
+		if err != nil {
+			return nil, err
+		}
+
+		current := assignment[m.Partition]
+		switch {
+		case sameReplicas(current, m.To):
+			this.Ui.Outputf("%s#%d already on %+v", m.Topic, m.Partition, m.To)
+
+		case !sameReplicas(current, m.From):
+			this.Ui.Warnf("%s#%d skipped: replicas changed to %+v since planned", m.Topic, m.Partition, current)
+
+		default:
+			r = append(r, zk.PartitionReplicas{Topic: m.Topic, Partition: m.Partition, Replicas: m.To})
+		}
+	}
+
+	return r, nil
+}
+
+func (this *Balance) awaitWave(zkcluster *zk.ZkCluster, plan *balancePlan) error {
+	for {
+		partitions, err := zkcluster.ReassigningPartitions()
+		if err != nil {
+			return err
+		}
+		if len(partitions) == 0 {
+			break
+		}
+
+		this.Ui.Outputf("%s %d partitions reassigning...", time.Now().Format("15:04:05"), len(partitions))
+		time.Sleep(time.Second * 5)
+	}
+
+	// the controller removes a partition from reassignment after its new replicas are in sync
+	for _, m := range plan.Moves[plan.Done : plan.Done+plan.Inflight] {
+		assignment, err := zkcluster.ReplicaAssignment(m.Topic)
+		if err != nil {
+			return err
+		}
+		if current := assignment[m.Partition]; !sameReplicas(current, m.To) {
+			this.Ui.Warnf("%s#%d ends up on %+v instead of %+v", m.Topic, m.Partition, current, m.To)
+		}
+	}
+
+	return nil
+}
+
+// abortPlan marks the plan aborted, the executing gk stops before the next wave.
+func (this *Balance) abortPlan(fn string) error {
+	plan, err := loadBalancePlan(fn)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(balancePlanAbortFile(fn), []byte(time.Now().String()), 0644); err != nil {
+		return err
+	}
+
+	this.Ui.Infof("plan aborted, %d/%d moves done", plan.Done, len(plan.Moves))
+	if plan.Inflight > 0 {
+		// kafka controller can't cancel an ongoing reassignment
+		this.Ui.Warnf("%d moves of the ongoing wave will still complete", plan.Inflight)
+	}
+	return nil
+}
+
+func sameReplicas(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type int32Slice []int32
+
+func (s int32Slice) Len() int           { return len(s) }
+func (s int32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestPlanBalanceBalanced(t *testing.T) {
+	partitions := []partitionLoad{
+		{topic: "t1", partition: 0, replicas: []int32{0, 1}, tps: 100},
+		{topic: "t1", partition: 1, replicas: []int32{1, 2}, tps: 100},
+		{topic: "t1", partition: 2, replicas: []int32{2, 0}, tps: 100},
+	}
+	assert.Equal(t, 0, len(planBalance([]int32{0, 1, 2}, partitions, 0.1, 50)))
+	assert.Equal(t, 0, len(planBalance([]int32{0}, partitions, 0.1, 50)))
+}
+
+func TestPlanBalanceMinimiseData(t *testing.T) {
+	// brokers 0 and 1 are hot, broker 2 is idle
+	partitions := []partitionLoad{
+		{topic: "big", partition: 0, replicas: []int32{0, 1}, tps: 100, size: 1 << 30},
+		{topic: "small", partition: 0, replicas: []int32{0, 1}, tps: 100, size: 1 << 10},
+		{topic: "small", partition: 1, replicas: []int32{1, 0}, tps: 100, size: 1 << 10},
+	}
+	moves := planBalance([]int32{0, 1, 2}, partitions, 0.1, 50)
+	assert.Equal(t, 2, len(moves))
+
+	// the small partitions are moved instead of the big one
+	assert.Equal(t, "small", moves[0].Topic)
+	assert.Equal(t, int32(0), moves[0].Partition)
+	assert.Equal(t, []int32{0, 1}, moves[0].From)
+	assert.Equal(t, []int32{0, 2}, moves[0].To)
+	assert.Equal(t, "small", moves[1].Topic)
+	assert.Equal(t, int32(1), moves[1].Partition)
+	assert.Equal(t, []int32{1, 2}, moves[1].To) // replica position kept
+}
+
+func TestPlanBalanceMaxMoves(t *testing.T) {
+	var partitions []partitionLoad
+	for i := int32(0); i < 10; i++ {
+		partitions = append(partitions, partitionLoad{topic: "t1", partition: i, replicas: []int32{0}})
+	}
+	assert.Equal(t, 3, len(planBalance([]int32{0, 1}, partitions, 0.1, 3)))
+
+	moves := planBalance([]int32{0, 1}, partitions, 0.1, 50)
+	assert.Equal(t, 5, len(moves))
+	for _, m := range moves {
+		assert.Equal(t, []int32{1}, m.To)
+	}
+}
+
+func TestBalancePlanNextWave(t *testing.T) {
+	plan := &balancePlan{Moves: []partitionMove{
+		{Size: 10}, {Size: 20}, {Size: 500}, {Size: 5}, {Size: 5},
+	}}
+	assert.Equal(t, 2, len(plan.nextWave(2, 0)))
+	assert.Equal(t, 2, len(plan.nextWave(5, 100)))
+
+	plan.Done = 2
+	assert.Equal(t, 1, len(plan.nextWave(5, 100))) // a single big move
+	assert.Equal(t, 3, len(plan.nextWave(5, 0)))
+
+	plan.Inflight = 1
+	assert.Equal(t, 2, len(plan.nextWave(5, 100)))
+
+	plan.Done, plan.Inflight = 4, 1
+	assert.Equal(t, 0, len(plan.nextWave(5, 100)))
+	assert.Equal(t, int64(540), plan.messagesMoved())
+}
+
+func TestSameReplicas(t *testing.T) {
+	assert.Equal(t, true, sameReplicas([]int32{1, 2}, []int32{1, 2}))
+	assert.Equal(t, false, sameReplicas([]int32{1, 2}, []int32{2, 1}))
+	assert.Equal(t, false, sameReplicas([]int32{1}, []int32{1, 2}))
+}
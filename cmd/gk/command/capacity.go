@@ -3,27 +3,566 @@ package command
 import (
 	"flag"
 	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/columnize"
+	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/sla"
+	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
+	"github.com/funkygao/golib/gofmt"
 )
 
+// when the histogram files are unavailable: 1KB messages with 2 replicas
+const defaultBytesPerMsg = 2 << 10
+
+// capacityIntent declares the expected load of a topic.
+type capacityIntent struct {
+	topic     string
+	tps       int64
+	msgSize   int64
+	retention time.Duration
+	replicas  int
+}
+
+// parseCapacityIntent parses intent like: topic=X,tps=20k,size=1KB,retention=3d,rf=3
+func parseCapacityIntent(s string) (capacityIntent, error) {
+	ts := sla.DefaultSla()
+	intent := capacityIntent{
+		msgSize:   1 << 10,
+		retention: time.Duration(ts.RetentionHours) * time.Hour,
+		replicas:  ts.Replicas,
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		tuples := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(tuples) != 2 {
+			return intent, fmt.Errorf("invalid intent: %s", s)
+		}
+
+		var err error
+		k, v := tuples[0], tuples[1]
+		switch k {
+		case "topic":
+			intent.topic = v
+
+		case "tps":
+			intent.tps, err = parseQuantity(v)
+
+		case "size":
+			intent.msgSize, err = parseByteSize(v)
+
+		case "retention":
+			intent.retention, err = parseRetention(v)
+
+		case "rf":
+			intent.replicas, err = strconv.Atoi(v)
+
+		default:
+			err = fmt.Errorf("unknown intent key: %s", k)
+		}
+		if err != nil {
+			return intent, err
+		}
+	}
+
+	if intent.topic == "" || intent.tps <= 0 || intent.msgSize <= 0 {
+		return intent, fmt.Errorf("intent requires topic, tps and size: %s", s)
+	}
+
+	ts.Replicas = intent.replicas
+	ts.RetentionHours = intent.retention.Hours()
+	if err := ts.Validate(); err != nil {
+		return intent, fmt.Errorf("%s: %v", intent.topic, err)
+	}
+
+	return intent, nil
+}
+
+// parseQuantity parses number with optional k/m suffix, e,g. 20k, 1.5m
+func parseQuantity(s string) (int64, error) {
+	unit := float64(1)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		unit, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		unit, s = 1e6, s[:len(s)-1]
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f * unit), nil
+}
+
+// parseByteSize parses size like 512B, 1KB, 1.5MB, 2TB
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(s)
+	unit := float64(1)
+	for _, u := range []struct {
+		suffix string
+		n      float64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			unit, s = u.n, strings.TrimSuffix(s, u.suffix)
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f * unit), nil
+}
+
+// parseRetention parses duration that also accepts days, e,g. 3d, 36h
+func parseRetention(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * 24 * float64(time.Hour)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+type capacityIntents []capacityIntent
+
+func (this *capacityIntents) String() string {
+	return fmt.Sprintf("%+v", *this)
+}
+
+func (this *capacityIntents) Set(s string) error {
+	intent, err := parseCapacityIntent(s)
+	if err != nil {
+		return err
+	}
+
+	*this = append(*this, intent)
+	return nil
+}
+
+type capacityConfig struct {
+	nic          float64 // bytes/s per broker
+	disk         float64 // free bytes per broker
+	headroom     float64 // ratio of nic reserved
+	partitionBps float64 // bytes/s a partition sustains
+	consumers    int     // consumer groups of each topic
+}
+
+type brokerTraffic struct {
+	id     int32
+	host   string
+	tps    int64
+	rx, tx float64 // bytes/s
+}
+
+type topicCapacity struct {
+	capacityIntent
+
+	partitions        int
+	tooManyPartitions bool
+	bps               float64 // produced bytes/s
+	rx, tx            float64 // bytes/s added to the cluster
+	disk              float64
+	diskPerBroker     float64
+}
+
+type capacityPlan struct {
+	topics  []topicCapacity
+	brokers []brokerTraffic
+
+	nic        float64 // nic bytes/s per broker
+	limit      float64 // usable nic bytes/s per broker
+	rx, tx     float64 // bytes/s added to each broker
+	needed     int     // brokers needed in total
+	bottleneck string
+}
+
+func (this capacityPlan) extra() int {
+	return this.needed - len(this.brokers)
+}
+
+// planCapacity estimates the resources of intents on top of the current broker traffic,
+// assuming that the load is spread evenly across brokers after rebalance.
+func planCapacity(intents []capacityIntent, brokers []brokerTraffic, cf capacityConfig) capacityPlan {
+	plan := capacityPlan{
+		brokers: brokers,
+		nic:     cf.nic,
+		limit:   cf.nic * (1 - cf.headroom),
+		needed:  len(brokers),
+	}
+
+	var curRx, curTx float64
+	for _, b := range brokers {
+		curRx += b.rx
+		curTx += b.tx
+	}
+
+	var addRx, addTx, addDisk float64
+	maxReplicas := 0
+	for _, intent := range intents {
+		t := topicCapacity{capacityIntent: intent}
+		t.bps = float64(intent.tps * intent.msgSize)
+		t.partitions = int(math.Ceil(t.bps / cf.partitionBps))
+		if t.partitions < 1 {
+			t.partitions = 1
+		}
+
+		ts := sla.DefaultSla()
+		ts.Partitions = t.partitions
+		t.tooManyPartitions = ts.Validate() == sla.ErrTooBigPartitions
+
+		// leaders receive from producers and followers fetch from leaders
+		t.rx = t.bps * float64(intent.replicas)
+		t.tx = t.bps * float64(intent.replicas-1+cf.consumers)
+		t.disk = t.bps * intent.retention.Seconds() * float64(intent.replicas)
+
+		addRx += t.rx
+		addTx += t.tx
+		addDisk += t.disk
+		if intent.replicas > maxReplicas {
+			maxReplicas = intent.replicas
+		}
+
+		plan.topics = append(plan.topics, t)
+	}
+
+	for _, need := range []struct {
+		what string
+		n    int
+	}{
+		{"replicas", maxReplicas},
+		{"network rx", int(math.Ceil((curRx + addRx) / plan.limit))},
+		{"network tx", int(math.Ceil((curTx + addTx) / plan.limit))},
+		{"disk", int(math.Ceil(addDisk / cf.disk))},
+	} {
+		if need.n > plan.needed {
+			plan.needed = need.n
+			plan.bottleneck = need.what
+		}
+	}
+
+	if plan.needed > 0 {
+		plan.rx = addRx / float64(plan.needed)
+		plan.tx = addTx / float64(plan.needed)
+	}
+
+	for i := range plan.topics {
+		t := &plan.topics[i]
+		hosting := t.partitions * t.replicas
+		if hosting > plan.needed {
+			hosting = plan.needed
+		}
+		if hosting > 0 {
+			t.diskPerBroker = t.disk / float64(hosting)
+		}
+	}
+
+	return plan
+}
+
 // chain of dependencies, performance metrics, prioritization
 type Capacity struct {
 	Ui  cli.Ui
 	Cmd string
+
+	zone, cluster string
+	interval      time.Duration
+	offsetFile    string
+	networkFile   string
 }
 
 func (this *Capacity) Run(args []string) (exitCode int) {
+	var (
+		intents                  capacityIntents
+		nicMbps                  int
+		disk, partitionBps       string
+		cf                       capacityConfig
+		err                      error
+		diskBytes, partitionSize int64
+	)
 	cmdFlags := flag.NewFlagSet("capacity", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
-	if err := cmdFlags.Parse(args); err != nil {
+	cmdFlags.StringVar(&this.zone, "z", ctx.ZkDefaultZone(), "")
+	cmdFlags.StringVar(&this.cluster, "c", "", "")
+	cmdFlags.Var(&intents, "intent", "")
+	cmdFlags.DurationVar(&this.interval, "i", time.Second*5, "")
+	cmdFlags.StringVar(&this.offsetFile, "f", "/var/wd/topics_offsets/offsets", "")
+	cmdFlags.StringVar(&this.networkFile, "n", "/var/wd/topics_offsets/network", "")
+	cmdFlags.IntVar(&nicMbps, "nic", 10000, "")
+	cmdFlags.StringVar(&disk, "disk", "2TB", "")
+	cmdFlags.Float64Var(&cf.headroom, "headroom", 0.3, "")
+	cmdFlags.StringVar(&partitionBps, "pbps", "10MB", "")
+	cmdFlags.IntVar(&cf.consumers, "consumers", 1, "")
+	if err = cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if validateArgs(this, this.Ui).
+		require("-c", "-intent").
+		invalid(args) {
+		return 2
+	}
+
+	if this.interval.Seconds() < 1 {
+		this.interval = time.Second
+	}
+
+	if diskBytes, err = parseByteSize(disk); err != nil || diskBytes <= 0 {
+		this.Ui.Errorf("invalid -disk: %s", disk)
+		return 2
+	}
+	if partitionSize, err = parseByteSize(partitionBps); err != nil || partitionSize <= 0 {
+		this.Ui.Errorf("invalid -pbps: %s", partitionBps)
+		return 2
+	}
+	if nicMbps <= 0 || cf.headroom < 0 || cf.headroom >= 1 || cf.consumers < 0 {
+		this.Ui.Error("invalid -nic, -headroom or -consumers")
+		return 2
+	}
+
+	cf.nic = float64(nicMbps) * 1e6 / 8
+	cf.disk = float64(diskBytes)
+	cf.partitionBps = float64(partitionSize)
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(this.zone, ctx.ZoneZkAddrs(this.zone)))
+	zkcluster := zkzone.NewCluster(this.cluster)
+
+	this.Ui.Outputf("sampling %s brokers load in %s...", this.cluster, this.interval)
+	brokers, err := this.brokerTraffic(zkcluster)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	plan := planCapacity(intents, brokers, cf)
+	this.showPlan(plan)
+	this.showFarm(zkzone, plan)
+
 	return
 }
 
+// bytesPerMsg returns the network bytes per produced message observed in the
+// histogram files, which covers replication and consumption.
+func (this *Capacity) bytesPerMsg() (rx, tx float64) {
+	rx, tx = defaultBytesPerMsg, defaultBytesPerMsg
+
+	f, err := os.Open(this.offsetFile)
+	if err != nil {
+		this.Ui.Warnf("%v, assume %s per message", err, gofmt.ByteSize(defaultBytesPerMsg))
+		return
+	}
+	offsets, err := parseOffsetGrowth(f)
+	f.Close()
+	if err != nil {
+		this.Ui.Warnf("%s: %v", this.offsetFile, err)
+		return
+	}
+
+	f, err = os.Open(this.networkFile)
+	if err != nil {
+		this.Ui.Warnf("%v, assume %s per message", err, gofmt.ByteSize(defaultBytesPerMsg))
+		return
+	}
+	network, err := parseNetworkGrowth(f)
+	f.Close()
+	if err != nil {
+		this.Ui.Warnf("%s: %v", this.networkFile, err)
+		return
+	}
+
+	var msgs, rxBytes, txBytes int64
+	for _, g := range offsets {
+		msgs += g.delta
+	}
+	for _, g := range network {
+		rxBytes += g.rx
+		txBytes += g.tx
+	}
+	if msgs <= 0 || rxBytes <= 0 {
+		return
+	}
+
+	return float64(rxBytes) / float64(msgs), float64(txBytes) / float64(msgs)
+}
+
+// brokerTraffic samples the produced messages of each broker like topbroker does.
+func (this *Capacity) brokerTraffic(zkcluster *zk.ZkCluster) ([]brokerTraffic, error) {
+	rxPerMsg, txPerMsg := this.bytesPerMsg()
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), saramaConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	topics, err := kfk.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	sample := func() (map[int32]int64, error) {
+		r := make(map[int32]int64)
+		for _, topic := range topics {
+			partitions, err := kfk.WritablePartitions(topic)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, partitionID := range partitions {
+				leader, err := kfk.Leader(topic, partitionID)
+				if err != nil {
+					return nil, err
+				}
+
+				latestOffset, err := kfk.GetOffset(topic, partitionID, sarama.OffsetNewest)
+				if err != nil {
+					return nil, err
+				}
+
+				r[leader.ID()] += latestOffset
+			}
+		}
+
+		return r, nil
+	}
+
+	offsets, err := sample()
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(this.interval)
+	lastOffsets, err := sample()
+	if err != nil {
+		return nil, err
+	}
+
+	var r []brokerTraffic
+	for id, broker := range zkcluster.Brokers() {
+		brokerId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+
+		tps := int64(float64(lastOffsets[int32(brokerId)]-offsets[int32(brokerId)]) / this.interval.Seconds())
+		r = append(r, brokerTraffic{
+			id:   int32(brokerId),
+			host: broker.Host,
+			tps:  tps,
+			rx:   float64(tps) * rxPerMsg,
+			tx:   float64(tps) * txPerMsg,
+		})
+	}
+	sort.Sort(brokerTrafficById(r))
+
+	return r, nil
+}
+
+type brokerTrafficById []brokerTraffic
+
+func (s brokerTrafficById) Len() int           { return len(s) }
+func (s brokerTrafficById) Less(i, j int) bool { return s[i].id < s[j].id }
+func (s brokerTrafficById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func byteRate(bps float64) string {
+	return gofmt.ByteSize(int64(bps)) + "/s"
+}
+
+func (this *Capacity) showPlan(plan capacityPlan) {
+	lines := []string{"Topic|TPS|Size|Retention|RF|Partitions|Ingress|Disk|Disk/Broker"}
+	for _, t := range plan.topics {
+		partitions := strconv.Itoa(t.partitions)
+		if t.tooManyPartitions {
+			partitions += "!"
+		}
+
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%d|%s|%s|%s|%s",
+			t.topic, gofmt.Comma(t.tps), gofmt.ByteSize(t.msgSize), t.retention, t.replicas,
+			partitions, byteRate(t.bps), gofmt.ByteSize(int64(t.disk)), gofmt.ByteSize(int64(t.diskPerBroker))))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	for _, t := range plan.topics {
+		if t.tooManyPartitions {
+			this.Ui.Warnf("%s needs %d partitions over sla max, split the topic or lower -pbps", t.topic, t.partitions)
+		}
+	}
+
+	this.Ui.Output("")
+	lines = []string{"Broker|Host|TPS|RX|TX|RX After|TX After|Headroom"}
+	for _, b := range plan.brokers {
+		rx, tx := b.rx+plan.rx, b.tx+plan.tx
+		headroom := 1 - math.Max(rx, tx)/plan.nic
+		mark := ""
+		if math.Max(rx, tx) > plan.limit {
+			mark = "!"
+		}
+
+		lines = append(lines, fmt.Sprintf("%d|%s|%s|%s|%s|%s|%s|%.0f%%%s",
+			b.id, b.host, gofmt.Comma(b.tps), byteRate(b.rx), byteRate(b.tx),
+			byteRate(rx), byteRate(tx), headroom*100, mark))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+
+	this.Ui.Output("")
+	if plan.extra() <= 0 {
+		this.Ui.Infof("%d brokers are enough, usable nic %s per broker", len(plan.brokers), byteRate(plan.limit))
+		return
+	}
+
+	this.Ui.Warnf("%d brokers needed, %d extra bounded by %s", plan.needed, plan.extra(), plan.bottleneck)
+}
+
+func (this *Capacity) showFarm(zkzone *zk.ZkZone, plan capacityPlan) {
+	if plan.extra() <= 0 {
+		return
+	}
+
+	hosts := make(map[string]struct{})
+	for _, b := range plan.brokers {
+		hosts[b.host] = struct{}{}
+	}
+
+	servers, tags := farmServers(zkzone)
+	var candidates []string
+	for _, server := range servers {
+		if _, present := hosts[server]; present {
+			continue
+		}
+
+		candidates = append(candidates, server)
+		if len(candidates) == plan.extra() {
+			break
+		}
+	}
+
+	for _, server := range candidates {
+		this.Ui.Outputf("%16s %+v", server, tags[server])
+	}
+	if len(candidates) < plan.extra() {
+		this.Ui.Warnf("farm short of %d servers", plan.extra()-len(candidates))
+	} else {
+		this.Ui.Info("deploy brokers on the servers above, then gk balance")
+	}
+}
+
 func (this *Capacity) Synopsis() string {
 	return "Intent-based capacity planning generate resource allocation plan"
 }
@@ -34,9 +573,44 @@ Usage: %s capacity [options]
 
     %s
 
+    e,g.
+    %s capacity -c cluster -intent topic=X,tps=20k,size=1KB,retention=3d,rf=3
+
 Options:
 
+    -z zone
+      Default %s
+
+    -c cluster
+
+    -intent topic=name,tps=n,size=bytes,retention=duration,rf=n
+      Expected load of a topic, can be repeated.
+      size defaults to 1KB, retention and rf default to the topic sla.
+
+    -i interval
+      Sample interval of current broker load, at least 1s. Default 5s.
+
+    -f offset file
+      The same file histogram uses to derive network bytes per message.
+
+    -n network volumn file
+      The same file histogram uses to derive network bytes per message.
+
+    -nic Mbps
+      Network bandwidth per broker. Default 10000.
+
+    -headroom ratio
+      Ratio of network bandwidth reserved. Default 0.3.
+
+    -disk size
+      Free disk per broker. Default 2TB.
+
+    -pbps size
+      Throughput a partition sustains per second. Default 10MB.
+
+    -consumers n
+      Consumer groups of each topic. Default 1.
 
-`, this.Cmd, this.Synopsis())
+`, this.Cmd, this.Synopsis(), this.Cmd, ctx.ZkDefaultZone())
 	return strings.TrimSpace(help)
 }
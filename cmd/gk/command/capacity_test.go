@@ -0,0 +1,139 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestParseCapacityIntent(t *testing.T) {
+	intent, err := parseCapacityIntent("topic=X,tps=20k,size=1KB,retention=3d,rf=3")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "X", intent.topic)
+	assert.Equal(t, int64(20000), intent.tps)
+	assert.Equal(t, int64(1024), intent.msgSize)
+	assert.Equal(t, 72*time.Hour, intent.retention)
+	assert.Equal(t, 3, intent.replicas)
+
+	// defaults to sla
+	intent, err = parseCapacityIntent("topic=Y,tps=1.5m")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1500000), intent.tps)
+	assert.Equal(t, 7*24*time.Hour, intent.retention)
+	assert.Equal(t, 2, intent.replicas)
+
+	for _, s := range []string{
+		"tps=20k",
+		"topic=X",
+		"topic=X,tps=abc",
+		"topic=X,tps=1k,rf=4",
+		"topic=X,tps=1k,retention=1000d",
+		"topic=X,tps=1k,foo=bar",
+		"topic=X,tps",
+	} {
+		_, err = parseCapacityIntent(s)
+		assert.NotEqual(t, nil, err, s)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, n := range map[string]int64{
+		"512":   512,
+		"512B":  512,
+		"1KB":   1 << 10,
+		"1.5mb": 3 << 19,
+		"2TB":   2 << 40,
+	} {
+		v, err := parseByteSize(s)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, n, v, s)
+	}
+
+	_, err := parseByteSize("1XB")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestPlanCapacity(t *testing.T) {
+	cf := capacityConfig{
+		nic:          100 << 20,
+		disk:         1 << 40,
+		headroom:     0.5,
+		partitionBps: 10 << 20,
+		consumers:    1,
+	}
+	brokers := []brokerTraffic{
+		{id: 0, rx: 10 << 20, tx: 10 << 20},
+		{id: 1, rx: 10 << 20, tx: 10 << 20},
+		{id: 2, rx: 10 << 20, tx: 10 << 20},
+	}
+
+	// 20MB/s, 1 hour, rf 3
+	intents := []capacityIntent{{topic: "X", tps: 20 << 10, msgSize: 1 << 10, retention: time.Hour, replicas: 3}}
+	plan := planCapacity(intents, brokers, cf)
+	assert.Equal(t, 2, plan.topics[0].partitions)
+	assert.Equal(t, false, plan.topics[0].tooManyPartitions)
+	assert.Equal(t, float64(60<<20), plan.topics[0].rx)
+	assert.Equal(t, float64(60<<20), plan.topics[0].tx) // 2 followers + 1 consumer
+	assert.Equal(t, float64(20<<20)*3600*3, plan.topics[0].disk)
+
+	// rx: 30MB + 60MB over 50MB usable per broker
+	assert.Equal(t, 3, plan.needed)
+	assert.Equal(t, "", plan.bottleneck)
+	assert.Equal(t, 0, plan.extra())
+	assert.Equal(t, float64(20<<20), plan.rx)
+
+	// network bound
+	intents[0].tps = 100 << 10
+	plan = planCapacity(intents, brokers, cf)
+	assert.Equal(t, 10, plan.topics[0].partitions)
+	assert.Equal(t, 7, plan.needed) // (30 + 300) / 50
+	assert.Equal(t, 4, plan.extra())
+	assert.Equal(t, "network rx", plan.bottleneck)
+
+	// disk bound
+	intents[0].retention = 7 * 24 * time.Hour
+	plan = planCapacity(intents, brokers, cf)
+	assert.Equal(t, 174, plan.needed) // 100MB * 7d * 3 / 1TB
+	assert.Equal(t, "disk", plan.bottleneck)
+	intents[0].retention = time.Hour
+
+	// sla max partitions
+	intents[0].tps = 1 << 20
+	plan = planCapacity(intents, brokers, cf)
+	assert.Equal(t, true, plan.topics[0].tooManyPartitions)
+
+	// replicas bound
+	plan = planCapacity([]capacityIntent{{topic: "Y", tps: 1, msgSize: 1, retention: time.Hour, replicas: 3}},
+		brokers[:1], cf)
+	assert.Equal(t, 3, plan.needed)
+	assert.Equal(t, "replicas", plan.bottleneck)
+	assert.Equal(t, 1, plan.topics[0].partitions)
+}
+
+func TestParseHistogramGrowth(t *testing.T) {
+	offsets, err := parseOffsetGrowth(strings.NewReader(`Thu Jun 16 21:45:01 CST 2016
+           -CUM Messages- 1,000
+Thu Jun 16 22:45:01 CST 2016
+           -CUM Messages- 1,500
+`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(offsets))
+	assert.Equal(t, int64(500), offsets[0].delta)
+	assert.Equal(t, int64(1000), offsets[0].offset)
+	assert.Equal(t, 22, offsets[0].t.Hour())
+
+	network, err := parseNetworkGrowth(strings.NewReader(`Thu Jun 16 21:45:01 CST 2016
+h1: bytes:100 bytes:200
+h2: bytes:100 bytes:200
+Thu Jun 16 22:45:01 CST 2016
+h1: bytes:300 bytes:500
+h2: bytes:300 bytes:500
+`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(network))
+	assert.Equal(t, int64(400), network[0].rx)
+	assert.Equal(t, int64(600), network[0].tx)
+	assert.Equal(t, int64(200), network[0].rxBase)
+}
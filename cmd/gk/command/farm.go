@@ -54,18 +54,9 @@ func (this *Farm) Run(args []string) (exitCode int) {
 		zkzone.Conn().Set(path, data, -1)
 
 	default:
-		children := zkzone.ChildrenWithData("/_farm")
-		sortedChildren := make([]string, 0, len(children))
-		for c := range children {
-			sortedChildren = append(sortedChildren, c)
-		}
-		sort.Strings(sortedChildren)
-
-		for _, c := range sortedChildren {
-			data := children[c]
-			var v []string
-			json.Unmarshal(data.Data(), &v)
-			this.Ui.Outputf("%16s %+v", c, v)
+		servers, tags := farmServers(zkzone)
+		for _, server := range servers {
+			this.Ui.Outputf("%16s %+v", server, tags[server])
 		}
 
 	}
@@ -73,6 +64,23 @@ func (this *Farm) Run(args []string) (exitCode int) {
 	return
 }
 
+// farmServers returns the sorted reserved servers and their tags.
+func farmServers(zkzone *zk.ZkZone) ([]string, map[string][]string) {
+	children := zkzone.ChildrenWithData("/_farm")
+	servers := make([]string, 0, len(children))
+	tags := make(map[string][]string, len(children))
+	for c, data := range children {
+		servers = append(servers, c)
+
+		var v []string
+		json.Unmarshal(data.Data(), &v)
+		tags[c] = v
+	}
+	sort.Strings(servers)
+
+	return servers, tags
+}
+
 func (*Farm) Synopsis() string {
 	return "Manage reserved servers farm to deploy new kafka brokers"
 }
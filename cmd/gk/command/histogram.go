@@ -51,18 +51,29 @@ func (this *Histogram) Run(args []string) (exitCode int) {
 	return
 }
 
-func (this *Histogram) showOffsetGrowth() ([]time.Time, []int64) {
-	f, err := os.OpenFile(this.offsetFile, os.O_RDONLY, 0660)
-	swallow(err)
-	defer f.Close()
+// offsetGrowth is the messages produced in the period ended at tm.
+type offsetGrowth struct {
+	tm     string // Thu Jun 16 22:45:01 CST 2016
+	t      time.Time
+	delta  int64
+	offset int64 // cumulated messages when the period began
+}
 
-	ts := make([]time.Time, 0)
-	vs := make([]int64, 0)
+// networkGrowth is the network traffic of all hosts in the period ended at tm.
+type networkGrowth struct {
+	tm             string
+	t              time.Time
+	rx, tx         int64
+	rxBase, txBase int64 // cumulated bytes when the period began
+}
 
-	r := bufio.NewReader(f)
+// parseOffsetGrowth parses the output of: date; gk topics -z prod -l | grep CUM
+func parseOffsetGrowth(rd io.Reader) ([]offsetGrowth, error) {
 	var (
+		r     = bufio.NewReader(rd)
 		lastN = int64(0)
 		tm    string
+		gs    []offsetGrowth
 	)
 
 	for {
@@ -82,55 +93,55 @@ func (this *Histogram) showOffsetGrowth() ([]time.Time, []int64) {
 			n = strings.Replace(n, ",", "", -1)
 			n = strings.TrimSpace(n)
 			offset, err := strconv.ParseInt(n, 10, 64)
-			swallow(err)
+			if err != nil {
+				return nil, err
+			}
 			if lastN > 0 {
-				t, e := time.Parse("Mon Jan 2 15:04:05 MST 2006", tm)
-				swallow(e)
-				ts = append(ts, t)
-				vs = append(vs, offset-lastN)
-
-				this.Ui.Output(fmt.Sprintf("%55s Message+ %15s/%s", tm,
-					gofmt.Comma(offset-lastN), gofmt.Comma(lastN)))
+				t, err := time.Parse("Mon Jan 2 15:04:05 MST 2006", tm)
+				if err != nil {
+					return nil, err
+				}
+				gs = append(gs, offsetGrowth{tm: tm, t: t, delta: offset - lastN, offset: lastN})
 			}
 
 			lastN = offset
 		}
 	}
 
-	return ts, vs
+	return gs, nil
 }
 
-func (this *Histogram) showNetworkGrowth() ([]time.Time, []int64, []int64) {
-	f, err := os.OpenFile(this.networkFile, os.O_RDONLY, 0660)
-	swallow(err)
-	defer f.Close()
-
-	ts := make([]time.Time, 0)
-	rx := make([]int64, 0)
-	tx := make([]int64, 0)
-
-	r := bufio.NewReader(f)
+// parseNetworkGrowth parses the output of: date; consul exec ifconfig bond0 | grep 'RX bytes' | awk '{print $1,$3,$7}' | sort
+func parseNetworkGrowth(rd io.Reader) ([]networkGrowth, error) {
 	var (
+		r                = bufio.NewReader(rd)
 		lastRx           = int64(0)
 		lastTx           = int64(0)
 		rxTotal, txTotal int64
 		tm               string
+		gs               []networkGrowth
 	)
 
+	appendGrowth := func() error {
+		t, err := time.Parse("Mon Jan 2 15:04:05 MST 2006", tm)
+		if err != nil {
+			return err
+		}
+
+		gs = append(gs, networkGrowth{tm: tm, t: t,
+			rx: rxTotal - lastRx, tx: txTotal - lastTx,
+			rxBase: lastRx, txBase: lastTx})
+		return nil
+	}
+
 	for {
 		// CDM1C01-209018015: bytes:98975866482403 bytes:115679008715688
 		line, err := r.ReadString('\n')
 		if err == io.EOF {
 			if lastRx > 0 {
-				t, e := time.Parse("Mon Jan 2 15:04:05 MST 2006", tm)
-				swallow(e)
-				ts = append(ts, t)
-				rx = append(rx, rxTotal-lastRx)
-				tx = append(tx, txTotal-lastTx)
-
-				this.Ui.Output(fmt.Sprintf("%55s    RX+:%10s/%-10s TX+:%10s/%-10s",
-					tm, gofmt.ByteSize(rxTotal-lastRx), gofmt.ByteSize(lastRx),
-					gofmt.ByteSize(txTotal-lastTx), gofmt.ByteSize(lastTx)))
+				if err = appendGrowth(); err != nil {
+					return nil, err
+				}
 			}
 
 			break
@@ -141,15 +152,9 @@ func (this *Histogram) showNetworkGrowth() ([]time.Time, []int64, []int64) {
 			// time info: Thu Jun 16 22:45:01 CST 2016
 
 			if lastRx > 0 {
-				t, e := time.Parse("Mon Jan 2 15:04:05 MST 2006", tm)
-				swallow(e)
-				ts = append(ts, t)
-				rx = append(rx, rxTotal-lastRx)
-				tx = append(tx, txTotal-lastTx)
-
-				this.Ui.Output(fmt.Sprintf("%55s    RX+:%10s/%-10s TX+:%10s/%-10s",
-					tm, gofmt.ByteSize(rxTotal-lastRx), gofmt.ByteSize(lastRx),
-					gofmt.ByteSize(txTotal-lastTx), gofmt.ByteSize(lastTx)))
+				if err = appendGrowth(); err != nil {
+					return nil, err
+				}
 			}
 
 			tm = line
@@ -166,15 +171,64 @@ func (this *Histogram) showNetworkGrowth() ([]time.Time, []int64, []int64) {
 			txBytes := strings.Split(parts[2], ":")[1]
 
 			n, err := strconv.ParseInt(rxBytes, 10, 64)
-			swallow(err)
+			if err != nil {
+				return nil, err
+			}
 			rxTotal += n
 
 			n, err = strconv.ParseInt(txBytes, 10, 64)
-			swallow(err)
+			if err != nil {
+				return nil, err
+			}
 			txTotal += n
 		}
 	}
 
+	return gs, nil
+}
+
+func (this *Histogram) showOffsetGrowth() ([]time.Time, []int64) {
+	f, err := os.OpenFile(this.offsetFile, os.O_RDONLY, 0660)
+	swallow(err)
+	defer f.Close()
+
+	gs, err := parseOffsetGrowth(f)
+	swallow(err)
+
+	ts := make([]time.Time, 0, len(gs))
+	vs := make([]int64, 0, len(gs))
+	for _, g := range gs {
+		ts = append(ts, g.t)
+		vs = append(vs, g.delta)
+
+		this.Ui.Output(fmt.Sprintf("%55s Message+ %15s/%s", g.tm,
+			gofmt.Comma(g.delta), gofmt.Comma(g.offset)))
+	}
+
+	return ts, vs
+}
+
+func (this *Histogram) showNetworkGrowth() ([]time.Time, []int64, []int64) {
+	f, err := os.OpenFile(this.networkFile, os.O_RDONLY, 0660)
+	swallow(err)
+	defer f.Close()
+
+	gs, err := parseNetworkGrowth(f)
+	swallow(err)
+
+	ts := make([]time.Time, 0, len(gs))
+	rx := make([]int64, 0, len(gs))
+	tx := make([]int64, 0, len(gs))
+	for _, g := range gs {
+		ts = append(ts, g.t)
+		rx = append(rx, g.rx)
+		tx = append(tx, g.tx)
+
+		this.Ui.Output(fmt.Sprintf("%55s    RX+:%10s/%-10s TX+:%10s/%-10s",
+			g.tm, gofmt.ByteSize(g.rx), gofmt.ByteSize(g.rxBase),
+			gofmt.ByteSize(g.tx), gofmt.ByteSize(g.txBase)))
+	}
+
 	return ts, rx, tx
 }
 
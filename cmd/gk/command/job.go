@@ -32,9 +32,10 @@ type Job struct {
 
 func (this *Job) Run(args []string) (exitCode int) {
 	var (
-		zone    string
-		appid   string
-		initJob string
+		zone     string
+		appid    string
+		initJob  string
+		priority string
 	)
 	cmdFlags := flag.NewFlagSet("job", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
@@ -42,16 +43,33 @@ func (this *Job) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&appid, "app", "", "")
 	cmdFlags.IntVar(&this.due, "d", 0, "")
 	cmdFlags.StringVar(&initJob, "init", "", "")
+	cmdFlags.StringVar(&priority, "priority", "", "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if validateArgs(this, this.Ui).
+		on("-priority", "-app").
+		invalid(args) {
+		return 2
+	}
+
 	this.zkzone = zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
 	if initJob != "" {
 		this.initializeJob(initJob)
 		return
 	}
 
+	if priority != "" {
+		if err := this.zkzone.NewOrchestrator().SetAppPriority(appid, priority); err != nil {
+			this.Ui.Error(err.Error())
+			return 1
+		}
+
+		this.Ui.Info(fmt.Sprintf("%s priority: %s", appid, priority))
+		return
+	}
+
 	if appid != "" {
 		this.displayAppJobs(appid)
 		return
@@ -316,6 +334,10 @@ Options:
     -d <due time in seconds>
       List jobs due from now within how many seconds.
 
+    -priority <high|normal|low>
+      Set priority class of the app specified by -app.
+      Job queues of higher priority weigh more when actord assigns job queues.
+
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
 }
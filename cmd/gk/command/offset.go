@@ -3,9 +3,11 @@ package command
 import (
 	"flag"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
@@ -24,6 +26,7 @@ func (this *Offset) Run(args []string) (exitCode int) {
 		group     string
 		partition string
 		offset    int64
+		ts        string
 	)
 	cmdFlags := flag.NewFlagSet("offset", flag.ContinueOnError)
 	cmdFlags.Usage = func() { this.Ui.Output(this.Help()) }
@@ -32,34 +35,70 @@ func (this *Offset) Run(args []string) (exitCode int) {
 	cmdFlags.StringVar(&topic, "t", "", "")
 	cmdFlags.StringVar(&group, "g", "", "")
 	cmdFlags.Int64Var(&offset, "offset", -1, "")
+	cmdFlags.StringVar(&ts, "ts", "", "")
 	cmdFlags.StringVar(&partition, "p", "", "")
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
 	if validateArgs(this, this.Ui).
-		require("-z", "-c", "-t", "-g", "-p", "-offset").
+		require("-z", "-c", "-t", "-g").
+		on("-offset", "-p").
 		requireAdminRights("-z").
 		invalid(args) {
 		return 2
 	}
 
-	if offset < 0 {
-		this.Ui.Error("offset must be positive")
-		return
+	if partition != "" {
+		if p, err := strconv.Atoi(partition); err != nil {
+			this.Ui.Error("invalid partition")
+			return
+		} else if p < 0 || p > 100 {
+			this.Ui.Error("invalid partition")
+			return
+		}
 	}
 
-	if p, err := strconv.Atoi(partition); err != nil {
-		this.Ui.Error("invalid partition")
-		return
-	} else if p < 0 || p > 100 {
-		this.Ui.Error("invalid partition")
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	zkcluster := zkzone.NewCluster(cluster)
+
+	if ts == "" {
+		if offset < 0 {
+			this.Ui.Error("offset must be positive")
+			return
+		}
+
+		swallow(zkcluster.ResetConsumerGroupOffset(topic, group, partition, offset))
+		this.Ui.Output("done")
 		return
 	}
 
-	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
-	zkcluster := zkzone.NewCluster(cluster)
-	zkcluster.ResetConsumerGroupOffset(topic, group, partition, offset)
+	t, err := zk.ParseOffsetTime(ts)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	offsets, err := zkcluster.OffsetsAtTime(topic, t, envelope.MessageTime)
+	swallow(err)
+
+	partitions := make([]int, 0, len(offsets))
+	for p := range offsets {
+		partitions = append(partitions, int(p))
+	}
+	sort.Ints(partitions)
+
+	for _, p := range partitions {
+		pid := strconv.Itoa(p)
+		if partition != "" && partition != pid {
+			continue
+		}
+
+		o := offsets[int32(p)]
+		swallow(zkcluster.ResetConsumerGroupOffset(topic, group, pid, o))
+		this.Ui.Output(fmt.Sprintf("%s#%s -> %d", topic, pid, o))
+	}
+
 	this.Ui.Output("done")
 	return
 }
@@ -70,10 +109,23 @@ func (*Offset) Synopsis() string {
 
 func (this *Offset) Help() string {
 	help := fmt.Sprintf(`
-Usage: %s offset -z zone -c cluster -t topic -g group -p partition -offset offset
+Usage: %s offset -z zone -c cluster -t topic -g group [options]
 
     %s
 
+Options:
+
+    -p partition
+
+    -offset offset
+      Reset the partition to the offset.
+
+    -ts time
+      Reset to the first message published at or after the time.
+      All partitions are reset if -p is absent.
+      Time format: 2006-01-02T15:04, RFC3339 or unix seconds.
+      Requires kateway pub with -pubts, and it must stay on since turned on.
+
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
 }
@@ -3,9 +3,13 @@ package command
 import (
 	"flag"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/funkygao/columnize"
 	"github.com/funkygao/gafka/ctx"
+	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/gocli"
 )
 
@@ -39,14 +43,77 @@ func (this *Scale) Run(args []string) (exitCode int) {
 	}
 
 	if partitions < 1 {
+		this.Ui.Error("-partitions must be positive")
+		return 2
+	}
+
+	brokerIds, err := parseBrokerIds(brokers)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 2
+	}
+
+	zkzone := zk.NewZkZone(zk.DefaultConfig(zone, ctx.ZoneZkAddrs(zone)))
+	zkcluster := zkzone.NewCluster(cluster)
+	plan, err := zkcluster.PlanScale(topic, partitions, brokerIds)
+	if err != nil {
+		this.Ui.Error(err.Error())
+		return 1
+	}
+
+	this.showPlan(plan)
+
+	// the default partitioner hashes key modulo partition count
+	this.Ui.Warnf("%s partitions %d -> %d: messages of the same key will go to a different partition",
+		topic, plan.Existing, plan.Existing+len(plan.Added))
+	this.Ui.Warn("ordering of keyed messages breaks until the old partitions are consumed up")
+	yes, _ := this.Ui.Ask("confirm to scale? [Y/N]")
+	if !strings.EqualFold(yes, "y") {
+		this.Ui.Output("bye")
+		return
+	}
+
+	if err = zkcluster.Scale(plan); err != nil {
+		this.Ui.Error(err.Error())
 		return 1
 	}
 
+	this.Ui.Infof("%s scaled to %d partitions", topic, plan.Existing+len(plan.Added))
 	return
 }
 
+func (this *Scale) showPlan(plan *zk.TopicScale) {
+	partitionIds := make([]int, 0, len(plan.Added))
+	for p := range plan.Added {
+		id, _ := strconv.Atoi(p)
+		partitionIds = append(partitionIds, id)
+	}
+	sort.Ints(partitionIds)
+
+	lines := []string{"Partition|Leader|Replicas"}
+	for _, id := range partitionIds {
+		replicas := plan.Added[strconv.Itoa(id)]
+		lines = append(lines, fmt.Sprintf("%d|%d|%+v", id, replicas[0], replicas))
+	}
+	this.Ui.Output(columnize.SimpleFormat(lines))
+}
+
+func parseBrokerIds(brokers string) ([]int32, error) {
+	var r []int32
+	for _, s := range strings.Split(brokers, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker id: %s", s)
+		}
+
+		r = append(r, int32(id))
+	}
+
+	return r, nil
+}
+
 func (*Scale) Synopsis() string {
-	return "Scale up a topic to specified brokers TODO"
+	return "Scale up a topic by adding partitions on specified brokers"
 }
 
 func (this *Scale) Help() string {
@@ -67,7 +134,11 @@ Options:
       How many partitions to add for this topic
 
     -brokers id1,id2,idN
-      Where to place the new partitions
+      Where to place the new partitions.
+      Leaders are spread across them and replicas across racks.
+      Rack is the broker host if broker.rack is not configured.
+
+    The number of partitions after scaling can't exceed the topic sla max partitions.
 
 `, this.Cmd, this.Synopsis())
 	return strings.TrimSpace(help)
@@ -136,11 +136,8 @@ func (this *Topics) Run(args []string) (exitCode int) {
 		zkcluster := zkzone.NewCluster(cluster)
 		ts := sla.DefaultSla()
 		ts.MinInsyncReplicas = minInsyncReplicas
-		output, err := zkcluster.AlterTopic(this.topicPattern, ts)
-		swallow(err)
-		for _, line := range output {
-			this.Ui.Output(line)
-		}
+		swallow(zkcluster.AlterTopic(this.topicPattern, ts))
+		this.Ui.Info(fmt.Sprintf("%s min.insync.replicas=%d", zkcluster.GetTopicConfigPath(this.topicPattern), minInsyncReplicas))
 		return
 	}
 
@@ -354,19 +351,13 @@ func (this *Topics) configTopic(zkcluster *zk.ZkCluster, topic string, retention
 
 	ts := sla.DefaultSla()
 	ts.RetentionHours = float64(retentionInMinute) / 60
-	output, err := zkcluster.AlterTopic(topic, ts)
-	if err != nil {
+	if err := zkcluster.AlterTopic(topic, ts); err != nil {
 		this.Ui.Error(fmt.Sprintf("%+v: %v", ts, err))
 		os.Exit(1)
 	}
 
 	path := zkcluster.GetTopicConfigPath(topic)
 	this.Ui.Info(path)
-
-	for _, line := range output {
-		this.Ui.Output(line)
-	}
-
 }
 
 func (this *Topics) echoOrBuffer(line string, buffer []string) []string {
@@ -578,14 +569,11 @@ func (this *Topics) addTopic(zkcluster *zk.ZkCluster, topic string, replicas,
 	if minInsyncReplicas > 0 {
 		ts.MinInsyncReplicas = minInsyncReplicas
 	}
-	lines, err := zkcluster.AddTopic(topic, ts)
-	if err != nil {
+	if err := zkcluster.AddTopic(topic, ts); err != nil {
 		return err
 	}
 
-	for _, l := range lines {
-		this.Ui.Output(color.Yellow(l))
-	}
+	this.Ui.Output(color.Yellow(fmt.Sprintf("Created topic \"%s\".", topic)))
 	if this.ipInNumber {
 		this.Ui.Output(fmt.Sprintf("\tzookeeper.connect: %s", zkcluster.ZkConnectAddr()))
 		this.Ui.Output(fmt.Sprintf("\t      broker.list: %s",
@@ -602,15 +590,11 @@ func (this *Topics) addTopic(zkcluster *zk.ZkCluster, topic string, replicas,
 func (this *Topics) delTopic(zkcluster *zk.ZkCluster, topic string) error {
 	this.Ui.Info(fmt.Sprintf("deleting kafka topic: %s", topic))
 
-	lines, err := zkcluster.DeleteTopic(topic)
-	if err != nil {
+	if err := zkcluster.DeleteTopic(topic); err != nil {
 		return err
 	}
 
-	for _, l := range lines {
-		this.Ui.Output(color.Yellow(l))
-	}
-
+	this.Ui.Output(color.Yellow(fmt.Sprintf("Topic %s is marked for deletion.", topic)))
 	return nil
 }
 
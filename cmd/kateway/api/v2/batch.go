@@ -0,0 +1,174 @@
+package pubsub
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Batcher buffers messages of a topic and publishes them when the buffer is full
+// or every FlushInterval.
+//
+// kateway has no multi-message pub API, so a flush pipelines one pub request per
+// message over up to BatchConcurrency concurrent requests. Messages of the same key
+// are published one after another in the order they are added, and once one of them
+// fails, the later ones of that key fail too instead of overtaking it. Messages
+// without key have no order.
+//
+// Add blocks on the flush when the buffer is full.
+type Batcher struct {
+	c          *Client
+	topic, ver string
+	onError    func(msg *PubMessage, err error)
+
+	mu     sync.Mutex
+	buf    []*PubMessage
+	closed bool
+
+	flushMu sync.Mutex // keeps the order between concurrent flushes
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewBatcher creates a batcher of the topic. onError is called for each message failed
+// to be published after retries, it can be nil.
+func (c *Client) NewBatcher(topic, ver string, onError func(msg *PubMessage, err error)) *Batcher {
+	b := &Batcher{
+		c:       c,
+		topic:   topic,
+		ver:     ver,
+		onError: onError,
+		buf:     make([]*PubMessage, 0, c.cfg.BatchSize),
+		quit:    make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.flushLoop()
+	return b
+}
+
+// Add buffers a message, and publishes the whole batch if the buffer is full.
+func (b *Batcher) Add(ctx context.Context, msg *PubMessage) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+
+	b.buf = append(b.buf, msg)
+	full := len(b.buf) >= b.c.cfg.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush publishes all buffered messages, and returns one of the publish errors.
+func (b *Batcher) Flush(ctx context.Context) (err error) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	msgs := b.buf
+	b.buf = make([]*PubMessage, 0, b.c.cfg.BatchSize)
+	b.mu.Unlock()
+
+	concurrency := b.c.cfg.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg     sync.WaitGroup
+		errMu  sync.Mutex // onError is never called concurrently
+		tokens = make(chan struct{}, concurrency)
+	)
+	for _, lane := range keyLanes(msgs) {
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func(lane []*PubMessage) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			var e error
+			for _, msg := range lane {
+				if e == nil {
+					e = b.c.Publish(ctx, b.topic, b.ver, msg)
+				}
+				if e == nil {
+					continue
+				}
+
+				errMu.Lock()
+				err = e
+				if b.onError != nil {
+					b.onError(msg, e)
+				}
+				errMu.Unlock()
+			}
+		}(lane)
+	}
+
+	wg.Wait()
+	return
+}
+
+// keyLanes groups the messages of the same key in order, each message without key
+// has a lane of its own.
+func keyLanes(msgs []*PubMessage) [][]*PubMessage {
+	lanes := make([][]*PubMessage, 0, len(msgs))
+	laneOf := make(map[string]int)
+	for _, msg := range msgs {
+		if msg.Key == nil {
+			lanes = append(lanes, []*PubMessage{msg})
+			continue
+		}
+
+		i, present := laneOf[string(msg.Key)]
+		if !present {
+			i = len(lanes)
+			laneOf[string(msg.Key)] = i
+			lanes = append(lanes, nil)
+		}
+		lanes[i] = append(lanes[i], msg)
+	}
+	return lanes
+}
+
+// Close flushes the buffered messages and stops the batcher.
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.quit)
+	b.wg.Wait()
+	return b.Flush(ctx)
+}
+
+func (b *Batcher) flushLoop() {
+	defer b.wg.Done()
+
+	tick := time.NewTicker(b.c.cfg.FlushInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-b.quit:
+			return
+
+		case <-tick.C:
+			b.Flush(context.Background())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package pubsub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"golang.org/x/net/context"
+)
+
+func TestBatcher(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		msgs []string
+	)
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) == "poison" {
+			http.Error(w, `{"errmsg":"too big"}`, http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		msgs = append(msgs, string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	c.cfg.BatchSize = 3
+	c.cfg.FlushInterval = time.Hour
+
+	var failed []string
+	b := c.NewBatcher("foobar", "v1", func(msg *PubMessage, err error) {
+		failed = append(failed, string(msg.Value))
+	})
+	ctx := context.Background()
+	// same key keeps the order
+	assert.Equal(t, nil, b.Add(ctx, &PubMessage{Key: []byte("k"), Value: []byte("1")}))
+	assert.Equal(t, nil, b.Add(ctx, &PubMessage{Key: []byte("k"), Value: []byte("2")}))
+	mu.Lock()
+	assert.Equal(t, 0, len(msgs)) // not full yet
+	mu.Unlock()
+
+	// full batch is flushed on Add
+	err := b.Add(ctx, &PubMessage{Value: []byte("poison")})
+	assert.Equal(t, http.StatusBadRequest, err.(*Error).StatusCode)
+	assert.Equal(t, []string{"1", "2"}, msgs)
+	assert.Equal(t, []string{"poison"}, failed)
+
+	// Close flushes the remaining
+	assert.Equal(t, nil, b.Add(ctx, &PubMessage{Key: []byte("k"), Value: []byte("3")}))
+	assert.Equal(t, nil, b.Close(ctx))
+	assert.Equal(t, []string{"1", "2", "3"}, msgs)
+	assert.Equal(t, ErrBatcherClosed, b.Add(ctx, &PubMessage{Value: []byte("4")}))
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	done := make(chan string, 1)
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		done <- string(b)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	c.cfg.FlushInterval = time.Millisecond * 10
+
+	b := c.NewBatcher("foobar", "v1", nil)
+	defer b.Close(context.Background())
+	b.Add(context.Background(), &PubMessage{Value: []byte("hello")})
+
+	select {
+	case v := <-done:
+		assert.Equal(t, "hello", v)
+	case <-time.After(time.Second * 5):
+		t.Fatal("batcher not flushed on interval")
+	}
+}
+
+func TestBatcherConcurrentKeys(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		msgs    = make(map[string][]string) // key -> values
+		arrived = make(chan struct{}, 2)
+		barrier = make(chan struct{})
+	)
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		key := r.URL.Query().Get("key")
+		switch string(b) {
+		case "a1", "b1":
+			// both keys must be in flight together
+			arrived <- struct{}{}
+			select {
+			case <-barrier:
+			case <-time.After(time.Second * 5):
+			}
+		case "c1":
+			http.Error(w, `{"errmsg":"too big"}`, http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		msgs[key] = append(msgs[key], string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+	c.cfg.BatchSize = 100
+	c.cfg.FlushInterval = time.Hour
+	c.cfg.BatchConcurrency = 2
+
+	var failed []string
+	b := c.NewBatcher("foobar", "v1", func(msg *PubMessage, err error) {
+		failed = append(failed, string(msg.Value))
+	})
+	ctx := context.Background()
+	for _, v := range []string{"a1", "b1", "a2", "c1", "b2", "c2", "a3"} {
+		assert.Equal(t, nil, b.Add(ctx, &PubMessage{Key: []byte(v[:1]), Value: []byte(v)}))
+	}
+
+	go func() {
+		<-arrived
+		<-arrived
+		close(barrier)
+	}()
+	start := time.Now()
+	err := b.Flush(ctx)
+	assert.Equal(t, true, time.Since(start) < time.Second*5)
+	assert.Equal(t, http.StatusBadRequest, err.(*Error).StatusCode)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, msgs["a"])
+	assert.Equal(t, []string{"b1", "b2"}, msgs["b"])
+	// c2 never overtakes the failed c1
+	assert.Equal(t, 0, len(msgs["c"]))
+	assert.Equal(t, []string{"c1", "c2"}, failed)
+	assert.Equal(t, nil, b.Close(ctx))
+}
+
+func TestKeyLanes(t *testing.T) {
+	lanes := keyLanes([]*PubMessage{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Value: []byte("2")},
+		{Key: []byte("a"), Value: []byte("3")},
+		{Value: []byte("4")},
+	})
+	assert.Equal(t, 3, len(lanes))
+	assert.Equal(t, "1", string(lanes[0][0].Value))
+	assert.Equal(t, "3", string(lanes[0][1].Value))
+	assert.Equal(t, "2", string(lanes[1][0].Value))
+	assert.Equal(t, "4", string(lanes[2][0].Value))
+}
@@ -1,15 +1,156 @@
 package pubsub
 
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Client is a context aware kateway client safe for concurrent use.
+//
+// Requests failed with network error, 5xx or 429 are retried with exponential
+// backoff, and Retry-After from kateway is respected.
 type Client struct {
+	cfg *Config
+
+	appid, secret string
+	pubEndpoint   string
+	subEndpoint   string
+
+	conn    *http.Client
+	metrics *Metrics
 }
 
+var _ service = &Client{}
+
 func New(options ...func(c *Client) error) (*Client, error) {
-	c := &Client{}
+	c := &Client{
+		cfg:     DefaultConfig(),
+		metrics: &Metrics{},
+	}
 	for _, option := range options {
 		if err := option(c); err != nil {
 			return nil, err
 		}
 	}
 
+	if c.conn == nil {
+		c.conn = &http.Client{
+			// timeout is controlled by context of each request
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 10,
+				Proxy:               http.ProxyFromEnvironment,
+				Dial: (&net.Dialer{
+					Timeout: c.cfg.Timeout,
+				}).Dial,
+				TLSHandshakeTimeout: c.cfg.Timeout,
+			},
+		}
+	}
+
 	return c, nil
 }
+
+// Metrics returns the client side metrics.
+func (c *Client) Metrics() *Metrics {
+	return c.metrics
+}
+
+// Error is a non-retryable or retries exhausted kateway error response.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kateway %d: %s", e.StatusCode, e.Message)
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var v struct {
+		Errmsg string `json:"errmsg"`
+	}
+	if json.Unmarshal(body, &v) == nil && v.Errmsg != "" {
+		return &Error{StatusCode: statusCode, Message: v.Errmsg}
+	}
+
+	return &Error{StatusCode: statusCode, Message: string(body)}
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// do sends the request built by newReq with retries, and returns the response with its body read.
+// Each attempt is bounded by timeout, ctx bounds them all.
+func (c *Client) do(ctx context.Context, timeout time.Duration,
+	newReq func() (*http.Request, error)) (resp *http.Response, body []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		var req *http.Request
+		if req, err = newReq(); err != nil {
+			return
+		}
+
+		req.Header.Set("User-Agent", UserAgent)
+		req.Header.Set(headerAppid, c.appid)
+
+		resp, body, err = c.roundTrip(ctx, timeout, req)
+		if err == nil && !retryable(resp.StatusCode) {
+			return
+		}
+
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		if err == nil {
+			err = newError(resp.StatusCode, body)
+		}
+		if attempt >= c.cfg.MaxRetries {
+			return
+		}
+
+		wait := backoff(attempt, c.cfg.MinBackoff, c.cfg.MaxBackoff)
+		if resp != nil {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				c.metrics.Throttled.Inc()
+			}
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get(headerRetry), time.Now()); ok {
+				wait = retryAfter
+			}
+		}
+
+		c.metrics.Retries.Inc()
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) roundTrip(ctx context.Context, timeout time.Duration,
+	req *http.Request) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := ctxhttp.Do(ctx, c.conn, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// read the whole body to reuse the connection
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
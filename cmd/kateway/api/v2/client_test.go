@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"golang.org/x/net/context"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) (*Client, *httptest.Server) {
+	ts := httptest.NewServer(h)
+	c, err := New(WithCredential("app1", "secret"),
+		WithPubEndpoint(ts.URL), WithSubEndpoint(ts.URL),
+		WithConfig(NewConfig().WithBackoff(time.Millisecond, time.Millisecond*10).WithTimeout(time.Second)))
+	assert.Equal(t, nil, err)
+	return c, ts
+}
+
+func TestPublishRetryAfter(t *testing.T) {
+	var calls int32
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/v1/msgs/foobar/v1", r.URL.Path)
+		assert.Equal(t, "k", r.URL.Query().Get("key"))
+		assert.Equal(t, "app1", r.Header.Get(headerAppid))
+		assert.Equal(t, "secret", r.Header.Get(headerPubkey))
+
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set(headerRetry, "0")
+			http.Error(w, `{"errmsg":"quota exceeded"}`, http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, `{"errmsg":"kafka down"}`, http.StatusServiceUnavailable)
+		default:
+			w.Header().Set(headerPartition, "3")
+			w.Header().Set(headerOffset, "100")
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	defer ts.Close()
+
+	err := c.Publish(context.Background(), "foobar", "v1", &PubMessage{Key: []byte("k"), Value: []byte("hello")})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, int64(2), c.Metrics().Retries.Count())
+	assert.Equal(t, int64(1), c.Metrics().Throttled.Count())
+	assert.Equal(t, int64(1), c.Metrics().PubOk.Count())
+}
+
+func TestPublishNotRetryable(t *testing.T) {
+	var calls int32
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, `{"errmsg":"invalid appid"}`, http.StatusBadRequest)
+	})
+	defer ts.Close()
+
+	err := c.Publish(context.Background(), "foobar", "v1", &PubMessage{Value: []byte("hello")})
+	assert.Equal(t, &Error{StatusCode: http.StatusBadRequest, Message: "invalid appid"}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, int64(1), c.Metrics().PubFail.Count())
+}
+
+func TestPublishRetriesExhausted(t *testing.T) {
+	var calls int32
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	defer ts.Close()
+
+	err := c.Publish(context.Background(), "foobar", "v1", &PubMessage{Value: []byte("hello")})
+	assert.Equal(t, http.StatusInternalServerError, err.(*Error).StatusCode)
+	assert.Equal(t, int32(1+DefaultConfig().MaxRetries), atomic.LoadInt32(&calls))
+}
+
+func TestPublishContextCanceled(t *testing.T) {
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerRetry, "60")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	t0 := time.Now()
+	err := c.Publish(ctx, "foobar", "v1", &PubMessage{Value: []byte("hello")})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, true, time.Since(t0) < time.Second*10)
+}
+
+func TestAddJob(t *testing.T) {
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/jobs/foobar/v1", r.URL.Path)
+		assert.Equal(t, "10", r.URL.Query().Get("delay"))
+		w.Header().Set(headerJobId, "341647700585877504")
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	jobId, err := c.AddJob(context.Background(), "foobar", "v1", []byte("job"), time.Second*10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "341647700585877504", jobId)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 8, 1, 0, 0, 0, 0, time.UTC)
+	d, ok := parseRetryAfter("3", now)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, time.Second*3, d)
+
+	d, ok = parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, time.Minute, d)
+
+	_, ok = parseRetryAfter("", now)
+	assert.Equal(t, false, ok)
+	_, ok = parseRetryAfter("-1", now)
+	assert.Equal(t, false, ok)
+	_, ok = parseRetryAfter("soon", now)
+	assert.Equal(t, false, ok)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Millisecond*100, backoff(0, time.Millisecond*100, time.Second))
+	assert.Equal(t, time.Millisecond*400, backoff(2, time.Millisecond*100, time.Second))
+	assert.Equal(t, time.Second, backoff(10, time.Millisecond*100, time.Second))
+}
+
+func TestMergeInConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MergeIn(NewConfig().WithMaxRetries(5), nil)
+	assert.Equal(t, 5, cfg.MaxRetries)
+	assert.Equal(t, DefaultConfig().Timeout, cfg.Timeout)
+}
@@ -5,14 +5,38 @@ import (
 )
 
 type Config struct {
-	Timeout    time.Duration
-	MaxRetries int
+	Timeout    time.Duration // per http request, long poll excluded
+	MaxRetries int           // on network error, 5xx and 429
+
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	BatchSize        int           // flush the batcher when it holds so many messages
+	FlushInterval    time.Duration // flush the batcher at least this often
+	BatchConcurrency int           // max concurrent pub requests of a batcher flush
+
+	SubBatch int    // max messages per long poll
+	SubWait  string // long poll wait, e,g. 30s
 }
 
 func NewConfig() *Config {
 	return &Config{}
 }
 
+// DefaultConfig returns the config used when no config is specified.
+func DefaultConfig() *Config {
+	return &Config{
+		Timeout:          time.Second * 30,
+		MaxRetries:       3,
+		MinBackoff:       time.Millisecond * 100,
+		MaxBackoff:       time.Second * 5,
+		BatchSize:        100,
+		FlushInterval:    time.Millisecond * 100,
+		BatchConcurrency: 8,
+		SubBatch:         1,
+	}
+}
+
 func (c *Config) WithTimeout(timeout time.Duration) *Config {
 	c.Timeout = timeout
 	return c
@@ -23,6 +47,29 @@ func (c *Config) WithMaxRetries(max int) *Config {
 	return c
 }
 
+func (c *Config) WithBackoff(min, max time.Duration) *Config {
+	c.MinBackoff = min
+	c.MaxBackoff = max
+	return c
+}
+
+func (c *Config) WithBatch(size int, flushInterval time.Duration) *Config {
+	c.BatchSize = size
+	c.FlushInterval = flushInterval
+	return c
+}
+
+func (c *Config) WithBatchConcurrency(n int) *Config {
+	c.BatchConcurrency = n
+	return c
+}
+
+func (c *Config) WithSubBatch(batch int, wait string) *Config {
+	c.SubBatch = batch
+	c.SubWait = wait
+	return c
+}
+
 func (c *Config) MergeIn(cfgs ...*Config) {
 	for _, other := range cfgs {
 		mergeInConfig(c, other)
@@ -36,5 +83,37 @@ func (c *Config) Copy(cfgs ...*Config) *Config {
 	return dst
 }
 
+// mergeInConfig overrides dst with the non-zero fields of src.
 func mergeInConfig(dst *Config, src *Config) {
+	if src == nil {
+		return
+	}
+
+	if src.Timeout != 0 {
+		dst.Timeout = src.Timeout
+	}
+	if src.MaxRetries != 0 {
+		dst.MaxRetries = src.MaxRetries
+	}
+	if src.MinBackoff != 0 {
+		dst.MinBackoff = src.MinBackoff
+	}
+	if src.MaxBackoff != 0 {
+		dst.MaxBackoff = src.MaxBackoff
+	}
+	if src.BatchSize != 0 {
+		dst.BatchSize = src.BatchSize
+	}
+	if src.FlushInterval != 0 {
+		dst.FlushInterval = src.FlushInterval
+	}
+	if src.BatchConcurrency != 0 {
+		dst.BatchConcurrency = src.BatchConcurrency
+	}
+	if src.SubBatch != 0 {
+		dst.SubBatch = src.SubBatch
+	}
+	if src.SubWait != "" {
+		dst.SubWait = src.SubWait
+	}
 }
@@ -0,0 +1,31 @@
+package pubsub
+
+import (
+	"errors"
+)
+
+var (
+	ErrSubStop        = errors.New("sub stopped")
+	ErrInvalidBury    = errors.New("invalid bury name")
+	ErrNoEndpoint     = errors.New("endpoint not specified")
+	ErrBatcherClosed  = errors.New("batcher closed")
+	ErrInvalidMessage = errors.New("invalid message set")
+)
+
+const (
+	ShadowRetry = "retry"
+	ShadowDead  = "dead"
+
+	UserAgent = "pubsub-go v2"
+
+	headerAppid     = "Appid"
+	headerPubkey    = "Pubkey"
+	headerSubkey    = "Subkey"
+	headerPartition = "X-Partition"
+	headerOffset    = "X-Offset"
+	headerKey       = "X-Key"
+	headerTag       = "X-Tag"
+	headerBury      = "X-Bury"
+	headerJobId     = "X-Job-Id"
+	headerRetry     = "Retry-After"
+)
@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a goroutine safe int64 counter.
+type Counter struct {
+	n int64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+func (c *Counter) Add(delta int64) {
+	atomic.AddInt64(&c.n, delta)
+}
+
+func (c *Counter) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// Metrics is the client side metrics since the client is created.
+type Metrics struct {
+	PubOk      Counter
+	PubFail    Counter
+	PubLatency Counter // total latency of successful pubs in microseconds
+
+	SubMsgs   Counter
+	SubPolls  Counter
+	SubErrors Counter
+	Acks      Counter
+	Buries    Counter
+
+	Retries   Counter // retried requests
+	Throttled Counter // 429 responses
+}
+
+func (m *Metrics) pubDone(t0 time.Time, err error) {
+	if err != nil {
+		m.PubFail.Inc()
+		return
+	}
+
+	m.PubOk.Inc()
+	m.PubLatency.Add(int64(time.Since(t0) / time.Microsecond))
+}
+
+// AvgPubLatency returns the average latency of successful pubs.
+func (m *Metrics) AvgPubLatency() time.Duration {
+	n := m.PubOk.Count()
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(m.PubLatency.Count()/n) * time.Microsecond
+}
+
+// Snapshot returns the metrics as a map, e,g. for logging or reporting.
+func (m *Metrics) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"pub.ok":         m.PubOk.Count(),
+		"pub.fail":       m.PubFail.Count(),
+		"pub.latency.us": int64(m.AvgPubLatency() / time.Microsecond),
+		"sub.msgs":       m.SubMsgs.Count(),
+		"sub.polls":      m.SubPolls.Count(),
+		"sub.errors":     m.SubErrors.Count(),
+		"acks":           m.Acks.Count(),
+		"buries":         m.Buries.Count(),
+		"retries":        m.Retries.Count(),
+		"throttled":      m.Throttled.Count(),
+	}
+}
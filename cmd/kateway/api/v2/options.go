@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WithCredential sets the appid and secret used for both pub and sub.
+func WithCredential(appid, secret string) func(c *Client) error {
+	return func(c *Client) error {
+		c.appid, c.secret = appid, secret
+		return nil
+	}
+}
+
+// WithPubEndpoint sets the kateway pub addr, e,g. http://pub.kateway:9191
+func WithPubEndpoint(endpoint string) func(c *Client) error {
+	return func(c *Client) error {
+		c.pubEndpoint = normalizeEndpoint(endpoint)
+		return nil
+	}
+}
+
+// WithSubEndpoint sets the kateway sub addr, e,g. http://sub.kateway:9192
+func WithSubEndpoint(endpoint string) func(c *Client) error {
+	return func(c *Client) error {
+		c.subEndpoint = normalizeEndpoint(endpoint)
+		return nil
+	}
+}
+
+// WithConfig overrides the default config with the non-zero fields of cfg.
+func WithConfig(cfg *Config) func(c *Client) error {
+	return func(c *Client) error {
+		c.cfg.MergeIn(cfg)
+		return nil
+	}
+}
+
+// WithHTTPClient replaces the underlying http client.
+func WithHTTPClient(hc *http.Client) func(c *Client) error {
+	return func(c *Client) error {
+		c.conn = hc
+		return nil
+	}
+}
+
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return endpoint
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type PubMessage struct {
+	Key   []byte
+	Value []byte
+	Tag   string
+}
+
+// Publish publishes a message to the versioned topic.
+//
+// A retried publish might result in duplicated messages, consumers should be idempotent.
+func (c *Client) Publish(ctx context.Context, topic, ver string, msg *PubMessage) error {
+	t0 := time.Now()
+	_, _, err := c.publishMessage(ctx, topic, ver, msg)
+	c.metrics.pubDone(t0, err)
+	return err
+}
+
+// AddJob schedules a delayed job, and returns the job id.
+func (c *Client) AddJob(ctx context.Context, topic, ver string, payload []byte, delay time.Duration) (string, error) {
+	return c.addJob(ctx, topic, ver, payload, delay)
+}
+
+func (c *Client) publishMessage(ctx context.Context, topic, ver string,
+	msg *PubMessage) (partition int32, offset int64, err error) {
+	if c.pubEndpoint == "" {
+		return -1, -1, ErrNoEndpoint
+	}
+
+	u := fmt.Sprintf("%s/v1/msgs/%s/%s", c.pubEndpoint, topic, ver)
+	if msg.Key != nil {
+		u += "?key=" + url.QueryEscape(string(msg.Key))
+	}
+
+	resp, body, err := c.do(ctx, c.cfg.Timeout, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", u, bytes.NewReader(msg.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerPubkey, c.secret)
+		if msg.Tag != "" {
+			req.Header.Set(headerTag, msg.Tag)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return -1, -1, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted &&
+		resp.StatusCode != http.StatusOK {
+		return -1, -1, newError(resp.StatusCode, body)
+	}
+
+	p, _ := strconv.Atoi(resp.Header.Get(headerPartition))
+	offset, _ = strconv.ParseInt(resp.Header.Get(headerOffset), 10, 64)
+	return int32(p), offset, nil
+}
+
+func (c *Client) addJob(ctx context.Context, topic, ver string, payload []byte, delay time.Duration) (string, error) {
+	if c.pubEndpoint == "" {
+		return "", ErrNoEndpoint
+	}
+
+	u := fmt.Sprintf("%s/v1/jobs/%s/%s?delay=%d", c.pubEndpoint, topic, ver, int64(delay/time.Second))
+	resp, body, err := c.do(ctx, c.cfg.Timeout, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", u, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerPubkey, c.secret)
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", newError(resp.StatusCode, body)
+	}
+
+	return resp.Header.Get(headerJobId), nil
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backoff returns the exponential backoff before the retry'th retry, capped by max.
+func backoff(retry int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// parseRetryAfter parses Retry-After header which is either delay seconds or a http date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
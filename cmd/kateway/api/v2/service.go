@@ -1,13 +1,16 @@
 package pubsub
 
 import (
+	"time"
+
 	"golang.org/x/net/context"
 )
 
-//
+// service is the kateway protocol the client talks.
 type service interface {
-	publishMessage(ctx context.Context, topic string, key, value []byte)
-	fetchMessages(ctx context.Context)
-	addJob(ctx context.Context)
-	acknowledge(ctx context.Context)
+	publishMessage(ctx context.Context, topic, ver string, msg *PubMessage) (partition int32, offset int64, err error)
+	fetchMessages(ctx context.Context, opt *SubOption) ([]*Message, error)
+	addJob(ctx context.Context, topic, ver string, payload []byte, delay time.Duration) (jobId string, err error)
+	acknowledge(ctx context.Context, opt *SubOption, msgs []*Message) error
+	bury(ctx context.Context, opt *SubOption, msg *Message, shadow string) error
 }
@@ -0,0 +1,301 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type SubOption struct {
+	AppId      string // the topic owner
+	Topic, Ver string
+	Group      string
+	Reset      string // newest | oldest
+	Shadow     string // sub from the retry or dead shadow queue
+	Tag        string // tag filter
+}
+
+type Message struct {
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Tag       string
+	Value     []byte
+}
+
+// Handler processes a message. The message is acked if Handler returns nil, and
+// buried if it returns Bury(shadow). Any other error stops the subscriber, and
+// the message will be redelivered after visibility timeout.
+type Handler func(ctx context.Context, msg *Message) error
+
+type buryError struct {
+	shadow string
+}
+
+func (e *buryError) Error() string {
+	return "bury to " + e.shadow
+}
+
+// Bury is returned by Handler to move the message to the retry or dead shadow queue.
+func Bury(shadow string) error {
+	return &buryError{shadow: shadow}
+}
+
+// Subscribe long polls messages and calls h for each message until ctx is done,
+// h returns ErrSubStop or a non-retryable error happens. Messages handled before
+// the stop are acked, the one that stops is not.
+func (c *Client) Subscribe(ctx context.Context, opt SubOption, h Handler) error {
+	for {
+		msgs, err := c.Fetch(ctx, opt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if e, ok := err.(*Error); ok && !retryable(e.StatusCode) {
+				return err
+			}
+
+			// kateway might be restarting, keep polling after retries exhausted
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.cfg.MaxBackoff):
+			}
+			continue
+		}
+
+		done := make([]*Message, 0, len(msgs))
+		for _, msg := range msgs {
+			if err = h(ctx, msg); err == nil {
+				done = append(done, msg)
+				continue
+			}
+
+			if e, ok := err.(*buryError); ok {
+				if err = c.Bury(ctx, opt, msg, e.shadow); err == nil {
+					continue
+				}
+			}
+			break
+		}
+
+		if e := c.Ack(ctx, opt, done...); e != nil {
+			return e
+		}
+
+		switch err {
+		case nil:
+		case ErrSubStop:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// Fetch long polls a batch of messages which must be explicitly acked or buried.
+// It returns empty slice if no message arrives within the wait time.
+func (c *Client) Fetch(ctx context.Context, opt SubOption) ([]*Message, error) {
+	msgs, err := c.fetchMessages(ctx, &opt)
+	c.metrics.SubPolls.Inc()
+	if err != nil {
+		c.metrics.SubErrors.Inc()
+		return nil, err
+	}
+
+	c.metrics.SubMsgs.Add(int64(len(msgs)))
+	return msgs, nil
+}
+
+// Ack acknowledges that the messages are processed successfully.
+func (c *Client) Ack(ctx context.Context, opt SubOption, msgs ...*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if err := c.acknowledge(ctx, &opt, msgs); err != nil {
+		return err
+	}
+
+	c.metrics.Acks.Add(int64(len(msgs)))
+	return nil
+}
+
+// Bury moves a message to the retry or dead shadow queue of the group.
+func (c *Client) Bury(ctx context.Context, opt SubOption, msg *Message, shadow string) error {
+	if shadow != ShadowRetry && shadow != ShadowDead {
+		return ErrInvalidBury
+	}
+
+	if err := c.bury(ctx, &opt, msg, shadow); err != nil {
+		return err
+	}
+
+	c.metrics.Buries.Inc()
+	return nil
+}
+
+func (c *Client) subURL(path string, opt *SubOption, q url.Values) string {
+	q.Set("group", opt.Group)
+	if opt.Shadow != "" {
+		q.Set("q", opt.Shadow)
+	}
+	return fmt.Sprintf("%s%s/%s/%s/%s?%s", c.subEndpoint, path, opt.AppId, opt.Topic, opt.Ver, q.Encode())
+}
+
+func (c *Client) fetchMessages(ctx context.Context, opt *SubOption) ([]*Message, error) {
+	if c.subEndpoint == "" {
+		return nil, ErrNoEndpoint
+	}
+
+	q := url.Values{}
+	q.Set("ack", "1")
+	if c.cfg.SubBatch > 1 {
+		q.Set("batch", strconv.Itoa(c.cfg.SubBatch))
+	}
+	if c.cfg.SubWait != "" {
+		q.Set("wait", c.cfg.SubWait)
+	}
+	if opt.Reset != "" {
+		q.Set("reset", opt.Reset)
+	}
+	u := c.subURL("/v1/msgs", opt, q)
+
+	// long poll holds the request up to the wait time
+	wait, err := time.ParseDuration(c.cfg.SubWait)
+	if err != nil {
+		wait = c.cfg.Timeout
+	}
+
+	resp, body, err := c.do(ctx, c.cfg.Timeout+wait, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerSubkey, c.secret)
+		if opt.Tag != "" {
+			req.Header.Set(headerTag, opt.Tag)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+
+	case http.StatusOK:
+		if c.cfg.SubBatch > 1 {
+			return decodeMessageSet(body)
+		}
+
+		p, _ := strconv.Atoi(resp.Header.Get(headerPartition))
+		offset, _ := strconv.ParseInt(resp.Header.Get(headerOffset), 10, 64)
+		return []*Message{{
+			Partition: int32(p),
+			Offset:    offset,
+			Key:       []byte(resp.Header.Get(headerKey)),
+			Tag:       resp.Header.Get(headerTag),
+			Value:     body,
+		}}, nil
+
+	default:
+		return nil, newError(resp.StatusCode, body)
+	}
+}
+
+// decodeMessageSet decodes the batch sub response.
+// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
+func decodeMessageSet(b []byte) ([]*Message, error) {
+	msgs := make([]*Message, 0)
+	for len(b) > 0 {
+		if len(b) < 16 {
+			return nil, ErrInvalidMessage
+		}
+
+		msg := &Message{
+			Partition: int32(binary.BigEndian.Uint32(b[0:4])),
+			Offset:    int64(binary.BigEndian.Uint64(b[4:12])),
+		}
+		size := int(binary.BigEndian.Uint32(b[12:16]))
+		b = b[16:]
+		if size < 0 || len(b) < size {
+			return nil, ErrInvalidMessage
+		}
+
+		msg.Value = b[:size]
+		b = b[size:]
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+func (c *Client) acknowledge(ctx context.Context, opt *SubOption, msgs []*Message) error {
+	type ackOffset struct {
+		Partition int   `json:"partition"`
+		Offset    int64 `json:"offset"`
+	}
+
+	acks := make([]ackOffset, 0, len(msgs))
+	for _, msg := range msgs {
+		acks = append(acks, ackOffset{Partition: int(msg.Partition), Offset: msg.Offset})
+	}
+	body, err := json.Marshal(acks)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/v1/offsets/%s/%s/%s/%s", c.subEndpoint, opt.AppId, opt.Topic, opt.Ver, opt.Group)
+	resp, b, err := c.do(ctx, c.cfg.Timeout, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerSubkey, c.secret)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newError(resp.StatusCode, b)
+	}
+	return nil
+}
+
+func (c *Client) bury(ctx context.Context, opt *SubOption, msg *Message, shadow string) error {
+	u := c.subURL("/v1/msgs", opt, url.Values{})
+	resp, b, err := c.do(ctx, c.cfg.Timeout, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", u, bytes.NewReader(msg.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerSubkey, c.secret)
+		req.Header.Set(headerBury, shadow)
+		req.Header.Set(headerPartition, strconv.Itoa(int(msg.Partition)))
+		req.Header.Set(headerOffset, strconv.FormatInt(msg.Offset, 10))
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newError(resp.StatusCode, b)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/funkygao/assert"
+	"golang.org/x/net/context"
+)
+
+func encodeMessageSet(msgs ...*Message) []byte {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		binary.Write(&buf, binary.BigEndian, msg.Partition)
+		binary.Write(&buf, binary.BigEndian, msg.Offset)
+		binary.Write(&buf, binary.BigEndian, int32(len(msg.Value)))
+		buf.Write(msg.Value)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeMessageSet(t *testing.T) {
+	b := encodeMessageSet(&Message{Partition: 1, Offset: 10, Value: []byte("a")},
+		&Message{Partition: 2, Offset: 20, Value: []byte{}})
+	msgs, err := decodeMessageSet(b)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, int32(2), msgs[1].Partition)
+	assert.Equal(t, int64(20), msgs[1].Offset)
+	assert.Equal(t, "a", string(msgs[0].Value))
+
+	_, err = decodeMessageSet(b[:len(b)-1])
+	assert.Equal(t, ErrInvalidMessage, err)
+}
+
+func TestSubscribe(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		polls  int
+		acked  []string
+		buried []string
+	)
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, "secret", r.Header.Get(headerSubkey))
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/msgs/app2/foobar/v1":
+			assert.Equal(t, "1", r.URL.Query().Get("ack"))
+			assert.Equal(t, "g1", r.URL.Query().Get("group"))
+			assert.Equal(t, "2", r.URL.Query().Get("batch"))
+
+			polls++
+			switch polls {
+			case 1:
+				w.WriteHeader(http.StatusNoContent)
+			case 2:
+				w.Write(encodeMessageSet(&Message{Partition: 0, Offset: 1, Value: []byte("ok")},
+					&Message{Partition: 0, Offset: 2, Value: []byte("bad")}))
+			default:
+				w.Write(encodeMessageSet(&Message{Partition: 1, Offset: 5, Value: []byte("stop")}))
+			}
+
+		case r.Method == "PUT" && r.URL.Path == "/v1/offsets/app2/foobar/v1/g1":
+			b, _ := ioutil.ReadAll(r.Body)
+			acked = append(acked, string(b))
+			w.Write([]byte(`{"ok":1}`))
+
+		case r.Method == "PUT" && r.URL.Path == "/v1/msgs/app2/foobar/v1":
+			b, _ := ioutil.ReadAll(r.Body)
+			buried = append(buried, r.Header.Get(headerBury)+":"+r.Header.Get(headerPartition)+":"+
+				r.Header.Get(headerOffset)+":"+string(b))
+			w.Write([]byte(`{"ok":1}`))
+
+		default:
+			t.Fatalf("unexpected %s %s", r.Method, r.URL)
+		}
+	})
+	defer ts.Close()
+	c.cfg.SubBatch = 2
+
+	opt := SubOption{AppId: "app2", Topic: "foobar", Ver: "v1", Group: "g1"}
+	err := c.Subscribe(context.Background(), opt, func(ctx context.Context, msg *Message) error {
+		switch string(msg.Value) {
+		case "bad":
+			return Bury(ShadowRetry)
+		case "stop":
+			return ErrSubStop
+		}
+		return nil
+	})
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, []string{"retry:0:2:bad"}, buried)
+	assert.Equal(t, 1, len(acked))
+	var acks []map[string]int64
+	json.Unmarshal([]byte(acked[0]), &acks)
+	assert.Equal(t, []map[string]int64{{"partition": 0, "offset": 1}}, acks)
+
+	m := c.Metrics()
+	assert.Equal(t, int64(3), m.SubMsgs.Count())
+	assert.Equal(t, int64(1), m.Acks.Count())
+	assert.Equal(t, int64(1), m.Buries.Count())
+}
+
+func TestSubscribeHandlerError(t *testing.T) {
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			t.Fatalf("unexpected ack")
+		}
+
+		w.Header().Set(headerPartition, "0")
+		w.Header().Set(headerOffset, "9")
+		w.Header().Set(headerKey, "k")
+		w.Write([]byte("hello"))
+	})
+	defer ts.Close()
+
+	errBoom := errors.New("boom")
+	opt := SubOption{AppId: "app2", Topic: "foobar", Ver: "v1", Group: "g1"}
+	err := c.Subscribe(context.Background(), opt, func(ctx context.Context, msg *Message) error {
+		assert.Equal(t, "k", string(msg.Key))
+		assert.Equal(t, int64(9), msg.Offset)
+		return errBoom
+	})
+	assert.Equal(t, errBoom, err)
+}
+
+func TestSubscribeAuthFailure(t *testing.T) {
+	c, ts := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errmsg":"invalid secret"}`, http.StatusUnauthorized)
+	})
+	defer ts.Close()
+
+	err := c.Subscribe(context.Background(), SubOption{AppId: "app2", Topic: "foobar", Ver: "v1", Group: "g1"},
+		func(ctx context.Context, msg *Message) error { return nil })
+	assert.Equal(t, http.StatusUnauthorized, err.(*Error).StatusCode)
+	assert.Equal(t, int64(1), c.Metrics().SubErrors.Count())
+}
+
+func TestBuryInvalidShadow(t *testing.T) {
+	c, err := New()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ErrInvalidBury, c.Bury(context.Background(), SubOption{}, &Message{}, "foo"))
+}
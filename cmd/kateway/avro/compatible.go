@@ -0,0 +1,168 @@
+package avro
+
+import (
+	"fmt"
+)
+
+// Compatibility modes of schema evolution.
+const (
+	CompatNone     = "none"
+	CompatBackward = "backward" // new schema can read data written with old schema
+	CompatForward  = "forward"  // old schema can read data written with new schema
+	CompatFull     = "full"     // both backward and forward
+)
+
+// ValidCompatibility checks if mode is a known compatibility mode.
+func ValidCompatibility(mode string) bool {
+	switch mode {
+	case CompatNone, CompatBackward, CompatForward, CompatFull:
+		return true
+	}
+	return false
+}
+
+// CheckCompatibility checks if the evolution from old to new schema satisfies the mode.
+func CheckCompatibility(mode string, old, new *Schema) error {
+	switch mode {
+	case CompatNone:
+		return nil
+
+	case CompatBackward:
+		return CanRead(new, old)
+
+	case CompatForward:
+		return CanRead(old, new)
+
+	case CompatFull:
+		if err := CanRead(new, old); err != nil {
+			return err
+		}
+		return CanRead(old, new)
+	}
+
+	return fmt.Errorf("unknown compatibility: %s", mode)
+}
+
+// CanRead checks if data written with writer schema can be resolved by reader schema
+// according to the avro schema resolution rules.
+func CanRead(reader, writer *Schema) error {
+	r := &resolver{seen: make(map[[2]*Schema]bool)}
+	return r.check(reader, writer, "$")
+}
+
+type resolver struct {
+	seen map[[2]*Schema]bool // recursive types guard
+}
+
+func (this *resolver) check(reader, writer *Schema, path string) error {
+	pair := [2]*Schema{reader, writer}
+	if this.seen[pair] {
+		return nil
+	}
+	this.seen[pair] = true
+
+	if writer.Type == TypeUnion {
+		// every written branch must be readable
+		for _, b := range writer.Branches {
+			if err := this.check(reader, b, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if reader.Type == TypeUnion {
+		for _, b := range reader.Branches {
+			if this.tryCheck(b, writer, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %s not in reader union", path, writer.typeName())
+	}
+
+	if reader.Type != writer.Type {
+		if promotable(writer.Type, reader.Type) {
+			return nil
+		}
+		return fmt.Errorf("%s: %s can't be read as %s", path, writer.typeName(), reader.typeName())
+	}
+
+	switch reader.Type {
+	case TypeRecord:
+		if reader.ShortName() != writer.ShortName() {
+			return fmt.Errorf("%s: record %s can't be read as %s", path, writer.Name, reader.Name)
+		}
+		for _, rf := range reader.Fields {
+			wf := writer.field(rf.Name)
+			for i := 0; wf == nil && i < len(rf.Aliases); i++ {
+				wf = writer.field(rf.Aliases[i])
+			}
+			if wf == nil {
+				if !rf.HasDefault {
+					return fmt.Errorf("%s.%s: missing in writer and reader has no default", path, rf.Name)
+				}
+				continue
+			}
+			if err := this.check(rf.Type, wf.Type, path+"."+rf.Name); err != nil {
+				return err
+			}
+		}
+
+	case TypeEnum:
+		if reader.ShortName() != writer.ShortName() {
+			return fmt.Errorf("%s: enum %s can't be read as %s", path, writer.Name, reader.Name)
+		}
+		symbols := make(map[string]bool, len(reader.Symbols))
+		for _, s := range reader.Symbols {
+			symbols[s] = true
+		}
+		for _, s := range writer.Symbols {
+			if !symbols[s] {
+				return fmt.Errorf("%s: enum symbol %s unknown to reader", path, s)
+			}
+		}
+
+	case TypeFixed:
+		if reader.ShortName() != writer.ShortName() || reader.Size != writer.Size {
+			return fmt.Errorf("%s: fixed %s can't be read as %s", path, writer.Name, reader.Name)
+		}
+
+	case TypeArray:
+		return this.check(reader.Items, writer.Items, path+"[]")
+
+	case TypeMap:
+		return this.check(reader.Values, writer.Values, path+"{}")
+	}
+
+	return nil
+}
+
+// tryCheck is check without polluting the recursive types guard on failure.
+func (this *resolver) tryCheck(reader, writer *Schema, path string) error {
+	seen := make(map[[2]*Schema]bool, len(this.seen))
+	for k, v := range this.seen {
+		seen[k] = v
+	}
+
+	err := this.check(reader, writer, path)
+	if err != nil {
+		this.seen = seen
+	}
+	return err
+}
+
+func promotable(writer, reader string) bool {
+	switch writer {
+	case TypeInt:
+		return reader == TypeLong || reader == TypeFloat || reader == TypeDouble
+	case TypeLong:
+		return reader == TypeFloat || reader == TypeDouble
+	case TypeFloat:
+		return reader == TypeDouble
+	case TypeString:
+		return reader == TypeBytes
+	case TypeBytes:
+		return reader == TypeString
+	}
+	return false
+}
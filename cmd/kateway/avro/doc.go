@@ -0,0 +1,6 @@
+// Package avro parses Avro schema definitions, validates JSON encoded
+// payloads against them and checks schema evolution compatibility.
+//
+// Only the subset needed by kateway is implemented: there is no binary
+// encoding, and logical types are validated as their underlying types.
+package avro
@@ -0,0 +1,268 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInt     = "int"
+	TypeLong    = "long"
+	TypeFloat   = "float"
+	TypeDouble  = "double"
+	TypeBytes   = "bytes"
+	TypeString  = "string"
+	TypeRecord  = "record"
+	TypeEnum    = "enum"
+	TypeArray   = "array"
+	TypeMap     = "map"
+	TypeFixed   = "fixed"
+	TypeUnion   = "union"
+)
+
+var primitives = map[string]bool{
+	TypeNull:    true,
+	TypeBoolean: true,
+	TypeInt:     true,
+	TypeLong:    true,
+	TypeFloat:   true,
+	TypeDouble:  true,
+	TypeBytes:   true,
+	TypeString:  true,
+}
+
+// Schema is a parsed Avro schema.
+type Schema struct {
+	Type     string
+	Name     string    // full name of record, enum and fixed
+	Fields   []*Field  // record
+	Symbols  []string  // enum
+	Items    *Schema   // array
+	Values   *Schema   // map
+	Branches []*Schema // union
+	Size     int       // fixed
+}
+
+type Field struct {
+	Name       string
+	Aliases    []string
+	Type       *Schema
+	HasDefault bool
+}
+
+// Parse parses the json definition of an Avro schema.
+func Parse(definition string) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(definition), &v); err != nil {
+		return nil, err
+	}
+
+	p := &parser{named: make(map[string]*Schema)}
+	return p.parse(v, "")
+}
+
+// ShortName returns the name without namespace.
+func (this *Schema) ShortName() string {
+	if i := strings.LastIndexByte(this.Name, '.'); i >= 0 {
+		return this.Name[i+1:]
+	}
+	return this.Name
+}
+
+// typeName is the name used by json encoding of unions.
+func (this *Schema) typeName() string {
+	if this.Name != "" {
+		return this.Name
+	}
+	return this.Type
+}
+
+func (this *Schema) String() string {
+	return this.typeName()
+}
+
+type parser struct {
+	named map[string]*Schema
+}
+
+func (this *parser) parse(v interface{}, namespace string) (*Schema, error) {
+	switch t := v.(type) {
+	case string:
+		if primitives[t] {
+			return &Schema{Type: t}, nil
+		}
+		if s, present := this.named[this.fullName(t, namespace)]; present {
+			return s, nil
+		}
+		if s, present := this.named[t]; present {
+			return s, nil
+		}
+		return nil, fmt.Errorf("undefined type: %s", t)
+
+	case []interface{}:
+		s := &Schema{Type: TypeUnion}
+		seen := make(map[string]bool)
+		for _, b := range t {
+			branch, err := this.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.Type == TypeUnion {
+				return nil, fmt.Errorf("union contains union")
+			}
+			if seen[branch.typeName()] {
+				return nil, fmt.Errorf("union contains duplicated %s", branch.typeName())
+			}
+			seen[branch.typeName()] = true
+			s.Branches = append(s.Branches, branch)
+		}
+		if len(s.Branches) == 0 {
+			return nil, fmt.Errorf("empty union")
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		return this.parseComplex(t, namespace)
+	}
+
+	return nil, fmt.Errorf("invalid schema: %v", v)
+}
+
+func (this *parser) parseComplex(m map[string]interface{}, namespace string) (*Schema, error) {
+	typ, _ := m["type"].(string)
+	if typ == "" {
+		if nested, present := m["type"]; present {
+			// e,g. {"type": {"type": "array", "items": "int"}}
+			return this.parse(nested, namespace)
+		}
+		return nil, fmt.Errorf("missing type")
+	}
+
+	s := &Schema{Type: typ}
+	switch typ {
+	case TypeRecord, "error", TypeEnum, TypeFixed:
+		if typ == "error" {
+			s.Type = TypeRecord
+		}
+
+		name, _ := m["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without name", typ)
+		}
+		if ns, ok := m["namespace"].(string); ok && ns != "" {
+			namespace = ns
+		}
+		s.Name = this.fullName(name, namespace)
+		if i := strings.LastIndexByte(s.Name, '.'); i >= 0 {
+			namespace = s.Name[:i]
+		}
+		if _, present := this.named[s.Name]; present {
+			return nil, fmt.Errorf("duplicated type: %s", s.Name)
+		}
+		// register before fields parsing to allow recursive types
+		this.named[s.Name] = s
+
+	case TypeArray, TypeMap:
+	default:
+		if primitives[typ] {
+			return s, nil
+		}
+		return this.parse(typ, namespace)
+	}
+
+	switch s.Type {
+	case TypeRecord:
+		fields, ok := m["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %s without fields", s.Name)
+		}
+		names := make(map[string]bool)
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("record %s has invalid field", s.Name)
+			}
+
+			field := &Field{}
+			field.Name, _ = fm["name"].(string)
+			if field.Name == "" {
+				return nil, fmt.Errorf("record %s has field without name", s.Name)
+			}
+			if names[field.Name] {
+				return nil, fmt.Errorf("record %s has duplicated field %s", s.Name, field.Name)
+			}
+			names[field.Name] = true
+
+			ft, present := fm["type"]
+			if !present {
+				return nil, fmt.Errorf("field %s.%s without type", s.Name, field.Name)
+			}
+			var err error
+			if field.Type, err = this.parse(ft, namespace); err != nil {
+				return nil, fmt.Errorf("field %s.%s: %v", s.Name, field.Name, err)
+			}
+
+			_, field.HasDefault = fm["default"]
+			if aliases, ok := fm["aliases"].([]interface{}); ok {
+				for _, a := range aliases {
+					if alias, ok := a.(string); ok {
+						field.Aliases = append(field.Aliases, alias)
+					}
+				}
+			}
+			s.Fields = append(s.Fields, field)
+		}
+
+	case TypeEnum:
+		symbols, ok := m["symbols"].([]interface{})
+		if !ok || len(symbols) == 0 {
+			return nil, fmt.Errorf("enum %s without symbols", s.Name)
+		}
+		for _, sym := range symbols {
+			symbol, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum %s has invalid symbol", s.Name)
+			}
+			s.Symbols = append(s.Symbols, symbol)
+		}
+
+	case TypeFixed:
+		size, ok := m["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %s without valid size", s.Name)
+		}
+		s.Size = int(size)
+
+	case TypeArray:
+		items, present := m["items"]
+		if !present {
+			return nil, fmt.Errorf("array without items")
+		}
+		var err error
+		if s.Items, err = this.parse(items, namespace); err != nil {
+			return nil, err
+		}
+
+	case TypeMap:
+		values, present := m["values"]
+		if !present {
+			return nil, fmt.Errorf("map without values")
+		}
+		var err error
+		if s.Values, err = this.parse(values, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (this *parser) fullName(name, namespace string) string {
+	if strings.ContainsRune(name, '.') || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
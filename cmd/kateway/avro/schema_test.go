@@ -0,0 +1,99 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+const userV1 = `
+{
+   "type" : "record",
+   "namespace" : "demo",
+   "name" : "User",
+   "fields" : [
+      { "name" : "name" , "type" : "string" },
+      { "name" : "age" , "type" : "int" },
+      { "name" : "email" , "type" : ["null", "string"] },
+      { "name" : "level" , "type" : {"type": "enum", "name": "Level", "symbols": ["LOW", "HIGH"]} },
+      { "name" : "tags" , "type" : {"type": "array", "items": "string"} },
+      { "name" : "friends" , "type" : {"type": "array", "items": "User"}, "default": [] }
+   ]
+}`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(userV1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, TypeRecord, s.Type)
+	assert.Equal(t, "demo.User", s.Name)
+	assert.Equal(t, "User", s.ShortName())
+	assert.Equal(t, 6, len(s.Fields))
+	assert.Equal(t, "demo.Level", s.Fields[3].Type.Name)
+	assert.Equal(t, s, s.Fields[5].Type.Items) // recursive
+	assert.Equal(t, true, s.Fields[5].HasDefault)
+
+	for _, def := range []string{
+		`"foo"`,
+		`{"type": "record", "name": "A"}`,
+		`{"type": "enum", "name": "E", "symbols": []}`,
+		`["int", "int"]`,
+		`{"type": "array"}`,
+		`not json`,
+	} {
+		_, err = Parse(def)
+		assert.NotEqual(t, nil, err, def)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	s, _ := Parse(userV1)
+	for _, ok := range []string{
+		`{"name":"bob","age":30,"email":null,"level":"LOW","tags":["a"]}`,
+		`{"name":"bob","age":30,"email":"a@b.c","level":"HIGH","tags":[]}`,
+		`{"name":"bob","age":30,"email":{"string":"a@b.c"},"level":"HIGH","tags":[]}`,
+		`{"name":"bob","age":30,"level":"HIGH","tags":[],"friends":[{"name":"al","age":1,"level":"LOW","tags":[]}]}`,
+	} {
+		assert.Equal(t, nil, s.ValidateJSON([]byte(ok)), ok)
+	}
+
+	for _, bad := range []string{
+		`{"name":"bob","age":"30","level":"LOW","tags":[]}`,
+		`{"name":"bob","age":3000000000,"level":"LOW","tags":[]}`,
+		`{"name":"bob","age":1.5,"level":"LOW","tags":[]}`,
+		`{"name":"bob","age":30,"level":"MID","tags":[]}`,
+		`{"name":"bob","age":30,"level":"LOW"}`,
+		`{"name":"bob","age":30,"level":"LOW","tags":[],"x":1}`,
+		`{"name":"bob","age":30,"email":1,"level":"LOW","tags":[]}`,
+		`[]`,
+		`{"name":"bob"`,
+	} {
+		assert.NotEqual(t, nil, s.ValidateJSON([]byte(bad)), bad)
+	}
+}
+
+func TestCompatibility(t *testing.T) {
+	v1, _ := Parse(`{"type":"record","name":"R","fields":[{"name":"a","type":"int"}]}`)
+
+	// add field with default: backward and forward compatible
+	v2, _ := Parse(`{"type":"record","name":"R","fields":[{"name":"a","type":"long"},{"name":"b","type":"string","default":""}]}`)
+	assert.Equal(t, nil, CheckCompatibility(CompatBackward, v1, v2))
+	assert.NotEqual(t, nil, CheckCompatibility(CompatForward, v1, v2)) // long can't be read as int
+
+	// add field without default: not backward compatible
+	v3, _ := Parse(`{"type":"record","name":"R","fields":[{"name":"a","type":"int"},{"name":"b","type":"string"}]}`)
+	assert.NotEqual(t, nil, CheckCompatibility(CompatBackward, v1, v3))
+	assert.Equal(t, nil, CheckCompatibility(CompatForward, v1, v3))
+	assert.Equal(t, nil, CheckCompatibility(CompatNone, v1, v3))
+
+	// enum symbols and unions
+	e1, _ := Parse(`{"type":"enum","name":"E","symbols":["A","B"]}`)
+	e2, _ := Parse(`{"type":"enum","name":"E","symbols":["A","B","C"]}`)
+	assert.Equal(t, nil, CheckCompatibility(CompatBackward, e1, e2))
+	assert.NotEqual(t, nil, CheckCompatibility(CompatFull, e1, e2))
+
+	u1, _ := Parse(`["null","string"]`)
+	u2, _ := Parse(`"string"`)
+	assert.Equal(t, nil, CanRead(u1, u2))
+	assert.NotEqual(t, nil, CanRead(u2, u1))
+	assert.Equal(t, false, ValidCompatibility("sideways"))
+}
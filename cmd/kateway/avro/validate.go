@@ -0,0 +1,178 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// ValidateJSON checks that a json payload conforms to the schema.
+//
+// A union value is either the plain value of one of its branches or the
+// avro json encoding {"<type name>": value}. Record fields with default or
+// nullable type can be omitted, unknown fields are rejected.
+func (this *Schema) ValidateJSON(payload []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid json: trailing data")
+	}
+
+	return this.validate(v, "$")
+}
+
+func (this *Schema) validate(v interface{}, path string) error {
+	mismatch := func() error {
+		return fmt.Errorf("%s: expect %s", path, this.typeName())
+	}
+
+	switch this.Type {
+	case TypeNull:
+		if v != nil {
+			return mismatch()
+		}
+
+	case TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+
+	case TypeInt, TypeLong:
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return mismatch()
+		}
+		if this.Type == TypeInt && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("%s: int overflow", path)
+		}
+
+	case TypeFloat, TypeDouble:
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		if _, err := n.Float64(); err != nil {
+			return mismatch()
+		}
+
+	case TypeString, TypeBytes:
+		if _, ok := v.(string); !ok {
+			return mismatch()
+		}
+
+	case TypeFixed:
+		s, ok := v.(string)
+		if !ok || utf8.RuneCountInString(s) != this.Size {
+			return mismatch()
+		}
+
+	case TypeEnum:
+		s, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		for _, symbol := range this.Symbols {
+			if s == symbol {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %q not in enum %s", path, s, this.Name)
+
+	case TypeArray:
+		items, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i, item := range items {
+			if err := this.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case TypeMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for k, val := range m {
+			if err := this.Values.validate(val, path+"."+k); err != nil {
+				return err
+			}
+		}
+
+	case TypeRecord:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range this.Fields {
+			val, present := m[f.Name]
+			if !present {
+				if f.HasDefault || f.Type.nullable() {
+					continue
+				}
+				return fmt.Errorf("%s.%s: missing", path, f.Name)
+			}
+			if err := f.Type.validate(val, path+"."+f.Name); err != nil {
+				return err
+			}
+		}
+		for k := range m {
+			if this.field(k) == nil {
+				return fmt.Errorf("%s.%s: unknown field", path, k)
+			}
+		}
+
+	case TypeUnion:
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+			for name, val := range m {
+				for _, b := range this.Branches {
+					if b.typeName() == name || (b.Name != "" && b.ShortName() == name) {
+						return b.validate(val, path)
+					}
+				}
+			}
+		}
+
+		for _, b := range this.Branches {
+			if b.validate(v, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: no matching type in union", path)
+	}
+
+	return nil
+}
+
+func (this *Schema) nullable() bool {
+	if this.Type == TypeNull {
+		return true
+	}
+	for _, b := range this.Branches {
+		if b.Type == TypeNull {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Schema) field(name string) *Field {
+	for _, f := range this.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
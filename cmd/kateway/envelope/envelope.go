@@ -0,0 +1,141 @@
+// Package envelope implements the kateway message envelope, it is shared by kateway
+// and the tools that inspect kafka messages published by kateway.
+//
+// An envelope wraps a message body with publish time and key/value headers.
+//
+// ┌─────────┐ ┌─────────┐ ┌───────────┐ ┌────────────┐ ┌─────────┐ ┌───────────────────────────────┐ ┌────────┐
+// │ magic   │ │ version │ │ timestamp │ │ header len │ │ crc32   │ │ [klen(1) key vlen(2) value]*  │ │ body   │
+// │ 4 bytes │ │ 1 byte  │ │ 8 bytes   │ │ 2 bytes    │ │ 4 bytes │ │ header len bytes              │ │        │
+// └─────────┘ └─────────┘ └───────────┘ └────────────┘ └─────────┘ └───────────────────────────────┘ └────────┘
+//
+// timestamp is the publish time in unix milliseconds, crc32 is checksum of the
+// timestamp and the headers.
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	Version = byte(2)
+
+	FixedLen        = 19 // magic + version + timestamp + header len + crc32
+	MaxHeaderKeyLen = 255
+	MaxHeaderLen    = 65535
+)
+
+// Magic leads an enveloped message, the header crc makes a
+// binary payload that happens to start with the magic still unambiguous.
+var Magic = []byte{0xEB, 'K', 'W', 'E'}
+
+// Header is a key/value pair carried in the envelope.
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Len returns the envelope length without body.
+func Len(headers []Header) int {
+	n := FixedLen
+	for _, h := range headers {
+		n += 3 + len(h.Key) + len(h.Value)
+	}
+	return n
+}
+
+// ValidHeaders checks whether the headers fit in an envelope.
+func ValidHeaders(headers []Header) bool {
+	n := 0
+	for _, h := range headers {
+		if len(h.Key) == 0 || len(h.Key) > MaxHeaderKeyLen || len(h.Value) > MaxHeaderLen {
+			return false
+		}
+		n += 3 + len(h.Key) + len(h.Value)
+	}
+	return n <= MaxHeaderLen
+}
+
+// Encode writes the envelope head into buf which must be at least Len bytes.
+// The body follows right after the returned length.
+func Encode(buf []byte, ts time.Time, headers []Header) int {
+	copy(buf, Magic)
+	buf[4] = Version
+	binary.BigEndian.PutUint64(buf[5:], uint64(ts.UnixNano()/int64(time.Millisecond)))
+
+	i := FixedLen
+	for _, h := range headers {
+		buf[i] = byte(len(h.Key))
+		i += 1 + copy(buf[i+1:], h.Key)
+		binary.BigEndian.PutUint16(buf[i:], uint16(len(h.Value)))
+		i += 2 + copy(buf[i+2:], h.Value)
+	}
+
+	binary.BigEndian.PutUint16(buf[13:], uint16(i-FixedLen))
+	crc := crc32.Update(crc32.ChecksumIEEE(buf[5:13]), crc32.IEEETable, buf[FixedLen:i])
+	binary.BigEndian.PutUint32(buf[15:], crc)
+	return i
+}
+
+// Valid checks whether msg is a valid envelope of known version.
+func Valid(msg []byte) bool {
+	_, _, ok := Decode(msg)
+	return ok
+}
+
+// Decode parses the envelope headers and locates the body.
+// ok is false if msg is not a valid envelope of known version.
+func Decode(msg []byte) (headers []Header, bodyIdx int, ok bool) {
+	_, headers, bodyIdx, ok = decodeWithTime(msg)
+	return
+}
+
+// MessageTime returns the publish time embedded in a message.
+// ok is false if the message is not enveloped or has no timestamp.
+func MessageTime(msg []byte) (ts time.Time, ok bool) {
+	ts, _, _, ok = decodeWithTime(msg)
+	return ts, ok && !ts.IsZero()
+}
+
+func decodeWithTime(msg []byte) (ts time.Time, headers []Header, bodyIdx int, ok bool) {
+	if len(msg) < FixedLen || !bytes.Equal(msg[:4], Magic) || msg[4] != Version {
+		return
+	}
+
+	bodyIdx = FixedLen + int(binary.BigEndian.Uint16(msg[13:]))
+	if bodyIdx > len(msg) {
+		return
+	}
+
+	h := msg[FixedLen:bodyIdx]
+	crc := crc32.Update(crc32.ChecksumIEEE(msg[5:13]), crc32.IEEETable, h)
+	if crc != binary.BigEndian.Uint32(msg[15:]) {
+		return
+	}
+
+	if ms := int64(binary.BigEndian.Uint64(msg[5:])); ms > 0 {
+		ts = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	for len(h) > 0 {
+		klen := int(h[0])
+		if klen == 0 || len(h) < 3+klen {
+			return
+		}
+		vlen := int(binary.BigEndian.Uint16(h[1+klen:]))
+		if len(h) < 3+klen+vlen {
+			return
+		}
+
+		headers = append(headers, Header{
+			Key:   string(h[1 : 1+klen]),
+			Value: string(h[3+klen : 3+klen+vlen]),
+		})
+		h = h[3+klen+vlen:]
+	}
+
+	ok = true
+	return
+}
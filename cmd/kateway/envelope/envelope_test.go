@@ -0,0 +1,62 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	headers := []Header{{"region", "bj"}, {"vip", ""}}
+	buf := make([]byte, Len(headers)+5)
+	n := Encode(buf, time.Now(), headers)
+	assert.Equal(t, Len(headers), n)
+	copy(buf[n:], "hello")
+
+	decoded, bodyIdx, ok := Decode(buf)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, headers, decoded)
+	assert.Equal(t, "hello", string(buf[bodyIdx:]))
+
+	// corrupted header
+	buf[FixedLen+1] ^= 0xff
+	assert.Equal(t, false, Valid(buf))
+
+	// unknown version
+	buf[FixedLen+1] ^= 0xff
+	buf[4] = Version + 1
+	assert.Equal(t, false, Valid(buf))
+}
+
+func TestNoHeaders(t *testing.T) {
+	buf := make([]byte, Len(nil))
+	Encode(buf, time.Time{}, nil)
+	headers, bodyIdx, ok := Decode(buf)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0, len(headers))
+	assert.Equal(t, len(buf), bodyIdx)
+}
+
+func TestValidHeaders(t *testing.T) {
+	assert.Equal(t, true, ValidHeaders([]Header{{"a", "b"}, {"c", ""}}))
+	assert.Equal(t, false, ValidHeaders([]Header{{"", "b"}}))
+	assert.Equal(t, false, ValidHeaders([]Header{{string(make([]byte, MaxHeaderKeyLen+1)), ""}}))
+}
+
+func TestMessageTime(t *testing.T) {
+	now := time.Now()
+	buf := make([]byte, Len(nil))
+	Encode(buf, now, nil)
+	ts, ok := MessageTime(buf)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), ts.UnixNano()/int64(time.Millisecond))
+
+	// corrupted timestamp
+	buf[6] ^= 0xff
+	_, ok = MessageTime(buf)
+	assert.Equal(t, false, ok)
+
+	_, ok = MessageTime([]byte("hello world"))
+	assert.Equal(t, false, ok)
+}
@@ -83,6 +83,7 @@ func newGatewayForTest(b *testing.B, store string) *Gateway {
 	Options.ReporterInterval = time.Hour
 	Options.InfluxServer = "none"
 	Options.InfluxDbName = "none"
+	Options.Reporter = "influxdb"
 	Options.JobStore = "dummy"
 	Options.EnableHintedHandoff = true
 	Options.HintedHandoffDir = "hhdata"
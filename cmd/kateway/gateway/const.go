@@ -1,5 +1,9 @@
 package gateway
 
+import (
+	"time"
+)
+
 const (
 	HttpHeaderXForwardedFor   = "X-Forwarded-For"
 	HttpHeaderPartition       = "X-Partition"
@@ -8,8 +12,12 @@ const (
 	HttpHeaderMsgKey          = "X-Key"
 	HttpHeaderMsgTag          = "X-Tag"
 	HttpHeaderJobId           = "X-Job-Id"
+	HttpHeaderXid             = "X-Xid"
 	HttpHeaderAcceptEncoding  = "Accept-Encoding"
 	HttpHeaderContentEncoding = "Content-Encoding"
+	HttpHeaderRetryAfter      = "Retry-After"
+	HttpHeaderQuotaScope      = "X-Quota-Scope"
+	HttpHeaderQuotaLimit      = "X-Quota-Limit"
 	HttpEncodingGzip          = "gzip"
 
 	UrlParamTopic   = "topic"
@@ -18,6 +26,9 @@ const (
 	UrlParamGroup   = "group"
 
 	MaxPartitionKeyLen = 256
+	MaxCheckbackLen    = 512
+
+	MaxVisibilityTimeout = time.Hour * 12
 )
 
 var (
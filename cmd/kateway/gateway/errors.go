@@ -13,4 +13,5 @@ var (
 	ErrBadResponseWriter    = errors.New("ResponseWriter Close not supported")
 	ErrPartitionOutOfRange  = errors.New("partition out of range")
 	ErrOffsetOutOfRange     = errors.New("offset out of range")
+	ErrCheckbackNotAllowed  = errors.New("checkback not allowed")
 )
@@ -18,6 +18,10 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/hh"
 	hhdisk "github.com/funkygao/gafka/cmd/kateway/hh/disk"
 	hhdummy "github.com/funkygao/gafka/cmd/kateway/hh/dummy"
+	hhkafka "github.com/funkygao/gafka/cmd/kateway/hh/kafka"
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
+	inflightdisk "github.com/funkygao/gafka/cmd/kateway/inflight/disk"
+	inflightmem "github.com/funkygao/gafka/cmd/kateway/inflight/mem"
 	"github.com/funkygao/gafka/cmd/kateway/job"
 	jobdummy "github.com/funkygao/gafka/cmd/kateway/job/dummy"
 	jobmysql "github.com/funkygao/gafka/cmd/kateway/job/mysql"
@@ -30,11 +34,16 @@ import (
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	storedummy "github.com/funkygao/gafka/cmd/kateway/store/dummy"
 	storekfk "github.com/funkygao/gafka/cmd/kateway/store/kafka"
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+	xadummy "github.com/funkygao/gafka/cmd/kateway/xa/dummy"
+	xamysql "github.com/funkygao/gafka/cmd/kateway/xa/mysql"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/registry"
+	"github.com/funkygao/gafka/registry/eureka"
 	"github.com/funkygao/gafka/registry/zk"
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/gafka/telemetry/influxdb"
+	"github.com/funkygao/gafka/telemetry/prometheus"
 	gzk "github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/golib/signal"
@@ -79,18 +88,41 @@ func New(id string) *Gateway {
 	}
 
 	if Options.EnableRegistry {
-		registry.Default = zk.New(this.zkzone)
+		switch Options.Registry {
+		case "zk":
+			registry.Default = zk.New(this.zkzone)
+
+		case "eureka":
+			registry.Default = eureka.New(eureka.DefaultConfig(Options.Zone, strings.Split(Options.EurekaServers, ",")...))
+
+		default:
+			panic("invalid registry: " + Options.Registry)
+		}
 	}
 	metaConf := zkmeta.DefaultConfig()
 	metaConf.Refresh = Options.MetaRefresh
 	meta.Default = zkmeta.New(metaConf, this.zkzone)
 	this.accessLogger = NewAccessLogger("access_log", 100)
 	this.svrMetrics = NewServerMetrics(Options.ReporterInterval, this)
-	rc, err := influxdb.NewConfig(Options.InfluxServer, Options.InfluxDbName, "", "", Options.ReporterInterval)
-	if err != nil {
-		log.Error("telemetry: %v", err)
-	} else {
-		telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+	switch Options.Reporter {
+	case "influxdb":
+		rc, err := influxdb.NewConfig(Options.InfluxServer, Options.InfluxDbName, "", "", Options.ReporterInterval)
+		if err != nil {
+			log.Error("telemetry: %v", err)
+		} else {
+			telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+		}
+
+	case "prometheus":
+		rc, err := prometheus.NewConfig(Options.PrometheusAddr)
+		if err != nil {
+			log.Error("telemetry: %v", err)
+		} else {
+			telemetry.Default = prometheus.New(metrics.DefaultRegistry, rc)
+		}
+
+	default:
+		panic("invalid reporter: " + Options.Reporter)
 	}
 
 	// initialize the manager store
@@ -167,6 +199,31 @@ func New(id string) *Gateway {
 			panic("invalid job store")
 		}
 
+		// prepared messages share the job mysql cluster
+		switch Options.XaStore {
+		case "mysql":
+			var mcc = &config.ConfigMysql{}
+			b, err := this.zkzone.KatewayJobClusterConfig()
+			if err != nil {
+				panic(err)
+			}
+			if err = mcc.From(b); err != nil {
+				panic(err)
+			}
+			xm, err := xamysql.New(id, mcc)
+			if err != nil {
+				panic(fmt.Errorf("mysql xa: %v", err))
+			}
+
+			xa.Default = xm
+
+		case "dummy":
+			xa.Default = xadummy.New()
+
+		default:
+			panic("invalid xa store")
+		}
+
 		// always create hh so that we can turn on/off it online
 		switch Options.HintedHandoffType {
 		case "disk":
@@ -175,6 +232,17 @@ func New(id string) *Gateway {
 			}
 			cfg := hhdisk.DefaultConfig()
 			cfg.Dirs = strings.Split(Options.HintedHandoffDir, ",")
+			if Options.HintedHandoffRaftId > 0 && !Options.FlushHintedOffOnly {
+				peers, err := hhdisk.ParsePeers(Options.HintedHandoffRaftPeers)
+				if err != nil {
+					panic(err)
+				}
+
+				cfg.RaftId = Options.HintedHandoffRaftId
+				cfg.RaftAddr = Options.HintedHandoffRaftAddr
+				cfg.RaftPeers = peers
+				cfg.RaftSecret = Options.HintedHandoffRaftSecret
+			}
 			if err := cfg.Validate(); err != nil {
 				panic(err)
 			}
@@ -184,6 +252,17 @@ func New(id string) *Gateway {
 			}
 			hh.Default = hhdisk.New(cfg)
 
+		case "kafka":
+			cfg := hhkafka.DefaultConfig()
+			cfg.StandbyCluster = Options.HintedHandoffStandby
+			if err := cfg.Validate(); err != nil {
+				panic(err)
+			}
+			if Options.AuditPub {
+				hhkafka.Auditor = &this.pubServer.auditor
+			}
+			hh.Default = hhkafka.New(cfg)
+
 		case "dummy":
 			hh.Default = hhdummy.New()
 
@@ -219,6 +298,19 @@ func New(id string) *Gateway {
 			panic("invalid store")
 
 		}
+
+		switch Options.InflightStore {
+		case "disk":
+			cfg := inflightdisk.DefaultConfig()
+			cfg.Dir = Options.InflightDir
+			inflight.Default = inflightdisk.New(cfg)
+
+		case "mem":
+			inflight.Default = inflightmem.New("", Options.Debug)
+
+		default:
+			panic("invalid inflight store")
+		}
 	}
 
 	return this
@@ -309,6 +401,11 @@ func (this *Gateway) Start() (err error) {
 		}
 		log.Trace("job store[%s] started", job.Default.Name())
 
+		if err = xa.Default.Start(); err != nil {
+			panic(err)
+		}
+		log.Trace("xa store[%s] started", xa.Default.Name())
+
 		this.pubServer.Start()
 	}
 	if this.subServer != nil {
@@ -317,6 +414,11 @@ func (this *Gateway) Start() (err error) {
 		}
 		log.Trace("sub store[%s] started", store.DefaultSubStore.Name())
 
+		if err = inflight.Default.Init(); err != nil {
+			panic(err)
+		}
+		log.Trace("inflight store[%s] started", Options.InflightStore)
+
 		this.subServer.Start()
 	}
 
@@ -383,10 +485,21 @@ func (this *Gateway) ServeForever() {
 			log.Trace("sub store[%s] stop...", store.DefaultSubStore.Name())
 			store.DefaultSubStore.Stop()
 		}
+		if inflight.Default != nil {
+			if err := inflight.Default.Stop(); err != nil {
+				log.Error("inflight store[%s]: %v", Options.InflightStore, err)
+			} else {
+				log.Trace("inflight store[%s] stopped", Options.InflightStore)
+			}
+		}
 		if job.Default != nil {
 			job.Default.Stop()
 			log.Trace("job store[%s] stopped", job.Default.Name())
 		}
+		if xa.Default != nil {
+			xa.Default.Stop()
+			log.Trace("xa store[%s] stopped", xa.Default.Name())
+		}
 
 		log.Info("...waiting for services shutdown...")
 		this.wg.Wait()
@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/job"
@@ -18,6 +19,9 @@ import (
 // TODO tag, partitionKey
 // TODO use dedicated metrics
 func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
 	if !Options.DisableMetrics {
 		this.pubMetrics.JobTryQps.Mark(1)
 	}
@@ -98,6 +102,16 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 		return
 	}
 
+	if Options.EnableQuota {
+		if e := this.quotas.Take(quotaPub, appid, topic, 1, int64(msgLen)); e != nil {
+			log.Warn("+job[%s] %s(%s) {topic:%s, ver:%s} %s", appid, r.RemoteAddr, realIp, topic, ver, e)
+
+			this.pubMetrics.Throttled.Inc(1)
+			writeQuotaThrottled(w, e)
+			return
+		}
+	}
+
 	lbr := io.LimitReader(r.Body, Options.MaxJobSize+1)
 	msg := mpool.NewMessage(msgLen)
 	msg.Body = msg.Body[0:msgLen]
@@ -163,6 +177,9 @@ func (this *pubServer) addJobHandler(w http.ResponseWriter, r *http.Request, par
 
 // DELETE /v1/jobs/:topic/:ver?id=22323
 func (this *pubServer) deleteJobHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
 	appid := r.Header.Get(HttpHeaderAppid)
 	topic := params.ByName(UrlParamTopic)
 	ver := params.ByName(UrlParamVersion)
@@ -1,8 +1,11 @@
 package gateway
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -13,6 +16,7 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/avro"
 	"github.com/funkygao/gafka/cmd/kateway/hh"
 	"github.com/funkygao/gafka/cmd/kateway/job"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
@@ -54,6 +58,126 @@ func (this *manServer) schemaHandler(w http.ResponseWriter, r *http.Request, par
 	w.Write([]byte(strings.TrimSpace(schema)))
 }
 
+// @rest GET /v1/schemas/:appid/:topic
+func (this *manServer) schemaVersionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hisAppid := params.ByName(UrlParamAppid)
+	myAppid := r.Header.Get(HttpHeaderAppid)
+	topic := params.ByName(UrlParamTopic)
+	realIp := getHttpRemoteIp(r)
+
+	log.Info("schemas[%s] %s(%s) {app:%s topic:%s UA:%s}",
+		myAppid, r.RemoteAddr, realIp, hisAppid, topic, r.Header.Get("User-Agent"))
+
+	if _, found := manager.Default.LookupCluster(hisAppid); !found {
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	type schemaVersion struct {
+		Ver      string          `json:"ver"`
+		Enforced bool            `json:"enforced"`
+		Schema   json.RawMessage `json:"schema"`
+	}
+
+	versions := manager.Default.TopicSchemaVersions(hisAppid, topic)
+	out := make([]schemaVersion, 0, len(versions))
+	for _, ver := range sortedSchemaVersions(versions) {
+		out = append(out, schemaVersion{
+			Ver:      ver,
+			Enforced: manager.Default.SchemaEnforced(hisAppid, topic, ver),
+			Schema:   json.RawMessage(strings.TrimSpace(versions[ver])),
+		})
+	}
+
+	b, _ := json.Marshal(out)
+	w.Write(b)
+}
+
+// @rest POST /v1/schemas/:appid/:topic/:ver?compat=backward&enforce=1
+func (this *manServer) registerSchemaHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	hisAppid := params.ByName(UrlParamAppid)
+	myAppid := r.Header.Get(HttpHeaderAppid)
+	topic := params.ByName(UrlParamTopic)
+	ver := params.ByName(UrlParamVersion)
+	realIp := getHttpRemoteIp(r)
+
+	query := r.URL.Query()
+	compat := query.Get("compat")
+	if compat == "" {
+		compat = avro.CompatBackward
+	}
+	enforce := query.Get("enforce") == "1"
+
+	log.Info("schema+[%s] %s(%s) {app:%s topic:%s ver:%s compat:%s enforce:%v UA:%s}",
+		myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, compat, enforce, r.Header.Get("User-Agent"))
+
+	if myAppid != hisAppid {
+		writeAuthFailure(w, manager.ErrAuthenticationFail)
+		return
+	}
+	if err := manager.Default.OwnTopic(myAppid, r.Header.Get(HttpHeaderPubkey), topic); err != nil {
+		log.Warn("schema+[%s] %s(%s) {topic:%s ver:%s} %v", myAppid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	if !avro.ValidCompatibility(compat) {
+		writeBadRequest(w, "invalid compat")
+		return
+	}
+	if schemaVersionNo(ver) < 0 {
+		writeBadRequest(w, "invalid version")
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, Options.MaxPubSize))
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	r.Body.Close()
+
+	definition := new(bytes.Buffer)
+	if err = json.Compact(definition, body); err != nil {
+		writeBadRequest(w, "invalid json body")
+		return
+	}
+
+	schema, err := avro.Parse(definition.String())
+	if err != nil {
+		log.Warn("schema+[%s] %s(%s) {topic:%s ver:%s} %v", myAppid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	versions := manager.Default.TopicSchemaVersions(hisAppid, topic)
+	if old, present := versions[ver]; present {
+		// a registered version is immutable, only its enforcement can be toggled
+		oldDefinition := new(bytes.Buffer)
+		if json.Compact(oldDefinition, []byte(old)) != nil || oldDefinition.String() != definition.String() {
+			writeBadRequest(w, "schema version already registered")
+			return
+		}
+	} else if err = checkSchemaEvolution(compat, versions, ver, schema); err != nil {
+		log.Warn("schema+[%s] %s(%s) {topic:%s ver:%s} %v", myAppid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	if err = manager.Default.RegisterTopicSchema(hisAppid, topic, ver, definition.String(), enforce); err != nil {
+		log.Error("schema+[%s] %s(%s) {topic:%s ver:%s} %v", myAppid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(ResponseOk)
+}
+
 // @rest GET /v1/status
 func (this *manServer) statusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	log.Info("status %s(%s)", r.RemoteAddr, getHttpRemoteIp(r))
@@ -88,6 +212,24 @@ func (this *manServer) statusHandler(w http.ResponseWriter, r *http.Request, par
 	w.Write(b)
 }
 
+// @rest GET /v1/load
+// live load that ehaproxy derives backend weight from, keep it cheap
+func (this *manServer) loadHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	output := make(map[string]interface{})
+	output["goroutines"] = runtime.NumGoroutine()
+	if this.gw.pubServer != nil {
+		output["pubconn"] = atomic.LoadInt32(&this.gw.pubServer.activeConnN)
+		output["pubinflight"] = atomic.LoadInt32(&this.gw.pubServer.inflightN)
+		output["pub_latency_p95"] = this.gw.pubServer.pubMetrics.PubLatency.Percentile(0.95) // in ms
+	}
+	if this.gw.subServer != nil {
+		output["subconn"] = atomic.LoadInt32(&this.gw.subServer.activeConnN)
+	}
+
+	b, _ := json.Marshal(output)
+	w.Write(b)
+}
+
 // @rest GET /v1/clusters
 func (this *manServer) clustersHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	log.Info("clusters %s(%s)", r.RemoteAddr, getHttpRemoteIp(r))
@@ -126,6 +268,9 @@ func (this *manServer) setOptionHandler(w http.ResponseWriter, r *http.Request,
 	case "ratelimit":
 		Options.Ratelimit = boolVal
 
+	case "quota":
+		Options.EnableQuota = boolVal
+
 	case "resethh":
 		hh.Default.ResetCounters()
 
@@ -596,46 +741,21 @@ func (this *manServer) createTopicHandler(w http.ResponseWriter, r *http.Request
 		appid, r.RemoteAddr, realIp, hisAppid, cluster, topic, ver, query.Encode())
 
 	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
-	lines, err := zkcluster.AddTopic(rawTopic, ts)
-	if err != nil {
+	if err := zkcluster.AddTopic(rawTopic, ts); err != nil {
 		log.Error("app[%s] %s(%s) create topic[%s]: %s", appid, r.RemoteAddr, realIp, rawTopic, err.Error())
 
-		writeServerError(w, err.Error())
-		return
-	}
-
-	createdOk := false
-	for _, l := range lines {
-		log.Trace("app[%s] %s(%s) create topic[%s] in cluster %s: %s", appid, r.RemoteAddr, realIp, rawTopic, cluster, l)
-
-		if strings.Contains(l, "Created topic") {
-			createdOk = true
-		}
-	}
-
-	if createdOk {
-		alterConfig := ts.DumpForAlterTopic()
-		if len(alterConfig) == 0 {
-			w.Write(ResponseOk)
-			return
-		}
-
-		lines, err = zkcluster.AlterTopic(rawTopic, ts)
-		if err != nil {
-			log.Error("app[%s] %s(%s) alter topic[%s]: %s", appid, r.RemoteAddr, realIp, rawTopic, err.Error())
-
+		if zk.IsTopicError(err, zk.ErrTopicExists) || zk.IsTopicError(err, zk.ErrInvalidTopicName) ||
+			zk.IsTopicError(err, zk.ErrNotEnoughBrokers) || zk.IsTopicError(err, zk.ErrMinIsrExceedsReplicas) {
+			writeBadRequest(w, err.Error())
+		} else {
 			writeServerError(w, err.Error())
-			return
 		}
+		return
+	}
 
-		for _, l := range lines {
-			log.Trace("app[%s] %s(%s) alter topic[%s] in cluster %s: %s", appid, r.RemoteAddr, realIp, rawTopic, cluster, l)
-		}
+	log.Trace("app[%s] %s(%s) created topic[%s] in cluster %s", appid, r.RemoteAddr, realIp, rawTopic, cluster)
 
-		w.Write(ResponseOk)
-	} else {
-		writeServerError(w, strings.Join(lines, ";"))
-	}
+	w.Write(ResponseOk)
 }
 
 // @rest PUT /v1/topics/:appid/:topic/:ver?partitions=1&retention.hours=72&retention.bytes=-1
@@ -724,18 +844,20 @@ func (this *manServer) alterTopicHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	lines, err := zkcluster.AlterTopic(rawTopic, ts)
-	if err != nil {
+	if err := zkcluster.AlterTopic(rawTopic, ts); err != nil {
 		log.Error("app[%s] from %s(%s) alter topic: {appid:%s cluster:%s topic:%s ver:%s query:%s} %v",
 			appid, r.RemoteAddr, realIp, hisAppid, cluster, topic, ver, query.Encode(), err)
 
-		writeServerError(w, err.Error())
+		if zk.IsTopicError(err, zk.ErrTopicNotFound) || zk.IsTopicError(err, zk.ErrPartitionsNotIncreased) ||
+			zk.IsTopicError(err, zk.ErrMinIsrExceedsReplicas) {
+			writeBadRequest(w, err.Error())
+		} else {
+			writeServerError(w, err.Error())
+		}
 		return
 	}
 
-	for _, l := range lines {
-		log.Trace("app[%s] alter topic[%s] in cluster %s: %s", appid, rawTopic, cluster, l)
-	}
+	log.Trace("app[%s] altered topic[%s] in cluster %s", appid, rawTopic, cluster)
 
 	w.Write(ResponseOk)
 }
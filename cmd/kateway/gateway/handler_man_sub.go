@@ -4,14 +4,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/meta"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/sla"
+	gzk "github.com/funkygao/gafka/zk"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
 	"github.com/samuel/go-zookeeper/zk"
@@ -328,6 +329,8 @@ LOOP:
 }
 
 // @rest PUT /v1/offset/:appid/:topic/:ver/:group/:partition?offset=xx
+// @rest PUT /v1/offset/:appid/:topic/:ver/:group/:partition?ts=2026-10-01T08:00
+// ts rewinds the group to the first message published at or after the time, partition -1 means all partitions
 func (this *manServer) resetSubOffsetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	var (
 		topic     string
@@ -337,6 +340,8 @@ func (this *manServer) resetSubOffsetHandler(w http.ResponseWriter, r *http.Requ
 		hisAppid  string
 		offset    string
 		offsetN   int64
+		ts        string
+		tsTime    time.Time
 		group     string
 		err       error
 		realIp    = getHttpRemoteIp(r)
@@ -347,7 +352,9 @@ func (this *manServer) resetSubOffsetHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	offset = r.URL.Query().Get("offset")
+	query := r.URL.Query()
+	offset = query.Get("offset")
+	ts = query.Get("ts")
 	group = params.ByName(UrlParamGroup)
 	partition = params.ByName("partition")
 	ver = params.ByName(UrlParamVersion)
@@ -355,26 +362,37 @@ func (this *manServer) resetSubOffsetHandler(w http.ResponseWriter, r *http.Requ
 	hisAppid = params.ByName(UrlParamAppid)
 	myAppid = r.Header.Get(HttpHeaderAppid)
 
-	offsetN, err = strconv.ParseInt(offset, 10, 64)
-	if err != nil {
-		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} %v",
-			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, err)
+	if ts != "" {
+		tsTime, err = gzk.ParseOffsetTime(ts)
+		if err != nil {
+			log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s ts:%s} %v",
+				myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, ts, err)
 
-		writeBadRequest(w, err.Error())
-		return
-	}
-	if offsetN < 0 {
-		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} negative offset",
-			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset)
+			writeBadRequest(w, err.Error())
+			return
+		}
+	} else {
+		offsetN, err = strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} %v",
+				myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, err)
 
-		writeBadRequest(w, "offset must be positive")
-		return
+			writeBadRequest(w, err.Error())
+			return
+		}
+		if offsetN < 0 {
+			log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} negative offset",
+				myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset)
+
+			writeBadRequest(w, "offset must be positive")
+			return
+		}
 	}
 
 	if err = manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
 		hisAppid, topic, group); err != nil {
-		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} %v",
-			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, err)
+		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s ts:%s} %v",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, ts, err)
 
 		writeAuthFailure(w, err)
 		return
@@ -382,29 +400,144 @@ func (this *manServer) resetSubOffsetHandler(w http.ResponseWriter, r *http.Requ
 
 	cluster, found := manager.Default.LookupCluster(hisAppid)
 	if !found {
-		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} cluster not found",
-			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset)
+		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s ts:%s} cluster not found",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, ts)
 
 		writeBadRequest(w, "invalid appid")
 		return
 	}
 
-	log.Info("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s}",
-		myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset)
+	log.Info("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s ts:%s}",
+		myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, ts)
 
 	// TODO stop all consumers of this group
 	zkcluster := meta.Default.ZkCluster(cluster)
 	realGroup := myAppid + "." + group
 	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
-	err = zkcluster.ResetConsumerGroupOffset(rawTopic, realGroup, partition, offsetN)
+	if ts == "" {
+		err = zkcluster.ResetConsumerGroupOffset(rawTopic, realGroup, partition, offsetN)
+		if err != nil {
+			log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} %v",
+				myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+
+		w.Write(ResponseOk)
+		return
+	}
+
+	offsets, err := zkcluster.OffsetsAtTime(rawTopic, tsTime, envelope.MessageTime)
 	if err != nil {
-		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s offset:%s} %v",
-			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, offset, err)
+		log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s ts:%s} %v",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, partition, group, ts, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
+
+	out := make(map[string]int64, len(offsets))
+	for p, o := range offsets {
+		pid := strconv.Itoa(int(p))
+		if partition != "-1" && partition != pid {
+			continue
+		}
+
+		if err = zkcluster.ResetConsumerGroupOffset(rawTopic, realGroup, pid, o); err != nil {
+			log.Error("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s partition:%s group:%s ts:%s} %v",
+				myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, pid, group, ts, err)
+
+			writeServerError(w, err.Error())
+			return
+		}
+
+		out[pid] = o
+	}
+
+	if len(out) == 0 {
+		writeBadRequest(w, "invalid partition")
+		return
+	}
+
+	log.Info("sub reset offset[%s] %s(%s) {app:%s topic:%s ver:%s group:%s ts:%s} %+v",
+		myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group, ts, out)
+
+	b, _ := json.Marshal(out)
+	w.Write(b)
+}
+
+// @rest POST /v1/groups/:appid/:topic/:ver/:group with json body {"filter":"tag=order;region in (bj,sh)"}
+// the filter makes kateway skip unmatched messages for the group, empty filter removes it
+func (this *manServer) addSubGroupHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic    string
+		ver      string
+		myAppid  string
+		hisAppid string
+		group    string
+		err      error
+	)
+
+	group = params.ByName(UrlParamGroup)
+	ver = params.ByName(UrlParamVersion)
+	topic = params.ByName(UrlParamTopic)
+	hisAppid = params.ByName(UrlParamAppid)
+	myAppid = r.Header.Get(HttpHeaderAppid)
+	realIp := getHttpRemoteIp(r)
+
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		log.Warn("sub+[%s/%s] %s(%s) %s.%s.%s illegal group name", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver)
+
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	if err = manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
+		hisAppid, topic, group); err != nil {
+		log.Error("sub+[%s/%s] %s(%s) %s.%s.%s %v", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	var req struct {
+		Filter string `json:"filter"`
+	}
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, "invalid json body")
+			return
+		}
+		r.Body.Close()
+	}
+
+	if req.Filter != "" {
+		if _, err = parseSubFilter(req.Filter); err != nil {
+			log.Warn("sub+[%s/%s] %s(%s) %s.%s.%s {%s} %v",
+				myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, req.Filter, err)
+
+			writeBadRequest(w, "illegal filter: "+err.Error())
+			return
+		}
+	}
+
+	log.Info("sub+[%s/%s] %s(%s) %s.%s.%s filter:%s", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, req.Filter)
+
+	realGroup := myAppid + "." + group
+	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
+	if err = this.gw.zkzone.CreateOrUpdateSubFilter(realGroup, rawTopic, req.Filter); err != nil {
+		log.Error("sub+[%s/%s] %s(%s) %s.%s.%s %v", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, err)
 
 		writeServerError(w, err.Error())
 		return
 	}
 
+	if this.gw.subServer != nil {
+		this.gw.subServer.filters.Invalidate(realGroup)
+	}
+
+	w.WriteHeader(http.StatusCreated)
 	w.Write(ResponseOk)
 }
 
@@ -473,6 +606,14 @@ func (this *manServer) delSubGroupHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := zkcluster.ZkZone().DeleteSubFilters(group); err != nil {
+		log.Error("unsub[%s] %s(%s) {app:%s, topic:%s, ver:%s, group:%s} filters: %v",
+			myAppid, r.RemoteAddr, realIp, hisAppid, topic, ver, group, err)
+	}
+	if this.gw.subServer != nil {
+		this.gw.subServer.filters.Invalidate(group)
+	}
+
 	w.Write(ResponseOk)
 }
 
@@ -532,30 +673,13 @@ func (this *manServer) addTopicShadowHandler(w http.ResponseWriter, r *http.Requ
 		manager.Default.ShadowTopic(sla.SlaKeyDeadLetterTopic, myAppid, hisAppid, topic, ver, group),
 	}
 	for _, t := range shadowTopics {
-		lines, err := zkcluster.AddTopic(t, ts)
-		if err != nil {
+		if err := zkcluster.AddTopic(t, ts); err != nil {
 			log.Error("shadow+ [%s/%s] %s(%s) %s.%s.%s %s: %s", myAppid, group, r.RemoteAddr, realIp,
 				hisAppid, topic, ver, t, err.Error())
 
 			writeServerError(w, err.Error())
 			return
 		}
-
-		ok := false
-		for _, l := range lines {
-			if strings.Contains(l, "Created topic") {
-				ok = true
-				break
-			}
-		}
-
-		if !ok {
-			log.Error("shadow+ [%s/%s] %s(%s) %s.%s.%s %s: %s", myAppid, group, r.RemoteAddr, realIp,
-				hisAppid, topic, ver, t, strings.Join(lines, ";"))
-
-			writeServerError(w, strings.Join(lines, ";"))
-			return
-		}
 	}
 
 	w.WriteHeader(http.StatusCreated)
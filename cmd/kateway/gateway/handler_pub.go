@@ -6,8 +6,10 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/cmd/kateway/hh"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
@@ -30,6 +32,9 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		t1           = time.Now()
 	)
 
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
 	if !Options.DisableMetrics {
 		this.pubMetrics.PubTryQps.Mark(1)
 	}
@@ -75,6 +80,17 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
+	if Options.EnableQuota {
+		if e := this.quotas.Take(quotaPub, appid, topic, 1, int64(msgLen)); e != nil {
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} %s",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), e)
+
+			this.pubMetrics.Throttled.Inc(1)
+			writeQuotaThrottled(w, e)
+			return
+		}
+	}
+
 	query := r.URL.Query() // reuse the query will save 100ns
 
 	partitionKey = query.Get("key")
@@ -95,7 +111,14 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 			this.respond4XX(appid, w, "too big tag", http.StatusBadRequest)
 			return
 		}
+		if !envelope.ValidHeaders(tagHeaders(tag)) {
+			this.respond4XX(appid, w, "illegal tag", http.StatusBadRequest)
+			return
+		}
+	}
 
+	enveloped := tag != "" || Options.PubTimestamp
+	if enveloped {
 		msgSz := tagLen(tag) + msgLen
 		msg = mpool.NewMessage(msgSz)
 		msg.Body = msg.Body[0:msgSz]
@@ -117,7 +140,20 @@ func (this *pubServer) pubHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
-	if tag != "" {
+	if manager.Default.SchemaEnforced(appid, topic, ver) {
+		if err := this.schemas.Validate(appid, topic, ver, msg.Body[:msgLen]); err != nil {
+			msg.Free()
+
+			log.Warn("pub[%s] %s(%s) {topic:%s ver:%s UA:%s} schema: %v",
+				appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), err)
+
+			this.pubMetrics.ClientError.Inc(1)
+			this.respond4XX(appid, w, "schema validation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if enveloped {
 		AddTagToMessage(msg, tag)
 	}
 
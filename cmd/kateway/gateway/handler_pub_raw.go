@@ -5,6 +5,7 @@ package gateway
 import (
 	"bytes"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/store"
@@ -15,6 +16,9 @@ import (
 //go:generate goannotation $GOFILE
 // @rest POST /v1/raw/msgs/:cluster/:topic?key=mykey&async=1&ack=all
 func (this *pubServer) pubRawHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
 	var (
 		cluster      string
 		topic        string
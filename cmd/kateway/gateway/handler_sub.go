@@ -4,9 +4,12 @@ import (
 	"compress/gzip"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/sla"
@@ -94,11 +97,23 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 		return
 	}
 
+	// consumed bytes are unknown in advance, admit only if the quotas are not in debt
+	if Options.EnableQuota {
+		if e := this.quotas.Take(quotaSub, myAppid, topic, 0, 0); e != nil {
+			log.Warn("sub[%s/%s] -(%s): {%s.%s.%s UA:%s} %s",
+				myAppid, group, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), e)
+
+			this.subMetrics.Throttled.Inc(1)
+			writeQuotaThrottled(w, e)
+			return
+		}
+	}
+
 	// fetch the client ack partition and offset
 	delayedAck = query.Get("ack") == "1"
 	if delayedAck {
 		// consumers use explicit acknowledges in order to signal a message as processed successfully
-		// if consumers fail to ACK, the message hangs and server will refuse to move ahead
+		// if consumers fail to ACK within visibility timeout, the message will be redelivered
 
 		// get the partitionN and offsetN from client header
 		// client will ack with partition=-1, offset=-1:
@@ -222,11 +237,24 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 			log.Debug("sub land[%s/%s] %s(%s) {T:%s/%s, O:%s}",
 				myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset)
 		}
+
+		// the message might have been redelivered to and acked by another consumer
+		if err = inflight.Default.Land(cluster, rawTopic, realGroup, partition, offsetN); err != nil {
+			log.Debug("sub land[%s/%s] %s(%s) {T:%s/%s, O:%s} %v",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset, err)
+		}
 	}
 
 	var gz *gzip.Writer
 	w, gz = gzipWriter(w, r)
-	err = this.pumpMessages(w, r, realIp, fetcher, limit, myAppid, hisAppid, topic, ver, group, delayedAck)
+	// shadow queues are fed with already filtered messages
+	var filter *subFilter
+	if shadow == "" {
+		filter = this.filters.Get(realGroup, rawTopic)
+	}
+
+	err = this.pumpMessages(w, r, realIp, fetcher, limit, cluster, rawTopic, shadow,
+		myAppid, hisAppid, topic, ver, group, delayedAck, filter)
 	if err != nil {
 		// e,g. broken pipe, io timeout, client gone
 		// e,g. kafka: error while consuming app1.foobar.v1/0: EOF (kafka was shutdown)
@@ -278,7 +306,8 @@ func (this *subServer) subHandler(w http.ResponseWriter, r *http.Request, params
 }
 
 func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, realIp string,
-	fetcher store.Fetcher, limit int, myAppid, hisAppid, topic, ver, group string, delayedAck bool) error {
+	fetcher store.Fetcher, limit int, cluster, rawTopic, shadow string,
+	myAppid, hisAppid, topic, ver, group string, delayedAck bool, filter *subFilter) error {
 	cn, ok := w.(http.CloseNotifier)
 	if !ok {
 		return ErrBadResponseWriter
@@ -292,8 +321,86 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 		tagConditions        = make(map[string]struct{})
 		clientGoneCh         = cn.CloseNotify()
 		startedAt            = time.Now()
+		realGroup            = myAppid + "." + group
 	)
 
+	writeMessage := func(partition int32, offset int64, key, body []byte) (err error) {
+		if limit == 1 {
+			// non-batch mode, just the message itself without meta
+			w.Header().Set("Content-Type", "text/plain; charset=utf8") // override middleware header
+			w.Header().Set(HttpHeaderMsgKey, string(key))
+			w.Header().Set(HttpHeaderPartition, strconv.FormatInt(int64(partition), 10))
+			w.Header().Set(HttpHeaderOffset, strconv.FormatInt(offset, 10))
+
+			// when remote close silently, the write still ok
+			_, err = w.Write(body)
+			return
+		}
+
+		// batch mode, write MessageSet
+		// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
+		if metaBuf == nil {
+			// initialize the reuseable buffer
+			metaBuf = make([]byte, 8)
+
+			// override the middleware added header
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+
+		if err = writeI32(w, metaBuf, partition); err != nil {
+			return
+		}
+		if err = writeI64(w, metaBuf, offset); err != nil {
+			return
+		}
+		if err = writeI32(w, metaBuf, int32(len(body))); err != nil {
+			return
+		}
+		_, err = w.Write(body)
+		return
+	}
+
+	if delayedAck {
+		// messages whose visibility timeout expired go before new messages
+		msgs, err := this.redeliver(cluster, rawTopic, shadow, myAppid, hisAppid, topic, ver, group, limit)
+		if err != nil {
+			log.Error("sub[%s/%s] %s(%s) redeliver %s: %v", myAppid, group, r.RemoteAddr, realIp, rawTopic, err)
+		}
+
+		for _, m := range msgs {
+			partitionN, _ := strconv.Atoi(m.Partition)
+			bodyIdx := 0
+			if IsTaggedMessage(m.Value) {
+				var tags []string
+				tags, bodyIdx, _ = ExtractMessageTag(m.Value)
+				if limit == 1 && len(tags) > 0 {
+					w.Header().Set(HttpHeaderMsgTag, strings.Join(tags, TagSeperator))
+				}
+			}
+
+			if err = writeMessage(int32(partitionN), m.Offset, m.Key, m.Value[bodyIdx:]); err != nil {
+				return err
+			}
+
+			log.Debug("sub[%s/%s] %s(%s) redeliver {%s/%s O:%d #%d}",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, m.Partition, m.Offset, m.Deliveries)
+
+			this.subMetrics.ConsumeOk(myAppid, topic, ver)
+			this.subMetrics.ConsumedOk(hisAppid, topic, ver)
+
+			n++
+			if n >= limit || this.chargeQuota(myAppid, topic, len(m.Value)-bodyIdx) {
+				return nil
+			}
+		}
+
+		if n > 0 {
+			w.(http.Flusher).Flush()
+			chunkedEver = true
+			idleTimeout = time.Second
+		}
+	}
+
 	// parse http tag header as filter condition
 	if tagFilter := r.Header.Get(HttpHeaderMsgTag); tagFilter != "" {
 		for _, t := range parseMessageTag(tagFilter) {
@@ -304,7 +411,7 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 	}
 
 	for {
-		if len(tagConditions) > 0 && time.Since(startedAt) > idleTimeout {
+		if (len(tagConditions) > 0 || filter != nil) && time.Since(startedAt) > idleTimeout {
 			// e,g. tag filter got 1000 msgs, but no tag hit after timeout, we'll return 204
 			if chunkedEver {
 				return nil
@@ -361,28 +468,32 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 					myAppid, group, r.RemoteAddr, realIp, msg.Topic, msg.Partition, msg.Offset, delayedAck)
 			}
 
-			partition := strconv.FormatInt(int64(msg.Partition), 10)
-
-			if limit == 1 {
-				w.Header().Set("Content-Type", "text/plain; charset=utf8") // override middleware header
-				w.Header().Set(HttpHeaderMsgKey, string(msg.Key))
-				w.Header().Set(HttpHeaderPartition, partition)
-				w.Header().Set(HttpHeaderOffset, strconv.FormatInt(msg.Offset, 10))
-			}
-
 			var (
+				headers []envelope.Header
 				tags    []string
 				bodyIdx int
 				err     error
 			)
 			if IsTaggedMessage(msg.Value) {
-				tags, bodyIdx, err = ExtractMessageTag(msg.Value)
+				headers, bodyIdx, err = ExtractMessageHeaders(msg.Value)
 				if err != nil {
 					// always move offset cursor ahead, otherwise will be blocked forever
 					fetcher.CommitUpto(msg)
 
 					return err
 				}
+				tags = headerTags(headers)
+			}
+
+			// skip the messages unmatched with group filter, and always move offset cursor
+			// ahead so that consumer lag stays correct
+			// with delayed ack, this is safe because delivered messages are kept inflight
+			if filter != nil && !filter.match(headers) {
+				log.Debug("sub auto commit offset with filter unmatched %s(%s) {G:%s, T:%s/%d, O:%d} %s/%+v",
+					r.RemoteAddr, realIp, group, msg.Topic, msg.Partition, msg.Offset, filter, tags)
+
+				fetcher.CommitUpto(msg)
+				continue
 			}
 
 			// assert tag conditions are satisfied. if empty, feed all messages
@@ -407,35 +518,22 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 				}
 			}
 
-			if limit == 1 {
-				// non-batch mode, just the message itself without meta
-				if _, err = w.Write(msg.Value[bodyIdx:]); err != nil {
-					// when remote close silently, the write still ok
+			if delayedAck {
+				// invisible to the group until acked or visibility timeout
+				if err = inflight.Default.TakeOff(cluster, rawTopic, realGroup,
+					strconv.FormatInt(int64(msg.Partition), 10), msg.Offset,
+					msg.Key, msg.Value, time.Now().Add(Options.VisibilityTimeout)); err != nil {
 					return err
 				}
-			} else {
-				// batch mode, write MessageSet
-				// MessageSet => [Partition(int32) Offset(int64) MessageSize(int32) Message] BigEndian
-				if metaBuf == nil {
-					// initialize the reuseable buffer
-					metaBuf = make([]byte, 8)
-
-					// override the middleware added header
-					w.Header().Set("Content-Type", "application/octet-stream")
-				}
+			}
 
-				if err = writeI32(w, metaBuf, msg.Partition); err != nil {
-					return err
-				}
-				if err = writeI64(w, metaBuf, msg.Offset); err != nil {
-					return err
-				}
-				if err = writeI32(w, metaBuf, int32(len(msg.Value[bodyIdx:]))); err != nil {
-					return err
-				}
-				if _, err = w.Write(msg.Value[bodyIdx:]); err != nil {
-					return err
-				}
+			if limit == 1 && len(tags) > 0 {
+				// expose the envelope headers
+				w.Header().Set(HttpHeaderMsgTag, strings.Join(tags, TagSeperator))
+			}
+
+			if err = writeMessage(msg.Partition, msg.Offset, msg.Key, msg.Value[bodyIdx:]); err != nil {
+				return err
 			}
 
 			if !delayedAck {
@@ -463,7 +561,7 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 			this.subMetrics.ConsumedOk(hisAppid, topic, ver)
 
 			n++
-			if n >= limit {
+			if n >= limit || this.chargeQuota(myAppid, topic, len(msg.Value)-bodyIdx) {
 				return nil
 			}
 
@@ -482,3 +580,14 @@ func (this *subServer) pumpMessages(w http.ResponseWriter, r *http.Request, real
 		}
 	}
 }
+
+// chargeQuota charges a delivered message to the sub quotas of myAppid and
+// tells whether the quotas are used up so that the batch should end early.
+func (this *subServer) chargeQuota(myAppid, topic string, bytes int) (exhausted bool) {
+	if !Options.EnableQuota {
+		return false
+	}
+
+	this.quotas.Charge(quotaSub, myAppid, topic, 1, int64(bytes))
+	return this.quotas.Take(quotaSub, myAppid, topic, 0, 0) != nil
+}
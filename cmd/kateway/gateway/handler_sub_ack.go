@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strconv"
 	"sync/atomic"
 
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/mpool"
 	"github.com/funkygao/httprouter"
@@ -92,6 +94,9 @@ func (this *subServer) ackHandler(w http.ResponseWriter, r *http.Request, params
 		acks[i].cluster = cluster
 		acks[i].topic = rawTopic
 		acks[i].group = realGroup
+
+		// acked messages are done with visibility timeout
+		inflight.Default.Land(cluster, rawTopic, realGroup, strconv.Itoa(acks[i].Partition), acks[i].Offset)
 	}
 
 	log.Debug("ack[%s/%s] %s(%s) {%s.%s.%s UA:%s} %+v",
@@ -166,6 +171,9 @@ func (this *subServer) ackRawHandler(w http.ResponseWriter, r *http.Request, par
 		acks[i].cluster = cluster
 		acks[i].topic = topic
 		acks[i].group = realGroup
+
+		// acked messages are done with visibility timeout
+		inflight.Default.Land(cluster, topic, realGroup, strconv.Itoa(acks[i].Partition), acks[i].Offset)
 	}
 
 	log.Debug("ack raw[%s/%s] %s(%s) {%s/%s UA:%s} %+v",
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/gafka/sla"
@@ -171,5 +172,8 @@ func (this *subServer) buryHandler(w http.ResponseWriter, r *http.Request, param
 		return
 	}
 
+	// step3: buried message is done with visibility timeout
+	inflight.Default.Land(cluster, rawTopic, myAppid+"."+group, partition, offsetN)
+
 	w.Write(ResponseOk)
 }
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/sla"
+	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
+)
+
+//go:generate goannotation $GOFILE
+// @rest PUT /v1/visibility/:appid/:topic/:ver?group=xx&q=<dead|retry>&timeout=30s
+// timeout=0 makes the inflight message visible for redelivery immediately
+func (this *subServer) visibilityHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var (
+		topic      string
+		ver        string
+		myAppid    string
+		hisAppid   string
+		group      string
+		rawTopic   string
+		shadow     string
+		partition  string
+		partitionN int = -1
+		offset     string
+		offsetN    int64 = -1
+		timeout    time.Duration
+		err        error
+	)
+
+	query := r.URL.Query()
+	group = query.Get("group")
+	if !manager.Default.ValidateGroupName(r.Header, group) {
+		writeBadRequest(w, "illegal group")
+		return
+	}
+
+	ver = params.ByName(UrlParamVersion)
+	topic = params.ByName(UrlParamTopic)
+	hisAppid = params.ByName(UrlParamAppid)
+	myAppid = r.Header.Get(HttpHeaderAppid)
+	realIp := getHttpRemoteIp(r)
+
+	// auth
+	if err = manager.Default.AuthSub(myAppid, r.Header.Get(HttpHeaderSubkey),
+		hisAppid, topic, group); err != nil {
+		log.Error("visibility[%s/%s] %s(%s) {%s.%s.%s UA:%s} %v",
+			myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	timeout, err = time.ParseDuration(query.Get("timeout"))
+	if err != nil || timeout < 0 || timeout > MaxVisibilityTimeout {
+		log.Error("visibility[%s/%s] %s(%s) {%s.%s.%s UA:%s} illegal timeout:%s",
+			myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), query.Get("timeout"))
+
+		writeBadRequest(w, "illegal timeout")
+		return
+	}
+
+	partition = r.Header.Get(HttpHeaderPartition)
+	offset = r.Header.Get(HttpHeaderOffset)
+	offsetN, err = strconv.ParseInt(offset, 10, 64)
+	if err != nil || offsetN < 0 {
+		log.Error("visibility[%s/%s] %s(%s) {%s.%s.%s UA:%s} illegal offset:%s",
+			myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), offset)
+
+		writeBadRequest(w, "bad offset")
+		return
+	}
+	partitionN, err = strconv.Atoi(partition)
+	if err != nil || partitionN < 0 {
+		log.Error("visibility[%s/%s] %s(%s) {%s.%s.%s UA:%s} illegal partition:%s",
+			myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, r.Header.Get("User-Agent"), partition)
+
+		writeBadRequest(w, "bad partition")
+		return
+	}
+
+	cluster, found := manager.Default.LookupCluster(hisAppid)
+	if !found {
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	shadow = query.Get("q")
+	if shadow != "" {
+		if !sla.ValidateShadowName(shadow) {
+			writeBadRequest(w, "invalid shadow name")
+			return
+		}
+
+		rawTopic = manager.Default.ShadowTopic(shadow, myAppid, hisAppid, topic, ver, group)
+	} else {
+		rawTopic = manager.Default.KafkaTopic(hisAppid, topic, ver)
+	}
+
+	log.Debug("visibility[%s/%s] %s(%s) {%s P:%s O:%s timeout:%s UA:%s}",
+		myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset, timeout, r.Header.Get("User-Agent"))
+
+	if err = inflight.Default.Touch(cluster, rawTopic, myAppid+"."+group, partition, offsetN,
+		time.Now().Add(timeout)); err != nil {
+		if err == inflight.ErrNotInflight {
+			// already acked, or redelivered and acked by another consumer
+			writeBadRequest(w, err.Error())
+		} else {
+			log.Error("visibility[%s/%s] %s(%s) {%s P:%s O:%s} %v",
+				myAppid, group, r.RemoteAddr, realIp, rawTopic, partition, offset, err)
+
+			writeServerError(w, err.Error())
+		}
+		return
+	}
+
+	w.Write(ResponseOk)
+}
+
+// redeliver takes off again the inflight messages of a group whose visibility timeout expired.
+// Messages delivered more than Options.MaxRedeliveries times are buried into the dead letter
+// queue if the group has shadow queues.
+func (this *subServer) redeliver(cluster, rawTopic, shadow, myAppid, hisAppid, topic, ver, group string,
+	limit int) ([]inflight.Message, error) {
+	realGroup := myAppid + "." + group
+	msgs, err := inflight.Default.Redeliver(cluster, rawTopic, realGroup, limit,
+		time.Now().Add(Options.VisibilityTimeout))
+	if err != nil || len(msgs) == 0 || Options.MaxRedeliveries <= 0 || shadow == sla.SlaKeyDeadLetterTopic {
+		return msgs, err
+	}
+
+	if !manager.Default.IsShadowedTopic(hisAppid, topic, ver, myAppid, group) {
+		return msgs, nil
+	}
+
+	deadTopic := manager.Default.ShadowTopic(sla.SlaKeyDeadLetterTopic, myAppid, hisAppid, topic, ver, group)
+	alive := msgs[:0]
+	for _, m := range msgs {
+		if m.Deliveries <= Options.MaxRedeliveries {
+			alive = append(alive, m)
+			continue
+		}
+
+		if _, _, err = store.DefaultPubStore.SyncPub(cluster, deadTopic, m.Key, m.Value); err != nil {
+			// deliver it anyway, will bury it on next redelivery
+			log.Error("redeliver[%s] {%s/%s O:%d} bury %s: %v", realGroup, rawTopic, m.Partition, m.Offset, deadTopic, err)
+
+			alive = append(alive, m)
+			continue
+		}
+
+		log.Warn("redeliver[%s] {%s/%s O:%d} delivered %d times, buried to %s",
+			realGroup, rawTopic, m.Partition, m.Offset, m.Deliveries-1, deadTopic)
+
+		inflight.Default.Land(cluster, rawTopic, realGroup, m.Partition, m.Offset)
+	}
+
+	return alive, nil
+}
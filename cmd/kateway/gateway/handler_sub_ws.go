@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/cmd/kateway/store"
 	"github.com/funkygao/httprouter"
@@ -66,6 +67,16 @@ func (this *subServer) subWsHandler(w http.ResponseWriter, r *http.Request, para
 
 	log.Debug("sub[%s] %s: %+v", myAppid, r.RemoteAddr, params)
 
+	if Options.EnableQuota {
+		if e := this.quotas.Take(quotaSub, myAppid, topic, 0, 0); e != nil {
+			log.Warn("sub[%s/%s] %s(%s) {%s.%s.%s} %s", myAppid, group, r.RemoteAddr, realIp, hisAppid, topic, ver, e)
+
+			this.subMetrics.Throttled.Inc(1)
+			writeWsError(ws, e.Error())
+			return
+		}
+	}
+
 	rawTopic := manager.Default.KafkaTopic(hisAppid, topic, ver)
 	cluster, found := manager.Default.LookupCluster(hisAppid)
 	if !found {
@@ -95,7 +106,7 @@ func (this *subServer) subWsHandler(w http.ResponseWriter, r *http.Request, para
 	//
 
 	clientGone := make(chan struct{})
-	go this.wsWritePump(clientGone, ws, fetcher)
+	go this.wsWritePump(clientGone, ws, fetcher, myAppid+"."+group, rawTopic, myAppid, topic)
 	this.wsReadPump(clientGone, ws)
 
 	return
@@ -128,17 +139,38 @@ func (this *subServer) wsReadPump(clientGone chan struct{}, ws *websocket.Conn)
 	}
 }
 
-func (this *subServer) wsWritePump(clientGone chan struct{}, ws *websocket.Conn, fetcher store.Fetcher) {
+func (this *subServer) wsWritePump(clientGone chan struct{}, ws *websocket.Conn, fetcher store.Fetcher,
+	realGroup, rawTopic, myAppid, topic string) {
 	defer fetcher.Close()
 
-	var err error
+	var (
+		err      error
+		messages = fetcher.Messages()
+		resume   <-chan time.Time // set while throttled by quota
+	)
 	for {
 		select {
-		case msg := <-fetcher.Messages():
+		case msg := <-messages:
+			// skip the messages unmatched with group filter, and always move offset cursor
+			// ahead so that consumer lag stays correct
+			if filter := this.filters.Get(realGroup, rawTopic); filter != nil {
+				var headers []envelope.Header
+				if IsTaggedMessage(msg.Value) {
+					headers, _, _ = ExtractMessageHeaders(msg.Value)
+				}
+				if !filter.match(headers) {
+					if err = fetcher.CommitUpto(msg); err != nil {
+						log.Error(err)
+					}
+					continue
+				}
+			}
+
+			body := messageBody(msg.Value)
 			ws.SetWriteDeadline(time.Now().Add(time.Second * 10))
 			// FIXME because of buffer, client recv 10, but kateway written 100, then
 			// client quit...
-			if err = ws.WriteMessage(websocket.BinaryMessage, msg.Value); err != nil {
+			if err = ws.WriteMessage(websocket.BinaryMessage, body); err != nil {
 				log.Error("%s: %v", ws.RemoteAddr(), err)
 				return
 			}
@@ -147,6 +179,18 @@ func (this *subServer) wsWritePump(clientGone chan struct{}, ws *websocket.Conn,
 				log.Error(err) // TODO add more ctx
 			}
 
+			if Options.EnableQuota {
+				// a stream can't be answered with 429, hold it till the quotas recover
+				this.quotas.Charge(quotaSub, myAppid, topic, 1, int64(len(body)))
+				if e := this.quotas.Take(quotaSub, myAppid, topic, 0, 0); e != nil {
+					this.subMetrics.Throttled.Inc(1)
+					messages, resume = nil, time.After(e.retryAfter)
+				}
+			}
+
+		case <-resume:
+			messages, resume = fetcher.Messages(), nil
+
 		case err = <-fetcher.Errors():
 			// TODO
 			log.Error(err)
@@ -56,23 +56,271 @@ what's the problem?
 package gateway
 
 import (
+	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/cmd/kateway/xa"
 	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
 )
 
 //go:generate goannotation $GOFILE
-// @rest POST /v1/xa/prepare/:topic/:ver
+// @rest POST /v1/xa/prepare/:topic/:ver?key=mykey&checkback=http://producer/xa/status
 func (this *pubServer) xa_prepare(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
 
+	t1 := time.Now()
+	realIp := getHttpRemoteIp(r)
+	appid := r.Header.Get(HttpHeaderAppid)
+	topic := params.ByName(UrlParamTopic)
+	ver := params.ByName(UrlParamVersion)
+
+	if Options.Ratelimit && !this.throttlePub.Pour(realIp, 1) {
+		log.Warn("xa+[%s] %s(%s) rate limit reached", appid, r.RemoteAddr, realIp)
+
+		writeQuotaExceeded(w)
+		return
+	}
+
+	if err := manager.Default.OwnTopic(appid, r.Header.Get(HttpHeaderPubkey), topic); err != nil {
+		log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} %s", appid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	msgLen := int(r.ContentLength)
+	switch {
+	case msgLen == -1:
+		log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} invalid content length: %d",
+			appid, r.RemoteAddr, realIp, topic, ver, msgLen)
+
+		writeBadRequest(w, "invalid content length")
+		return
+
+	case int64(msgLen) > Options.MaxPubSize:
+		log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} too big content length: %d",
+			appid, r.RemoteAddr, realIp, topic, ver, msgLen)
+
+		writeBadRequest(w, ErrTooBigMessage.Error())
+		return
+
+	case msgLen < Options.MinPubSize:
+		log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} too small content length: %d",
+			appid, r.RemoteAddr, realIp, topic, ver, msgLen)
+
+		writeBadRequest(w, ErrTooSmallMessage.Error())
+		return
+	}
+
+	// charged on prepare, the commit only delivers what is already admitted
+	if Options.EnableQuota {
+		if e := this.quotas.Take(quotaPub, appid, topic, 1, int64(msgLen)); e != nil {
+			log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} %s", appid, r.RemoteAddr, realIp, topic, ver, e)
+
+			this.pubMetrics.Throttled.Inc(1)
+			writeQuotaThrottled(w, e)
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	partitionKey := query.Get("key")
+	if len(partitionKey) > MaxPartitionKeyLen {
+		writeBadRequest(w, "too big key")
+		return
+	}
+
+	checkback := query.Get("checkback")
+	if len(checkback) > MaxCheckbackLen {
+		writeBadRequest(w, "too long checkback")
+		return
+	}
+	if checkback != "" {
+		if _, err := parseCheckback(checkback); err != nil {
+			log.Warn("xa+[%s] %s(%s) {topic:%s, ver:%s} checkback %s: %v",
+				appid, r.RemoteAddr, realIp, topic, ver, checkback, err)
+
+			writeBadRequest(w, "checkback not allowed")
+			return
+		}
+	}
+
+	cluster, found := manager.Default.LookupCluster(appid)
+	if !found {
+		log.Error("xa+[%s] %s(%s) {topic:%s, ver:%s} cluster not found",
+			appid, r.RemoteAddr, realIp, topic, ver)
+
+		writeBadRequest(w, "invalid appid")
+		return
+	}
+
+	// the prepared message outlives this request, mpool not applied
+	body := make([]byte, msgLen)
+	lbr := io.LimitReader(r.Body, Options.MaxPubSize+1)
+	if _, err := io.ReadAtLeast(lbr, body, msgLen); err != nil {
+		log.Error("xa+[%s] %s(%s) {topic:%s, ver:%s} %s",
+			appid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	xid, err := xa.Default.Prepare(xa.Txn{
+		Appid:     appid,
+		Cluster:   cluster,
+		Topic:     manager.Default.KafkaTopic(appid, topic, ver),
+		Key:       []byte(partitionKey),
+		Payload:   body,
+		Checkback: checkback,
+		Owner:     this.gw.id,
+		Ctime:     t1.Unix(),
+	})
+	if err != nil {
+		log.Error("xa+[%s] %s(%s) {topic:%s, ver:%s} %s",
+			appid, r.RemoteAddr, realIp, topic, ver, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
+
+	if Options.AuditPub {
+		this.auditor.Trace("xa+[%s] %s(%s) {topic:%s ver:%s UA:%s} xid:%s",
+			appid, r.RemoteAddr, realIp, topic, ver, r.Header.Get("User-Agent"), xid)
+	}
+
+	w.Header().Set(HttpHeaderXid, xid)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(ResponseOk)
+
+	if !Options.DisableMetrics {
+		this.pubMetrics.PubLatency.Update(time.Since(t1).Nanoseconds() / 1e6) // in ms
+	}
 }
 
 // @rest POST /v1/xa/commit?id=xx
 func (this *pubServer) xa_commit(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
+	appid := r.Header.Get(HttpHeaderAppid)
+	realIp := getHttpRemoteIp(r)
+	if err := manager.Default.Auth(appid, r.Header.Get(HttpHeaderPubkey)); err != nil {
+		log.Warn("xa=[%s] %s(%s) %s", appid, r.RemoteAddr, realIp, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	xid := r.URL.Query().Get("id")
+	txn, err := xa.Default.Commit(appid, xid)
+	if err != nil {
+		this.respondXaError(w, r, "xa=", appid, xid, err)
+		return
+	}
+
+	partition, offset, err := this.xaDeliver(txn)
+	if err != nil {
+		log.Error("xa=[%s] %s(%s) xid:%s %s", appid, r.RemoteAddr, realIp, xid, err)
+
+		writeServerError(w, err.Error())
+		return
+	}
 
+	if Options.AuditPub {
+		this.auditor.Trace("xa=[%s] %s(%s) {%s UA:%s} xid:%s {P:%d O:%d}",
+			appid, r.RemoteAddr, realIp, txn.Topic, r.Header.Get("User-Agent"), xid, partition, offset)
+	}
+
+	w.Write(ResponseOk)
 }
 
 // @rest PUT /v1/xa/rollback?id=xx
 func (this *pubServer) xa_rollback(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	atomic.AddInt32(&this.inflightN, 1)
+	defer atomic.AddInt32(&this.inflightN, -1)
+
+	appid := r.Header.Get(HttpHeaderAppid)
+	realIp := getHttpRemoteIp(r)
+	if err := manager.Default.Auth(appid, r.Header.Get(HttpHeaderPubkey)); err != nil {
+		log.Warn("xa-[%s] %s(%s) %s", appid, r.RemoteAddr, realIp, err)
+
+		writeAuthFailure(w, err)
+		return
+	}
+
+	xid := r.URL.Query().Get("id")
+	txn, err := xa.Default.Rollback(appid, xid)
+	if err != nil {
+		this.respondXaError(w, r, "xa-", appid, xid, err)
+		return
+	}
+
+	if Options.AuditPub {
+		this.auditor.Trace("xa-[%s] %s(%s) {%s UA:%s} xid:%s",
+			appid, r.RemoteAddr, realIp, txn.Topic, r.Header.Get("User-Agent"), xid)
+	}
+
+	w.Write(ResponseOk)
+}
+
+func (this *pubServer) respondXaError(w http.ResponseWriter, r *http.Request, op, appid, xid string, err error) {
+	switch err {
+	case xa.ErrInvalidXid:
+		log.Warn("%s[%s] %s(%s) xid:%s %v", op, appid, r.RemoteAddr, getHttpRemoteIp(r), xid, err)
+
+		writeBadRequest(w, err.Error())
+		return
+
+	case xa.ErrTxnNotFound:
+		// already decided by the other party or by checkback
+		log.Warn("%s[%s] %s(%s) xid:%s %v", op, appid, r.RemoteAddr, getHttpRemoteIp(r), xid, err)
+
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte{})
+		return
+	}
+
+	log.Error("%s[%s] %s(%s) xid:%s %v", op, appid, r.RemoteAddr, getHttpRemoteIp(r), xid, err)
+	writeServerError(w, err.Error())
+}
+
+// xaDeliver releases a delivering prepared message to the final message storage.
+// The prepared message is removed only after it is published; if delivery fails,
+// it is put back so that it can be committed later.
+func (this *pubServer) xaDeliver(txn xa.Txn) (partition int32, offset int64, err error) {
+	msg := txn.Payload
+	if Options.PubTimestamp {
+		// stamped on delivery: the message is invisible before
+		msg = make([]byte, envelope.Len(nil)+len(txn.Payload))
+		copy(msg[envelope.Encode(msg, time.Now(), nil):], txn.Payload)
+	}
+
+	partition, offset, err = store.DefaultPubStore.SyncPub(txn.Cluster, txn.Topic, txn.Key, msg)
+	if err != nil && Options.EnableHintedHandoff {
+		offset = -1
+		err = hh.Default.Append(txn.Cluster, txn.Topic, txn.Key, msg)
+	}
+	if err != nil {
+		if e := xa.Default.Abort(txn); e != nil {
+			// left in delivering state, checkback will redeliver it
+			log.Error("xa %s abort: %v", txn, e)
+		}
+
+		return
+	}
+
+	if e := xa.Default.Delivered(txn); e != nil {
+		// checkback will redeliver it: at least once
+		log.Error("xa %s delivered: %v", txn, e)
+	}
 
+	return
 }
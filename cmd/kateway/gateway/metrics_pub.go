@@ -26,6 +26,7 @@ type pubMetrics struct {
 
 	InternalErr metrics.Counter
 	ClientError metrics.Counter
+	Throttled   metrics.Counter
 	PubQps      metrics.Meter
 	PubTryQps   metrics.Meter
 	JobQps      metrics.Meter
@@ -43,6 +44,7 @@ func NewPubMetrics(gw *Gateway) *pubMetrics {
 
 		InternalErr: metrics.NewRegisteredCounter("pub.internalerr", metrics.DefaultRegistry),
 		ClientError: metrics.NewRegisteredCounter("pub.clienterr", metrics.DefaultRegistry),
+		Throttled:   metrics.NewRegisteredCounter("pub.throttled", metrics.DefaultRegistry),
 		PubQps:      metrics.NewRegisteredMeter("pub.qps", metrics.DefaultRegistry),
 		PubTryQps:   metrics.NewRegisteredMeter("pub.try.qps", metrics.DefaultRegistry),
 		JobQps:      metrics.NewRegisteredMeter("job.qps", metrics.DefaultRegistry),
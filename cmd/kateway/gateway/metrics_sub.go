@@ -18,6 +18,7 @@ type subMetrics struct {
 	SubTryQps   metrics.Meter
 	ClientError metrics.Meter
 	ServerError metrics.Meter
+	Throttled   metrics.Counter
 
 	expConsumeOk      *expvar.Int
 	expActiveConns    *expvar.Int
@@ -40,6 +41,7 @@ func NewSubMetrics(gw *Gateway) *subMetrics {
 		SubTryQps:   metrics.NewRegisteredMeter("sub.try.qps", metrics.DefaultRegistry),
 		ClientError: metrics.NewRegisteredMeter(("sub.clienterr"), metrics.DefaultRegistry),
 		ServerError: metrics.NewRegisteredMeter("sub.servererr", metrics.DefaultRegistry),
+		Throttled:   metrics.NewRegisteredCounter("sub.throttled", metrics.DefaultRegistry),
 	}
 
 	if Options.DebugHttpAddr != "" {
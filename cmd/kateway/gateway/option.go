@@ -24,6 +24,10 @@ var (
 		DebugHttpAddr              string
 		Store                      string
 		JobStore                   string
+		XaStore                    string
+		XaCheckbackHosts           string
+		InflightStore              string
+		InflightDir                string
 		ManagerStore               string
 		PidFile                    string
 		CertFile                   string
@@ -34,12 +38,22 @@ var (
 		DummyCluster               string
 		InfluxServer               string
 		InfluxDbName               string
+		Reporter                   string
+		PrometheusAddr             string
 		KillFile                   string
 		HintedHandoffType          string
 		HintedHandoffDir           string
+		HintedHandoffRaftAddr      string
+		HintedHandoffRaftPeers     string
+		HintedHandoffRaftSecret    string
+		HintedHandoffRaftId        uint64
+		HintedHandoffStandby       string
+		Registry                   string
+		EurekaServers              string
 		AllwaysHintedHandoff       bool
 		ShowVersion                bool
 		Ratelimit                  bool
+		EnableQuota                bool
 		PermitStandbySub           bool
 		DisableMetrics             bool
 		EnableHintedHandoff        bool
@@ -60,6 +74,8 @@ var (
 		UseCompress                bool
 		Debug                      bool
 		EnableRegistry             bool
+		LegacyTag                  bool
+		PubTimestamp               bool
 		HttpHeaderMaxBytes         int
 		MaxPubSize                 int64
 		MaxJobSize                 int64
@@ -68,12 +84,14 @@ var (
 		MinPubSize                 int
 		PubQpsLimit                int64
 		MaxSubBatchSize            int
+		MaxRedeliveries            int
 		MaxClients                 int
 		MaxRequestPerConn          int // to make load balancer distribute request even for persistent conn
 		PubPoolCapcity             int
 		AssignJobShardId           int // how to assign shard id for new app
 		PubPoolIdleTimeout         time.Duration
 		SubTimeout                 time.Duration
+		VisibilityTimeout          time.Duration
 		OffsetCommitInterval       time.Duration
 		BadClientPunishDuration    time.Duration
 		InternalServerErrorBackoff time.Duration
@@ -83,6 +101,10 @@ var (
 		HttpReadTimeout            time.Duration
 		HttpWriteTimeout           time.Duration
 		MaxWaitBeforeForceClose    time.Duration
+		XaCheckInterval            time.Duration
+		XaCheckbackAge             time.Duration
+		XaCheckbackTimeout         time.Duration
+		XaMaxPrepareAge            time.Duration
 	}
 )
 
@@ -124,16 +146,27 @@ func ParseFlags() {
 	flag.StringVar(&Options.KeyFile, "keyfile", "", "key file path")
 	flag.StringVar(&Options.DebugHttpAddr, "debughttp", "", "debug http bind addr")
 	flag.StringVar(&Options.Store, "store", "kafka", "message underlying store")
-	flag.StringVar(&Options.HintedHandoffType, "hhtype", "disk", "underlying hinted handoff")
+	flag.StringVar(&Options.HintedHandoffType, "hhtype", "disk", "underlying hinted handoff: disk|kafka|dummy")
 	flag.StringVar(&Options.HintedHandoffDir, "hhdirs", "hhdata", "hinted handoff dirs separated by comma")
+	flag.Uint64Var(&Options.HintedHandoffRaftId, "hhraftid", 0, "hinted handoff raft id, 0 disables hh replication")
+	flag.StringVar(&Options.HintedHandoffRaftAddr, "hhraftaddr", "", "hinted handoff raft transport bind addr")
+	flag.StringVar(&Options.HintedHandoffRaftPeers, "hhpeers", "", "hinted handoff raft peers, e,g. 1=host1:9195,2=host2:9195")
+	flag.StringVar(&Options.HintedHandoffRaftSecret, "hhraftsecret", "", "hinted handoff raft shared secret that signs messages between peers")
+	flag.StringVar(&Options.HintedHandoffStandby, "hhstandby", "", "standby cluster where kafka hinted handoff parks failed pubs")
 	flag.BoolVar(&Options.FlushHintedOffOnly, "hhflush", false, "flush hinted handoff and exit")
 	flag.StringVar(&Options.JobStore, "jstore", "mysql", "job underlying store")
+	flag.StringVar(&Options.XaStore, "xastore", "mysql", "xa prepared message underlying store")
+	flag.StringVar(&Options.XaCheckbackHosts, "xacheckbackhosts", "", "xa checkback allowed hosts separated by comma, .example.com matches subdomains, empty disables checkback")
+	flag.StringVar(&Options.InflightStore, "inflight", "disk", "delayed ack inflight messages underlying store <disk|mem>")
+	flag.StringVar(&Options.InflightDir, "inflightdir", "inflight", "inflight store dir")
 	flag.StringVar(&Options.DummyCluster, "dummycluster", "me", "dummy store's cluster name")
 	flag.StringVar(&Options.ManagerStore, "mstore", "mysql", "store integration with manager")
 	flag.StringVar(&Options.ConfigFile, "conf", "", "config file, defaults $HOME/.gafka.cf")
 	flag.StringVar(&Options.KillFile, "kill", "", "kill running kateway by pid file")
 	flag.StringVar(&Options.InfluxServer, "influxdbaddr", "", "influxdb server address for the metrics reporter")
 	flag.StringVar(&Options.InfluxDbName, "influxdbname", "pubsub", "influxdb db name")
+	flag.StringVar(&Options.Reporter, "reporter", "influxdb", "telemetry reporter: influxdb|prometheus")
+	flag.StringVar(&Options.PrometheusAddr, "promaddr", ":9197", "prometheus /metrics listen addr")
 	flag.BoolVar(&Options.ShowVersion, "version", false, "show version and exit")
 	flag.BoolVar(&Options.Debug, "debug", false, "enable debug mode")
 	flag.BoolVar(&Options.RunSwaggerServer, "swagger", false, "run swagger server")
@@ -143,7 +176,9 @@ func ParseFlags() {
 	flag.BoolVar(&Options.AuditSub, "auditsub", true, "enable Sub audit")
 	flag.BoolVar(&Options.UseCompress, "snappy", false, "backend store will snappy compress messages")
 	flag.BoolVar(&Options.EnableAccessLog, "accesslog", false, "en(dis)able access log")
-	flag.BoolVar(&Options.EnableRegistry, "withreg", true, "self register in zk, otherwise isolated from cluster")
+	flag.BoolVar(&Options.EnableRegistry, "withreg", true, "self register in registry, otherwise isolated from cluster")
+	flag.StringVar(&Options.Registry, "registry", "zk", "registry backend: zk|eureka")
+	flag.StringVar(&Options.EurekaServers, "eureka", "", "eureka service urls separated by comma, e,g. http://localhost:8761/eureka")
 	flag.BoolVar(&Options.DryRun, "dryrun", false, "dry run mode")
 	flag.BoolVar(&Options.HintedHandoffBufio, "hhbuf", false, "enable hinted handoff bufio")
 	flag.BoolVar(&Options.EnableHintedHandoff, "hh", true, "enable hinted handoff for full pub availability")
@@ -154,7 +189,10 @@ func ParseFlags() {
 	flag.BoolVar(&Options.BadGroupRateLimit, "badgroup_rater", true, "rate limit of bad consumer group")
 	flag.BoolVar(&Options.BadPubAppRateLimit, "badpub_rater", true, "rate limit of bad pub app client")
 	flag.BoolVar(&Options.Ratelimit, "raltelimit", false, "enable rate limit")
+	flag.BoolVar(&Options.EnableQuota, "quota", true, "enforce pub/sub quotas of apps and topics")
 	flag.BoolVar(&Options.EnableHttpPanicRecover, "httppanic", true, "enable http handler panic recover")
+	flag.BoolVar(&Options.LegacyTag, "legacytag", true, "recognize legacy tag marks on sub, turn off after legacy tagged messages expire")
+	flag.BoolVar(&Options.PubTimestamp, "pubts", false, "envelope every pub message with publish time so that sub offset can be reset by time, keep it on once turned on")
 	flag.BoolVar(&Options.DisableMetrics, "metricsoff", false, "disable metrics reporter")
 	flag.IntVar(&Options.HttpHeaderMaxBytes, "maxheader", 4<<10, "http header max size in bytes")
 	flag.Int64Var(&Options.MaxPubSize, "maxpub", 512<<10, "max Pub message size")
@@ -165,6 +203,7 @@ func ParseFlags() {
 	flag.IntVar(&Options.MaxMsgTagLen, "tagsz", 1024, "max message tag length permitted")
 	// kafka Fetch maxFetchSize=1MB, so if our msg agv size is 250B, batch size can be 4000
 	flag.IntVar(&Options.MaxSubBatchSize, "maxbatch", 4000, "max sub batch size")
+	flag.IntVar(&Options.MaxRedeliveries, "maxredeliver", 0, "max redeliveries of a delayed ack message before buried to dead queue, 0 means unlimited")
 	flag.IntVar(&Options.LogRotateSize, "logsize", 10<<30, "max unrotated log file size")
 	flag.Int64Var(&Options.PubQpsLimit, "publimit", 60*10000, "pub qps limit per minute per ip")
 	flag.IntVar(&Options.PubPoolCapcity, "pubpool", 100, "pub connection pool capacity")
@@ -173,12 +212,17 @@ func ParseFlags() {
 	flag.DurationVar(&Options.HttpReadTimeout, "httprtimeout", time.Minute*5, "http server read timeout")
 	flag.DurationVar(&Options.HttpWriteTimeout, "httpwtimeout", time.Minute, "http server write timeout")
 	flag.DurationVar(&Options.SubTimeout, "subtimeout", time.Second*30, "sub timeout before send http 204")
+	flag.DurationVar(&Options.VisibilityTimeout, "visibility", time.Second*30, "delayed ack message visibility timeout before redelivered")
 	flag.DurationVar(&Options.ReporterInterval, "report", time.Second*30, "reporter flush interval")
 	flag.DurationVar(&Options.BadClientPunishDuration, "punish", time.Second*3, "punish bad client by sleep")
 	flag.DurationVar(&Options.MetaRefresh, "metarefresh", time.Minute*5, "meta data refresh interval")
 	flag.DurationVar(&Options.ManagerRefresh, "manrefresh", time.Minute*5, "manager integration refresh interval")
 	flag.DurationVar(&Options.PubPoolIdleTimeout, "pubpoolidle", 0, "pub pool connect idle timeout")
 	flag.DurationVar(&Options.InternalServerErrorBackoff, "500backoff", time.Second, "internal server error backoff duration")
+	flag.DurationVar(&Options.XaCheckInterval, "xacheck", time.Second*30, "xa undecided prepare check interval")
+	flag.DurationVar(&Options.XaCheckbackAge, "xacheckback", time.Minute, "xa prepare age before checking back with producer")
+	flag.DurationVar(&Options.XaCheckbackTimeout, "xacheckbacktimeout", time.Second*5, "xa checkback http timeout")
+	flag.DurationVar(&Options.XaMaxPrepareAge, "xamaxage", time.Hour*24, "xa prepare max age before rolled back")
 	flag.DurationVar(&Options.MaxWaitBeforeForceClose, "maxwait", time.Second*20, "how long to wait for current active http connections close before forced close")
 
 	flag.Parse()
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+const (
+	quotaPub = "pub"
+	quotaSub = "sub"
+
+	quotaScopeApp   = "app"
+	quotaScopeTopic = "topic"
+
+	quotaUnitMsgs  = "msgs/s"
+	quotaUnitBytes = "bytes/s"
+
+	quotaBucketIdle = time.Minute * 10
+)
+
+// tokenBucket refills rate tokens per second with a burst of 1s.
+// Tokens can go negative when charged after the fact, e,g. consumed bytes,
+// and the debt is paid back before anything else is admitted.
+type tokenBucket struct {
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: float64(rate), last: now}
+}
+
+func (this *tokenBucket) refill(rate int64, now time.Time) {
+	// the quota might be changed by manager refresh
+	this.rate = rate
+
+	if elapsed := now.Sub(this.last); elapsed > 0 {
+		this.tokens += elapsed.Seconds() * float64(this.rate)
+		this.last = now
+	}
+	if this.tokens > float64(this.rate) {
+		this.tokens = float64(this.rate)
+	}
+}
+
+// wait returns how long it takes before n tokens are available.
+// A cost larger than the burst is admitted on a full bucket, otherwise it would starve forever.
+func (this *tokenBucket) wait(n int64) time.Duration {
+	need := float64(n)
+	if need > float64(this.rate) {
+		need = float64(this.rate)
+	}
+	if this.tokens >= need {
+		return 0
+	}
+
+	return time.Duration((need - this.tokens) / float64(this.rate) * float64(time.Second))
+}
+
+type quotaLimit struct {
+	scope, unit string
+	key         string // bucket key
+	rate, cost  int64
+}
+
+type quotaExceeded struct {
+	scope, unit string
+	limit       int64
+	retryAfter  time.Duration
+}
+
+func (this *quotaExceeded) Error() string {
+	return fmt.Sprintf("%s quota %d %s exceeded", this.scope, this.limit, this.unit)
+}
+
+// quotas enforces the manager quotas of pub and sub per appid and per appid+topic.
+// The buckets are local to each kateway instance, behind a load balancer of N
+// instances an app gets up to N times its quota.
+//
+// Buckets left idle for quotaBucketIdle are evicted once full again: a new bucket
+// starts full, so forgetting them is lossless.
+type quotas struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newQuotas() *quotas {
+	return &quotas{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (this *quotas) limits(dir, appid, topic string, msgs, bytes int64) []quotaLimit {
+	appQuota := manager.Default.Quota(appid, "")
+	topicQuota := manager.Default.Quota(appid, topic)
+	if appQuota.Unlimited() && topicQuota.Unlimited() {
+		// fast path
+		return nil
+	}
+
+	limits := make([]quotaLimit, 0, 4)
+	add := func(scope, unit string, rate, cost int64) {
+		if rate <= 0 {
+			return
+		}
+
+		// appid and topic might contain dot but never '|'
+		key := dir + "|" + scope + "|" + unit + "|" + appid
+		if scope == quotaScopeTopic {
+			key += "|" + topic
+		}
+		limits = append(limits, quotaLimit{scope: scope, unit: unit, key: key, rate: rate, cost: cost})
+	}
+
+	switch dir {
+	case quotaPub:
+		add(quotaScopeApp, quotaUnitMsgs, appQuota.PubQps, msgs)
+		add(quotaScopeApp, quotaUnitBytes, appQuota.PubBps, bytes)
+		add(quotaScopeTopic, quotaUnitMsgs, topicQuota.PubQps, msgs)
+		add(quotaScopeTopic, quotaUnitBytes, topicQuota.PubBps, bytes)
+
+	case quotaSub:
+		add(quotaScopeApp, quotaUnitMsgs, appQuota.SubQps, msgs)
+		add(quotaScopeApp, quotaUnitBytes, appQuota.SubBps, bytes)
+		add(quotaScopeTopic, quotaUnitMsgs, topicQuota.SubQps, msgs)
+		add(quotaScopeTopic, quotaUnitBytes, topicQuota.SubBps, bytes)
+	}
+
+	return limits
+}
+
+func (this *quotas) bucket(l quotaLimit, now time.Time) *tokenBucket {
+	b, present := this.buckets[l.key]
+	if !present {
+		b = newTokenBucket(l.rate, now)
+		this.buckets[l.key] = b
+	} else {
+		b.refill(l.rate, now)
+	}
+
+	return b
+}
+
+func (this *quotas) sweep(now time.Time) {
+	if now.Sub(this.swept) < quotaBucketIdle {
+		return
+	}
+
+	this.swept = now
+	for key, b := range this.buckets {
+		idle := now.Sub(b.last)
+		if idle >= quotaBucketIdle && b.tokens+idle.Seconds()*float64(b.rate) >= float64(b.rate) {
+			delete(this.buckets, key)
+		}
+	}
+}
+
+// Take admits msgs and bytes only if all the app and topic quotas allow, and
+// returns the quota that needs the longest wait otherwise.
+func (this *quotas) Take(dir, appid, topic string, msgs, bytes int64) *quotaExceeded {
+	limits := this.limits(dir, appid, topic, msgs, bytes)
+	if len(limits) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.sweep(now)
+	var exceeded *quotaExceeded
+	for _, l := range limits {
+		if wait := this.bucket(l, now).wait(l.cost); wait > 0 {
+			if exceeded == nil || wait > exceeded.retryAfter {
+				exceeded = &quotaExceeded{scope: l.scope, unit: l.unit, limit: l.rate, retryAfter: wait}
+			}
+		}
+	}
+	if exceeded != nil {
+		return exceeded
+	}
+
+	for _, l := range limits {
+		this.buckets[l.key].tokens -= float64(l.cost)
+	}
+	return nil
+}
+
+// Charge consumes the quotas unconditionally, used when the cost is known after the fact.
+func (this *quotas) Charge(dir, appid, topic string, msgs, bytes int64) {
+	limits := this.limits(dir, appid, topic, msgs, bytes)
+	if len(limits) == 0 {
+		return
+	}
+
+	now := time.Now()
+	this.mu.Lock()
+	this.sweep(now)
+	for _, l := range limits {
+		this.bucket(l, now).tokens -= float64(l.cost)
+	}
+	this.mu.Unlock()
+}
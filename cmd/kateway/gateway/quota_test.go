@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+type quotaManager struct {
+	manager.Manager
+
+	quotas map[string]manager.Quota // appid.topic
+}
+
+func (this *quotaManager) Quota(appid, topic string) manager.Quota {
+	return this.quotas[appid+"."+topic]
+}
+
+func setupQuotaManager(quotas map[string]manager.Quota) func() {
+	old := manager.Default
+	manager.Default = &quotaManager{quotas: quotas}
+	return func() {
+		manager.Default = old
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, now)
+	assert.Equal(t, time.Duration(0), b.wait(10))
+	b.tokens -= 10
+	assert.Equal(t, time.Millisecond*100, b.wait(1))
+
+	b.refill(10, now.Add(time.Millisecond*500))
+	assert.Equal(t, float64(5), b.tokens)
+	b.refill(10, now.Add(time.Hour))
+	assert.Equal(t, float64(10), b.tokens) // burst of 1s
+
+	// cost larger than burst admitted on a full bucket
+	assert.Equal(t, time.Duration(0), b.wait(100))
+	b.tokens -= 100
+	assert.Equal(t, time.Second*9, b.wait(0))
+
+	// quota lowered by manager refresh
+	b.tokens = 10
+	b.refill(2, now.Add(time.Hour))
+	assert.Equal(t, float64(2), b.tokens)
+}
+
+func TestQuotasUnlimited(t *testing.T) {
+	defer setupQuotaManager(nil)()
+
+	q := newQuotas()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, true, q.Take(quotaPub, "app1", "foobar", 1, 1<<20) == nil)
+	}
+	assert.Equal(t, 0, len(q.buckets))
+}
+
+func TestQuotasAppAndTopic(t *testing.T) {
+	defer setupQuotaManager(map[string]manager.Quota{
+		"app1.":       {PubQps: 2},
+		"app1.foobar": {PubBps: 100},
+	})()
+
+	q := newQuotas()
+	assert.Equal(t, true, q.Take(quotaPub, "app1", "foobar", 1, 60) == nil)
+	e := q.Take(quotaPub, "app1", "foobar", 1, 60)
+	assert.Equal(t, quotaScopeTopic, e.scope)
+	assert.Equal(t, quotaUnitBytes, e.unit)
+	assert.Equal(t, int64(100), e.limit)
+
+	// nothing is taken when any quota is exceeded
+	assert.Equal(t, true, q.Take(quotaPub, "app1", "other", 1, 1<<20) == nil)
+	e = q.Take(quotaPub, "app1", "other", 1, 10)
+	assert.Equal(t, quotaScopeApp, e.scope)
+	assert.Equal(t, quotaUnitMsgs, e.unit)
+	assert.Equal(t, true, e.retryAfter > 0 && e.retryAfter <= time.Second/2)
+
+	// sub quotas are separate from pub
+	assert.Equal(t, true, q.Take(quotaSub, "app1", "foobar", 1, 1<<20) == nil)
+}
+
+func TestQuotasBucketKey(t *testing.T) {
+	defer setupQuotaManager(map[string]manager.Quota{
+		"a.":    {PubQps: 100},
+		"a.b.c": {PubQps: 1},
+		"a.b.":  {PubQps: 100},
+	})()
+
+	// topic c of app a.b never shares the bucket of topic b.c of app a
+	q := newQuotas()
+	assert.Equal(t, true, q.Take(quotaPub, "a", "b.c", 1, 0) == nil)
+	assert.Equal(t, true, q.Take(quotaPub, "a.b", "c", 1, 0) == nil)
+}
+
+func TestQuotasSweep(t *testing.T) {
+	now := time.Now()
+	q := newQuotas()
+	q.swept = now
+	q.buckets["idle"] = &tokenBucket{rate: 10, tokens: 2, last: now}
+	q.buckets["debt"] = &tokenBucket{rate: 10, tokens: -1e5, last: now}
+	q.buckets["busy"] = &tokenBucket{rate: 10, tokens: 10, last: now.Add(quotaBucketIdle)}
+
+	q.sweep(now.Add(quotaBucketIdle / 2))
+	assert.Equal(t, 3, len(q.buckets))
+
+	q.sweep(now.Add(quotaBucketIdle))
+	assert.Equal(t, 2, len(q.buckets))
+	_, present := q.buckets["idle"]
+	assert.Equal(t, false, present)
+}
+
+func TestQuotasChargeDebt(t *testing.T) {
+	defer setupQuotaManager(map[string]manager.Quota{
+		"app2.": {SubBps: 100},
+	})()
+
+	q := newQuotas()
+	assert.Equal(t, true, q.Take(quotaSub, "app2", "foobar", 0, 0) == nil)
+	q.Charge(quotaSub, "app2", "foobar", 1, 300)
+	e := q.Take(quotaSub, "app2", "foobar", 0, 0)
+	assert.Equal(t, quotaScopeApp, e.scope)
+	assert.Equal(t, true, e.retryAfter > time.Millisecond*1900 && e.retryAfter <= time.Second*2)
+}
+
+func TestWriteQuotaThrottled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeQuotaThrottled(rec, &quotaExceeded{
+		scope:      quotaScopeTopic,
+		unit:       quotaUnitMsgs,
+		limit:      50,
+		retryAfter: time.Millisecond * 1200,
+	})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HttpHeaderRetryAfter))
+	assert.Equal(t, "topic", rec.Header().Get(HttpHeaderQuotaScope))
+	assert.Equal(t, "50 msgs/s", rec.Header().Get(HttpHeaderQuotaLimit))
+}
@@ -2,7 +2,9 @@ package gateway
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -54,6 +56,19 @@ func writeQuotaExceeded(w http.ResponseWriter) {
 	_writeErrorResponse(w, "quota exceeded", http.StatusTooManyRequests)
 }
 
+// writeQuotaThrottled tells a well behaved client when to retry instead of punishing it.
+func writeQuotaThrottled(w http.ResponseWriter, e *quotaExceeded) {
+	retryAfter := int64(math.Ceil(e.retryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set(HttpHeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+	w.Header().Set(HttpHeaderQuotaScope, e.scope)
+	w.Header().Set(HttpHeaderQuotaLimit, strconv.FormatInt(e.limit, 10)+" "+e.unit)
+	_writeErrorResponse(w, e.Error(), http.StatusTooManyRequests)
+}
+
 func writeServerError(w http.ResponseWriter, err string) {
 	// internal server error, if client brutely retry without backoff, it will
 	// hurt both server and client and its dependencies
@@ -22,6 +22,7 @@ func (this *Gateway) buildRouting() {
 		// api for 'gk kateway'
 		this.manServer.Router().GET("/v1/clusters", m(this.manServer.clustersHandler))
 		this.manServer.Router().GET("/v1/status", m(this.manServer.statusHandler))
+		this.manServer.Router().GET("/v1/load", this.manServer.loadHandler) // polled by ehaproxy
 		this.manServer.Router().PUT("/v1/options/:option/:value", m(this.manServer.setOptionHandler))
 
 		// api for pubsub manager
@@ -39,6 +40,10 @@ func (this *Gateway) buildRouting() {
 			this.manServer.deleteWebhookHandler)
 		this.manServer.Router().GET("/v1/schemas/:appid/:topic/:ver",
 			m(this.manServer.schemaHandler))
+		this.manServer.Router().POST("/v1/schemas/:appid/:topic/:ver",
+			m(this.manServer.registerSchemaHandler))
+		this.manServer.Router().GET("/v1/schemas/:appid/:topic",
+			m(this.manServer.schemaVersionsHandler))
 		this.manServer.Router().DELETE("/v1/manager/cache",
 			m(this.manServer.refreshManagerHandler))
 
@@ -59,6 +64,8 @@ func (this *Gateway) buildRouting() {
 			m(this.manServer.subStatusHandler))
 		this.manServer.Router().GET("/v1/sub/status",
 			m(this.manServer.appSubStatusHandler))
+		this.manServer.Router().POST("/v1/groups/:appid/:topic/:ver/:group",
+			m(this.manServer.addSubGroupHandler))
 		this.manServer.Router().DELETE("/v1/groups/:appid/:topic/:ver/:group",
 			m(this.manServer.delSubGroupHandler))
 		this.manServer.Router().PUT("/v1/offset/:appid/:topic/:ver/:group/:partition",
@@ -80,8 +87,8 @@ func (this *Gateway) buildRouting() {
 
 		// pubServer acts as a XA compliant RM(resource manager)
 		this.pubServer.Router().POST("/v1/xa/prepare/:topic/:ver", m(this.pubServer.xa_prepare))
-		this.pubServer.Router().PUT("/v1/xa/rollback", m(this.pubServer.xa_commit))
-		this.pubServer.Router().PUT("/v1/xa/abort", m(this.pubServer.xa_rollback))
+		this.pubServer.Router().POST("/v1/xa/commit", m(this.pubServer.xa_commit))
+		this.pubServer.Router().PUT("/v1/xa/rollback", m(this.pubServer.xa_rollback))
 
 		// TODO deprecated
 		this.pubServer.Router().POST("/topics/:topic/:ver", m(this.pubServer.pubHandler))
@@ -99,6 +106,7 @@ func (this *Gateway) buildRouting() {
 		this.subServer.Router().PUT("/v1/msgs/:appid/:topic/:ver", m(this.subServer.buryHandler))
 		this.subServer.Router().GET("/v1/ws/msgs/:appid/:topic/:ver", m(this.subServer.subWsHandler))
 		this.subServer.Router().PUT("/v1/offsets/:appid/:topic/:ver/:group", m(this.subServer.ackHandler))
+		this.subServer.Router().PUT("/v1/visibility/:appid/:topic/:ver", m(this.subServer.visibilityHandler))
 		this.subServer.Router().PUT("/v1/raw/offsets/:cluster/:topic/:group", m(this.subServer.ackRawHandler))
 
 		// TODO deprecated
@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/funkygao/gafka/cmd/kateway/avro"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+)
+
+type schemaEntry struct {
+	definition string
+	schema     *avro.Schema
+}
+
+// schemaCache holds the parsed avro schemas of topics that enforce schema on pub.
+// An entry is parsed again only when its definition changes in manager.
+type schemaCache struct {
+	mu      sync.RWMutex
+	entries map[string]schemaEntry // appid.topic.ver
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: make(map[string]schemaEntry)}
+}
+
+func (this *schemaCache) Get(appid, topic, ver string) (*avro.Schema, error) {
+	definition, err := manager.Default.TopicSchema(appid, topic, ver)
+	if err != nil {
+		return nil, err
+	}
+
+	key := appid + "." + topic + "." + ver
+	this.mu.RLock()
+	entry, present := this.entries[key]
+	this.mu.RUnlock()
+	if present && entry.definition == definition {
+		return entry.schema, nil
+	}
+
+	schema, err := avro.Parse(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	this.mu.Lock()
+	this.entries[key] = schemaEntry{definition: definition, schema: schema}
+	this.mu.Unlock()
+	return schema, nil
+}
+
+// Validate checks a pub payload against the topic schema.
+func (this *schemaCache) Validate(appid, topic, ver string, payload []byte) error {
+	schema, err := this.Get(appid, topic, ver)
+	if err != nil {
+		return err
+	}
+
+	return schema.ValidateJSON(payload)
+}
+
+// schemaVersionNo returns the numeric part of a topic version, e.g. v10 -> 10.
+func schemaVersionNo(ver string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(ver, "v"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// sortedSchemaVersions sorts topic versions numerically, so that v10 comes after v9.
+func sortedSchemaVersions(versions map[string]string) []string {
+	r := make([]string, 0, len(versions))
+	for ver := range versions {
+		r = append(r, ver)
+	}
+	sort.Sort(byVersionNo(r))
+	return r
+}
+
+type byVersionNo []string
+
+func (b byVersionNo) Len() int      { return len(b) }
+func (b byVersionNo) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byVersionNo) Less(i, j int) bool {
+	ni, nj := schemaVersionNo(b[i]), schemaVersionNo(b[j])
+	if ni != nj {
+		return ni < nj
+	}
+	return b[i] < b[j]
+}
+
+// checkSchemaEvolution validates a new schema version against the closest
+// lower version registered for the topic.
+func checkSchemaEvolution(mode string, versions map[string]string, ver string, schema *avro.Schema) error {
+	if mode == avro.CompatNone {
+		return nil
+	}
+
+	var prevVer string
+	for _, v := range sortedSchemaVersions(versions) {
+		if schemaVersionNo(v) < schemaVersionNo(ver) {
+			prevVer = v
+		}
+	}
+	if prevVer == "" {
+		return nil
+	}
+
+	prev, err := avro.Parse(versions[prevVer])
+	if err != nil {
+		return fmt.Errorf("%s: %v", prevVer, err)
+	}
+
+	if err = avro.CheckCompatibility(mode, prev, schema); err != nil {
+		return fmt.Errorf("incompatible with %s: %v", prevVer, err)
+	}
+	return nil
+}
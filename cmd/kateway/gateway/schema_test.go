@@ -0,0 +1,33 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/avro"
+)
+
+func TestSortedSchemaVersions(t *testing.T) {
+	versions := map[string]string{"v10": "", "v2": "", "v1": "", "v9": ""}
+	assert.Equal(t, []string{"v1", "v2", "v9", "v10"}, sortedSchemaVersions(versions))
+}
+
+func TestCheckSchemaEvolution(t *testing.T) {
+	versions := map[string]string{
+		"v1": `{"type":"record","name":"order","fields":[{"name":"id","type":"long"}]}`,
+	}
+
+	// adding a field without default breaks backward compatibility
+	v2, err := avro.Parse(`{"type":"record","name":"order","fields":[{"name":"id","type":"long"},{"name":"uid","type":"string"}]}`)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, nil, checkSchemaEvolution(avro.CompatBackward, versions, "v2", v2))
+	assert.Equal(t, nil, checkSchemaEvolution(avro.CompatForward, versions, "v2", v2))
+	assert.Equal(t, nil, checkSchemaEvolution(avro.CompatNone, versions, "v2", v2))
+
+	v2, err = avro.Parse(`{"type":"record","name":"order","fields":[{"name":"id","type":"long"},{"name":"uid","type":"string","default":""}]}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, checkSchemaEvolution(avro.CompatFull, versions, "v2", v2))
+
+	// the first version has nothing to be compatible with
+	assert.Equal(t, nil, checkSchemaEvolution(avro.CompatFull, versions, "v1", v2))
+}
@@ -18,6 +18,9 @@ type pubServer struct {
 	pubMetrics  *pubMetrics
 	throttlePub *ratelimiter.LeakyBuckets
 	auditor     log.Logger
+	schemas     *schemaCache
+	quotas      *quotas
+	inflightN   int32 // pub, job and xa requests being handled, websocket excluded, polled by ehaproxy
 
 	throttleBadAppid *ratelimiter.LeakyBuckets
 }
@@ -27,6 +30,8 @@ func newPubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *pubS
 		webServer:        newWebServer("pub_server", httpAddr, httpsAddr, maxClients, Options.HttpReadTimeout, gw),
 		throttlePub:      ratelimiter.NewLeakyBuckets(Options.PubQpsLimit, time.Minute),
 		throttleBadAppid: ratelimiter.NewLeakyBuckets(3, time.Minute),
+		schemas:          newSchemaCache(),
+		quotas:           newQuotas(),
 	}
 	this.pubMetrics = NewPubMetrics(this.gw)
 	this.onConnNewFunc = this.onConnNew
@@ -57,6 +62,9 @@ func newPubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *pubS
 }
 
 func (this *pubServer) Start() {
+	this.gw.wg.Add(1)
+	go this.xaCheckback()
+
 	this.pubMetrics.Load()
 	this.webServer.Start()
 }
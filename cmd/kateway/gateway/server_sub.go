@@ -40,6 +40,9 @@ type subServer struct {
 
 	subMetrics *subMetrics
 
+	filters *subFilters // subscription group filters
+	quotas  *quotas
+
 	badGroupBudget   *ratelimiter.LeakyBuckets
 	goodGroupClients map[string]struct{} // key is remote addr(port inclusive)
 	goodGroupLock    sync.RWMutex
@@ -58,6 +61,8 @@ func newSubServer(httpAddr, httpsAddr string, maxClients int, gw *Gateway) *subS
 		ackShutdown:      0,
 		ackCh:            make(chan ackOffsets, 100),
 		ackedOffsets:     make(map[string]map[string]map[string]map[int]int64),
+		filters:          newSubFilters(gw.zkzone),
+		quotas:           newQuotas(),
 	}
 	this.subMetrics = NewSubMetrics(this.gw)
 	this.waitExitFunc = this.waitExit
@@ -95,6 +100,8 @@ func (this *subServer) Start() {
 	this.gw.wg.Add(1)
 	go this.ackCommitter()
 
+	go this.filters.Watch(this.gw.shutdownCh)
+
 	this.subMetrics.Load()
 	this.webServer.Start()
 }
@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
+	"github.com/funkygao/gafka/zk"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	filterOpExists = iota
+	filterOpEq
+	filterOpNe
+	filterOpIn
+	filterOpNotIn
+
+	subFilterCacheTTL = time.Minute
+)
+
+// subFilter is a server side filter expression attached to a subscription group.
+// Clauses are separated by ';' and all of them must be satisfied, e,g.
+//
+//  tag=order;region in (bj,sh);vip;level!=0;city not in (gz)
+//
+// Clauses are evaluated on the message envelope headers, a tag a=b is a header
+// with key a and value b. A clause with a bare key only checks the key exists.
+type subFilter struct {
+	expr    string
+	clauses []filterClause
+}
+
+type filterClause struct {
+	key    string
+	op     int
+	values map[string]struct{}
+}
+
+func parseSubFilter(expr string) (*subFilter, error) {
+	f := &subFilter{expr: expr}
+	for _, c := range strings.Split(expr, TagSeperator) {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		clause, err := parseFilterClause(c)
+		if err != nil {
+			return nil, err
+		}
+		f.clauses = append(f.clauses, clause)
+	}
+
+	if len(f.clauses) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	return f, nil
+}
+
+func parseFilterClause(c string) (clause filterClause, err error) {
+	clause.values = make(map[string]struct{})
+
+	if i := strings.Index(c, "!="); i > 0 {
+		clause.key, clause.op = strings.TrimSpace(c[:i]), filterOpNe
+		clause.values[strings.TrimSpace(c[i+2:])] = struct{}{}
+	} else if i = strings.Index(c, "="); i > 0 {
+		clause.key, clause.op = strings.TrimSpace(c[:i]), filterOpEq
+		clause.values[strings.TrimSpace(c[i+1:])] = struct{}{}
+	} else if i = strings.Index(c, "("); i > 0 {
+		if !strings.HasSuffix(c, ")") {
+			return clause, fmt.Errorf("unclosed parenthesis: %s", c)
+		}
+
+		fields := strings.Fields(c[:i])
+		switch {
+		case len(fields) == 2 && fields[1] == "in":
+			clause.op = filterOpIn
+		case len(fields) == 3 && fields[1] == "not" && fields[2] == "in":
+			clause.op = filterOpNotIn
+		default:
+			return clause, fmt.Errorf("illegal clause: %s", c)
+		}
+
+		clause.key = fields[0]
+		for _, v := range strings.Split(c[i+1:len(c)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				clause.values[v] = struct{}{}
+			}
+		}
+		if len(clause.values) == 0 {
+			return clause, fmt.Errorf("empty value list: %s", c)
+		}
+	} else {
+		if strings.ContainsAny(c, " \t=!(),") {
+			return clause, fmt.Errorf("illegal clause: %s", c)
+		}
+
+		clause.key, clause.op = c, filterOpExists
+	}
+
+	if clause.key == "" {
+		return clause, fmt.Errorf("empty key: %s", c)
+	}
+
+	return
+}
+
+// match checks if the message headers satisfy all the clauses.
+func (this *subFilter) match(headers []envelope.Header) bool {
+	attrs := make(map[string]string, len(headers))
+	for _, h := range headers {
+		attrs[h.Key] = h.Value
+	}
+
+	for _, c := range this.clauses {
+		v, present := attrs[c.key]
+		switch c.op {
+		case filterOpExists:
+			if !present {
+				return false
+			}
+
+		case filterOpEq, filterOpIn:
+			if _, hit := c.values[v]; !present || !hit {
+				return false
+			}
+
+		case filterOpNe, filterOpNotIn:
+			if _, hit := c.values[v]; present && hit {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (this *subFilter) String() string {
+	return this.expr
+}
+
+type subFilterEntry struct {
+	filter   *subFilter
+	loadedAt time.Time
+}
+
+// subFilters caches the subscription group filters stored in zk.
+// Every filter change is broadcast through a zk watch which flushes the cache
+// of all kateways, the ttl bounds staleness when the watch is lost.
+type subFilters struct {
+	zkzone *zk.ZkZone
+
+	mu      sync.RWMutex
+	entries map[string]subFilterEntry // group:topic
+}
+
+func newSubFilters(zkzone *zk.ZkZone) *subFilters {
+	return &subFilters{
+		zkzone:  zkzone,
+		entries: make(map[string]subFilterEntry),
+	}
+}
+
+// Get returns the filter of a group on a raw topic, nil if the group has no filter.
+func (this *subFilters) Get(group, rawTopic string) *subFilter {
+	key := group + ":" + rawTopic
+	this.mu.RLock()
+	entry, present := this.entries[key]
+	this.mu.RUnlock()
+	if present && time.Since(entry.loadedAt) < subFilterCacheTTL {
+		return entry.filter
+	}
+
+	expr, err := this.zkzone.SubFilter(group, rawTopic)
+	if err != nil {
+		// keep using the stale filter
+		log.Error("filter[%s] %s: %v", group, rawTopic, err)
+		return entry.filter
+	}
+
+	entry = subFilterEntry{loadedAt: time.Now()}
+	if expr != "" {
+		if entry.filter, err = parseSubFilter(expr); err != nil {
+			log.Error("filter[%s] %s {%s}: %v", group, rawTopic, expr, err)
+		}
+	}
+
+	this.mu.Lock()
+	this.entries[key] = entry
+	this.mu.Unlock()
+	return entry.filter
+}
+
+// Watch flushes the cache whenever any group filter changes until quit.
+func (this *subFilters) Watch(quit <-chan struct{}) {
+	for {
+		changes, err := this.zkzone.WatchSubFilters()
+		if err != nil {
+			log.Error("filter watch: %v", err)
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(time.Second):
+				continue
+			}
+		}
+
+		select {
+		case <-quit:
+			return
+
+		case <-changes:
+			this.mu.Lock()
+			this.entries = make(map[string]subFilterEntry)
+			this.mu.Unlock()
+		}
+	}
+}
+
+// Invalidate discards the cached filters of a group.
+func (this *subFilters) Invalidate(group string) {
+	prefix := group + ":"
+	this.mu.Lock()
+	for key := range this.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(this.entries, key)
+		}
+	}
+	this.mu.Unlock()
+}
@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
+)
+
+func TestParseSubFilter(t *testing.T) {
+	f, err := parseSubFilter("tag=order; region in (bj, sh);vip;level!=0;city not in (gz)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, len(f.clauses))
+	assert.Equal(t, "region", f.clauses[1].key)
+	assert.Equal(t, filterOpIn, f.clauses[1].op)
+	assert.Equal(t, 2, len(f.clauses[1].values))
+	assert.Equal(t, filterOpExists, f.clauses[2].op)
+	assert.Equal(t, filterOpNe, f.clauses[3].op)
+	assert.Equal(t, filterOpNotIn, f.clauses[4].op)
+
+	for _, expr := range []string{"", ";", "region in (bj", "region in ()", "region between (1,2)", "a b", "=x"} {
+		_, err = parseSubFilter(expr)
+		assert.NotEqual(t, nil, err)
+	}
+}
+
+func TestSubFilterMatch(t *testing.T) {
+	f, _ := parseSubFilter("tag=order;region in (bj,sh)")
+	assert.Equal(t, true, f.match(tagHeaders("tag=order;region=bj")))
+	assert.Equal(t, true, f.match(tagHeaders("region=sh;tag=order;")))
+	assert.Equal(t, false, f.match(tagHeaders("tag=order;region=gz")))
+	assert.Equal(t, false, f.match(tagHeaders("tag=order")))
+	assert.Equal(t, false, f.match(nil))
+
+	f, _ = parseSubFilter("vip;city not in (gz);level!=0")
+	assert.Equal(t, true, f.match(tagHeaders("vip")))
+	assert.Equal(t, true, f.match(tagHeaders("vip;city=bj;level=1")))
+	assert.Equal(t, false, f.match(tagHeaders("vip;city=gz")))
+	assert.Equal(t, false, f.match(tagHeaders("vip;level=0")))
+	assert.Equal(t, false, f.match(tagHeaders("city=bj")))
+}
+
+func TestSubFilterMatchHeaders(t *testing.T) {
+	f, _ := parseSubFilter("url=/a?b=c;region in (bj,sh)")
+	assert.Equal(t, true, f.match([]envelope.Header{{Key: "url", Value: "/a?b=c"}, {Key: "region", Value: "sh"}}))
+	assert.Equal(t, false, f.match([]envelope.Header{{Key: "url", Value: "/a"}, {Key: "region", Value: "sh"}}))
+
+	// a header with empty value is a bare tag
+	f, _ = parseSubFilter("vip")
+	assert.Equal(t, true, f.match([]envelope.Header{{Key: "vip"}}))
+	assert.Equal(t, false, f.match([]envelope.Header{{Key: "vip0"}}))
+}
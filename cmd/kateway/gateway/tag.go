@@ -3,53 +3,136 @@ package gateway
 import (
 	"bytes"
 	"strings"
+	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/mpool"
 )
 
 const (
-	TagMarkStart = byte(1) // FIXME conflicts with ProtocolBuffer
-	TagMarkEnd   = byte(2)
 	TagSeperator = ";" // follow cookie rules a=b;c=d
+
+	// Legacy in-band tag marks, only recognized on sub for messages published
+	// before the envelope format.
+	// ┌────────────────────────────┐ ┌────────┐
+	// │TagMarkStart Tag TagMarkEnd │ │Message │
+	// └────────────────────────────┘ └────────┘
+	TagMarkStart = byte(1)
+	TagMarkEnd   = byte(2)
 )
 
+// IsTaggedMessage checks if a message is enveloped or carries legacy tag marks.
 func IsTaggedMessage(msg []byte) bool {
-	return msg[0] == TagMarkStart
+	return envelope.Valid(msg) || (Options.LegacyTag && isLegacyTaggedMessage(msg))
 }
 
-// ┌────────────────────────────┐ ┌────────┐
-// │TagMarkStart Tag TagMarkEnd │ │Message │
-// └────────────────────────────┘ └────────┘
+// AddTagToMessage wraps the message body with an envelope whose headers are the tags,
+// empty tag leaves only the publish time in the envelope.
+// m.Body must have been allocated with extra tagLen(tag) bytes.
 func AddTagToMessage(m *mpool.Message, tag string) {
-	shift := tagLen(tag)
+	headers := tagHeaders(tag)
+	shift := envelope.Len(headers)
 	for i := len(m.Body) - 1; i >= shift; i-- {
 		m.Body[i] = m.Body[i-shift]
 	}
 
-	i := 0
-	m.Body[i] = TagMarkStart
-	i++
-	for _, b := range tag {
-		m.Body[i] = byte(b)
-		i++
-	}
-	m.Body[i] = TagMarkEnd
+	envelope.Encode(m.Body, time.Now(), headers)
 }
 
+// ExtractMessageTag returns the tags and the body index of a tagged message.
 func ExtractMessageTag(msg []byte) ([]string, int, error) {
-	tagEnd := bytes.IndexByte(msg, TagMarkEnd)
-	if tagEnd == -1 {
+	if headers, bodyIdx, ok := envelope.Decode(msg); ok {
+		return headerTags(headers), bodyIdx, nil
+	}
+
+	if !isLegacyTaggedMessage(msg) {
 		// not a tagged message
 		return nil, 0, ErrIllegalTaggedMessage
 	}
 
+	tagEnd := bytes.IndexByte(msg, TagMarkEnd)
 	tag := string(msg[1:tagEnd]) // discard the tag mark start
 	tags := parseMessageTag(tag)
 	return tags, tagEnd + 1, nil
 }
 
+// ExtractMessageHeaders returns the envelope headers and the body index of a tagged message,
+// legacy tags are converted to headers.
+func ExtractMessageHeaders(msg []byte) ([]envelope.Header, int, error) {
+	if headers, bodyIdx, ok := envelope.Decode(msg); ok {
+		return headers, bodyIdx, nil
+	}
+
+	if !isLegacyTaggedMessage(msg) {
+		return nil, 0, ErrIllegalTaggedMessage
+	}
+
+	tagEnd := bytes.IndexByte(msg, TagMarkEnd)
+	return tagHeaders(string(msg[1:tagEnd])), tagEnd + 1, nil
+}
+
+// messageBody strips the envelope or legacy tag marks if any.
+func messageBody(msg []byte) []byte {
+	if !IsTaggedMessage(msg) {
+		return msg
+	}
+
+	_, bodyIdx, _ := ExtractMessageTag(msg)
+	return msg[bodyIdx:]
+}
+
+// isLegacyTaggedMessage rejects binary payloads that merely start with TagMarkStart:
+// a legacy tag is printable and no longer than the max tag length.
+func isLegacyTaggedMessage(msg []byte) bool {
+	if len(msg) < 2 || msg[0] != TagMarkStart {
+		return false
+	}
+
+	for i := 1; i < len(msg) && i <= Options.MaxMsgTagLen+1; i++ {
+		switch c := msg[i]; {
+		case c == TagMarkEnd:
+			return i > 1
+		case c < 0x20 || c > 0x7e:
+			return false
+		}
+	}
+
+	return false
+}
+
 func tagLen(tag string) int {
-	return 2 + len(tag) // TagMarkStart tag TagMarkEnd
+	return envelope.Len(tagHeaders(tag))
+}
+
+// tagHeaders converts tags a=b;c into envelope headers.
+func tagHeaders(tag string) []envelope.Header {
+	tags := parseMessageTag(tag)
+	headers := make([]envelope.Header, 0, len(tags))
+	for _, t := range tags {
+		if t == "" {
+			continue
+		}
+
+		if i := strings.Index(t, "="); i >= 0 {
+			headers = append(headers, envelope.Header{Key: t[:i], Value: t[i+1:]})
+		} else {
+			headers = append(headers, envelope.Header{Key: t})
+		}
+	}
+	return headers
+}
+
+// headerTags converts envelope headers into tags a=b, c.
+func headerTags(headers []envelope.Header) []string {
+	tags := make([]string, 0, len(headers))
+	for _, h := range headers {
+		if h.Value == "" {
+			tags = append(tags, h.Key)
+		} else {
+			tags = append(tags, h.Key+"="+h.Value)
+		}
+	}
+	return tags
 }
 
 func parseMessageTag(tag string) []string {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
 	"github.com/funkygao/gafka/mpool"
 )
 
@@ -20,7 +21,7 @@ func TestAddAndExtractMessageTag(t *testing.T) {
 	t.Logf("%s  %+v %d/%d", string(m.Body), m.Body, len(body), len(m.Body))
 	AddTagToMessage(m, tag)
 	t.Logf("%s  %+v %d", string(m.Body), m.Body, len(m.Body))
-	assert.Equal(t, TagMarkStart, m.Body[0])
+	assert.Equal(t, true, IsTaggedMessage(m.Body))
 	t.Logf("%s", string(m.Body))
 
 	// extract tag
@@ -38,6 +39,78 @@ func TestParseMessageTag(t *testing.T) {
 	assert.Equal(t, "y_", tags[1])
 }
 
+func TestValidEnvelopeHeaders(t *testing.T) {
+	assert.Equal(t, true, envelope.ValidHeaders(tagHeaders("a=b;c")))
+	assert.Equal(t, false, envelope.ValidHeaders(tagHeaders("=b")))
+}
+
+func TestBinaryPayloadNotTagged(t *testing.T) {
+	Options.LegacyTag = true
+	Options.MaxMsgTagLen = 1024
+
+	// e,g. protobuf field 0 varint
+	for _, payload := range [][]byte{
+		{TagMarkStart},
+		{TagMarkStart, 0x08, 0x96, 0x01, TagMarkEnd},
+		{TagMarkStart, TagMarkEnd, 'a'},
+		{TagMarkStart, 'a', 'b'},
+		{0xEB, 'K', 'W', 'E', envelope.Version, 0, 0, 0, 0, 0, 1},
+	} {
+		assert.Equal(t, false, IsTaggedMessage(payload))
+		assert.Equal(t, string(payload), string(messageBody(payload)))
+	}
+}
+
+func TestLegacyTaggedMessage(t *testing.T) {
+	Options.MaxMsgTagLen = 1024
+	legacy := append([]byte{TagMarkStart}, "a=b;c"...)
+	legacy = append(legacy, TagMarkEnd)
+	legacy = append(legacy, "hello"...)
+
+	Options.LegacyTag = true
+	assert.Equal(t, true, IsTaggedMessage(legacy))
+	tags, bodyIdx, err := ExtractMessageTag(legacy)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"a=b", "c"}, tags)
+	assert.Equal(t, "hello", string(legacy[bodyIdx:]))
+	headers, bodyIdx, err := ExtractMessageHeaders(legacy)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []envelope.Header{{Key: "a", Value: "b"}, {Key: "c"}}, headers)
+	assert.Equal(t, "hello", string(legacy[bodyIdx:]))
+
+	Options.LegacyTag = false
+	assert.Equal(t, false, IsTaggedMessage(legacy))
+	Options.LegacyTag = true
+}
+
+func TestAddTagToMessageRoundTrip(t *testing.T) {
+	tag := "tag=order;region=bj;vip"
+	body := "hello world"
+	m := mpool.NewMessage(len(body) + tagLen(tag))
+	m.Body = m.Body[:len(body)+tagLen(tag)]
+	copy(m.Body, body)
+	AddTagToMessage(m, tag)
+
+	assert.Equal(t, true, envelope.Valid(m.Body))
+	tags, bodyIdx, err := ExtractMessageTag(m.Body)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"tag=order", "region=bj", "vip"}, tags)
+	assert.Equal(t, body, string(m.Body[bodyIdx:]))
+	assert.Equal(t, body, string(messageBody(m.Body)))
+}
+
+func TestAddEmptyTagToMessage(t *testing.T) {
+	// pub without tag while -pubts
+	body := "hello"
+	m := mpool.NewMessage(len(body) + tagLen(""))
+	m.Body = m.Body[:len(body)+tagLen("")]
+	copy(m.Body, body)
+	AddTagToMessage(m, "")
+	_, ok := envelope.MessageTime(m.Body)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, body, string(messageBody(m.Body)))
+}
+
 func BenchmarkAddTagToMessage(b *testing.B) {
 	b.ReportAllocs()
 	m := mpool.NewMessage(1024)
@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	xaStatusCommit   = "commit"
+	xaStatusRollback = "rollback"
+)
+
+// xaCheckback periodically asks producers for the outcome of prepared messages
+// that stay undecided too long, and redelivers committed messages whose delivery
+// was interrupted.
+//
+// Any live kateway may claim such messages, including those accepted by a dead
+// kateway; a claim touches the message so that it is not checked by all kateway
+// instances in the same round.
+func (this *pubServer) xaCheckback() {
+	ticker := time.NewTicker(Options.XaCheckInterval)
+	defer func() {
+		ticker.Stop()
+		log.Debug("xa checkback done")
+		this.gw.wg.Done()
+	}()
+
+	client := &http.Client{
+		Timeout: Options.XaCheckbackTimeout,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: 1,
+			Proxy:               nil,
+			Dial: (&net.Dialer{
+				Timeout: Options.XaCheckbackTimeout,
+			}).Dial,
+			ResponseHeaderTimeout: Options.XaCheckbackTimeout,
+			TLSHandshakeTimeout:   Options.XaCheckbackTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// a redirect could lead to a host not allowed
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for {
+		select {
+		case <-this.gw.shutdownCh:
+			return
+
+		case <-ticker.C:
+			txns, err := xa.Default.Claim(this.gw.id, Options.XaCheckbackAge)
+			if err != nil {
+				log.Error("xa checkback: %v", err)
+				continue
+			}
+
+			for _, txn := range txns {
+				select {
+				case <-this.gw.shutdownCh:
+					return
+				default:
+				}
+
+				this.xaResolve(client, txn)
+			}
+		}
+	}
+}
+
+func (this *pubServer) xaResolve(client *http.Client, txn xa.Txn) {
+	xid := fmt.Sprintf("%d", txn.Xid)
+	if txn.State == xa.StateDelivering {
+		// committed, but the kateway crashed or failed to publish
+		if _, _, err := this.xaDeliver(txn); err != nil {
+			log.Error("xa? %s redeliver: %v", txn, err)
+			return
+		}
+
+		log.Warn("xa? %s redelivered", txn)
+		return
+	}
+
+	expired := time.Since(time.Unix(txn.Ctime, 0)) > Options.XaMaxPrepareAge
+
+	var (
+		status string
+		err    error
+	)
+	if txn.Checkback != "" {
+		status, err = this.xaQueryProducer(client, txn.Checkback, xid)
+		if err != nil {
+			log.Warn("xa? %s %v", txn, err)
+		}
+	}
+
+	switch {
+	case status == xaStatusCommit:
+		var committed xa.Txn
+		if committed, err = xa.Default.Commit(txn.Appid, xid); err != nil {
+			// decided by producer while we are asking
+			log.Debug("xa? %s %v", txn, err)
+			return
+		}
+
+		if _, _, err = this.xaDeliver(committed); err != nil {
+			log.Error("xa? %s commit: %v", txn, err)
+			return
+		}
+
+		log.Info("xa? %s checkback committed", txn)
+
+	case status == xaStatusRollback, expired:
+		if _, err = xa.Default.Rollback(txn.Appid, xid); err != nil {
+			log.Debug("xa? %s %v", txn, err)
+			return
+		}
+
+		if status == xaStatusRollback {
+			log.Info("xa? %s checkback rolled back", txn)
+		} else {
+			log.Warn("xa? %s undecided after %s, rolled back", txn, Options.XaMaxPrepareAge)
+		}
+
+	default:
+		// unknown yet, ask again in next round
+	}
+
+	if Options.AuditPub && err == nil && (status != "" || expired) {
+		this.auditor.Trace("xa?[%s] {%s} xid:%s status:%s expired:%v",
+			txn.Appid, txn.Topic, xid, status, expired)
+	}
+}
+
+// xaQueryProducer asks the producer for a transaction status.
+//
+// The checkback url is called as GET checkback?id=xid and the producer responds
+// {"status": "commit|rollback|unknown"}.
+func (this *pubServer) xaQueryProducer(client *http.Client, checkback, xid string) (status string, err error) {
+	// the allowed hosts might have changed since prepare
+	var u *url.URL
+	if u, err = parseCheckback(checkback); err != nil {
+		return
+	}
+
+	q := u.Query()
+	q.Set("id", xid)
+	u.RawQuery = q.Encode()
+
+	var response *http.Response
+	response, err = client.Get(u.String())
+	if err != nil {
+		return
+	}
+
+	var body []byte
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return
+	}
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("GET[%s] -> %d %s", u.String(), response.StatusCode, string(body))
+		return
+	}
+
+	var v struct {
+		Status string `json:"status"`
+	}
+	if err = json.Unmarshal(body, &v); err != nil {
+		return
+	}
+
+	status = v.Status
+	return
+}
+
+// parseCheckback parses a producer checkback url, which must be http(s) on
+// a host allowed by Options.XaCheckbackHosts so that kateway cannot be made
+// to call arbitrary internal urls.
+func parseCheckback(checkback string) (*url.URL, error) {
+	u, err := url.Parse(checkback)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrCheckbackNotAllowed
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" || u.User != nil {
+		return nil, ErrCheckbackNotAllowed
+	}
+
+	for _, allowed := range strings.Split(Options.XaCheckbackHosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "":
+		case strings.HasPrefix(allowed, "."):
+			if strings.HasSuffix(host, allowed) {
+				return u, nil
+			}
+		case host == allowed:
+			return u, nil
+		}
+	}
+
+	return nil, ErrCheckbackNotAllowed
+}
@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/envelope"
+	"github.com/funkygao/gafka/cmd/kateway/manager"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+	xadummy "github.com/funkygao/gafka/cmd/kateway/xa/dummy"
+	"github.com/funkygao/httprouter"
+)
+
+type xaManager struct {
+	manager.Manager
+}
+
+func (this *xaManager) OwnTopic(appid, pubkey, topic string) error { return nil }
+func (this *xaManager) Auth(appid, secret string) error            { return nil }
+func (this *xaManager) LookupCluster(appid string) (string, bool)  { return "trade", true }
+func (this *xaManager) Quota(appid, topic string) manager.Quota    { return manager.Quota{} }
+func (this *xaManager) KafkaTopic(appid string, topic string, ver string) string {
+	return appid + "." + topic + "." + ver
+}
+
+type xaPubStore struct {
+	store.PubStore
+
+	mu   sync.Mutex
+	down bool
+	msgs []string
+}
+
+func (this *xaPubStore) SyncPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.down {
+		return 0, 0, errors.New("kafka down")
+	}
+
+	this.msgs = append(this.msgs, string(msg))
+	return 0, int64(len(this.msgs) - 1), nil
+}
+
+func setupXa(t *testing.T) (*pubServer, *xaPubStore, func()) {
+	oldOptions, oldManager, oldStore, oldXa := Options, manager.Default, store.DefaultPubStore, xa.Default
+	Options.Ratelimit = false
+	Options.DisableMetrics = true
+	Options.AuditPub = false
+	Options.EnableHintedHandoff = false
+	Options.MaxPubSize = 1 << 10
+	Options.MinPubSize = 1
+	Options.XaCheckbackHosts = "127.0.0.1"
+
+	ps := &xaPubStore{}
+	manager.Default = &xaManager{}
+	store.DefaultPubStore = ps
+	xa.Default = xadummy.New()
+
+	s := &pubServer{webServer: &webServer{gw: &Gateway{id: "1"}}}
+	return s, ps, func() {
+		Options, manager.Default, store.DefaultPubStore, xa.Default = oldOptions, oldManager, oldStore, oldXa
+	}
+}
+
+func xaPrepareRequest(s *pubServer, msg, checkback string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/v1/xa/prepare/foobar/v1?checkback="+checkback, strings.NewReader(msg))
+	r.Header.Set(HttpHeaderAppid, "app1")
+	w := httptest.NewRecorder()
+	s.xa_prepare(w, r, httprouter.Params{
+		httprouter.Param{Key: UrlParamTopic, Value: "foobar"},
+		httprouter.Param{Key: UrlParamVersion, Value: "v1"},
+	})
+	return w
+}
+
+func xaPrepare(t *testing.T, s *pubServer, msg, checkback string) string {
+	w := xaPrepareRequest(s, msg, checkback)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	xid := w.Header().Get(HttpHeaderXid)
+	assert.NotEqual(t, "", xid)
+	return xid
+}
+
+func xaDecide(s *pubServer, op, xid string) int {
+	r, _ := http.NewRequest("POST", "/v1/xa/"+op+"?id="+xid, nil)
+	r.Header.Set(HttpHeaderAppid, "app1")
+	w := httptest.NewRecorder()
+	if op == "commit" {
+		s.xa_commit(w, r, nil)
+	} else {
+		s.xa_rollback(w, r, nil)
+	}
+	return w.Code
+}
+
+func TestXaCommitAndRollback(t *testing.T) {
+	s, ps, teardown := setupXa(t)
+	defer teardown()
+
+	xid := xaPrepare(t, s, "hello", "")
+	assert.Equal(t, 0, len(ps.msgs)) // invisible until committed
+	assert.Equal(t, http.StatusOK, xaDecide(s, "commit", xid))
+	assert.Equal(t, []string{"hello"}, ps.msgs)
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", xid))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "rollback", xid))
+
+	xid = xaPrepare(t, s, "world", "")
+	assert.Equal(t, http.StatusOK, xaDecide(s, "rollback", xid))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", xid))
+	assert.Equal(t, 1, len(ps.msgs))
+
+	assert.Equal(t, http.StatusBadRequest, xaDecide(s, "commit", "abc"))
+	assert.Equal(t, http.StatusBadRequest, xaDecide(s, "rollback", ""))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", "12345"))
+}
+
+func TestXaCommitPubFailure(t *testing.T) {
+	s, ps, teardown := setupXa(t)
+	defer teardown()
+
+	xid := xaPrepare(t, s, "hello", "")
+	ps.down = true
+	assert.Equal(t, http.StatusInternalServerError, xaDecide(s, "commit", xid))
+
+	// put back to prepared, producer can retry
+	ps.down = false
+	assert.Equal(t, http.StatusOK, xaDecide(s, "commit", xid))
+	assert.Equal(t, []string{"hello"}, ps.msgs)
+}
+
+func TestXaCheckback(t *testing.T) {
+	s, ps, teardown := setupXa(t)
+	defer teardown()
+	Options.XaMaxPrepareAge = 1 << 62
+
+	status := map[string]string{}
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"` + status[r.URL.Query().Get("id")] + `"}`))
+	}))
+	defer producer.Close()
+
+	committed := xaPrepare(t, s, "committed", producer.URL)
+	rolledback := xaPrepare(t, s, "rolledback", producer.URL)
+	unknown := xaPrepare(t, s, "unknown", producer.URL)
+	status[committed] = xaStatusCommit
+	status[rolledback] = xaStatusRollback
+
+	// kateway crashed after marking delivering
+	crashed := xaPrepare(t, s, "crashed", "")
+	_, err := xa.Default.Commit("app1", crashed)
+	assert.Equal(t, nil, err)
+
+	// claimed by another kateway
+	txns, err := xa.Default.Claim("2", 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(txns))
+	for _, txn := range txns {
+		assert.Equal(t, "2", txn.Owner)
+		s.xaResolve(producer.Client(), txn)
+	}
+
+	assert.Equal(t, 2, len(ps.msgs))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", committed))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", rolledback))
+	assert.Equal(t, http.StatusConflict, xaDecide(s, "commit", crashed))
+	assert.Equal(t, http.StatusOK, xaDecide(s, "commit", unknown))
+	assert.Equal(t, 3, len(ps.msgs))
+}
+
+func TestParseCheckback(t *testing.T) {
+	oldOptions := Options
+	defer func() { Options = oldOptions }()
+
+	Options.XaCheckbackHosts = "producer.local, .svc.example.com"
+	for _, checkback := range []string{
+		"http://producer.local/xa/status",
+		"https://PRODUCER.local:8080/xa/status?a=b",
+		"http://order.svc.example.com/xa",
+	} {
+		_, err := parseCheckback(checkback)
+		assert.Equal(t, nil, err)
+	}
+
+	for _, checkback := range []string{
+		"file:///etc/passwd",
+		"gopher://producer.local/",
+		"http://127.0.0.1:10191/v1/status",
+		"http://producer.local.evil.com/",
+		"http://svc.example.com.evil/",
+		"http://user@producer.local/",
+		"/xa/status",
+	} {
+		_, err := parseCheckback(checkback)
+		assert.Equal(t, ErrCheckbackNotAllowed, err)
+	}
+
+	Options.XaCheckbackHosts = ""
+	_, err := parseCheckback("http://producer.local/xa/status")
+	assert.Equal(t, ErrCheckbackNotAllowed, err)
+}
+
+func TestXaPrepareCheckbackNotAllowed(t *testing.T) {
+	s, ps, teardown := setupXa(t)
+	defer teardown()
+
+	for _, checkback := range []string{"http://10.0.0.1/admin", "file:///etc/passwd"} {
+		w := xaPrepareRequest(s, "hello", checkback)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+	assert.Equal(t, 0, len(ps.msgs))
+}
+
+func TestXaDeliverPubTimestamp(t *testing.T) {
+	s, ps, teardown := setupXa(t)
+	defer teardown()
+
+	Options.PubTimestamp = true
+	xid := xaPrepare(t, s, "hello", "")
+	assert.Equal(t, http.StatusOK, xaDecide(s, "commit", xid))
+	assert.Equal(t, 1, len(ps.msgs))
+
+	msg := []byte(ps.msgs[0])
+	ts, ok := envelope.MessageTime(msg)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, time.Since(ts) < time.Minute)
+	_, bodyIdx, ok := envelope.Decode(msg)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "hello", string(msg[bodyIdx:]))
+}
@@ -6,15 +6,24 @@ import (
 	"io"
 )
 
+const (
+	// attrIndexed marks a replicated block that carries its raft log index.
+	attrIndexed byte = 1 << 0
+)
+
 type block struct {
-	magic [2]byte // TODO [0]magic [1]attr
+	magic [2]byte // [0]magic [1]attr
+	index uint64  // raft log index of a replicated block, 0 if not replicated
 	key   []byte
 	value []byte
 
-	rbuf, wbuf [4]byte
+	rbuf, wbuf [8]byte
 }
 
 func (b *block) size() int64 {
+	if b.index > 0 {
+		return int64(len(b.key) + len(b.value) + 18)
+	}
 	return int64(len(b.key) + len(b.value) + 10)
 }
 
@@ -27,10 +36,21 @@ func (b *block) valueLen() uint32 {
 }
 
 func (b *block) writeTo(w io.Writer) (err error) {
-	if err = writeBytes(w, b.magic[:]); err != nil {
+	magic := b.magic
+	if b.index > 0 {
+		magic[1] |= attrIndexed
+	}
+	if err = writeBytes(w, magic[:]); err != nil {
 		return
 	}
 
+	if b.index > 0 {
+		binary.BigEndian.PutUint64(b.wbuf[:], b.index)
+		if err = writeBytes(w, b.wbuf[:]); err != nil {
+			return
+		}
+	}
+
 	if err = b.writeUint32(w, b.keyLen()); err != nil {
 		return
 	}
@@ -55,10 +75,16 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 	if err := readBytes(r, b.rbuf[:2]); err != nil {
 		return err
 	}
-	for i := 0; i < len(currentMagic); i++ {
-		if b.rbuf[i] != currentMagic[i] {
-			return ErrSegmentCorrupt
+	if b.rbuf[0] != currentMagic[0] || b.rbuf[1]&^attrIndexed != currentMagic[1] {
+		return ErrSegmentCorrupt
+	}
+
+	b.index = 0
+	if b.rbuf[1]&attrIndexed != 0 {
+		if err := readBytes(r, b.rbuf[:]); err != nil {
+			return err
 		}
+		b.index = binary.BigEndian.Uint64(b.rbuf[:])
 	}
 
 	keyLen, err := b.readUint32(r)
@@ -82,6 +108,8 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 			b.key = b.key[:int(keyLen)]
 		}
 		copy(b.key, buf[:int(keyLen)])
+	} else {
+		b.key = b.key[:0]
 	}
 
 	valueLen, err := b.readUint32(r)
@@ -109,15 +137,15 @@ func (b *block) readFrom(r io.Reader, buf []byte) error {
 }
 
 func (b *block) readUint32(r io.Reader) (uint32, error) {
-	if err := readBytes(r, b.rbuf[:]); err != nil {
+	if err := readBytes(r, b.rbuf[:4]); err != nil {
 		return 0, err
 	}
-	return binary.BigEndian.Uint32(b.rbuf[:]), nil
+	return binary.BigEndian.Uint32(b.rbuf[:4]), nil
 }
 
 func (b *block) writeUint32(w io.Writer, v uint32) error {
-	binary.BigEndian.PutUint32(b.wbuf[:], v)
-	return writeBytes(w, b.wbuf[:])
+	binary.BigEndian.PutUint32(b.wbuf[:4], v)
+	return writeBytes(w, b.wbuf[:4])
 }
 
 func writeBytes(w io.Writer, b []byte) error {
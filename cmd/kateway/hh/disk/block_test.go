@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/funkygao/assert"
@@ -18,5 +19,26 @@ func TestBlockBasic(t *testing.T) {
 }
 
 func TestBlockReadWrite(t *testing.T) {
-	t.SkipNow()
+	var buf bytes.Buffer
+	b1 := block{magic: currentMagic, key: []byte("k"), value: []byte("v1")}
+	b2 := block{magic: currentMagic, index: 1 << 40, value: []byte("v2")}
+	assert.Equal(t, nil, b1.writeTo(&buf))
+	assert.Equal(t, nil, b2.writeTo(&buf))
+	assert.Equal(t, b1.size()+b2.size(), int64(buf.Len()))
+
+	var b block
+	rbuf := make([]byte, maxBlockSize)
+	assert.Equal(t, nil, b.readFrom(&buf, rbuf))
+	assert.Equal(t, uint64(0), b.index)
+	assert.Equal(t, "v1", string(b.value))
+	assert.Equal(t, b1.size(), b.size())
+
+	// the block is reused by reader
+	assert.Equal(t, nil, b.readFrom(&buf, rbuf))
+	assert.Equal(t, uint64(1<<40), b.index)
+	assert.Equal(t, "v2", string(b.value))
+	assert.Equal(t, b2.size(), b.size())
+
+	buf.Write([]byte{currentMagic[0], 1 << 7})
+	assert.Equal(t, ErrSegmentCorrupt, b.readFrom(&buf, rbuf))
 }
@@ -0,0 +1,28 @@
+package disk
+
+const (
+	opAppend     = "append"
+	opCheckpoint = "checkpoint"
+	opHeartbeat  = "heartbeat"
+	opTakeover   = "takeover"
+)
+
+// command is the replicated raft log entry.
+type command struct {
+	Op    string `json:"op"`
+	ReqId uint64 `json:"id,omitempty"` // proposer's request id, for append only
+	By    uint64 `json:"by"`           // proposer, or new pumper for takeover
+	Owner uint64 `json:"owner,omitempty"`
+
+	Cluster string `json:"cluster,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Key     []byte `json:"k,omitempty"`
+	Value   []byte `json:"v,omitempty"`
+	Index   uint64 `json:"idx,omitempty"` // raft index of the last delivered block, for checkpoint only
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
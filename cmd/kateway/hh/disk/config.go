@@ -2,6 +2,9 @@ package disk
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,12 +12,24 @@ type Config struct {
 	Dirs          []string
 	PurgeInterval time.Duration
 	MaxAge        time.Duration
+
+	// Raft replication is enabled only when RaftId is not 0.
+	RaftId            uint64
+	RaftAddr          string            // raft transport listen addr
+	RaftPeers         map[uint64]string // raft id -> raft addr, self inclusive
+	RaftSecret        string            // shared secret that signs raft messages between peers
+	RaftTick          time.Duration
+	HeartbeatInterval time.Duration // how often a node announces it is alive
+	OwnerTimeout      time.Duration // how long before a silent node's backlog is taken over
 }
 
 func DefaultConfig() *Config {
 	return &Config{
-		PurgeInterval: defaultPurgeInterval,
-		MaxAge:        defaultMaxAge,
+		PurgeInterval:     defaultPurgeInterval,
+		MaxAge:            defaultMaxAge,
+		RaftTick:          defaultRaftTick,
+		HeartbeatInterval: defaultHeartbeatInterval,
+		OwnerTimeout:      defaultOwnerTimeout,
 	}
 }
 
@@ -23,5 +38,52 @@ func (this *Config) Validate() error {
 		return errors.New("hh Dirs must be specified")
 	}
 
+	if this.RaftId == 0 {
+		return nil
+	}
+
+	if this.RaftAddr == "" {
+		return errors.New("hh RaftAddr must be specified")
+	}
+	if _, present := this.RaftPeers[this.RaftId]; !present {
+		return errors.New("hh RaftPeers must include self")
+	}
+	if this.RaftSecret == "" {
+		return errors.New("hh RaftSecret must be specified")
+	}
+	if this.OwnerTimeout <= this.HeartbeatInterval {
+		return errors.New("hh OwnerTimeout must be greater than HeartbeatInterval")
+	}
+
 	return nil
 }
+
+// Replicated returns whether the queues are replicated to peers with raft.
+func (this *Config) Replicated() bool {
+	return this.RaftId != 0
+}
+
+// ParsePeers parses raft peers in the form of "1=host1:port,2=host2:port".
+func ParsePeers(s string) (map[uint64]string, error) {
+	peers := make(map[uint64]string)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid peer: %s", p)
+		}
+
+		id, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid peer id: %s", p)
+		}
+
+		peers[id] = parts[1]
+	}
+
+	return peers, nil
+}
@@ -32,15 +32,28 @@ type Service struct {
 	//         ├── 00000000000000000003
 	//         └── cursor.dmp
 	queues map[clusterTopic]*queue
+
+	// replicator is nil if raft replication is disabled
+	replicator *replicator
 }
 
 func New(cfg *Config) hh.Service {
-	timer = timewheel.NewTimeWheel(time.Second, 120)
-	return &Service{
+	timerMu.Lock()
+	if timerRef == 0 {
+		timer = timewheel.NewTimeWheel(time.Second, 120)
+	}
+	timerRef++
+	timerMu.Unlock()
+
+	this := &Service{
 		cfg:    cfg,
 		queues: make(map[clusterTopic]*queue),
 		closed: true,
 	}
+	if cfg.Replicated() {
+		this.replicator = newReplicator(this)
+	}
+	return this
 }
 
 func (this *Service) Name() string {
@@ -59,11 +72,23 @@ func (this *Service) Start() (err error) {
 
 	}
 
+	if this.replicator != nil {
+		if err = this.replicator.Start(); err != nil {
+			return
+		}
+	}
+
 	this.closed = false
 	return
 }
 
 func (this *Service) Stop() {
+	if this.replicator != nil && !this.closed {
+		// stop applying raft log before the queues close
+		// raft apply needs the lock, so stop it before we lock
+		this.replicator.Stop()
+	}
+
 	this.rwmux.Lock()
 	defer this.rwmux.Unlock()
 
@@ -80,7 +105,12 @@ func (this *Service) Stop() {
 	}
 	this.queues = make(map[clusterTopic]*queue)
 
-	timer.Stop()
+	timerMu.Lock()
+	timerRef--
+	if timerRef == 0 {
+		timer.Stop()
+	}
+	timerMu.Unlock()
 	this.closed = true
 }
 
@@ -124,10 +154,27 @@ func (this *Service) Append(cluster, topic string, key, value []byte) error {
 		return ErrNotOpen
 	}
 
-	b := &block{magic: currentMagic, key: key, value: value}
 	ct := clusterTopic{cluster: cluster, topic: topic}
+	if this.replicator != nil {
+		// the block is appended to local queue when the raft log entry is applied
+		err := this.replicator.Append(cluster, topic, key, value)
+		if err != ErrNoLeader {
+			// a timed out proposal might still commit, appending it locally too
+			// would deliver it twice
+			return err
+		}
 
-	log.Debug("hh[%s] append %s/%s", this.Name(), cluster, topic)
+		// without leader, we still accept the block to keep pub available, but it
+		// is lost if this node dies before delivering it.
+		log.Warn("hh[%s] %s/%s %v, append without replication", this.Name(), cluster, topic, err)
+	}
+
+	return this.append(ct, &block{magic: currentMagic, key: key, value: value})
+}
+
+// append appends a block to local queue without replication.
+func (this *Service) append(ct clusterTopic, b *block) error {
+	log.Debug("hh[%s] append %s/%s", this.Name(), ct.cluster, ct.topic)
 
 	this.rwmux.RLock()
 	q, present := this.queues[ct]
@@ -212,7 +259,7 @@ func (this *Service) loadQueues(dir string, startQueues bool) error {
 
 	// load queues from disk
 	for _, cluster := range clusters {
-		if !cluster.IsDir() {
+		if !cluster.IsDir() || cluster.Name() == replicaDir || cluster.Name() == raftDir {
 			continue
 		}
 
@@ -242,6 +289,9 @@ func (this *Service) createAndOpenQueue(baseDir string, ct clusterTopic, start b
 	}
 
 	this.queues[ct] = newQueue(baseDir, ct, defaultMaxQueueSize, this.cfg.PurgeInterval, this.cfg.MaxAge)
+	if this.replicator != nil {
+		this.replicator.hook(this.replicator.id, this.queues[ct])
+	}
 	if err := this.queues[ct].Open(); err != nil {
 		return err
 	}
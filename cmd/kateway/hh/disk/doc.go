@@ -1,3 +1,6 @@
 // Package disk implements a disk-backend hinted handoff which
 // uses raft for replication.
+//
+// When replication is enabled, the queues of a kateway are replicated to its
+// peers, and a live peer pumps the backlog of a dead kateway to kafka.
 package disk
@@ -16,4 +16,8 @@ var (
 	ErrCursorNotFound   = fmt.Errorf("cursor not found")
 	ErrCursorOutOfRange = fmt.Errorf("cursor out of range")
 	ErrHeadIsTail       = fmt.Errorf("head is tail")
+	ErrProposeTimeout   = fmt.Errorf("raft propose timeout")
+	ErrReplicatorClosed = fmt.Errorf("replicator closed")
+	ErrNoLeader         = fmt.Errorf("raft has no leader")
+	ErrRaftLogFailed    = fmt.Errorf("raft log failed")
 )
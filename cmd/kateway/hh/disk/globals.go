@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"sync"
 	"time"
 
 	"github.com/funkygao/golib/timewheel"
@@ -22,6 +23,16 @@ const (
 	flusherMaxRetries    = 3
 	pollSleep            = time.Second
 	dumpPerBlocks        = 100
+
+	replicaDir               = "_replicas" // reserved dir name, never a cluster name
+	raftDir                  = "_raft"
+	defaultRaftTick          = time.Millisecond * 100
+	defaultHeartbeatInterval = time.Second * 5
+	defaultOwnerTimeout      = time.Second * 30
+	raftElectionTicks        = 10
+	raftHeartbeatTicks       = 1
+	raftProposeTimeout       = time.Second * 5
+	raftCompactEvery         = 10000
 )
 
 var (
@@ -30,7 +41,9 @@ var (
 
 	currentMagic = [2]byte{0, 0}
 
-	timer *timewheel.TimeWheel
+	timer    *timewheel.TimeWheel
+	timerRef int // services sharing the timer
+	timerMu  sync.Mutex
 
 	// group commit
 	flushEveryBlocks = 100
@@ -23,6 +23,7 @@ func (q *queue) pump() {
 		okN, failN int64
 		retries    int
 		backoff    time.Duration
+		skipped    uint64 // raft index up to which blocks delivered by peers are skipped
 	)
 	for {
 		select {
@@ -32,11 +33,45 @@ func (q *queue) pump() {
 		default:
 		}
 
+		if q.delivered != nil {
+			if upto := q.delivered(); upto > skipped {
+				n, e := q.skip(upto)
+				switch e {
+				case nil:
+					skipped = upto
+				case ErrEOQ:
+					// delivered blocks not flushed to us yet
+				default:
+					log.Error("queue[%s] skip: %s", q.ident(), e)
+				}
+				if n > 0 {
+					log.Debug("queue[%s] skipped %d blocks delivered by peer", q.ident(), n)
+				}
+			}
+		}
+
+		if q.standby != nil && q.standby() {
+			select {
+			case <-q.quit:
+				log.Trace("queue[%s] pump done, delivered: %d/%d", q.ident(), okN, failN)
+				return
+			case <-timer.After(pollSleep):
+			}
+			continue
+		}
+
 		backoff = initialBackoff
 
 		err = q.Next(&b)
 		switch err {
 		case nil:
+			if q.delivered != nil && b.index > 0 && b.index <= q.delivered() {
+				// delivered by peer while we were in standby
+				q.cursor.commitPosition()
+				q.inflights.Add(-1)
+				continue
+			}
+
 			for retries = 0; retries < defaultMaxRetries; retries++ {
 				// TODO we might use AsyncPub
 				partition, offset, err = store.DefaultPubStore.SyncPub(q.clusterTopic.cluster, q.clusterTopic.topic, b.key, b.value)
@@ -49,6 +84,9 @@ func (q *queue) pump() {
 					okN++
 					q.inflights.Add(-1)
 					q.deliverN.Add(1)
+					if q.onDeliver != nil {
+						q.onDeliver(b.index)
+					}
 					if okN%dumpPerBlocks == 0 {
 						if e := q.cursor.dump(); e != nil {
 							log.Error("queue[%s] dump: %s", q.ident(), e)
@@ -60,6 +98,9 @@ func (q *queue) pump() {
 					failN++
 					q.deliverN.Add(1)
 					q.inflights.Add(-1)
+					if q.onDeliver != nil {
+						q.onDeliver(b.index)
+					}
 					err = nil // move ahead without retry
 					break
 				}
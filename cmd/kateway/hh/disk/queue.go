@@ -71,6 +71,11 @@ type queue struct {
 
 	quit          chan struct{}
 	emptyInflight sync2.AtomicInt32
+
+	// replication hooks, nil if not replicated
+	standby   func() bool   // pump stays idle while another node delivers this queue
+	delivered func() uint64 // raft index up to which blocks have been delivered by any node
+	onDeliver func(uint64)  // called with the block raft index each time pump moves past a block
 }
 
 // newQueue create a queue that will store segments in dir and that will
@@ -347,6 +352,27 @@ func (q *queue) Next(b *block) (err error) {
 
 }
 
+// skip advances the cursor over the leading replicated blocks whose raft index
+// is not greater than upto, i,e. they have been delivered by another node.
+// Only the pump goroutine is allowed to call it.
+func (q *queue) skip(upto uint64) (n int64, err error) {
+	var b block
+	for {
+		if err = q.Next(&b); err != nil {
+			return
+		}
+
+		if b.index == 0 || b.index > upto {
+			err = q.Rollback(&b)
+			return
+		}
+
+		q.cursor.commitPosition()
+		q.inflights.Add(-1)
+		n++
+	}
+}
+
 func (q *queue) EmptyInflight() bool {
 	return q.emptyInflight.Get() == 1
 }
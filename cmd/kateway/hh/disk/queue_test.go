@@ -78,3 +78,41 @@ func TestQueueCorrupt(t *testing.T) {
 		}
 	}
 }
+
+func TestQueueSkip(t *testing.T) {
+	os.RemoveAll("hh")
+	defer os.RemoveAll("hh")
+
+	q := newQueue("hh", clusterTopic{cluster: "me", topic: "foobar"}, 0, time.Second, time.Hour)
+	assert.Equal(t, nil, q.Open())
+	defer q.Close()
+
+	// 0 is appended without quorum, never skipped
+	for _, idx := range []uint64{3, 5, 0, 7, 9} {
+		b := block{magic: currentMagic, index: idx, value: []byte(fmt.Sprintf("v%d", idx))}
+		assert.Equal(t, nil, q.Append(&b))
+	}
+
+	n, err := q.skip(2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), n)
+
+	n, err = q.skip(7)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), n)
+
+	var b block
+	assert.Equal(t, nil, q.Next(&b))
+	assert.Equal(t, "v0", string(b.value))
+	q.cursor.commitPosition()
+
+	n, err = q.skip(8)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, nil, q.Next(&b))
+	assert.Equal(t, uint64(9), b.index)
+	q.cursor.commitPosition()
+
+	_, err = q.skip(10)
+	assert.Equal(t, ErrEOQ, err)
+}
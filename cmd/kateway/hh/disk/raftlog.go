@@ -0,0 +1,247 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
+)
+
+const (
+	raftHardStateFile = "hardstate"
+	raftSnapshotFile  = "snapshot"
+	raftEntriesFile   = "entries"
+	raftAppliedFile   = "applied"
+)
+
+// raftLog persists the raft hard state, log entries and applied index so that
+// a node can restart without replaying blocks it has already appended.
+//
+// Entries are appended as length prefixed records, the file is rewritten when
+// the log is compacted.
+type raftLog struct {
+	dir     string
+	entries *os.File
+}
+
+func openRaftLog(dir string) (*raftLog, error) {
+	if err := mkdirIfNotExist(dir); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, raftEntriesFile), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &raftLog{dir: dir, entries: f}, nil
+}
+
+// load restores the raft storage, restored is false for a brand new node.
+func (this *raftLog) load(storage *raft.MemoryStorage) (restored bool, applied uint64,
+	confState raftpb.ConfState, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(this.path(raftSnapshotFile)); err == nil {
+		var snap raftpb.Snapshot
+		if err = snap.Unmarshal(b); err != nil {
+			return
+		}
+		if err = storage.ApplySnapshot(snap); err != nil {
+			return
+		}
+		confState = snap.Metadata.ConfState
+		applied = snap.Metadata.Index
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	if b, err = ioutil.ReadFile(this.path(raftHardStateFile)); err == nil {
+		var hs raftpb.HardState
+		if err = hs.Unmarshal(b); err != nil {
+			return
+		}
+		if err = storage.SetHardState(hs); err != nil {
+			return
+		}
+		restored = true
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	if _, err = this.entries.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	r := bufio.NewReader(this.entries)
+	var lenBuf [4]byte
+	for {
+		if _, err = io.ReadFull(r, lenBuf[:]); err != nil {
+			break
+		}
+
+		rec := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+		if _, err = io.ReadFull(r, rec); err != nil {
+			// torn write of the last record
+			break
+		}
+
+		var ent raftpb.Entry
+		if err = ent.Unmarshal(rec); err != nil {
+			return
+		}
+		if err = storage.Append([]raftpb.Entry{ent}); err != nil {
+			return
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	if b, err = ioutil.ReadFile(this.path(raftAppliedFile)); err == nil {
+		var n uint64
+		if n, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return
+		}
+		if n > applied {
+			applied = n
+		}
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// Save persists a raft Ready before its messages are sent.
+func (this *raftLog) Save(hs raftpb.HardState, entries []raftpb.Entry, snap raftpb.Snapshot) error {
+	if !raft.IsEmptySnap(snap) {
+		b, err := snap.Marshal()
+		if err != nil {
+			return err
+		}
+		if err = this.writeFile(raftSnapshotFile, b); err != nil {
+			return err
+		}
+	}
+
+	if len(entries) > 0 {
+		var lenBuf [4]byte
+		w := bufio.NewWriter(this.entries)
+		for _, ent := range entries {
+			b, err := ent.Marshal()
+			if err != nil {
+				return err
+			}
+
+			binary.BigEndian.PutUint32(lenBuf[:], uint32(len(b)))
+			if _, err = w.Write(lenBuf[:]); err != nil {
+				return err
+			}
+			if _, err = w.Write(b); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if err := this.entries.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if !raft.IsEmptyHardState(hs) {
+		b, err := hs.Marshal()
+		if err != nil {
+			return err
+		}
+		return this.writeFile(raftHardStateFile, b)
+	}
+
+	return nil
+}
+
+func (this *raftLog) SaveApplied(applied uint64) error {
+	return this.writeFile(raftAppliedFile, []byte(strconv.FormatUint(applied, 10)))
+}
+
+// Compact persists the snapshot and rewrites the entries file with entries after it.
+func (this *raftLog) Compact(snap raftpb.Snapshot, storage *raft.MemoryStorage) error {
+	b, err := snap.Marshal()
+	if err != nil {
+		return err
+	}
+	if err = this.writeFile(raftSnapshotFile, b); err != nil {
+		return err
+	}
+
+	first, _ := storage.FirstIndex()
+	last, _ := storage.LastIndex()
+	var entries []raftpb.Entry
+	if last >= first {
+		if entries, err = storage.Entries(first, last+1, math.MaxUint64); err != nil {
+			return err
+		}
+	}
+
+	tmp := this.path(raftEntriesFile + ".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	old := this.entries
+	this.entries = f
+	if err = this.Save(raftpb.HardState{}, entries, raftpb.Snapshot{}); err != nil {
+		this.entries = old
+		f.Close()
+		return err
+	}
+
+	if err = os.Rename(tmp, this.path(raftEntriesFile)); err != nil {
+		this.entries = old
+		f.Close()
+		return err
+	}
+
+	return old.Close()
+}
+
+func (this *raftLog) Close() error {
+	return this.entries.Close()
+}
+
+func (this *raftLog) path(name string) string {
+	return filepath.Join(this.dir, name)
+}
+
+// writeFile atomically replaces a small file.
+func (this *raftLog) writeFile(name string, b []byte) error {
+	tmp := this.path(name + ".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, this.path(name))
+}
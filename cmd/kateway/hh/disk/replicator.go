@@ -1,4 +1,799 @@
 package disk
 
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
+	log "github.com/funkygao/log4go"
+	"golang.org/x/net/context"
+)
+
+// replicator replicates the hinted handoff queues to peer kateway instances
+// through a raft log.
+//
+// Each block appended on a node is proposed as a raft entry and written to the
+// queues of every peer when committed: the owner keeps it in its own queue while
+// the others keep a replica under the replicas dir. Each replicated block carries
+// its raft index. The owner pumps its queues and periodically proposes delivery
+// checkpoints, i,e. the raft index of the last delivered block, so that peers skip
+// the delivered blocks of their replicas.
+//
+// If an owner keeps silent longer than OwnerTimeout, the raft leader assigns its
+// backlog to a live peer, which pumps the replica queues until the owner is back.
+//
+// Raft snapshots carry the blocks not delivered yet, so that a peer lagging behind
+// the compacted log still gets the full backlog.
+//
+// Without a leader, a block is appended to the local queue only, it is not replicated
+// and waits for this node to deliver it. A proposal timing out is reported to the
+// caller instead, since it might still commit.
+//
+// If the raft log cannot be persisted, the node leaves the raft group and Append
+// keeps failing with ErrRaftLogFailed until kateway restarts.
 type replicator struct {
+	svc *Service
+	cfg *Config
+	id  uint64
+
+	node      raft.Node
+	storage   *raft.MemoryStorage
+	wal       *raftLog
+	transport *transport
+	confState raftpb.ConfState
+	applied   uint64
+
+	nextReqId uint64
+	waitersMu sync.Mutex
+	waiters   map[uint64]chan error // request id -> proposer waiting for the apply
+
+	mu          sync.RWMutex
+	replicas    map[uint64]map[clusterTopic]*queue // owner -> replica queues
+	pumpers     map[uint64]uint64                  // owner -> node delivering the owner's backlog
+	lastSeen    map[uint64]time.Time               // node -> last heartbeat applied
+	checkpoints map[uint64]map[clusterTopic]uint64 // owner -> queue -> raft index delivered, replicated
+	pumped      map[uint64]map[clusterTopic]uint64 // owner -> queue -> raft index delivered by us
+
+	failed   chan struct{} // closed when the raft log cannot be persisted
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newReplicator(svc *Service) *replicator {
+	return &replicator{
+		svc:         svc,
+		cfg:         svc.cfg,
+		id:          svc.cfg.RaftId,
+		nextReqId:   uint64(time.Now().UnixNano()), // never reuse ids of a previous process
+		waiters:     make(map[uint64]chan error),
+		replicas:    make(map[uint64]map[clusterTopic]*queue),
+		pumpers:     make(map[uint64]uint64),
+		lastSeen:    make(map[uint64]time.Time),
+		checkpoints: make(map[uint64]map[clusterTopic]uint64),
+		pumped:      make(map[uint64]map[clusterTopic]uint64),
+		failed:      make(chan struct{}),
+		quit:        make(chan struct{}),
+	}
+}
+
+func (this *replicator) Start() (err error) {
+	this.wal, err = openRaftLog(filepath.Join(this.cfg.Dirs[0], raftDir))
+	if err != nil {
+		return
+	}
+
+	this.storage = raft.NewMemoryStorage()
+	restored, applied, confState, err := this.wal.load(this.storage)
+	if err != nil {
+		return
+	}
+
+	this.applied = applied
+	if err = this.recover(); err != nil {
+		return
+	}
+
+	if err = this.loadReplicas(); err != nil {
+		return
+	}
+
+	c := &raft.Config{
+		ID:              this.id,
+		ElectionTick:    raftElectionTicks,
+		HeartbeatTick:   raftHeartbeatTicks,
+		Storage:         this.storage,
+		Applied:         applied,
+		MaxSizePerMsg:   1 << 20,
+		MaxInflightMsgs: 256,
+		CheckQuorum:     true, // leader steps down when partitioned, so that Append falls back fast
+	}
+	if restored {
+		this.confState = confState
+		this.node = raft.RestartNode(c)
+	} else {
+		peers := make([]raft.Peer, 0, len(this.cfg.RaftPeers))
+		for id := range this.cfg.RaftPeers {
+			peers = append(peers, raft.Peer{ID: id})
+			this.confState.Nodes = append(this.confState.Nodes, id)
+		}
+		this.node = raft.StartNode(c, peers)
+	}
+
+	// grace period for peers to announce themselves
+	now := time.Now()
+	for id := range this.cfg.RaftPeers {
+		this.lastSeen[id] = now
+	}
+
+	this.transport = newTransport(this.id, this.cfg.RaftPeers, []byte(this.cfg.RaftSecret), this.node)
+	if err = this.transport.Start(this.cfg.RaftAddr); err != nil {
+		this.node.Stop()
+		return
+	}
+
+	this.wg.Add(2)
+	go this.run()
+	go this.housekeeping()
+
+	log.Trace("hh replicator[%d] started on %s, peers: %+v", this.id, this.cfg.RaftAddr, this.cfg.RaftPeers)
+	return
+}
+
+func (this *replicator) Stop() {
+	this.stopOnce.Do(func() {
+		close(this.quit)
+		this.transport.Stop()
+		this.wg.Wait()
+		this.node.Stop()
+
+		this.mu.Lock()
+		for owner, queues := range this.replicas {
+			for _, q := range queues {
+				if err := q.Close(); err != nil {
+					log.Error("replica[%d] queue[%s] %v", owner, q.ident(), err)
+				}
+			}
+		}
+		this.replicas = make(map[uint64]map[clusterTopic]*queue)
+		this.mu.Unlock()
+
+		if err := this.wal.Close(); err != nil {
+			log.Error("hh replicator[%d] %v", this.id, err)
+		}
+
+		log.Trace("hh replicator[%d] stopped", this.id)
+	})
+}
+
+// Append replicates a block and waits until it is appended to the local queue.
+// ErrNoLeader or ErrProposeTimeout is returned if there is no quorum.
+func (this *replicator) Append(cluster, topic string, key, value []byte) error {
+	select {
+	case <-this.failed:
+		return ErrRaftLogFailed
+	default:
+	}
+
+	if this.node.Status().Lead == raft.None {
+		return ErrNoLeader
+	}
+
+	reqId := atomic.AddUint64(&this.nextReqId, 1)
+	data, err := json.Marshal(command{
+		Op:      opAppend,
+		ReqId:   reqId,
+		By:      this.id,
+		Owner:   this.id,
+		Cluster: cluster,
+		Topic:   topic,
+		Key:     key,
+		Value:   value,
+	})
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan error, 1)
+	this.waitersMu.Lock()
+	this.waiters[reqId] = ch
+	this.waitersMu.Unlock()
+	defer func() {
+		this.waitersMu.Lock()
+		delete(this.waiters, reqId)
+		this.waitersMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), raftProposeTimeout)
+	defer cancel()
+	if err = this.node.Propose(ctx, data); err != nil {
+		if ctx.Err() != nil {
+			return ErrProposeTimeout
+		}
+		return err
+	}
+
+	select {
+	case err = <-ch:
+		return err
+	case <-ctx.Done():
+		return ErrProposeTimeout
+	case <-this.failed:
+		return ErrRaftLogFailed
+	case <-this.quit:
+		return ErrReplicatorClosed
+	}
+}
+
+// hook makes a queue aware of who is delivering the owner's backlog.
+func (this *replicator) hook(owner uint64, q *queue) {
+	ct := q.clusterTopic
+	q.standby = func() bool {
+		return this.pumper(owner) != this.id
+	}
+	q.delivered = func() uint64 {
+		this.mu.RLock()
+		defer this.mu.RUnlock()
+		return this.checkpoints[owner][ct]
+	}
+	q.onDeliver = func(index uint64) {
+		if index == 0 {
+			// appended without quorum, not replicated
+			return
+		}
+
+		this.mu.Lock()
+		if _, present := this.pumped[owner]; !present {
+			this.pumped[owner] = make(map[clusterTopic]uint64)
+		}
+		if index > this.pumped[owner][ct] {
+			this.pumped[owner][ct] = index
+		}
+		this.mu.Unlock()
+	}
+}
+
+func (this *replicator) pumper(owner uint64) uint64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if p, present := this.pumpers[owner]; present {
+		return p
+	}
+	return owner
+}
+
+func (this *replicator) run() {
+	defer this.wg.Done()
+
+	ticker := time.NewTicker(this.cfg.RaftTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case <-ticker.C:
+			this.node.Tick()
+
+		case rd := <-this.node.Ready():
+			// persist before sending messages and applying
+			if err := this.wal.Save(rd.HardState, rd.Entries, rd.Snapshot); err != nil {
+				// acking or applying what is not persisted could break the raft
+				// guarantees after restart, leave the group instead
+				log.Critical("hh replicator[%d] wal: %v, stopped", this.id, err)
+				close(this.failed)
+				this.node.Stop()
+				return
+			}
+			if !raft.IsEmptySnap(rd.Snapshot) {
+				this.storage.ApplySnapshot(rd.Snapshot)
+				this.confState = rd.Snapshot.Metadata.ConfState
+				if rd.Snapshot.Metadata.Index > this.applied {
+					// we lagged behind the compacted log of leader
+					log.Warn("hh replicator[%d] restore snapshot %d->%d",
+						this.id, this.applied, rd.Snapshot.Metadata.Index)
+					this.Restore(rd.Snapshot)
+					this.applied = rd.Snapshot.Metadata.Index
+					if err := this.wal.SaveApplied(this.applied); err != nil {
+						log.Error("hh replicator[%d] wal: %v", this.id, err)
+					}
+				}
+			}
+			if !raft.IsEmptyHardState(rd.HardState) {
+				this.storage.SetHardState(rd.HardState)
+			}
+			this.storage.Append(rd.Entries)
+
+			this.transport.Send(rd.Messages)
+
+			for _, ent := range rd.CommittedEntries {
+				this.applyEntry(ent)
+			}
+			if len(rd.CommittedEntries) > 0 {
+				if err := this.wal.SaveApplied(this.applied); err != nil {
+					log.Error("hh replicator[%d] wal: %v", this.id, err)
+				}
+				this.maybeCompact()
+			}
+
+			this.node.Advance()
+		}
+	}
+}
+
+func (this *replicator) applyEntry(ent raftpb.Entry) {
+	if ent.Index <= this.applied {
+		return
+	}
+
+	switch ent.Type {
+	case raftpb.EntryNormal:
+		if cmd, ok := this.decodeEntry(ent); ok {
+			this.apply(cmd)
+		}
+
+	case raftpb.EntryConfChange:
+		var cc raftpb.ConfChange
+		if err := cc.Unmarshal(ent.Data); err != nil {
+			log.Error("hh replicator[%d] conf change %d: %v", this.id, ent.Index, err)
+			break
+		}
+		this.confState = *this.node.ApplyConfChange(cc)
+	}
+
+	this.applied = ent.Index
+}
+
+// decodeEntry decodes a normal raft entry, the Index of an append command is
+// set to the entry index.
+func (this *replicator) decodeEntry(ent raftpb.Entry) (cmd command, ok bool) {
+	if len(ent.Data) == 0 {
+		// empty entry when a new leader is elected
+		return
+	}
+
+	if err := json.Unmarshal(ent.Data, &cmd); err != nil {
+		log.Error("hh replicator[%d] entry %d: %v", this.id, ent.Index, err)
+		return
+	}
+
+	if cmd.Op == opAppend {
+		cmd.Index = ent.Index
+	}
+	return cmd, true
+}
+
+func (this *replicator) maybeCompact() {
+	first, err := this.storage.FirstIndex()
+	if err != nil || this.applied < first+raftCompactEvery {
+		return
+	}
+
+	data, err := this.snapshotData(first)
+	if err != nil {
+		log.Error("hh replicator[%d] snapshot: %v", this.id, err)
+		return
+	}
+
+	snap, err := this.storage.CreateSnapshot(this.applied, &this.confState, data)
+	if err != nil {
+		log.Error("hh replicator[%d] snapshot: %v", this.id, err)
+		return
+	}
+	if err = this.storage.Compact(this.applied); err != nil {
+		log.Error("hh replicator[%d] compact: %v", this.id, err)
+		return
+	}
+	if err = this.wal.Compact(snap, this.storage); err != nil {
+		log.Error("hh replicator[%d] wal compact: %v", this.id, err)
+		return
+	}
+
+	log.Debug("hh replicator[%d] compacted up to %d", this.id, this.applied)
+}
+
+// snapshotData carries the pending blocks of the last snapshot and of the log
+// entries since then over to a new snapshot at applied.
+func (this *replicator) snapshotData(first uint64) ([]byte, error) {
+	prev, err := this.storage.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	state, err := decodeSnapshotState(prev.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	ents, err := this.storage.Entries(first, this.applied+1, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	var appends []command
+	for _, ent := range ents {
+		if ent.Type != raftpb.EntryNormal {
+			continue
+		}
+		if cmd, ok := this.decodeEntry(ent); ok && cmd.Op == opAppend {
+			appends = append(appends, cmd)
+		}
+	}
+
+	this.mu.RLock()
+	state = mergeSnapshotState(state, appends, this.pumpers, this.checkpoints)
+	this.mu.RUnlock()
+
+	return json.Marshal(state)
+}
+
+// Restore catches up with a snapshot sent by leader when we lagged behind its
+// compacted log: the pending blocks we have not applied yet are appended.
+func (this *replicator) Restore(snap raftpb.Snapshot) {
+	state, err := decodeSnapshotState(snap.Data)
+	if err != nil {
+		log.Error("hh replicator[%d] snapshot %d: %v", this.id, snap.Metadata.Index, err)
+		return
+	}
+
+	this.loadState(state)
+
+	var n int
+	for _, sq := range state.Queues {
+		ct := clusterTopic{cluster: sq.Cluster, topic: sq.Topic}
+		for _, b := range sq.Blocks {
+			if b.Index <= this.applied {
+				// appended before we lagged behind
+				continue
+			}
+
+			if err = this.appendBlock(sq.Owner, ct, b.Index, b.Key, b.Value); err != nil {
+				log.Error("hh replicator[%d] restore %d:%s/%s %v", this.id, sq.Owner, sq.Cluster, sq.Topic, err)
+				continue
+			}
+			n++
+		}
+	}
+
+	log.Info("hh replicator[%d] restored %d blocks from snapshot %d", this.id, n, snap.Metadata.Index)
+}
+
+// recover rebuilds the state machine after restart from the snapshot and the
+// log entries applied before, whose blocks are already in the queues.
+func (this *replicator) recover() error {
+	snap, err := this.storage.Snapshot()
+	if err != nil {
+		return err
+	}
+	state, err := decodeSnapshotState(snap.Data)
+	if err != nil {
+		return err
+	}
+	this.loadState(state)
+
+	last, err := this.storage.LastIndex()
+	if err != nil {
+		return err
+	}
+	hi := this.applied
+	if hi > last {
+		hi = last
+	}
+	if hi <= snap.Metadata.Index {
+		return nil
+	}
+
+	ents, err := this.storage.Entries(snap.Metadata.Index+1, hi+1, math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	for _, ent := range ents {
+		if ent.Type != raftpb.EntryNormal {
+			continue
+		}
+		if cmd, ok := this.decodeEntry(ent); ok {
+			this.applyState(cmd)
+		}
+	}
+
+	return nil
+}
+
+func (this *replicator) loadState(state snapshotState) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for owner, pumper := range state.Pumpers {
+		this.pumpers[owner] = pumper
+	}
+	for _, sq := range state.Queues {
+		this.setCheckpoint(sq.Owner, clusterTopic{cluster: sq.Cluster, topic: sq.Topic}, sq.Delivered)
+	}
+}
+
+// setCheckpoint must be called with mu held.
+func (this *replicator) setCheckpoint(owner uint64, ct clusterTopic, index uint64) {
+	if _, present := this.checkpoints[owner]; !present {
+		this.checkpoints[owner] = make(map[clusterTopic]uint64)
+	}
+	if index > this.checkpoints[owner][ct] {
+		this.checkpoints[owner][ct] = index
+	}
+}
+
+// housekeeping announces liveness, checkpoints deliveries and, on the raft leader,
+// assigns the backlog of silent nodes to live peers.
+func (this *replicator) housekeeping() {
+	defer this.wg.Done()
+
+	ticker := time.NewTicker(this.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case <-ticker.C:
+			this.propose(command{Op: opHeartbeat, By: this.id})
+			this.checkpoint()
+
+			if this.node.Status().Lead == this.id {
+				this.rebalance()
+			}
+		}
+	}
+}
+
+// checkpoint proposes the raft index of the last block we delivered for each
+// queue, failed proposals are retried in next round.
+func (this *replicator) checkpoint() {
+	var cmds []command
+	this.mu.RLock()
+	for owner, queues := range this.pumped {
+		for ct, index := range queues {
+			if index > this.checkpoints[owner][ct] {
+				cmds = append(cmds, command{
+					Op:      opCheckpoint,
+					By:      this.id,
+					Owner:   owner,
+					Cluster: ct.cluster,
+					Topic:   ct.topic,
+					Index:   index,
+				})
+			}
+		}
+	}
+	this.mu.RUnlock()
+
+	for _, cmd := range cmds {
+		if err := this.propose(cmd); err != nil {
+			log.Debug("hh replicator[%d] checkpoint %+v: %v", this.id, cmd, err)
+		}
+	}
+}
+
+func (this *replicator) rebalance() {
+	now := time.Now()
+
+	this.mu.RLock()
+	alive := make(map[uint64]bool, len(this.cfg.RaftPeers))
+	for id := range this.cfg.RaftPeers {
+		alive[id] = now.Sub(this.lastSeen[id]) < this.cfg.OwnerTimeout
+	}
+	owners := []uint64{this.id}
+	for owner := range this.replicas {
+		owners = append(owners, owner)
+	}
+	this.mu.RUnlock()
+
+	candidates := make([]uint64, 0, len(alive))
+	for id, ok := range alive {
+		if ok {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Sort(uint64s(candidates))
+
+	for _, owner := range owners {
+		current := this.pumper(owner)
+
+		var want uint64
+		switch {
+		case alive[owner]:
+			// owner is back, hand over its backlog
+			want = owner
+		case alive[current]:
+			want = current
+		case len(candidates) > 0:
+			want = candidates[0]
+		}
+
+		if want != 0 && want != current {
+			log.Warn("hh replicator[%d] backlog of node %d: %d -> %d", this.id, owner, current, want)
+			this.propose(command{Op: opTakeover, By: want, Owner: owner})
+		}
+	}
+}
+
+func (this *replicator) propose(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), raftProposeTimeout)
+	defer cancel()
+	return this.node.Propose(ctx, data)
+}
+
+// apply is the raft state machine.
+func (this *replicator) apply(cmd command) {
+	ct := clusterTopic{cluster: cmd.Cluster, topic: cmd.Topic}
+
+	switch cmd.Op {
+	case opAppend:
+		err := this.appendBlock(cmd.Owner, ct, cmd.Index, cmd.Key, cmd.Value)
+		if err != nil {
+			log.Error("hh replicator[%d] append %d:%s/%s %v", this.id, cmd.Owner, cmd.Cluster, cmd.Topic, err)
+		}
+
+		if cmd.By == this.id {
+			this.waitersMu.Lock()
+			if ch, present := this.waiters[cmd.ReqId]; present {
+				ch <- err
+			}
+			this.waitersMu.Unlock()
+		}
+
+	case opCheckpoint:
+		// queue pumps skip the delivered blocks by raft index
+		this.applyState(cmd)
+
+	case opHeartbeat:
+		this.mu.Lock()
+		this.lastSeen[cmd.By] = time.Now()
+		this.mu.Unlock()
+
+	case opTakeover:
+		this.applyState(cmd)
+
+		if cmd.By == this.id && cmd.Owner != this.id {
+			log.Info("hh replicator[%d] took over backlog of node %d", this.id, cmd.Owner)
+		}
+
+	default:
+		log.Warn("hh replicator[%d] unknown op: %+v", this.id, cmd)
+	}
+}
+
+// applyState applies the part of a command that is carried in snapshots.
+func (this *replicator) applyState(cmd command) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	switch cmd.Op {
+	case opCheckpoint:
+		this.setCheckpoint(cmd.Owner, clusterTopic{cluster: cmd.Cluster, topic: cmd.Topic}, cmd.Index)
+
+	case opTakeover:
+		this.pumpers[cmd.Owner] = cmd.By
+	}
+}
+
+// appendBlock appends a replicated block to the owner's queue or to its replica.
+func (this *replicator) appendBlock(owner uint64, ct clusterTopic, index uint64, key, value []byte) error {
+	b := &block{magic: currentMagic, index: index, key: key, value: value}
+	if owner == this.id {
+		return this.svc.append(ct, b)
+	}
+
+	return this.appendReplica(owner, ct, b)
+}
+
+func (this *replicator) queueOf(owner uint64, ct clusterTopic) *queue {
+	if owner == this.id {
+		this.svc.rwmux.RLock()
+		defer this.svc.rwmux.RUnlock()
+		return this.svc.queues[ct]
+	}
+
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.replicas[owner][ct]
+}
+
+func (this *replicator) appendReplica(owner uint64, ct clusterTopic, b *block) error {
+	q := this.queueOf(owner, ct)
+	if q == nil {
+		var err error
+		if q, err = this.openReplica(owner, ct); err != nil {
+			return err
+		}
+	}
+
+	return q.Append(b)
+}
+
+func (this *replicator) replicaBaseDir(owner uint64) string {
+	return filepath.Join(this.cfg.Dirs[0], replicaDir, strconv.FormatUint(owner, 10))
+}
+
+func (this *replicator) openReplica(owner uint64, ct clusterTopic) (*queue, error) {
+	baseDir := this.replicaBaseDir(owner)
+	if err := os.MkdirAll(ct.ClusterDir(baseDir), 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	q := newQueue(baseDir, ct, defaultMaxQueueSize, this.cfg.PurgeInterval, this.cfg.MaxAge)
+	this.hook(owner, q)
+	if err := q.Open(); err != nil {
+		return nil, err
+	}
+	q.Start()
+
+	this.mu.Lock()
+	if _, present := this.replicas[owner]; !present {
+		this.replicas[owner] = make(map[clusterTopic]*queue)
+	}
+	this.replicas[owner][ct] = q
+	this.mu.Unlock()
+
+	return q, nil
+}
+
+// loadReplicas opens the replica queues on disk.
+func (this *replicator) loadReplicas() error {
+	base := filepath.Join(this.cfg.Dirs[0], replicaDir)
+	if err := mkdirIfNotExist(base); err != nil {
+		return err
+	}
+
+	owners, err := ioutil.ReadDir(base)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		owner, err := strconv.ParseUint(o.Name(), 10, 64)
+		if !o.IsDir() || err != nil {
+			continue
+		}
+
+		clusters, err := ioutil.ReadDir(filepath.Join(base, o.Name()))
+		if err != nil {
+			return err
+		}
+		for _, cluster := range clusters {
+			if !cluster.IsDir() {
+				continue
+			}
+
+			topics, err := ioutil.ReadDir(filepath.Join(base, o.Name(), cluster.Name()))
+			if err != nil {
+				return err
+			}
+			for _, topic := range topics {
+				if !topic.IsDir() {
+					continue
+				}
+
+				ct := clusterTopic{cluster: cluster.Name(), topic: topic.Name()}
+				if _, err = this.openReplica(owner, ct); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,217 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+)
+
+// recordingPubStore records delivered messages and fails all pubs while down.
+type recordingPubStore struct {
+	mu        sync.Mutex
+	down      bool
+	delivered map[string]int
+}
+
+func (this *recordingPubStore) Name() string             { return "recording" }
+func (this *recordingPubStore) Start() error             { return nil }
+func (this *recordingPubStore) Stop()                    {}
+func (this *recordingPubStore) IsSystemError(error) bool { return true }
+
+func (this *recordingPubStore) SyncPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.down {
+		return 0, -1, errors.New("kafka down")
+	}
+
+	this.delivered[string(msg)]++
+	return 0, 0, nil
+}
+
+func (this *recordingPubStore) SyncAllPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	return this.SyncPub(cluster, topic, key, msg)
+}
+
+func (this *recordingPubStore) AsyncPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	return this.SyncPub(cluster, topic, key, msg)
+}
+
+func (this *recordingPubStore) setDown(down bool) {
+	this.mu.Lock()
+	this.down = down
+	this.mu.Unlock()
+}
+
+func (this *recordingPubStore) deliveredN() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.delivered)
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	return false
+}
+
+func startReplicatedCluster(t *testing.T, n int) []*Service {
+	peers := make(map[uint64]string, n)
+	for i := 1; i <= n; i++ {
+		peers[uint64(i)] = freeAddr(t)
+	}
+
+	nodes := make([]*Service, 0, n)
+	for i := 1; i <= n; i++ {
+		dir := fmt.Sprintf("hhraft%d", i)
+		os.RemoveAll(dir)
+
+		cfg := DefaultConfig()
+		cfg.Dirs = []string{dir}
+		cfg.RaftId = uint64(i)
+		cfg.RaftAddr = peers[uint64(i)]
+		cfg.RaftPeers = peers
+		cfg.RaftSecret = "s3cret"
+		cfg.RaftTick = time.Millisecond * 20
+		cfg.HeartbeatInterval = time.Millisecond * 100
+		cfg.OwnerTimeout = time.Second
+		assert.Equal(t, nil, cfg.Validate())
+
+		s := New(cfg).(*Service)
+		assert.Equal(t, nil, s.Start())
+		nodes = append(nodes, s)
+	}
+
+	return nodes
+}
+
+func TestReplicatorFailover(t *testing.T) {
+	pubStore := &recordingPubStore{down: true, delivered: make(map[string]int)}
+	saved := store.DefaultPubStore
+	store.DefaultPubStore = pubStore
+	defer func() {
+		store.DefaultPubStore = saved
+	}()
+
+	nodes := startReplicatedCluster(t, 3)
+	defer func() {
+		for i, s := range nodes {
+			s.Stop()
+			os.RemoveAll(fmt.Sprintf("hhraft%d", i+1))
+		}
+	}()
+
+	// wait for leader election
+	assert.Equal(t, true, waitFor(time.Second*5, func() bool {
+		return nodes[0].replicator.node.Status().Lead != 0
+	}))
+
+	const msgN = 10
+	for i := 0; i < msgN; i++ {
+		assert.Equal(t, nil, nodes[0].Append("c1", "t1", nil, []byte(fmt.Sprintf("msg%d", i))))
+	}
+	assert.Equal(t, int64(msgN), nodes[0].Inflights())
+
+	// the followers hold replicas of node1's backlog
+	for _, s := range nodes[1:] {
+		ok := waitFor(time.Second*5, func() bool {
+			q := s.replicator.queueOf(1, clusterTopic{cluster: "c1", topic: "t1"})
+			return q != nil && q.Inflights() == msgN
+		})
+		assert.Equal(t, true, ok)
+	}
+
+	// node1 dies before kafka recovers
+	nodes[0].Stop()
+	pubStore.setDown(false)
+
+	// a follower takes over and pumps node1's backlog
+	ok := waitFor(time.Second*15, func() bool {
+		return pubStore.deliveredN() == msgN
+	})
+	assert.Equal(t, true, ok)
+
+	// all live nodes agree on who took over
+	ok = waitFor(time.Second*5, func() bool {
+		pumper := nodes[1].replicator.pumper(1)
+		return pumper != 1 && pumper == nodes[2].replicator.pumper(1)
+	})
+	assert.Equal(t, true, ok)
+}
+
+func TestReplicatorAppendWithoutQuorum(t *testing.T) {
+	pubStore := &recordingPubStore{down: true, delivered: make(map[string]int)}
+	saved := store.DefaultPubStore
+	store.DefaultPubStore = pubStore
+	defer func() {
+		store.DefaultPubStore = saved
+	}()
+
+	nodes := startReplicatedCluster(t, 3)
+	defer func() {
+		for i, s := range nodes {
+			s.Stop()
+			os.RemoveAll(fmt.Sprintf("hhraft%d", i+1))
+		}
+	}()
+
+	assert.Equal(t, true, waitFor(time.Second*5, func() bool {
+		return nodes[0].replicator.node.Status().Lead != 0
+	}))
+	assert.Equal(t, nil, nodes[0].Append("c1", "t1", nil, []byte("replicated")))
+
+	// partitioned from the majority
+	nodes[1].Stop()
+	nodes[2].Stop()
+	assert.Equal(t, true, waitFor(time.Second*5, func() bool {
+		return nodes[0].replicator.node.Status().Lead == 0
+	}))
+
+	assert.Equal(t, nil, nodes[0].Append("c1", "t1", nil, []byte("local")))
+	assert.Equal(t, int64(2), nodes[0].Inflights())
+
+	// a broken raft log never falls back to the local queue
+	close(nodes[0].replicator.failed)
+	assert.Equal(t, ErrRaftLogFailed, nodes[0].Append("c1", "t1", nil, []byte("lost")))
+	assert.Equal(t, int64(2), nodes[0].Inflights())
+
+	pubStore.setDown(false)
+	ok := waitFor(time.Second*5, func() bool {
+		return pubStore.deliveredN() == 2
+	})
+	assert.Equal(t, true, ok)
+}
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers("1=127.0.0.1:10001, 2=127.0.0.1:10002")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(peers))
+	assert.Equal(t, "127.0.0.1:10002", peers[2])
+
+	_, err = ParsePeers("0=127.0.0.1:10001")
+	assert.NotEqual(t, nil, err)
+	_, err = ParsePeers("1")
+	assert.NotEqual(t, nil, err)
+}
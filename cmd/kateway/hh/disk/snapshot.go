@@ -0,0 +1,107 @@
+package disk
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// snapshotState is the replicator state machine carried in raft snapshots:
+// who pumps each owner's backlog, and the blocks not yet delivered.
+type snapshotState struct {
+	Pumpers map[uint64]uint64 `json:"pumpers"`
+	Queues  []snapshotQueue   `json:"queues"`
+}
+
+type snapshotQueue struct {
+	Owner     uint64          `json:"owner"`
+	Cluster   string          `json:"cluster"`
+	Topic     string          `json:"topic"`
+	Delivered uint64          `json:"delivered"` // checkpoint raft index
+	Blocks    []snapshotBlock `json:"blocks"`    // pending blocks in raft index order
+}
+
+type snapshotBlock struct {
+	Index uint64 `json:"idx"`
+	Key   []byte `json:"k,omitempty"`
+	Value []byte `json:"v"`
+}
+
+func decodeSnapshotState(data []byte) (state snapshotState, err error) {
+	if len(data) == 0 {
+		return
+	}
+
+	err = json.Unmarshal(data, &state)
+	return
+}
+
+// mergeSnapshotState builds the next snapshot state from the previous one and
+// the appends since then, blocks delivered before checkpoints are dropped.
+func mergeSnapshotState(prev snapshotState, appends []command, pumpers map[uint64]uint64,
+	checkpoints map[uint64]map[clusterTopic]uint64) snapshotState {
+	type queueKey struct {
+		owner uint64
+		ct    clusterTopic
+	}
+	queues := make(map[queueKey]*snapshotQueue)
+	queueOf := func(owner uint64, ct clusterTopic) *snapshotQueue {
+		k := queueKey{owner: owner, ct: ct}
+		if q, present := queues[k]; present {
+			return q
+		}
+
+		q := &snapshotQueue{Owner: owner, Cluster: ct.cluster, Topic: ct.topic}
+		queues[k] = q
+		return q
+	}
+
+	for _, q := range prev.Queues {
+		sq := queueOf(q.Owner, clusterTopic{cluster: q.Cluster, topic: q.Topic})
+		sq.Blocks = append(sq.Blocks, q.Blocks...)
+	}
+	for _, cmd := range appends {
+		sq := queueOf(cmd.Owner, clusterTopic{cluster: cmd.Cluster, topic: cmd.Topic})
+		sq.Blocks = append(sq.Blocks, snapshotBlock{Index: cmd.Index, Key: cmd.Key, Value: cmd.Value})
+	}
+	for owner, cps := range checkpoints {
+		for ct := range cps {
+			queueOf(owner, ct)
+		}
+	}
+
+	state := snapshotState{
+		Pumpers: make(map[uint64]uint64, len(pumpers)),
+		Queues:  make([]snapshotQueue, 0, len(queues)),
+	}
+	for owner, pumper := range pumpers {
+		state.Pumpers[owner] = pumper
+	}
+	for k, sq := range queues {
+		sq.Delivered = checkpoints[k.owner][k.ct]
+		pending := sq.Blocks[:0]
+		for _, b := range sq.Blocks {
+			if b.Index > sq.Delivered {
+				pending = append(pending, b)
+			}
+		}
+		sq.Blocks = pending
+		state.Queues = append(state.Queues, *sq)
+	}
+	sort.Sort(snapshotQueues(state.Queues))
+
+	return state
+}
+
+type snapshotQueues []snapshotQueue
+
+func (s snapshotQueues) Len() int      { return len(s) }
+func (s snapshotQueues) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s snapshotQueues) Less(i, j int) bool {
+	if s[i].Owner != s[j].Owner {
+		return s[i].Owner < s[j].Owner
+	}
+	if s[i].Cluster != s[j].Cluster {
+		return s[i].Cluster < s[j].Cluster
+	}
+	return s[i].Topic < s[j].Topic
+}
@@ -0,0 +1,57 @@
+package disk
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestMergeSnapshotState(t *testing.T) {
+	ct1 := clusterTopic{cluster: "c1", topic: "t1"}
+	ct2 := clusterTopic{cluster: "c1", topic: "t2"}
+	prev := snapshotState{
+		Pumpers: map[uint64]uint64{1: 2},
+		Queues: []snapshotQueue{
+			{Owner: 1, Cluster: "c1", Topic: "t1", Delivered: 3,
+				Blocks: []snapshotBlock{{Index: 4, Value: []byte("a")}, {Index: 6, Value: []byte("b")}}},
+		},
+	}
+	appends := []command{
+		{Op: opAppend, Owner: 1, Cluster: "c1", Topic: "t1", Index: 8, Value: []byte("c")},
+		{Op: opAppend, Owner: 2, Cluster: "c1", Topic: "t2", Index: 9, Value: []byte("d")},
+	}
+	checkpoints := map[uint64]map[clusterTopic]uint64{
+		1: {ct1: 6},
+		3: {ct2: 5}, // no pending blocks
+	}
+
+	state := mergeSnapshotState(prev, appends, map[uint64]uint64{1: 3}, checkpoints)
+	assert.Equal(t, uint64(3), state.Pumpers[1])
+	assert.Equal(t, 3, len(state.Queues))
+
+	q := state.Queues[0]
+	assert.Equal(t, uint64(1), q.Owner)
+	assert.Equal(t, uint64(6), q.Delivered)
+	assert.Equal(t, 1, len(q.Blocks))
+	assert.Equal(t, uint64(8), q.Blocks[0].Index)
+
+	q = state.Queues[1]
+	assert.Equal(t, uint64(2), q.Owner)
+	assert.Equal(t, uint64(0), q.Delivered)
+	assert.Equal(t, "d", string(q.Blocks[0].Value))
+
+	q = state.Queues[2]
+	assert.Equal(t, uint64(3), q.Owner)
+	assert.Equal(t, uint64(5), q.Delivered)
+	assert.Equal(t, 0, len(q.Blocks))
+
+	// delivered blocks are dropped in next snapshot
+	checkpoints[1][ct1] = 8
+	state = mergeSnapshotState(state, nil, nil, checkpoints)
+	assert.Equal(t, 0, len(state.Queues[0].Blocks))
+	assert.Equal(t, 1, len(state.Queues[1].Blocks))
+
+	state, err := decodeSnapshotState(nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(state.Queues))
+}
@@ -0,0 +1,220 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
+	log "github.com/funkygao/log4go"
+	"golang.org/x/net/context"
+)
+
+const (
+	raftHttpPath         = "/raft"
+	raftMacHeader        = "X-Raft-Mac"
+	raftPeerQueueSize    = 1 << 10
+	raftTransportTimeout = time.Second * 3
+	raftMaxMessageSize   = 256 << 20 // snapshots carry the pending blocks
+)
+
+// transport exchanges raft messages between peers over http.
+//
+// Each message is signed with HMAC-SHA256 of the shared secret, messages not
+// signed or not from a known peer are rejected.
+type transport struct {
+	id     uint64
+	peers  map[uint64]string
+	secret []byte
+	node   raft.Node
+
+	client   *http.Client
+	listener net.Listener
+	outboxes map[uint64]chan raftpb.Message // ordered delivery per peer
+	quit     chan struct{}
+}
+
+func newTransport(id uint64, peers map[uint64]string, secret []byte, node raft.Node) *transport {
+	return &transport{
+		id:     id,
+		peers:  peers,
+		secret: secret,
+		node:   node,
+		client: &http.Client{
+			Timeout: raftTransportTimeout,
+		},
+		outboxes: make(map[uint64]chan raftpb.Message, len(peers)),
+		quit:     make(chan struct{}),
+	}
+}
+
+func (this *transport) Start(addr string) (err error) {
+	this.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(raftHttpPath, this.handleMessage)
+	go http.Serve(this.listener, mux)
+
+	for id, peerAddr := range this.peers {
+		if id == this.id {
+			continue
+		}
+
+		outbox := make(chan raftpb.Message, raftPeerQueueSize)
+		this.outboxes[id] = outbox
+		go this.deliver(id, peerAddr, outbox)
+	}
+
+	return
+}
+
+func (this *transport) Stop() {
+	close(this.quit)
+	this.listener.Close()
+}
+
+// Send queues messages for delivery, it never blocks the raft loop.
+func (this *transport) Send(msgs []raftpb.Message) {
+	for _, m := range msgs {
+		outbox, present := this.outboxes[m.To]
+		if !present {
+			log.Warn("hh replicator[%d] unknown peer: %d", this.id, m.To)
+			continue
+		}
+
+		select {
+		case outbox <- m:
+		default:
+			// raft will retry, dropping is safe
+			this.node.ReportUnreachable(m.To)
+		}
+	}
+}
+
+func (this *transport) deliver(to uint64, addr string, outbox <-chan raftpb.Message) {
+	url := fmt.Sprintf("http://%s%s", addr, raftHttpPath)
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case m := <-outbox:
+			err := this.post(url, m)
+			if err != nil {
+				log.Debug("hh replicator[%d] -> %d: %v", this.id, to, err)
+				this.node.ReportUnreachable(to)
+			}
+
+			if m.Type == raftpb.MsgSnap {
+				if err != nil {
+					this.node.ReportSnapshot(to, raft.SnapshotFailure)
+				} else {
+					this.node.ReportSnapshot(to, raft.SnapshotFinish)
+				}
+			}
+		}
+	}
+}
+
+func (this *transport) post(url string, m raftpb.Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(b) > raftMaxMessageSize {
+		return fmt.Errorf("raft message %d bytes too large", len(b))
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(raftMacHeader, hex.EncodeToString(this.sign(b)))
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("POST %s -> %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (this *transport) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	mac, err := hex.DecodeString(r.Header.Get(raftMacHeader))
+	if err != nil || len(mac) != sha256.Size {
+		log.Warn("hh replicator[%d] unsigned raft message from %s", this.id, r.RemoteAddr)
+
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.ContentLength > raftMaxMessageSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, raftMaxMessageSize+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(b) > raftMaxMessageSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !hmac.Equal(mac, this.sign(b)) {
+		log.Warn("hh replicator[%d] unauthorized raft message from %s", this.id, r.RemoteAddr)
+
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var m raftpb.Message
+	if err = m.Unmarshal(b); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, present := this.peers[m.From]; !present || m.To != this.id {
+		log.Warn("hh replicator[%d] raft message %d->%d from %s rejected", this.id, m.From, m.To, r.RemoteAddr)
+
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err = this.node.Step(context.TODO(), m); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (this *transport) sign(b []byte) []byte {
+	h := hmac.New(sha256.New, this.secret)
+	h.Write(b)
+	return h.Sum(nil)
+}
@@ -0,0 +1,42 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/etcd/raft/raftpb"
+	"github.com/funkygao/assert"
+)
+
+func TestTransportAuth(t *testing.T) {
+	tr := newTransport(1, map[uint64]string{1: "a", 2: "b"}, []byte("s3cret"), nil)
+	post := func(m raftpb.Message, secret string) int {
+		b, err := m.Marshal()
+		assert.Equal(t, nil, err)
+
+		r, _ := http.NewRequest("POST", raftHttpPath, bytes.NewReader(b))
+		if secret != "" {
+			peer := newTransport(m.From, nil, []byte(secret), nil)
+			r.Header.Set(raftMacHeader, hex.EncodeToString(peer.sign(b)))
+		}
+		w := httptest.NewRecorder()
+		tr.handleMessage(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post(raftpb.Message{From: 2, To: 1}, ""))
+	assert.Equal(t, http.StatusUnauthorized, post(raftpb.Message{From: 2, To: 1}, "guess"))
+	assert.Equal(t, http.StatusForbidden, post(raftpb.Message{From: 3, To: 1}, "s3cret"))
+	assert.Equal(t, http.StatusForbidden, post(raftpb.Message{From: 2, To: 2}, "s3cret"))
+
+	// oversized messages are rejected before the body is read
+	r, _ := http.NewRequest("POST", raftHttpPath, bytes.NewReader([]byte("x")))
+	r.Header.Set(raftMacHeader, hex.EncodeToString(tr.sign([]byte("x"))))
+	r.ContentLength = raftMaxMessageSize + 1
+	w := httptest.NewRecorder()
+	tr.handleMessage(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
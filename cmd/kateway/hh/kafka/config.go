@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+)
+
+type Config struct {
+	StandbyCluster  string        // the cluster where failed pub messages are parked
+	Topic           string        // handoff topic prefix in the standby cluster, one topic per cluster
+	Group           string        // consumer group prefix that replays the handoff topics
+	RefreshInterval time.Duration // how often the replay progress is refreshed
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Topic:           defaultTopic,
+		Group:           defaultGroup,
+		RefreshInterval: defaultRefreshInterval,
+	}
+}
+
+func (this *Config) Validate() error {
+	if this.StandbyCluster == "" {
+		return errors.New("hh StandbyCluster must be specified")
+	}
+	if this.Topic == "" || this.Group == "" {
+		return errors.New("hh Topic and Group must be specified")
+	}
+	if this.RefreshInterval <= 0 {
+		return errors.New("hh RefreshInterval must be positive")
+	}
+
+	return nil
+}
+
+// handoffTopic is where the failed pub messages of a cluster are parked.
+// Each cluster has its own topic so that a cluster still down does not
+// hold up the replay of the others.
+func (this *Config) handoffTopic(cluster string) string {
+	return this.Topic + "." + cluster
+}
+
+func (this *Config) replayGroup(cluster string) string {
+	return this.Group + "." + cluster
+}
@@ -3,4 +3,7 @@
 // When pub fails, kafka hinted handoff will publish to another
 // cluster, and it continuously consumes the handoff cluster and
 // pub to the original cluster.
+//
+// Each original cluster has its own handoff topic, so that a cluster
+// that stays down only holds up the replay of its own messages.
 package kafka
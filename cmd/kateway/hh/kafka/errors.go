@@ -0,0 +1,12 @@
+package kafka
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotOpen        = errors.New("service not open")
+	ErrStandbyCluster = errors.New("standby cluster cannot hand off to itself")
+	ErrInvalidRecord  = errors.New("invalid handoff record")
+	ErrClusterTooLong = errors.New("cluster name too long")
+)
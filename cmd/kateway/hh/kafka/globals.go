@@ -0,0 +1,21 @@
+package kafka
+
+import (
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	defaultTopic           = "_kateway_hh"
+	defaultGroup           = "_kateway_hh"
+	defaultRefreshInterval = time.Second * 5
+
+	initialBackoff = time.Second
+	maxBackoff     = time.Second * 31
+)
+
+var (
+	// Auditor logs the replayed messages for pub audit if not nil.
+	Auditor *log.Logger
+)
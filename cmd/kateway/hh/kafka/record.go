@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"encoding/binary"
+)
+
+const (
+	nilKey        = 0xFFFFFFFF
+	maxClusterLen = 255
+)
+
+// A record is a failed pub message parked in the handoff topic.
+//
+// ┌──────────┐ ┌─────────┐ ┌──────────┐ ┌───────┐ ┌─────────┐ ┌─────┐ ┌───────┐
+// │ clen(1)  │ │ cluster │ │ tlen(2)  │ │ topic │ │ klen(4) │ │ key │ │ value │
+// └──────────┘ └─────────┘ └──────────┘ └───────┘ └─────────┘ └─────┘ └───────┘
+//
+// klen is 0xFFFFFFFF for nil key, cluster is at most maxClusterLen bytes.
+func encodeRecord(cluster, topic string, key, value []byte) []byte {
+	b := make([]byte, 1+len(cluster)+2+len(topic)+4+len(key)+len(value))
+	i := 0
+	b[i] = byte(len(cluster))
+	i += 1 + copy(b[i+1:], cluster)
+	binary.BigEndian.PutUint16(b[i:], uint16(len(topic)))
+	i += 2 + copy(b[i+2:], topic)
+	if key == nil {
+		binary.BigEndian.PutUint32(b[i:], nilKey)
+	} else {
+		binary.BigEndian.PutUint32(b[i:], uint32(len(key)))
+	}
+	i += 4 + copy(b[i+4:], key)
+	copy(b[i:], value)
+	return b
+}
+
+func decodeRecord(b []byte) (cluster, topic string, key, value []byte, err error) {
+	err = ErrInvalidRecord
+
+	if len(b) < 1 {
+		return
+	}
+	clen := int(b[0])
+	b = b[1:]
+	if len(b) < clen+2 {
+		return
+	}
+	cluster = string(b[:clen])
+	b = b[clen:]
+
+	tlen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < tlen+4 {
+		return
+	}
+	topic = string(b[:tlen])
+	b = b[tlen:]
+
+	klen := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if klen != nilKey {
+		if uint32(len(b)) < klen {
+			return
+		}
+		key = b[:klen]
+		b = b[klen:]
+	}
+
+	value, err = b, nil
+	return
+}
+
+// partitionKey keeps records of the same cluster/topic in order.
+func partitionKey(cluster, topic string) []byte {
+	return []byte(cluster + "/" + topic)
+}
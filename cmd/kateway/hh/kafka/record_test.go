@@ -0,0 +1,38 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestRecordEncodeDecode(t *testing.T) {
+	b := encodeRecord("trade", "100.orders.v1", []byte("uid"), []byte("hello world"))
+	cluster, topic, key, value, err := decodeRecord(b)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "trade", cluster)
+	assert.Equal(t, "100.orders.v1", topic)
+	assert.Equal(t, "uid", string(key))
+	assert.Equal(t, "hello world", string(value))
+
+	// nil key is different from empty key
+	_, _, key, _, err = decodeRecord(encodeRecord("trade", "t", nil, []byte("v")))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, key == nil)
+	_, _, key, _, err = decodeRecord(encodeRecord("trade", "t", []byte{}, []byte("v")))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, key != nil)
+	assert.Equal(t, 0, len(key))
+}
+
+func TestRecordCorrupted(t *testing.T) {
+	b := encodeRecord("trade", "100.orders.v1", []byte("uid"), nil)
+	for i := 0; i < len(b); i++ {
+		_, _, _, _, err := decodeRecord(b[:i])
+		assert.Equal(t, ErrInvalidRecord, err)
+	}
+
+	_, _, _, value, err := decodeRecord(b)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(value))
+}
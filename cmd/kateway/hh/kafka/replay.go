@@ -0,0 +1,307 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/gafka/sla"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/kafka-cg/consumergroup"
+	log "github.com/funkygao/log4go"
+)
+
+// handoffConsumer consumes a handoff topic, it is a kafka consumer group except in tests.
+type handoffConsumer interface {
+	Messages() <-chan *sarama.ConsumerMessage
+	Errors() <-chan error
+	CommitUpto(*sarama.ConsumerMessage) error
+	Close() error
+}
+
+// startReplay replays the handoff topic of a cluster unless it is being replayed,
+// caller holds the lock.
+func (this *Service) startReplay(cluster string, untilEmpty bool) {
+	if _, present := this.replaying[cluster]; present {
+		return
+	}
+
+	this.replaying[cluster] = struct{}{}
+	this.wg.Add(1)
+	go this.replay(cluster, untilEmpty)
+}
+
+// replay consumes the handoff topic of a cluster and pubs each record to the cluster.
+// If untilEmpty, it returns as soon as there is no lag.
+func (this *Service) replay(cluster string, untilEmpty bool) {
+	defer func() {
+		this.mu.Lock()
+		delete(this.replaying, cluster)
+		this.mu.Unlock()
+		this.wg.Done()
+	}()
+
+	topic := this.cfg.handoffTopic(cluster)
+	if untilEmpty {
+		// nothing handed off, don't bother joining the group
+		if lag, err := this.lag(cluster); err == nil && lag == 0 {
+			return
+		}
+	} else if err := this.createTopic(cluster); err != nil {
+		log.Error("hh[kafka] create %s/%s: %s", this.cfg.StandbyCluster, topic, err)
+	}
+
+	var (
+		cg  handoffConsumer
+		err error
+	)
+	for {
+		cg, err = this.join(cluster)
+		if err == nil {
+			break
+		}
+
+		log.Error("hh[kafka] join %s: %s", this.cfg.replayGroup(cluster), err)
+		select {
+		case <-this.quit:
+			return
+		case <-time.After(maxBackoff):
+		}
+	}
+	defer func() {
+		// commits the offsets before leaving the group
+		if err := cg.Close(); err != nil {
+			log.Error("hh[kafka] close %s: %s", this.cfg.replayGroup(cluster), err)
+		}
+	}()
+
+	log.Trace("hh[kafka] replaying %s/%s", this.cfg.StandbyCluster, topic)
+
+	var emptyCheck <-chan time.Time
+	if untilEmpty {
+		tick := time.NewTicker(this.cfg.RefreshInterval)
+		defer tick.Stop()
+		emptyCheck = tick.C
+	}
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case <-emptyCheck:
+			if lag, err := this.lag(cluster); err != nil {
+				log.Error("hh[kafka] %s lag: %s", topic, err)
+			} else if lag == 0 {
+				log.Trace("hh[kafka] %s flushed, delivered: %d", topic, this.deliverN.Get())
+				return
+			} else {
+				log.Trace("hh[kafka] %s flushing, lag: %d", topic, lag)
+			}
+
+		case err := <-cg.Errors():
+			log.Error("hh[kafka] %s %s", topic, err)
+
+		case msg := <-cg.Messages():
+			if !this.deliver(msg) {
+				// not committed, will be replayed again
+				return
+			}
+
+			cg.CommitUpto(msg)
+
+			this.mu.Lock()
+			replayed := this.replayed[cluster]
+			if replayed == nil {
+				replayed = make(map[int32]int64)
+				this.replayed[cluster] = replayed
+			}
+			if msg.Offset+1 > replayed[msg.Partition] {
+				replayed[msg.Partition] = msg.Offset + 1
+			}
+			this.mu.Unlock()
+
+			this.deliverN.Add(1)
+			if this.inflights.Get() > 0 {
+				this.inflights.Add(-1)
+			}
+		}
+	}
+}
+
+// deliver pubs a handoff record to its original cluster with exponential backoff until
+// success. It returns false if the service is stopped before the record is delivered.
+func (this *Service) deliver(msg *sarama.ConsumerMessage) bool {
+	cluster, topic, key, value, err := decodeRecord(msg.Value)
+	if err != nil {
+		log.Error("hh[kafka] %s P:%d O:%d %s, skipped", msg.Topic, msg.Partition, msg.Offset, err)
+		return true
+	}
+
+	var (
+		partition int32
+		offset    int64
+	)
+	backoff := initialBackoff
+	for {
+		partition, offset, err = store.DefaultPubStore.SyncPub(cluster, topic, key, value)
+		switch err {
+		case nil:
+			if Auditor != nil {
+				Auditor.Trace("hh[%s/%s] {P:%d O:%d}", cluster, topic, partition, offset)
+			}
+			return true
+
+		case store.ErrInvalidTopic, store.ErrInvalidCluster:
+			log.Warn("hh[kafka] %s/%s %s, dropped", cluster, topic, err)
+			return true
+		}
+
+		log.Debug("hh[kafka] %s/%s {k:%s v:%s} %s", cluster, topic, string(key), string(value), err)
+
+		select {
+		case <-this.quit:
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// refresh periodically syncs the replay progress with the committed offsets of the
+// replay groups, which covers messages replayed by other kateway instances.
+func (this *Service) refresh() {
+	defer this.wg.Done()
+
+	tick := time.NewTicker(this.cfg.RefreshInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case <-tick.C:
+			var total int64
+			for _, cluster := range this.clusters() {
+				lag, err := this.lag(cluster)
+				if err != nil {
+					log.Error("hh[kafka] %s lag: %s", this.cfg.handoffTopic(cluster), err)
+					continue
+				}
+
+				total += lag
+			}
+			this.inflights.Set(total)
+		}
+	}
+}
+
+// lag returns number of handoff records of a cluster not replayed yet, and updates
+// the replay progress.
+func (this *Service) lag(cluster string) (int64, error) {
+	newest, committed, err := this.progress(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	replayed := this.replayed[cluster]
+	if replayed == nil {
+		replayed = make(map[int32]int64)
+		this.replayed[cluster] = replayed
+	}
+
+	var lag int64
+	for partitionID, offset := range newest {
+		if committed[partitionID] > replayed[partitionID] {
+			replayed[partitionID] = committed[partitionID]
+		}
+		if offset > replayed[partitionID] {
+			lag += offset - replayed[partitionID]
+		}
+	}
+
+	return lag, nil
+}
+
+func (this *Service) joinReplayGroup(cluster string) (handoffConsumer, error) {
+	cf := consumergroup.NewConfig()
+	cf.Net.DialTimeout = time.Second * 10
+	cf.Net.WriteTimeout = time.Second * 10
+	cf.Net.ReadTimeout = time.Second * 10
+	cf.ChannelBufferSize = 100
+	cf.Consumer.Return.Errors = true
+	cf.Consumer.MaxProcessingTime = time.Second * 2
+	cf.Zookeeper.Chroot = meta.Default.ZkChroot(this.cfg.StandbyCluster)
+	cf.Zookeeper.Timeout = zk.DefaultZkSessionTimeout()
+	cf.Offsets.CommitInterval = time.Second
+	cf.Offsets.ProcessingTimeout = time.Second
+	cf.Offsets.ResetOffsets = false
+	cf.Offsets.Initial = sarama.OffsetOldest
+
+	cg, err := consumergroup.JoinConsumerGroup(this.cfg.replayGroup(cluster), []string{this.cfg.handoffTopic(cluster)},
+		meta.Default.ZkAddrs(), cf)
+	if err != nil {
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// replayProgress returns the newest offset and the next offset to replay of each
+// partition of the handoff topic of a cluster, empty if the topic does not exist.
+func (this *Service) replayProgress(cluster string) (newest, committed map[int32]int64, err error) {
+	topic := this.cfg.handoffTopic(cluster)
+	zkcluster := meta.Default.ZkCluster(this.cfg.StandbyCluster)
+	offsets := zkcluster.ConsumerOffsetsOfGroup(this.cfg.replayGroup(cluster))[topic]
+
+	kfk, err := sarama.NewClient(zkcluster.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer kfk.Close()
+
+	partitions, err := kfk.Partitions(topic)
+	if err == sarama.ErrUnknownTopicOrPartition {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	newest = make(map[int32]int64, len(partitions))
+	committed = make(map[int32]int64, len(partitions))
+	for _, partitionID := range partitions {
+		if newest[partitionID], err = kfk.GetOffset(topic, partitionID, sarama.OffsetNewest); err != nil {
+			return nil, nil, err
+		}
+
+		offset, present := offsets[strconv.Itoa(int(partitionID))]
+		if !present {
+			// never consumed: replay starts from the oldest
+			if offset, err = kfk.GetOffset(topic, partitionID, sarama.OffsetOldest); err != nil {
+				return nil, nil, err
+			}
+		}
+		committed[partitionID] = offset
+	}
+
+	return newest, committed, nil
+}
+
+func (this *Service) createHandoffTopic(cluster string) error {
+	err := meta.Default.ZkCluster(this.cfg.StandbyCluster).AddTopic(this.cfg.handoffTopic(cluster), sla.DefaultSla())
+	if err != nil && !zk.IsTopicError(err, zk.ErrTopicExists) {
+		return err
+	}
+
+	return nil
+}
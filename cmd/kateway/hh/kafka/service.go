@@ -1,8 +1,198 @@
 package kafka
 
+import (
+	"sync"
+
+	"github.com/funkygao/gafka/cmd/kateway/hh"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+	"github.com/funkygao/golib/sync2"
+	log "github.com/funkygao/log4go"
+)
+
+var _ hh.Service = &Service{}
+
+type position struct {
+	partition int32
+	offset    int64
+}
+
+// Service parks failed pub messages in the handoff topics of a standby cluster,
+// and replays them into their original cluster once it recovers.
+//
+// Each cluster has its own handoff topic and replay group. All kateway instances
+// share the replay groups, so a message handed off by one instance might be
+// replayed by another.
 type Service struct {
+	cfg *Config
+
+	closed sync2.AtomicBool
+	quit   chan struct{}
+	wg     sync.WaitGroup
+
+	mu sync.RWMutex
+
+	// the latest handoff position of each cluster/topic, used to tell
+	// whether all its handed off messages have been replayed
+	pending map[string]position
+
+	// cluster -> partition -> committed offset of the replay group, i.e. the next offset to replay
+	replayed map[string]map[int32]int64
+
+	// clusters whose handoff topic is being replayed
+	replaying map[string]struct{}
+
+	inflights sync2.AtomicInt64
+	appendN   sync2.AtomicInt64
+	deliverN  sync2.AtomicInt64
+
+	// kafka access of the standby cluster, replaced in tests
+	join        func(cluster string) (handoffConsumer, error)
+	progress    func(cluster string) (newest, committed map[int32]int64, err error)
+	createTopic func(cluster string) error
+}
+
+func New(cfg *Config) hh.Service {
+	this := &Service{
+		cfg:       cfg,
+		pending:   make(map[string]position),
+		replayed:  make(map[string]map[int32]int64),
+		replaying: make(map[string]struct{}),
+	}
+	this.closed.Set(true)
+	this.join = this.joinReplayGroup
+	this.progress = this.replayProgress
+	this.createTopic = this.createHandoffTopic
+	return this
+}
+
+func (this *Service) Name() string {
+	return "kafka"
+}
+
+func (this *Service) Start() error {
+	this.quit = make(chan struct{})
+
+	this.mu.Lock()
+	this.closed.Set(false)
+	for _, cluster := range this.clusters() {
+		this.startReplay(cluster, false)
+	}
+	this.mu.Unlock()
+
+	this.wg.Add(1)
+	go this.refresh()
+
+	log.Trace("hh[kafka] started, standby: %s/%s.*", this.cfg.StandbyCluster, this.cfg.Topic)
+	return nil
+}
+
+func (this *Service) Stop() {
+	this.mu.Lock()
+	if this.closed.Get() {
+		this.mu.Unlock()
+		return
+	}
+	this.closed.Set(true)
+	this.mu.Unlock()
+
+	close(this.quit)
+	this.wg.Wait()
+	log.Trace("hh[kafka] stopped")
+}
+
+func (this *Service) Append(cluster, topic string, key, value []byte) error {
+	if this.closed.Get() {
+		return ErrNotOpen
+	}
+	if cluster == this.cfg.StandbyCluster {
+		return ErrStandbyCluster
+	}
+	if len(cluster) > maxClusterLen {
+		return ErrClusterTooLong
+	}
+
+	this.mu.RLock()
+	_, replaying := this.replaying[cluster]
+	this.mu.RUnlock()
+	if !replaying {
+		// a cluster added after Start
+		if err := this.createTopic(cluster); err != nil {
+			return err
+		}
+	}
+
+	partition, offset, err := store.DefaultPubStore.SyncPub(this.cfg.StandbyCluster, this.cfg.handoffTopic(cluster),
+		partitionKey(cluster, topic), encodeRecord(cluster, topic, key, value))
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	this.pending[cluster+"/"+topic] = position{partition: partition, offset: offset}
+	if !replaying && !this.closed.Get() {
+		this.startReplay(cluster, false)
+	}
+	this.mu.Unlock()
+
+	this.inflights.Add(1)
+	this.appendN.Add(1)
+	return nil
+}
+
+func (this *Service) Empty(cluster, topic string) bool {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	pos, present := this.pending[cluster+"/"+topic]
+	if !present {
+		return true
+	}
+
+	return this.replayed[cluster][pos.partition] > pos.offset
+}
+
+// FlushInflights replays the handoff topics until there is no lag.
+// It must be called when the service is not started.
+func (this *Service) FlushInflights() {
+	if !this.closed.Get() {
+		log.Warn("hh[kafka] flush inflights while open, ignored")
+		return
+	}
+
+	this.quit = make(chan struct{})
+	this.mu.Lock()
+	for _, cluster := range this.clusters() {
+		this.startReplay(cluster, true)
+	}
+	this.mu.Unlock()
+	this.wg.Wait()
+}
+
+func (this *Service) Inflights() int64 {
+	return this.inflights.Get()
+}
+
+func (this *Service) AppendN() int64 {
+	return this.appendN.Get()
+}
+
+func (this *Service) DeliverN() int64 {
+	return this.deliverN.Get()
+}
+
+func (this *Service) ResetCounters() {
+	this.appendN.Set(0)
+	this.deliverN.Set(0)
 }
 
-func New() *Service {
-	return &Service{}
+// clusters returns the live clusters that might hand off to the standby cluster.
+func (this *Service) clusters() []string {
+	var clusters []string
+	for _, cluster := range meta.Default.ClusterNames() {
+		if cluster != this.cfg.StandbyCluster && len(cluster) <= maxClusterLen {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
 }
@@ -0,0 +1,245 @@
+package kafka
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/meta"
+	"github.com/funkygao/gafka/cmd/kateway/store"
+)
+
+type mockMeta struct {
+	meta.MetaStore
+}
+
+func (this *mockMeta) ClusterNames() []string { return []string{"trade", "pay", "standby"} }
+
+// mockKafka is the standby cluster with single partition handoff topics, and
+// the original clusters that fail all pubs while down.
+type mockKafka struct {
+	store.PubStore
+
+	mu        sync.Mutex
+	logs      map[string][]*sarama.ConsumerMessage // handoff topic: messages
+	committed map[string]int64                     // handoff topic: next offset
+	down      map[string]bool                      // cluster: down
+	delivered map[string][]string                  // cluster: messages
+	created   map[string]bool                      // cluster: handoff topic created
+}
+
+func newMockKafka() *mockKafka {
+	return &mockKafka{
+		logs:      make(map[string][]*sarama.ConsumerMessage),
+		committed: make(map[string]int64),
+		down:      make(map[string]bool),
+		delivered: make(map[string][]string),
+		created:   make(map[string]bool),
+	}
+}
+
+func (this *mockKafka) SyncPub(cluster, topic string, key, msg []byte) (int32, int64, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if cluster == "standby" {
+		offset := int64(len(this.logs[topic]))
+		this.logs[topic] = append(this.logs[topic], &sarama.ConsumerMessage{Topic: topic, Offset: offset, Value: msg})
+		return 0, offset, nil
+	}
+
+	if this.down[cluster] {
+		return 0, 0, errors.New("kafka down")
+	}
+
+	this.delivered[cluster] = append(this.delivered[cluster], string(msg))
+	return 0, int64(len(this.delivered[cluster]) - 1), nil
+}
+
+func (this *mockKafka) setDown(cluster string, down bool) {
+	this.mu.Lock()
+	this.down[cluster] = down
+	this.mu.Unlock()
+}
+
+func (this *mockKafka) deliveredOf(cluster string) []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]string(nil), this.delivered[cluster]...)
+}
+
+func (this *mockKafka) topicCreated(cluster string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.created[cluster]
+}
+
+func (this *mockKafka) next(topic string, offset int64) *sarama.ConsumerMessage {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if offset < int64(len(this.logs[topic])) {
+		return this.logs[topic][offset]
+	}
+	return nil
+}
+
+type mockConsumer struct {
+	kafka *mockKafka
+	topic string
+	msgs  chan *sarama.ConsumerMessage
+	quit  chan struct{}
+}
+
+func (this *mockConsumer) feed() {
+	this.kafka.mu.Lock()
+	offset := this.kafka.committed[this.topic]
+	this.kafka.mu.Unlock()
+
+	for {
+		msg := this.kafka.next(this.topic, offset)
+		if msg == nil {
+			select {
+			case <-this.quit:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			continue
+		}
+
+		select {
+		case <-this.quit:
+			return
+		case this.msgs <- msg:
+			offset++
+		}
+	}
+}
+
+func (this *mockConsumer) Messages() <-chan *sarama.ConsumerMessage { return this.msgs }
+func (this *mockConsumer) Errors() <-chan error                     { return nil }
+func (this *mockConsumer) Close() error                             { close(this.quit); return nil }
+
+func (this *mockConsumer) CommitUpto(msg *sarama.ConsumerMessage) error {
+	this.kafka.mu.Lock()
+	this.kafka.committed[this.topic] = msg.Offset + 1
+	this.kafka.mu.Unlock()
+	return nil
+}
+
+func setupService(t *testing.T) (*Service, *mockKafka, func()) {
+	oldMeta, oldStore := meta.Default, store.DefaultPubStore
+	kfk := newMockKafka()
+	meta.Default = &mockMeta{}
+	store.DefaultPubStore = kfk
+
+	cfg := DefaultConfig()
+	cfg.StandbyCluster = "standby"
+	cfg.RefreshInterval = time.Millisecond * 10
+	s := New(cfg).(*Service)
+	s.join = func(cluster string) (handoffConsumer, error) {
+		c := &mockConsumer{
+			kafka: kfk,
+			topic: cfg.handoffTopic(cluster),
+			msgs:  make(chan *sarama.ConsumerMessage),
+			quit:  make(chan struct{}),
+		}
+		go c.feed()
+		return c, nil
+	}
+	s.progress = func(cluster string) (newest, committed map[int32]int64, err error) {
+		kfk.mu.Lock()
+		defer kfk.mu.Unlock()
+		topic := cfg.handoffTopic(cluster)
+		if _, present := kfk.logs[topic]; !present {
+			return nil, nil, nil
+		}
+		return map[int32]int64{0: int64(len(kfk.logs[topic]))}, map[int32]int64{0: kfk.committed[topic]}, nil
+	}
+	s.createTopic = func(cluster string) error {
+		kfk.mu.Lock()
+		kfk.created[cluster] = true
+		kfk.mu.Unlock()
+		return nil
+	}
+
+	return s, kfk, func() {
+		meta.Default, store.DefaultPubStore = oldMeta, oldStore
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("timed out")
+}
+
+func TestServiceAppend(t *testing.T) {
+	s, kfk, teardown := setupService(t)
+	defer teardown()
+
+	assert.Equal(t, ErrNotOpen, s.Append("trade", "t1", nil, []byte("m1")))
+	assert.Equal(t, nil, s.Start())
+	defer s.Stop()
+
+	assert.Equal(t, ErrStandbyCluster, s.Append("standby", "t1", nil, []byte("m1")))
+	assert.Equal(t, ErrClusterTooLong, s.Append(strings.Repeat("c", maxClusterLen+1), "t1", nil, []byte("m1")))
+	assert.Equal(t, true, s.Empty("trade", "t1"))
+
+	// one cluster down does not hold up the others
+	kfk.setDown("trade", true)
+	assert.Equal(t, nil, s.Append("trade", "t1", nil, []byte("m1")))
+	assert.Equal(t, nil, s.Append("pay", "t2", []byte("k"), []byte("m2")))
+	assert.Equal(t, nil, s.Append("pay", "t2", nil, []byte("m3")))
+	assert.Equal(t, int64(3), s.AppendN())
+	waitUntil(t, func() bool { return s.Empty("pay", "t2") })
+	assert.Equal(t, []string{"m2", "m3"}, kfk.deliveredOf("pay"))
+	assert.Equal(t, false, s.Empty("trade", "t1"))
+	assert.Equal(t, 0, len(kfk.deliveredOf("trade")))
+
+	kfk.setDown("trade", false)
+	waitUntil(t, func() bool { return s.Empty("trade", "t1") })
+	assert.Equal(t, []string{"m1"}, kfk.deliveredOf("trade"))
+	assert.Equal(t, int64(3), s.DeliverN())
+	waitUntil(t, func() bool { return s.Inflights() == 0 })
+
+	// cluster added after start has its handoff topic created and replayed
+	assert.Equal(t, nil, s.Append("risk", "t3", nil, []byte("m4")))
+	assert.Equal(t, true, kfk.topicCreated("risk"))
+	waitUntil(t, func() bool { return s.Empty("risk", "t3") })
+
+	s.ResetCounters()
+	assert.Equal(t, int64(0), s.AppendN())
+	assert.Equal(t, int64(0), s.DeliverN())
+
+	s.Stop()
+	assert.Equal(t, ErrNotOpen, s.Append("trade", "t1", nil, []byte("m1")))
+}
+
+func TestServiceFlushInflights(t *testing.T) {
+	s, kfk, teardown := setupService(t)
+	defer teardown()
+
+	// handed off by a kateway that crashed, partially replayed
+	topic := s.cfg.handoffTopic("trade")
+	for _, m := range []string{"m1", "m2", "m3"} {
+		kfk.SyncPub("standby", topic, nil, encodeRecord("trade", "t1", nil, []byte(m)))
+	}
+	kfk.committed[topic] = 1
+
+	s.FlushInflights()
+	assert.Equal(t, []string{"m2", "m3"}, kfk.deliveredOf("trade"))
+	assert.Equal(t, int64(3), kfk.committed[topic])
+	assert.Equal(t, int64(2), s.DeliverN())
+	assert.Equal(t, false, kfk.topicCreated("trade")) // flush never creates handoff topics
+
+	// nothing left
+	s.FlushInflights()
+	assert.Equal(t, int64(2), s.DeliverN())
+}
@@ -0,0 +1,31 @@
+package disk
+
+import (
+	"errors"
+	"time"
+)
+
+type Config struct {
+	Dir string
+
+	// SyncInterval is how often the log is fsync'ed, 0 means fsync on each write.
+	SyncInterval time.Duration
+
+	// CompactThreshold is the min log size in bytes before compaction is considered.
+	CompactThreshold int64
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		SyncInterval:     time.Second,
+		CompactThreshold: 64 << 20,
+	}
+}
+
+func (this *Config) Validate() error {
+	if this.Dir == "" {
+		return errors.New("inflight Dir must be specified")
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package disk
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	logFile     = "inflight.log"
+	compactFile = "inflight.log.compact"
+)
+
+var _ inflight.Inflight = &diskInflight{}
+
+type diskInflight struct {
+	cfg *Config
+
+	mu    sync.Mutex
+	table *inflight.Table
+	live  int64 // bytes of live records in log
+
+	f      *os.File
+	w      *bufio.Writer
+	size   int64 // log file size
+	dirty  bool  // written since last fsync
+	quit   chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func New(cfg *Config) inflight.Inflight {
+	return &diskInflight{
+		cfg:    cfg,
+		table:  inflight.NewTable(),
+		quit:   make(chan struct{}),
+		closed: true,
+	}
+}
+
+// Init replays the log on disk and opens it for appending.
+func (this *diskInflight) Init() (err error) {
+	if err = this.cfg.Validate(); err != nil {
+		return
+	}
+	if err = os.MkdirAll(this.cfg.Dir, 0700); err != nil {
+		return
+	}
+
+	// a crash during compaction leaves the original log intact
+	os.Remove(filepath.Join(this.cfg.Dir, compactFile))
+
+	this.f, err = os.OpenFile(this.logPath(), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return
+	}
+
+	if err = this.replay(); err != nil {
+		this.f.Close()
+		return
+	}
+
+	this.w = bufio.NewWriter(this.f)
+	this.closed = false
+
+	if this.cfg.SyncInterval > 0 {
+		this.wg.Add(1)
+		go this.syncer()
+	}
+
+	log.Trace("inflight[%s] replayed %d messages", this.cfg.Dir, this.Count())
+	return
+}
+
+func (this *diskInflight) Stop() error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	this.mu.Unlock()
+
+	close(this.quit)
+	this.wg.Wait()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if err := this.sync(); err != nil {
+		this.f.Close()
+		return err
+	}
+	return this.f.Close()
+}
+
+func (this *diskInflight) TakeOff(cluster, topic, group, partition string, offset int64, key, msg []byte, deadline time.Time) error {
+	if len(partition) > maxPartitionBytes {
+		return ErrPartitionTooLong
+	}
+
+	rec := record{
+		op:         opTakeOff,
+		key:        inflight.GroupKey(cluster, topic, group),
+		partition:  partition,
+		offset:     offset,
+		deadline:   deadline.UnixNano(),
+		deliveries: 1,
+		msgKey:     key,
+		value:      msg,
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return ErrNotOpen
+	}
+
+	if old := this.table.Get(rec.key, partition, offset); old != nil {
+		rec.deliveries = old.Deliveries + 1
+	}
+
+	n, err := this.append(&rec)
+	if err != nil {
+		return err
+	}
+
+	this.apply(&rec, n)
+	return nil
+}
+
+func (this *diskInflight) Touch(cluster, topic, group, partition string, offset int64, deadline time.Time) error {
+	key := inflight.GroupKey(cluster, topic, group)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	m := this.table.Get(key, partition, offset)
+	if m == nil || this.closed {
+		return inflight.ErrNotInflight
+	}
+
+	return this.touch(key, m, deadline, m.Deliveries)
+}
+
+func (this *diskInflight) Redeliver(cluster, topic, group string, n int, deadline time.Time) ([]inflight.Message, error) {
+	key := inflight.GroupKey(cluster, topic, group)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return nil, ErrNotOpen
+	}
+
+	expired := this.table.Expired(key, time.Now(), n)
+	msgs := make([]inflight.Message, 0, len(expired))
+	for _, m := range expired {
+		if err := this.touch(key, m, deadline, m.Deliveries+1); err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, *m)
+	}
+
+	this.maybeCompact()
+	return msgs, nil
+}
+
+func (this *diskInflight) Land(cluster, topic, group, partition string, offset int64) error {
+	_, err := this.LandX(cluster, topic, group, partition, offset)
+	return err
+}
+
+func (this *diskInflight) LandX(cluster, topic, group, partition string, offset int64) ([]byte, error) {
+	key := inflight.GroupKey(cluster, topic, group)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	m := this.table.Get(key, partition, offset)
+	if m == nil || this.closed {
+		return nil, inflight.ErrNotInflight
+	}
+
+	rec := record{op: opLand, key: key, partition: partition, offset: offset}
+	n, err := this.append(&rec)
+	if err != nil {
+		return nil, err
+	}
+
+	this.apply(&rec, n)
+	this.maybeCompact()
+	return m.Value, nil
+}
+
+// Count returns number of inflight messages.
+func (this *diskInflight) Count() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.table.Len()
+}
+
+// touch logs the new visibility deadline of an inflight message, caller holds the lock.
+func (this *diskInflight) touch(key string, m *inflight.Message, deadline time.Time, deliveries int) error {
+	rec := record{
+		op:         opTouch,
+		key:        key,
+		partition:  m.Partition,
+		offset:     m.Offset,
+		deadline:   deadline.UnixNano(),
+		deliveries: deliveries,
+	}
+	n, err := this.append(&rec)
+	if err != nil {
+		return err
+	}
+
+	this.apply(&rec, n)
+	return nil
+}
+
+// append writes a record to log, caller holds the lock.
+func (this *diskInflight) append(rec *record) (int64, error) {
+	b := rec.encode()
+	if _, err := this.w.Write(b); err != nil {
+		return 0, err
+	}
+	if err := this.w.Flush(); err != nil {
+		return 0, err
+	}
+
+	this.size += int64(len(b))
+	this.dirty = true
+	if this.cfg.SyncInterval == 0 {
+		if err := this.sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(b)), nil
+}
+
+// apply makes a logged record take effect in memory, caller holds the lock.
+// Only the latest TakeOff record of an inflight message is live, touches are
+// folded into it on compaction.
+func (this *diskInflight) apply(rec *record, n int64) {
+	switch rec.op {
+	case opTakeOff:
+		old := this.table.Put(rec.key, &inflight.Message{
+			Partition:  rec.partition,
+			Offset:     rec.offset,
+			Key:        rec.msgKey,
+			Value:      rec.value,
+			Deadline:   time.Unix(0, rec.deadline),
+			Deliveries: rec.deliveries,
+		})
+		if old != nil {
+			// reentrant TakeOff replaces the previous record
+			this.live -= recordSize(rec.key, old)
+		}
+		this.live += n
+
+	case opTouch:
+		if m := this.table.Get(rec.key, rec.partition, rec.offset); m != nil {
+			this.table.SetDeadline(rec.key, m, time.Unix(0, rec.deadline))
+			m.Deliveries = rec.deliveries
+		}
+
+	case opLand:
+		if m := this.table.Delete(rec.key, rec.partition, rec.offset); m != nil {
+			this.live -= recordSize(rec.key, m)
+		}
+	}
+}
+
+func (this *diskInflight) replay() error {
+	r := bufio.NewReader(this.f)
+	var valid int64
+	for {
+		rec, n, err := decodeRecord(r)
+		if err != nil {
+			if err != io.EOF {
+				// torn write at tail, drop it
+				log.Warn("inflight[%s] truncate log at %d: %v", this.cfg.Dir, valid, err)
+			}
+			break
+		}
+
+		this.apply(&rec, n)
+		valid += n
+	}
+
+	if err := this.f.Truncate(valid); err != nil {
+		return err
+	}
+	if _, err := this.f.Seek(valid, io.SeekStart); err != nil {
+		return err
+	}
+
+	this.size = valid
+	return nil
+}
+
+// maybeCompact rewrites the log with live records only, caller holds the lock.
+func (this *diskInflight) maybeCompact() {
+	if this.size < this.cfg.CompactThreshold || this.live*2 > this.size {
+		return
+	}
+
+	t0 := time.Now()
+	before := this.size
+	if err := this.compact(); err != nil {
+		log.Error("inflight[%s] compact: %v", this.cfg.Dir, err)
+		return
+	}
+
+	log.Trace("inflight[%s] compacted %d -> %d bytes in %s", this.cfg.Dir, before, this.size, time.Since(t0))
+}
+
+func (this *diskInflight) compact() error {
+	tmp := filepath.Join(this.cfg.Dir, compactFile)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	w := bufio.NewWriter(f)
+	this.table.Each(func(key string, m *inflight.Message) {
+		if err != nil {
+			return
+		}
+
+		rec := record{
+			op:         opTakeOff,
+			key:        key,
+			partition:  m.Partition,
+			offset:     m.Offset,
+			deadline:   m.Deadline.UnixNano(),
+			deliveries: m.Deliveries,
+			msgKey:     m.Key,
+			value:      m.Value,
+		}
+		b := rec.encode()
+		_, err = w.Write(b)
+		size += int64(len(b))
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = os.Rename(tmp, this.logPath()); err != nil {
+		f.Close()
+		return err
+	}
+
+	this.f.Close()
+	this.f = f
+	this.w = bufio.NewWriter(f)
+	this.size = size
+	this.live = size
+	this.dirty = false
+	return nil
+}
+
+func (this *diskInflight) syncer() {
+	defer this.wg.Done()
+
+	ticker := time.NewTicker(this.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.quit:
+			return
+
+		case <-ticker.C:
+			this.mu.Lock()
+			if err := this.sync(); err != nil {
+				log.Error("inflight[%s] sync: %v", this.cfg.Dir, err)
+			}
+			this.mu.Unlock()
+		}
+	}
+}
+
+// sync flushes log to disk, caller holds the lock.
+func (this *diskInflight) sync() error {
+	if !this.dirty {
+		return nil
+	}
+
+	if err := this.f.Sync(); err != nil {
+		return err
+	}
+
+	this.dirty = false
+	return nil
+}
+
+func (this *diskInflight) logPath() string {
+	return filepath.Join(this.cfg.Dir, logFile)
+}
+
+func recordSize(key string, m *inflight.Message) int64 {
+	return int64(recordHeaderLen + recordFixedLen + len(key) + len(m.Partition) + len(m.Key) + len(m.Value))
+}
@@ -0,0 +1,129 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/inflight"
+)
+
+var (
+	msg      = []byte("hello world")
+	deadline = time.Now().Add(time.Minute)
+)
+
+func newTestStore(t *testing.T) *diskInflight {
+	cfg := DefaultConfig()
+	cfg.Dir = "inflight_test"
+	cfg.SyncInterval = 0
+	s := New(cfg).(*diskInflight)
+	assert.Equal(t, nil, s.Init())
+	return s
+}
+
+func TestTakeOffLandReplay(t *testing.T) {
+	os.RemoveAll("inflight_test")
+	defer os.RemoveAll("inflight_test")
+
+	s := newTestStore(t)
+	for i := int64(1); i <= 5; i++ {
+		assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", i, nil, msg, deadline))
+	}
+	assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", 5, nil, msg, deadline)) // reentrant
+
+	// out of order acks
+	assert.Equal(t, nil, s.Land("cluster", "topic", "group", "0", 4))
+	m, err := s.LandX("cluster", "topic", "group", "0", 2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello world", string(m))
+	assert.Equal(t, inflight.ErrNotInflight, s.Land("cluster", "topic", "group", "0", 2))
+	assert.Equal(t, 3, s.Count())
+	assert.Equal(t, nil, s.Stop())
+
+	// crash recovery
+	s = newTestStore(t)
+	assert.Equal(t, 3, s.Count())
+	for _, offset := range []int64{1, 3, 5} {
+		assert.Equal(t, nil, s.Land("cluster", "topic", "group", "0", offset))
+	}
+	assert.Equal(t, 0, s.Count())
+	s.Stop()
+}
+
+func TestTornTail(t *testing.T) {
+	os.RemoveAll("inflight_test")
+	defer os.RemoveAll("inflight_test")
+
+	s := newTestStore(t)
+	assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", 1, nil, msg, deadline))
+	s.Stop()
+
+	// simulate a partial write
+	f, _ := os.OpenFile(filepath.Join("inflight_test", logFile), os.O_APPEND|os.O_WRONLY, 0600)
+	f.Write([]byte{0, 0, 0, 100, 1, 2})
+	f.Close()
+
+	s = newTestStore(t)
+	assert.Equal(t, 1, s.Count())
+	assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", 2, nil, msg, deadline))
+	s.Stop()
+
+	s = newTestStore(t)
+	assert.Equal(t, 2, s.Count())
+	s.Stop()
+}
+
+func TestCompact(t *testing.T) {
+	os.RemoveAll("inflight_test")
+	defer os.RemoveAll("inflight_test")
+
+	s := newTestStore(t)
+	s.cfg.CompactThreshold = 1 << 10
+	for i := int64(0); i < 100; i++ {
+		assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", i, nil, msg, deadline))
+	}
+	for i := int64(0); i < 99; i++ {
+		assert.Equal(t, nil, s.Land("cluster", "topic", "group", "0", i))
+	}
+	assert.Equal(t, true, s.size < 1<<10)
+	s.Stop()
+
+	s = newTestStore(t)
+	assert.Equal(t, 1, s.Count())
+	m, err := s.LandX("cluster", "topic", "group", "0", 99)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "hello world", string(m))
+	s.Stop()
+}
+
+func TestVisibilityReplay(t *testing.T) {
+	os.RemoveAll("inflight_test")
+	defer os.RemoveAll("inflight_test")
+
+	past := time.Now().Add(-time.Second)
+	s := newTestStore(t)
+	assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "0", 1, []byte("key"), msg, deadline))
+	assert.Equal(t, nil, s.TakeOff("cluster", "topic", "group", "1", 2, nil, msg, deadline))
+	assert.Equal(t, nil, s.Touch("cluster", "topic", "group", "1", 2, past))
+	msgs, err := s.Redeliver("cluster", "topic", "group", 10, deadline)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, 2, msgs[0].Deliveries)
+	assert.Equal(t, nil, s.Touch("cluster", "topic", "group", "0", 1, past))
+	s.Stop()
+
+	// deadlines and delivery counts survive crash
+	s = newTestStore(t)
+	msgs, err = s.Redeliver("cluster", "topic", "group", 10, deadline)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "0", msgs[0].Partition)
+	assert.Equal(t, int64(1), msgs[0].Offset)
+	assert.Equal(t, 2, msgs[0].Deliveries)
+	assert.Equal(t, "key", string(msgs[0].Key))
+	assert.Equal(t, "hello world", string(msgs[0].Value))
+	s.Stop()
+}
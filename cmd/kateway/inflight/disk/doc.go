@@ -0,0 +1,7 @@
+// Package disk implements a durable inflight store with an append-only log.
+//
+// Each TakeOff and Land is appended to the log before it takes effect in
+// memory, and the log is replayed on Init so that inflight messages survive
+// a kateway crash. When landed records dominate the log, it is compacted by
+// rewriting only the live inflight messages.
+package disk
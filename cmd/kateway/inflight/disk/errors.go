@@ -0,0 +1,10 @@
+package disk
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotOpen          = errors.New("inflight store not open")
+	ErrPartitionTooLong = errors.New("inflight partition too long")
+)
@@ -0,0 +1,122 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	opTakeOff byte = 1
+	opLand    byte = 2
+	opTouch   byte = 3
+
+	recordHeaderLen   = 8  // payload len + crc
+	recordFixedLen    = 28 // op + key len + partition len + offset + deadline + deliveries + msg key len
+	maxRecordLen      = 16 << 20
+	maxPartitionBytes = 255
+)
+
+var errCorruptRecord = errors.New("corrupt inflight record")
+
+// record is a single log entry, key is the group key and msgKey the key of
+// the kafka message.
+//
+// ┌─────────┐ ┌─────────┐ ┌────────┐ ┌─────────┐ ┌─────────┐ ┌──────────┐ ┌───────────┐
+// | len     | | crc32   | | op     | | key len | | key     | | part len | | partition |
+// | 4 bytes | | 4 bytes | | 1 byte | | 2 bytes | | N bytes | | 1 byte   | | N bytes   |
+// └─────────┘ └─────────┘ └────────┘ └─────────┘ └─────────┘ └──────────┘ └───────────┘
+// ┌─────────┐ ┌──────────┐ ┌────────────┐ ┌─────────────┐ ┌─────────┐ ┌─────────┐
+// | offset  | | deadline | | deliveries | | msg key len | | msg key | | value   |
+// | 8 bytes | | 8 bytes  | | 4 bytes    | | 4 bytes     | | N bytes | | N bytes |
+// └─────────┘ └──────────┘ └────────────┘ └─────────────┘ └─────────┘ └─────────┘
+type record struct {
+	op         byte
+	key        string
+	partition  string
+	offset     int64
+	deadline   int64 // unix nano
+	deliveries int
+	msgKey     []byte
+	value      []byte
+}
+
+func (r *record) encode() []byte {
+	payloadLen := recordFixedLen + len(r.key) + len(r.partition) + len(r.msgKey) + len(r.value)
+	buf := make([]byte, recordHeaderLen+payloadLen)
+	p := buf[recordHeaderLen:]
+	p[0] = r.op
+	binary.BigEndian.PutUint16(p[1:], uint16(len(r.key)))
+	i := 3 + copy(p[3:], r.key)
+	p[i] = byte(len(r.partition))
+	i += 1 + copy(p[i+1:], r.partition)
+	binary.BigEndian.PutUint64(p[i:], uint64(r.offset))
+	binary.BigEndian.PutUint64(p[i+8:], uint64(r.deadline))
+	binary.BigEndian.PutUint32(p[i+16:], uint32(r.deliveries))
+	binary.BigEndian.PutUint32(p[i+20:], uint32(len(r.msgKey)))
+	i += 24 + copy(p[i+24:], r.msgKey)
+	copy(p[i:], r.value)
+
+	binary.BigEndian.PutUint32(buf[0:], uint32(payloadLen))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(p))
+	return buf
+}
+
+// decodeRecord reads the next record, returns the bytes consumed.
+func decodeRecord(r io.Reader) (rec record, n int64, err error) {
+	var hdr [recordHeaderLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+
+	payloadLen := binary.BigEndian.Uint32(hdr[0:])
+	if payloadLen < recordFixedLen || payloadLen > maxRecordLen {
+		err = errCorruptRecord
+		return
+	}
+
+	p := make([]byte, payloadLen)
+	if _, err = io.ReadFull(r, p); err != nil {
+		return
+	}
+	if crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(hdr[4:]) {
+		err = errCorruptRecord
+		return
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(p[1:]))
+	if recordFixedLen+keyLen > len(p) {
+		err = errCorruptRecord
+		return
+	}
+	i := 3 + keyLen
+	partLen := int(p[i])
+	if recordFixedLen+keyLen+partLen > len(p) {
+		err = errCorruptRecord
+		return
+	}
+
+	rec.op = p[0]
+	rec.key = string(p[3:i])
+	rec.partition = string(p[i+1 : i+1+partLen])
+	i += 1 + partLen
+	rec.offset = int64(binary.BigEndian.Uint64(p[i:]))
+	rec.deadline = int64(binary.BigEndian.Uint64(p[i+8:]))
+	rec.deliveries = int(binary.BigEndian.Uint32(p[i+16:]))
+	msgKeyLen := int(binary.BigEndian.Uint32(p[i+20:]))
+	if msgKeyLen > len(p)-i-24 {
+		err = errCorruptRecord
+		return
+	}
+	i += 24
+	if msgKeyLen > 0 {
+		rec.msgKey = p[i : i+msgKeyLen]
+		i += msgKeyLen
+	}
+	if v := p[i:]; len(v) > 0 {
+		rec.value = v
+	}
+	n = int64(recordHeaderLen) + int64(payloadLen)
+	return
+}
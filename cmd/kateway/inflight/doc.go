@@ -1,4 +1,3 @@
-// Deprecated pkg
 // Package inflight provides storage for manipulating inflight
 // message offsets.
 //
@@ -19,4 +18,11 @@
 //    |        Sub/Land(2) |
 //    |<-------------------|
 //    |                    |
+//
+// Inflight messages are local to the kateway that took them off, other
+// kateways of the group never redeliver them.
+// If a kateway dies, its inflight messages are redelivered only after it
+// restarts with the same disk store, the mem store loses them on crash.
+// If it never comes back, the group has to reset its offset to consume
+// them again.
 package inflight
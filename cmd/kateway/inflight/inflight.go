@@ -1,11 +1,31 @@
 package inflight
 
+import (
+	"time"
+)
+
 type Inflight interface {
+	// Land removes an inflight message.
+	// Acks can be out of order: landing an offset leaves lower inflight offsets untouched.
 	Land(cluster, topic, group, partition string, offset int64) error
 
+	// LandX is Land and returns the landed message.
 	LandX(cluster, topic, group, partition string, offset int64) ([]byte, error)
 
-	TakeOff(cluster, topic, group, partition string, offset int64, msg []byte) error
+	// TakeOff records a message as inflight and invisible to the group until deadline.
+	// It is reentrant for the same offset, each TakeOff counts as a delivery.
+	// The message key is kept so that redelivery carries it.
+	TakeOff(cluster, topic, group, partition string, offset int64, key, msg []byte, deadline time.Time) error
+
+	// Touch changes the visibility deadline of an inflight message, which either
+	// extends or cuts short its visibility timeout.
+	Touch(cluster, topic, group, partition string, offset int64, deadline time.Time) error
+
+	// Redeliver returns at most n inflight messages of a group whose visibility
+	// timeout has expired, earliest expired first, and takes them off again
+	// until deadline.
+	// Only messages taken off by this kateway are redelivered, see package doc.
+	Redeliver(cluster, topic, group string, n int, deadline time.Time) ([]Message, error)
 
 	Init() error
 	Stop() error
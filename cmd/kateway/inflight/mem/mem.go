@@ -2,27 +2,23 @@ package mem
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/funkygao/gafka/cmd/kateway/inflight"
-	"github.com/funkygao/golib/cmap"
 	log "github.com/funkygao/log4go"
 )
 
 type dumpRecord struct {
 	Key string
-	Val message
-}
-
-type message struct {
-	Offset int64
-	Value  []byte
+	Val inflight.Message
 }
 
 type memInflight struct {
-	offsets cmap.ConcurrentMap
+	mu    sync.Mutex
+	table *inflight.Table
 
 	snapshotFile string
 	debug        bool
@@ -30,83 +26,107 @@ type memInflight struct {
 
 func New(fn string, debug bool) *memInflight {
 	return &memInflight{
-		offsets:      cmap.New(),
+		table:        inflight.NewTable(),
 		snapshotFile: fn,
 		debug:        debug,
 	}
 }
 
-// FIXME bad perf
-func (this *memInflight) key(cluster, topic, group, partition string) string {
-	return fmt.Sprintf("%s:%s:%s:%s", cluster, topic, group, partition)
+func (this *memInflight) Land(cluster, topic, group, partition string, offset int64) error {
+	_, err := this.LandX(cluster, topic, group, partition, offset)
+	return err
 }
 
-func (this *memInflight) Land(cluster, topic, group, partition string, offset int64) error {
-	key := this.key(cluster, topic, group, partition)
+func (this *memInflight) LandX(cluster, topic, group, partition string, offset int64) ([]byte, error) {
+	key := inflight.GroupKey(cluster, topic, group)
 	if this.debug {
-		log.Debug("Land %s => %d", key, offset)
-	}
-	o, found := this.offsets.Get(key)
-	if !found || o.(message).Offset != offset {
-		if this.debug {
-			log.Error("out of order: %s", this)
-		}
-		return inflight.ErrOutOfOrder
+		log.Debug("LandX %s/%s => %d", key, partition, offset)
 	}
 
-	this.offsets.Remove(key)
-	return nil
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	m := this.table.Delete(key, partition, offset)
+	if m == nil {
+		return nil, inflight.ErrNotInflight
+	}
+	return m.Value, nil
 }
 
-func (this *memInflight) LandX(cluster, topic, group, partition string, offset int64) ([]byte, error) {
-	key := this.key(cluster, topic, group, partition)
+func (this *memInflight) TakeOff(cluster, topic, group, partition string, offset int64, key, msg []byte, deadline time.Time) error {
+	groupKey := inflight.GroupKey(cluster, topic, group)
 	if this.debug {
-		log.Debug("LandX %s => %d", key, offset)
-	}
-	o, found := this.offsets.Get(key)
-	if !found || o.(message).Offset != offset {
-		if this.debug {
-			log.Error("out of order: %s", this)
-		}
-		return nil, inflight.ErrOutOfOrder
+		log.Debug("TakeOff %s/%s => %d", groupKey, partition, offset)
 	}
 
-	msg := o.(message).Value
+	m := &inflight.Message{
+		Partition:  partition,
+		Offset:     offset,
+		Key:        key,
+		Value:      msg,
+		Deadline:   deadline,
+		Deliveries: 1,
+	}
 
-	this.offsets.Remove(key)
-	return msg, nil
+	this.mu.Lock()
+	if old := this.table.Put(groupKey, m); old != nil {
+		m.Deliveries = old.Deliveries + 1
+	}
+	this.mu.Unlock()
+	return nil
 }
 
-// FIXME not atomic, add CAS
-func (this *memInflight) TakeOff(cluster, topic, group, partition string, offset int64, msg []byte) error {
-	key := this.key(cluster, topic, group, partition)
-	if this.debug {
-		log.Debug("TakeOff %s => %d", key, offset)
+func (this *memInflight) Touch(cluster, topic, group, partition string, offset int64, deadline time.Time) error {
+	key := inflight.GroupKey(cluster, topic, group)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	m := this.table.Get(key, partition, offset)
+	if m == nil {
+		return inflight.ErrNotInflight
 	}
-	o, found := this.offsets.Get(key)
-	if found && o.(message).Offset != offset {
-		if this.debug {
-			log.Error("out of order: %s", this)
-		}
-		return inflight.ErrOutOfOrder
+
+	this.table.SetDeadline(key, m, deadline)
+	return nil
+}
+
+func (this *memInflight) Redeliver(cluster, topic, group string, n int, deadline time.Time) ([]inflight.Message, error) {
+	key := inflight.GroupKey(cluster, topic, group)
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	expired := this.table.Expired(key, time.Now(), n)
+	msgs := make([]inflight.Message, 0, len(expired))
+	for _, m := range expired {
+		this.table.SetDeadline(key, m, deadline)
+		m.Deliveries++
+		msgs = append(msgs, *m)
 	}
+	return msgs, nil
+}
+
+// Count returns number of inflight messages.
+func (this *memInflight) Count() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.table.Len()
+}
+
+func (this *memInflight) dumps() []dumpRecord {
+	this.mu.Lock()
+	defer this.mu.Unlock()
 
-	this.offsets.Set(key, message{
-		Offset: offset,
-		Value:  msg,
+	dumps := make([]dumpRecord, 0, this.table.Len())
+	this.table.Each(func(key string, m *inflight.Message) {
+		dumps = append(dumps, dumpRecord{Key: key, Val: *m})
 	})
-	return nil
+	return dumps
 }
 
 func (this *memInflight) String() string {
-	dumps := make([]dumpRecord, 0, this.offsets.Count())
-	for item := range this.offsets.Iter() {
-		dumps = append(dumps, dumpRecord{
-			Key: item.Key,
-			Val: item.Val.(message),
-		})
-	}
-	data, _ := json.Marshal(dumps)
+	data, _ := json.Marshal(this.dumps())
 	return string(data)
 }
 
@@ -127,9 +147,13 @@ func (this *memInflight) Init() error {
 	if err = json.Unmarshal(data, &dumps); err != nil {
 		return err
 	}
-	for _, record := range dumps {
-		this.offsets.Set(record.Key, record.Val)
+
+	this.mu.Lock()
+	for i := range dumps {
+		m := dumps[i].Val
+		this.table.Put(dumps[i].Key, &m)
 	}
+	this.mu.Unlock()
 	return nil
 }
 
@@ -138,14 +162,7 @@ func (this *memInflight) Stop() error {
 		return nil
 	}
 
-	dumps := make([]dumpRecord, 0, this.offsets.Count())
-	for item := range this.offsets.Iter() {
-		dumps = append(dumps, dumpRecord{
-			Key: item.Key,
-			Val: item.Val.(message),
-		})
-	}
-	data, err := json.Marshal(dumps)
+	data, err := json.Marshal(this.dumps())
 	if err != nil {
 		return err
 	}
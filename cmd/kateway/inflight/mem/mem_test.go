@@ -1,8 +1,9 @@
 package mem
 
 import (
-	//"os"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/funkygao/assert"
 	"github.com/funkygao/gafka/cmd/kateway/inflight"
@@ -10,55 +11,92 @@ import (
 
 var _ inflight.Inflight = &memInflight{}
 
-var msg = []byte("hello world")
+var (
+	msg      = []byte("hello world")
+	deadline = time.Now().Add(time.Minute)
+)
 
 func TestBasic(t *testing.T) {
 	m := New("", true)
-	err := m.TakeOff("cluster", "topic", "group", "partition", 1, msg)
+	err := m.TakeOff("cluster", "topic", "group", "partition", 1, nil, msg, deadline)
+	assert.Equal(t, nil, err)
+	err = m.TakeOff("cluster", "topic", "group", "partition", 1, nil, msg, deadline) // reentrant is ok
 	assert.Equal(t, nil, err)
-	err = m.TakeOff("cluster", "topic", "group", "partition", 1, msg) // reentrant is ok
+	err = m.TakeOff("cluster", "topic", "group", "partition", 2, nil, msg, deadline)
 	assert.Equal(t, nil, err)
-	err = m.TakeOff("cluster", "topic", "group", "partition", 2, msg)
-	assert.Equal(t, inflight.ErrOutOfOrder, err)
+	assert.Equal(t, 2, m.Count())
 	var m1 []byte
 	m1, err = m.LandX("cluster", "topic", "group", "partition", 1)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, "hello world", string(m1))
+	err = m.Land("cluster", "topic", "group", "partition", 1)
+	assert.Equal(t, inflight.ErrNotInflight, err)
 	err = m.Land("cluster", "topic", "group", "partition", 2)
-	assert.Equal(t, inflight.ErrOutOfOrder, err)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, m.Count())
+}
+
+func TestOutOfOrderLand(t *testing.T) {
+	m := New("", false)
+	for i := int64(1); i <= 3; i++ {
+		assert.Equal(t, nil, m.TakeOff("cluster", "topic", "group", "partition", i, nil, msg, deadline))
+	}
+
+	assert.Equal(t, nil, m.Land("cluster", "topic", "group", "partition", 3))
+	assert.Equal(t, nil, m.Land("cluster", "topic", "group", "partition", 1))
+	assert.Equal(t, 1, m.Count())
 }
 
 func TestInitAndStop(t *testing.T) {
 	m := New("snapshot", true)
-	assert.Equal(t, nil, m.Init())
-	t.Logf("count: %d", m.offsets.Count())
-	for it := range m.offsets.Iter() {
-		t.Logf("%s %d %s", it.Key, it.Val.(message).Offset, string(it.Val.(message).Value))
-	}
-	m.TakeOff("cluster", "topic", "group", "partition0", 1, msg)
-	m.TakeOff("cluster", "topic", "group", "partition1", 2, msg)
-	assert.Equal(t, nil, m.Init())
-	m.Stop()
+	defer os.Remove(m.snapshotFile)
 
 	assert.Equal(t, nil, m.Init())
-	assert.Equal(t, 2, m.offsets.Count())
+	m.TakeOff("cluster", "topic", "group", "partition0", 1, nil, msg, deadline)
+	m.TakeOff("cluster", "topic", "group", "partition1", 2, nil, msg, deadline)
+	m.TakeOff("cluster", "topic", "group", "partition1", 3, nil, msg, deadline)
+	assert.Equal(t, nil, m.Stop())
 
-	//os.Remove(m.snapshotFile)
+	m = New("snapshot", true)
+	assert.Equal(t, nil, m.Init())
+	assert.Equal(t, 3, m.Count())
 }
 
-func BenchmarkKey(b *testing.B) {
-	b.ReportAllocs()
-	m := New("", true)
-	for i := 0; i < b.N; i++ {
-		m.key("cluster", "topic", "group", "partition")
-	}
+func TestVisibilityTimeout(t *testing.T) {
+	m := New("", false)
+	past := time.Now().Add(-time.Second)
+	assert.Equal(t, nil, m.TakeOff("cluster", "topic", "group", "0", 1, nil, msg, deadline))
+	assert.Equal(t, nil, m.TakeOff("cluster", "topic", "group", "1", 2, nil, msg, past))
+	assert.Equal(t, nil, m.TakeOff("cluster", "topic", "group", "1", 3, []byte("key"), msg, past.Add(-time.Second)))
+
+	// earliest expired first, and invisible again after redelivery
+	msgs, err := m.Redeliver("cluster", "topic", "group", 10, deadline)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, int64(3), msgs[0].Offset)
+	assert.Equal(t, "1", msgs[0].Partition)
+	assert.Equal(t, 2, msgs[0].Deliveries)
+	assert.Equal(t, "key", string(msgs[0].Key))
+	msgs, _ = m.Redeliver("cluster", "topic", "group", 10, deadline)
+	assert.Equal(t, 0, len(msgs))
+
+	// cut short the visibility timeout
+	assert.Equal(t, nil, m.Touch("cluster", "topic", "group", "0", 1, past))
+	assert.Equal(t, inflight.ErrNotInflight, m.Touch("cluster", "topic", "group", "0", 9, past))
+	msgs, _ = m.Redeliver("cluster", "topic", "group", 1, deadline)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, int64(1), msgs[0].Offset)
+
+	// other groups are isolated
+	msgs, _ = m.Redeliver("cluster", "topic", "group1", 10, deadline)
+	assert.Equal(t, 0, len(msgs))
 }
 
 func BenchmarkTakeOffThenLand(b *testing.B) {
 	b.ReportAllocs()
 	m := New("", true)
 	for i := 0; i < b.N; i++ {
-		m.TakeOff("cluster", "topic", "group", "partition", 1, msg)
+		m.TakeOff("cluster", "topic", "group", "partition", 1, nil, msg, deadline)
 		m.Land("cluster", "topic", "group", "partition", 1)
 	}
 }
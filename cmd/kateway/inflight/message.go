@@ -0,0 +1,17 @@
+package inflight
+
+import (
+	"time"
+)
+
+// Message is an inflight message waiting for ack.
+type Message struct {
+	Partition  string
+	Offset     int64
+	Key        []byte
+	Value      []byte
+	Deadline   time.Time // invisible to the group until deadline
+	Deliveries int       // how many times it has been taken off
+
+	index int // in the deadline heap of its group
+}
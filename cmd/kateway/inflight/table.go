@@ -0,0 +1,156 @@
+package inflight
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+// Table indexes inflight messages by group, partition and offset.
+// It is not thread safe, it is shared by the store implementations which
+// serialize access themselves.
+type Table struct {
+	groups map[string]*group // group key
+}
+
+// group holds the inflight messages of a consumer group, with a min-heap
+// on deadline so that finding expired messages does not scan the group.
+type group struct {
+	partitions map[string]map[int64]*Message // partition: offset
+	deadlines  byDeadline
+}
+
+func NewTable() *Table {
+	return &Table{groups: make(map[string]*group)}
+}
+
+// GroupKey identifies a consumer group of a topic.
+func GroupKey(cluster, topic, group string) string {
+	return fmt.Sprintf("%s:%s:%s", cluster, topic, group)
+}
+
+func (this *Table) Get(key, partition string, offset int64) *Message {
+	g, present := this.groups[key]
+	if !present {
+		return nil
+	}
+	return g.partitions[partition][offset]
+}
+
+// Put adds or replaces an inflight message and returns the replaced one.
+func (this *Table) Put(key string, m *Message) (old *Message) {
+	g, present := this.groups[key]
+	if !present {
+		g = &group{partitions: make(map[string]map[int64]*Message)}
+		this.groups[key] = g
+	}
+	msgs, present := g.partitions[m.Partition]
+	if !present {
+		msgs = make(map[int64]*Message)
+		g.partitions[m.Partition] = msgs
+	}
+
+	old = msgs[m.Offset]
+	msgs[m.Offset] = m
+	if old != nil {
+		m.index = old.index
+		g.deadlines[m.index] = m
+		heap.Fix(&g.deadlines, m.index)
+	} else {
+		heap.Push(&g.deadlines, m)
+	}
+	return
+}
+
+// SetDeadline changes the deadline of an inflight message got from the table.
+func (this *Table) SetDeadline(key string, m *Message, deadline time.Time) {
+	m.Deadline = deadline
+	if g, present := this.groups[key]; present && m.index < len(g.deadlines) && g.deadlines[m.index] == m {
+		heap.Fix(&g.deadlines, m.index)
+	}
+}
+
+// Delete removes an inflight message and returns it, nil if not found.
+func (this *Table) Delete(key, partition string, offset int64) *Message {
+	m := this.Get(key, partition, offset)
+	if m == nil {
+		return nil
+	}
+
+	g := this.groups[key]
+	heap.Remove(&g.deadlines, m.index)
+	delete(g.partitions[partition], offset)
+	if len(g.partitions[partition]) == 0 {
+		delete(g.partitions, partition)
+	}
+	if len(g.partitions) == 0 {
+		delete(this.groups, key)
+	}
+	return m
+}
+
+// Expired returns at most n messages of a group whose deadline is before now,
+// earliest deadline first.
+// The messages stay inflight, callers move them on with SetDeadline.
+func (this *Table) Expired(key string, now time.Time, n int) []*Message {
+	g, present := this.groups[key]
+	if !present {
+		return nil
+	}
+
+	var expired []*Message
+	for len(expired) < n && len(g.deadlines) > 0 && g.deadlines[0].Deadline.Before(now) {
+		expired = append(expired, heap.Pop(&g.deadlines).(*Message))
+	}
+	for _, m := range expired {
+		heap.Push(&g.deadlines, m)
+	}
+	return expired
+}
+
+// Len returns number of inflight messages.
+func (this *Table) Len() (n int) {
+	for _, g := range this.groups {
+		n += len(g.deadlines)
+	}
+	return
+}
+
+// Each calls fn for every inflight message.
+func (this *Table) Each(fn func(key string, m *Message)) {
+	for key, g := range this.groups {
+		for _, m := range g.deadlines {
+			fn(key, m)
+		}
+	}
+}
+
+// byDeadline is a heap.Interface of inflight messages.
+type byDeadline []*Message
+
+func (this byDeadline) Len() int { return len(this) }
+func (this byDeadline) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].index = i
+	this[j].index = j
+}
+func (this byDeadline) Less(i, j int) bool {
+	if this[i].Deadline.Equal(this[j].Deadline) {
+		return this[i].Offset < this[j].Offset
+	}
+	return this[i].Deadline.Before(this[j].Deadline)
+}
+
+func (this *byDeadline) Push(x interface{}) {
+	m := x.(*Message)
+	m.index = len(*this)
+	*this = append(*this, m)
+}
+
+func (this *byDeadline) Pop() interface{} {
+	old := *this
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	*this = old[:len(old)-1]
+	return m
+}
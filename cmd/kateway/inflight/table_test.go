@@ -0,0 +1,44 @@
+package inflight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestTableExpired(t *testing.T) {
+	now := time.Now()
+	table := NewTable()
+	for i := int64(0); i < 10; i++ {
+		// offset 9 expires first, 0 last
+		table.Put("g", &Message{Partition: "0", Offset: i, Deadline: now.Add(time.Duration(i-10) * time.Second)})
+	}
+	table.Put("g1", &Message{Partition: "0", Offset: 1, Deadline: now.Add(-time.Hour)})
+	assert.Equal(t, 11, table.Len())
+
+	expired := table.Expired("g", now, 3)
+	assert.Equal(t, 3, len(expired))
+	assert.Equal(t, int64(0), expired[0].Offset)
+	assert.Equal(t, int64(2), expired[2].Offset)
+
+	// moved on, landed and replaced
+	table.SetDeadline("g", expired[0], now.Add(time.Minute))
+	assert.Equal(t, int64(1), table.Delete("g", "0", 1).Offset)
+	assert.Equal(t, (*Message)(nil), table.Delete("g", "0", 1))
+	table.Put("g", &Message{Partition: "0", Offset: 5, Deadline: now.Add(-time.Hour)})
+	assert.Equal(t, 10, table.Len())
+
+	expired = table.Expired("g", now, 100)
+	assert.Equal(t, 8, len(expired))
+	assert.Equal(t, int64(5), expired[0].Offset)
+	assert.Equal(t, int64(2), expired[1].Offset)
+	assert.Equal(t, int64(9), expired[7].Offset)
+
+	assert.Equal(t, 0, len(table.Expired("g2", now, 10)))
+	for _, m := range expired {
+		table.Delete("g", m.Partition, m.Offset)
+	}
+	table.Delete("g", "0", 0)
+	assert.Equal(t, 1, table.Len())
+}
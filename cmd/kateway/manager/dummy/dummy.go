@@ -70,6 +70,23 @@ func (this *dummyStore) DeadPartitions() map[string]map[int32]struct{} {
 	return nil
 }
 
+func (this *dummyStore) TopicSchemaVersions(appid, topic string) map[string]string {
+	schema, _ := this.TopicSchema(appid, topic, "v1")
+	return map[string]string{"v1": schema}
+}
+
+func (this *dummyStore) SchemaEnforced(appid, topic, ver string) bool {
+	return false
+}
+
+func (this *dummyStore) RegisterTopicSchema(appid, topic, ver, schema string, enforced bool) error {
+	return nil
+}
+
+func (this *dummyStore) Quota(appid, topic string) manager.Quota {
+	return manager.Quota{}
+}
+
 func (this *dummyStore) ForceRefresh() {
 
 }
@@ -34,12 +34,25 @@ type Manager interface {
 	// TopicSchema returns the avro schema definition json string.
 	TopicSchema(appid, topic, ver string) (string, error)
 
+	// TopicSchemaVersions returns the avro schemas of all versions of a topic keyed by version.
+	TopicSchemaVersions(appid, topic string) map[string]string
+
+	// SchemaEnforced checks if pub payloads of a topic version must conform to its schema.
+	SchemaEnforced(appid, topic, ver string) bool
+
+	// RegisterTopicSchema saves the avro schema of a topic version.
+	RegisterTopicSchema(appid, topic, ver, schema string, enforced bool) error
+
 	// ShadowTopic returns raw kafka topic name of a shadowed topic.
 	ShadowTopic(shadow, myAppid, hisAppid, topic, ver, group string) string
 
 	// AuthSub checks if an appid is able to consume message from hisAppid.hisTopic.
 	AuthSub(appid, subkey, hisAppid, hisTopic, group string) error
 
+	// Quota returns the rate limit of an app if topic is empty, else of the app topic.
+	// For sub, appid is the consumer app and topic is the consumed topic.
+	Quota(appid, topic string) Quota
+
 	// LookupCluster locate the cluster name of an appid.
 	LookupCluster(appid string) (cluster string, found bool)
 
@@ -3,8 +3,10 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kateway/manager"
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/mpool"
 	"github.com/funkygao/gafka/zk"
@@ -33,6 +35,8 @@ type mysqlStore struct {
 	shadowQueueMap      map[string]string                       // hisappid.topic.ver.myappid:group
 	deadPartitionMap    map[string]map[int32]struct{}           // topic:partitionId
 	topicSchemaMap      map[string]map[string]map[string]string // appid:topic:ver:schema
+	schemaEnforcedMap   map[string]bool                         // appid.topic.ver
+	quotaMap            atomic.Value                            // map[appid.topic]manager.Quota, topic empty for app
 
 	topicNames *mpool.Intern
 }
@@ -140,11 +144,17 @@ func (this *mysqlStore) refreshFromMysql() error {
 		return err
 	}
 
-	if false {
-		if err = this.fetchSchemas(db); err != nil {
-			return err
-		}
+	// schema registry is optional, keep the stale schemas on failure
+	if err = this.fetchSchemas(db); err != nil {
+		log.Warn("manager[%s] schemas: %v", this.Name(), err)
+	}
 
+	// quotas are optional too, keep the stale quotas on failure
+	if err = this.fetchQuotas(db); err != nil {
+		log.Warn("manager[%s] quotas: %v", this.Name(), err)
+	}
+
+	if false {
 		if err = this.fetchShadowQueueRecords(db); err != nil {
 			return err
 		}
@@ -158,17 +168,22 @@ func (this *mysqlStore) shadowKey(hisAppid, topic, ver, myAppid string) string {
 	return hisAppid + "." + topic + "." + ver + "." + myAppid
 }
 
+func (this *mysqlStore) schemaKey(appid, topic, ver string) string {
+	return appid + "." + topic + "." + ver
+}
+
 func (this *mysqlStore) fetchSchemas(db *sql.DB) error {
-	rows, err := db.Query("SELECT AppId,TopicName,Ver,Schema FROM topic_schema")
+	rows, err := db.Query("SELECT AppId,TopicName,Ver,`Schema`,Enforce FROM topic_schema")
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	schemas := make(map[string]map[string]map[string]string)
+	enforced := make(map[string]bool)
 	var schema topicSchemaRecord
 	for rows.Next() {
-		err = rows.Scan(&schema.AppId, &schema.TopicName, &schema.Ver, &schema.Schema)
+		err = rows.Scan(&schema.AppId, &schema.TopicName, &schema.Ver, &schema.Schema, &schema.Enforce)
 		if err != nil {
 			log.Error("mysql manager store: %v", err)
 			continue
@@ -182,9 +197,49 @@ func (this *mysqlStore) fetchSchemas(db *sql.DB) error {
 		}
 
 		schemas[schema.AppId][schema.TopicName][schema.Ver] = schema.Schema
+		if schema.Enforce == 1 {
+			enforced[this.schemaKey(schema.AppId, schema.TopicName, schema.Ver)] = true
+		}
 	}
 
 	this.topicSchemaMap = schemas
+	this.schemaEnforcedMap = enforced
+	return nil
+}
+
+func (this *mysqlStore) quotaKey(appid, topic string) string {
+	return appid + "." + topic
+}
+
+func (this *mysqlStore) fetchQuotas(db *sql.DB) error {
+	rows, err := db.Query("SELECT AppId,TopicName,PubQps,PubBps,SubQps,SubBps FROM app_quota WHERE Status=1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	quotas := make(map[string]manager.Quota)
+	var quota appQuotaRecord
+	for rows.Next() {
+		err = rows.Scan(&quota.AppId, &quota.TopicName, &quota.PubQps, &quota.PubBps, &quota.SubQps, &quota.SubBps)
+		if err != nil {
+			log.Error("mysql manager store: %v", err)
+			continue
+		}
+
+		q := manager.Quota{
+			PubQps: quota.PubQps,
+			PubBps: quota.PubBps,
+			SubQps: quota.SubQps,
+			SubBps: quota.SubBps,
+		}
+		if !q.Unlimited() {
+			quotas[this.quotaKey(quota.AppId, quota.TopicName)] = q
+		}
+	}
+
+	// read by every pub/sub while being refreshed
+	this.quotaMap.Store(quotas)
 	return nil
 }
 
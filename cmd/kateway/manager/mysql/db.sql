@@ -137,7 +137,20 @@ CREATE TABLE `topic_schema` (
   `TopicName` varchar(255) NOT NULL, 
   `Ver` varchar(50) NOT NULL,
   `Schema` text,
+  `Enforce` tinyint(1) NOT NULL DEFAULT 0 COMMENT '1:pub payload validated against schema',
   `CreateTime` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
   PRIMARY KEY (`AppId`, `TopicName`, `Ver`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `app_quota` (
+  `AppId` bigint(20) NOT NULL,
+  `TopicName` varchar(255) NOT NULL DEFAULT '' COMMENT '空:应用级配额',
+  `PubQps` bigint(20) NOT NULL DEFAULT 0 COMMENT 'msgs/sec, 0:不限',
+  `PubBps` bigint(20) NOT NULL DEFAULT 0 COMMENT 'bytes/sec, 0:不限',
+  `SubQps` bigint(20) NOT NULL DEFAULT 0 COMMENT 'msgs/sec, 0:不限',
+  `SubBps` bigint(20) NOT NULL DEFAULT 0 COMMENT 'bytes/sec, 0:不限',
+  `CreateTime` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Status` tinyint(2) NOT NULL COMMENT '状态：1正常|-2废弃',
+  PRIMARY KEY (`AppId`, `TopicName`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
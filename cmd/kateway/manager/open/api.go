@@ -2,6 +2,7 @@ package open
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"fmt"
 	"hash/adler32"
@@ -71,6 +72,51 @@ func (this *mysqlStore) TopicSchema(appid, topic, ver string) (string, error) {
 	return "", manager.ErrSchemaNotFound
 }
 
+func (this *mysqlStore) TopicSchemaVersions(appid, topic string) map[string]string {
+	r := make(map[string]string)
+	for ver, schema := range this.topicSchemaMap[appid][topic] {
+		r[ver] = schema
+	}
+	return r
+}
+
+func (this *mysqlStore) SchemaEnforced(appid, topic, ver string) bool {
+	return this.schemaEnforcedMap[this.schemaKey(appid, topic, ver)]
+}
+
+func (this *mysqlStore) RegisterTopicSchema(appid, topic, ver, schema string, enforced bool) error {
+	dsn, err := this.zkzone.KatewayMysqlDsn()
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	enforce := 0
+	if enforced {
+		enforce = 1
+	}
+	_, err = db.Exec("INSERT INTO topic_schema(AppId,TopicName,Ver,`Schema`,Enforce,Status) VALUES(?,?,?,?,?,1) "+
+		"ON DUPLICATE KEY UPDATE `Schema`=VALUES(`Schema`),Enforce=VALUES(Enforce)",
+		appid, topic, ver, schema, enforce)
+	if err != nil {
+		return err
+	}
+
+	// load it from mysql instead of mutating maps that are being read
+	this.ForceRefresh()
+	return nil
+}
+
+func (this *mysqlStore) Quota(appid, topic string) manager.Quota {
+	quotas, _ := this.quotaMap.Load().(map[string]manager.Quota)
+	return quotas[this.quotaKey(appid, topic)]
+}
+
 func (this *mysqlStore) ShadowTopic(shadow, myAppid, hisAppid, topic, ver, group string) (r string) {
 	r = this.KafkaTopic(hisAppid, topic, ver)
 	return r + "." + myAppid + "." + group + "." + shadow
@@ -83,6 +129,7 @@ func (this *mysqlStore) Dump() map[string]interface{} {
 	r["app_topic"] = this.appTopicsMap
 	r["groups"] = this.appConsumerGroupMap
 	r["shadows"] = this.shadowQueueMap
+	r["quotas"] = this.quotaMap.Load()
 	return r
 }
 
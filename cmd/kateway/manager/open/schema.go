@@ -29,4 +29,11 @@ type deadPartitionRecord struct {
 type topicSchemaRecord struct {
 	AppId, TopicName, Ver string
 	Schema                string
+	Enforce               int
+}
+
+type appQuotaRecord struct {
+	AppId, TopicName string
+	PubQps, PubBps   int64
+	SubQps, SubBps   int64
 }
@@ -0,0 +1,15 @@
+package manager
+
+// Quota is the rate limit of an app or of an app topic.
+// A zero field means unlimited.
+type Quota struct {
+	PubQps int64 `json:"pub_qps"` // published msgs/sec
+	PubBps int64 `json:"pub_bps"` // published bytes/sec
+	SubQps int64 `json:"sub_qps"` // consumed msgs/sec
+	SubBps int64 `json:"sub_bps"` // consumed bytes/sec
+}
+
+// Unlimited checks if the quota has no limit at all.
+func (q Quota) Unlimited() bool {
+	return q.PubQps <= 0 && q.PubBps <= 0 && q.SubQps <= 0 && q.SubBps <= 0
+}
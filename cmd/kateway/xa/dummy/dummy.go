@@ -0,0 +1,131 @@
+// Package dummy is an in-memory prepared message store for testing and
+// single node deployments.
+package dummy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+)
+
+var _ xa.Store = &dummy{}
+
+type dummy struct {
+	mu   sync.Mutex
+	xid  int64
+	txns map[int64]xa.Txn
+}
+
+func New() xa.Store {
+	return &dummy{txns: make(map[int64]xa.Txn)}
+}
+
+func (this *dummy) Name() string {
+	return "dummy"
+}
+
+func (this *dummy) Start() error {
+	return nil
+}
+
+func (this *dummy) Stop() {}
+
+func (this *dummy) Prepare(txn xa.Txn) (xid string, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.xid++
+	txn.Xid = this.xid
+	txn.State = xa.StatePrepared
+	if txn.Ctime == 0 {
+		txn.Ctime = time.Now().Unix()
+	}
+	txn.Mtime = txn.Ctime
+	this.txns[txn.Xid] = txn
+
+	xid = strconv.FormatInt(txn.Xid, 10)
+	return
+}
+
+func (this *dummy) Commit(appid, xid string) (txn xa.Txn, err error) {
+	return this.decide(appid, xid, func(txn *xa.Txn) {
+		txn.State = xa.StateDelivering
+		txn.Mtime = time.Now().Unix()
+		this.txns[txn.Xid] = *txn
+	})
+}
+
+func (this *dummy) Delivered(txn xa.Txn) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if t, present := this.txns[txn.Xid]; present && t.State == xa.StateDelivering {
+		delete(this.txns, txn.Xid)
+	}
+
+	return nil
+}
+
+func (this *dummy) Abort(txn xa.Txn) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	t, present := this.txns[txn.Xid]
+	if !present || t.State != xa.StateDelivering {
+		return xa.ErrTxnNotFound
+	}
+
+	t.State = xa.StatePrepared
+	t.Mtime = time.Now().Unix()
+	this.txns[txn.Xid] = t
+	return nil
+}
+
+func (this *dummy) Rollback(appid, xid string) (txn xa.Txn, err error) {
+	return this.decide(appid, xid, func(txn *xa.Txn) {
+		delete(this.txns, txn.Xid)
+	})
+}
+
+func (this *dummy) Claim(owner string, age time.Duration) ([]xa.Txn, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	now := time.Now().Unix()
+	deadline := time.Now().Add(-age).Unix()
+	var txns []xa.Txn
+	for id, txn := range this.txns {
+		if txn.Mtime > deadline {
+			continue
+		}
+
+		txn.Owner = owner
+		txn.Mtime = now
+		this.txns[id] = txn
+		txns = append(txns, txn)
+	}
+
+	return txns, nil
+}
+
+// decide applies fn to a prepared message of appid.
+func (this *dummy) decide(appid, xid string, fn func(txn *xa.Txn)) (txn xa.Txn, err error) {
+	var id int64
+	if id, err = xa.ParseXid(xid); err != nil {
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	txn, present := this.txns[id]
+	if !present || txn.Appid != appid || txn.State != xa.StatePrepared {
+		err = xa.ErrTxnNotFound
+		return
+	}
+
+	fn(&txn)
+	return
+}
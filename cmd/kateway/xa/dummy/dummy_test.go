@@ -0,0 +1,64 @@
+package dummy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+)
+
+func TestStateMachine(t *testing.T) {
+	s := New()
+	xid, err := s.Prepare(xa.Txn{Appid: "app1", Topic: "foobar", Payload: []byte("hello")})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1", xid)
+
+	_, err = s.Commit("app2", xid)
+	assert.Equal(t, xa.ErrTxnNotFound, err)
+	_, err = s.Commit("app1", "bad")
+	assert.Equal(t, xa.ErrInvalidXid, err)
+
+	txn, err := s.Commit("app1", xid)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, xa.StateDelivering, txn.State)
+	assert.Equal(t, "hello", string(txn.Payload))
+
+	// decided
+	_, err = s.Commit("app1", xid)
+	assert.Equal(t, xa.ErrTxnNotFound, err)
+	_, err = s.Rollback("app1", xid)
+	assert.Equal(t, xa.ErrTxnNotFound, err)
+
+	// publish failed
+	assert.Equal(t, nil, s.Abort(txn))
+	assert.Equal(t, xa.ErrTxnNotFound, s.Abort(txn))
+	txn, err = s.Commit("app1", xid)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, s.Delivered(txn))
+	_, err = s.Commit("app1", xid)
+	assert.Equal(t, xa.ErrTxnNotFound, err)
+
+	xid, _ = s.Prepare(xa.Txn{Appid: "app1"})
+	_, err = s.Rollback("app1", xid)
+	assert.Equal(t, nil, err)
+	_, err = s.Commit("app1", xid)
+	assert.Equal(t, xa.ErrTxnNotFound, err)
+}
+
+func TestClaim(t *testing.T) {
+	s := New()
+	old := time.Now().Add(-time.Hour).Unix()
+	s.Prepare(xa.Txn{Appid: "app1", Owner: "1", Ctime: old})
+	s.Prepare(xa.Txn{Appid: "app1", Owner: "1"})
+
+	txns, err := s.Claim("2", time.Minute)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(txns))
+	assert.Equal(t, "2", txns[0].Owner)
+	assert.Equal(t, old, txns[0].Ctime)
+
+	// claimed prepares are not checked again until age passes
+	txns, _ = s.Claim("3", time.Minute)
+	assert.Equal(t, 0, len(txns))
+}
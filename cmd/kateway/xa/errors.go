@@ -0,0 +1,8 @@
+package xa
+
+import "errors"
+
+var (
+	ErrTxnNotFound = errors.New("transaction not found")
+	ErrInvalidXid  = errors.New("invalid xid")
+)
@@ -0,0 +1,41 @@
+package xa
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	StatePrepared   = 0
+	StateDelivering = 1
+)
+
+// Txn is a prepared message awaiting commit or rollback.
+type Txn struct {
+	Xid       int64
+	Appid     string
+	Cluster   string
+	Topic     string // kafka topic
+	Key       []byte
+	Payload   []byte
+	Checkback string // producer callback url to query the transaction outcome
+	Owner     string // kateway id that accepted the prepare or claimed it for checkback
+	State     int
+	Ctime     int64
+	Mtime     int64 // last state change or claim
+}
+
+// String never includes the payload, which is business data.
+func (this Txn) String() string {
+	return fmt.Sprintf("{%d %s:%s/%s S:%d}", this.Xid, this.Appid, this.Cluster, this.Topic, this.State)
+}
+
+// ParseXid validates the xid given by producer.
+func ParseXid(xid string) (int64, error) {
+	id, err := strconv.ParseInt(xid, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidXid
+	}
+
+	return id, nil
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS XaPrepare (
+    xid bigint unsigned NOT NULL DEFAULT 0,
+    appid varchar(64) NOT NULL DEFAULT "",
+    cluster varchar(64) NOT NULL DEFAULT "",
+    topic varchar(255) NOT NULL DEFAULT "",
+    msg_key varbinary(256),
+    payload blob NOT NULL,
+    checkback varchar(512) NOT NULL DEFAULT "",
+    owner varchar(64) NOT NULL DEFAULT "",
+    state tinyint NOT NULL DEFAULT 0 COMMENT "0:prepared 1:delivering",
+    ctime int NOT NULL DEFAULT 0,
+    mtime int NOT NULL DEFAULT 0,
+    claim bigint unsigned NOT NULL DEFAULT 0 COMMENT "token of the last checkback claim",
+    PRIMARY KEY (xid),
+    KEY(mtime),
+    KEY(claim)
+) ENGINE = INNODB DEFAULT CHARSET=utf8;
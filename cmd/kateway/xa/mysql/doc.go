@@ -0,0 +1,5 @@
+// Package mysql implements a prepared message store with mysql as backend.
+//
+// All kateway instances share the same table so that a commit or rollback
+// can land on any kateway behind the load balancer.
+package mysql
@@ -0,0 +1,228 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/fae/config"
+	"github.com/funkygao/fae/servant/mysql"
+	"github.com/funkygao/gafka/cmd/kateway/xa"
+	"github.com/funkygao/golib/idgen"
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	pool  = "ShardLookup"
+	table = "XaPrepare"
+
+	txnColumns = "xid, appid, cluster, topic, msg_key, payload, checkback, owner, state, ctime, mtime"
+
+	sqlInsert     = "INSERT INTO XaPrepare(" + txnColumns + ") VALUES(?,?,?,?,?,?,?,?,?,?,?)"
+	sqlSelect     = "SELECT " + txnColumns + " FROM XaPrepare WHERE xid=? AND appid=? AND state=?"
+	sqlTransit    = "UPDATE XaPrepare SET state=?, mtime=? WHERE xid=? AND state=?"
+	sqlCommit     = "UPDATE XaPrepare SET state=?, mtime=? WHERE xid=? AND appid=? AND state=?"
+	sqlDelete     = "DELETE FROM XaPrepare WHERE xid=? AND state=?"
+	sqlRollback   = "DELETE FROM XaPrepare WHERE xid=? AND appid=? AND state=?"
+	sqlClaim      = "UPDATE XaPrepare SET owner=?, mtime=?, claim=? WHERE mtime<=? LIMIT ?"
+	sqlClaimed    = "SELECT " + txnColumns + " FROM XaPrepare WHERE claim=?"
+	maxClaimBatch = 500
+)
+
+type mysqlStore struct {
+	idgen *idgen.IdGenerator
+	mc    *mysql.MysqlCluster
+}
+
+// New creates a mysql based prepared message store.
+//
+// id is the kateway id, which is used as the xid generator worker id.
+func New(id string, cf *config.ConfigMysql) (xa.Store, error) {
+	if cf == nil {
+		return nil, fmt.Errorf("xa store: empty mysql config")
+	}
+
+	wid, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ig, err := idgen.NewIdGenerator(wid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mysqlStore{
+		idgen: ig,
+		mc:    mysql.New(cf),
+	}, nil
+}
+
+func (this *mysqlStore) Name() string {
+	return "mysql"
+}
+
+func (this *mysqlStore) Start() error {
+	this.mc.Warmup()
+	return nil
+}
+
+func (this *mysqlStore) Stop() {
+	this.mc.Close()
+}
+
+func (this *mysqlStore) Prepare(txn xa.Txn) (xid string, err error) {
+	txn.Xid = this.nextId()
+	txn.State = xa.StatePrepared
+	if txn.Ctime == 0 {
+		txn.Ctime = time.Now().Unix()
+	}
+	txn.Mtime = txn.Ctime
+
+	if err = this.insert(txn); err != nil {
+		return
+	}
+
+	xid = strconv.FormatInt(txn.Xid, 10)
+	return
+}
+
+func (this *mysqlStore) Commit(appid, xid string) (txn xa.Txn, err error) {
+	var id int64
+	if id, err = xa.ParseXid(xid); err != nil {
+		return
+	}
+
+	// the UPDATE decides who wins if commit and rollback race, and only the
+	// owner app can commit its prepared message
+	var affectedRows int64
+	affectedRows, _, err = this.mc.Exec(pool, table, 0, sqlCommit, xa.StateDelivering, time.Now().Unix(),
+		id, appid, xa.StatePrepared)
+	if err != nil {
+		return
+	}
+	if affectedRows == 0 {
+		err = xa.ErrTxnNotFound
+		return
+	}
+
+	txn, err = this.get(id, appid, xa.StateDelivering)
+	return
+}
+
+func (this *mysqlStore) Delivered(txn xa.Txn) error {
+	_, _, err := this.mc.Exec(pool, table, 0, sqlDelete, txn.Xid, xa.StateDelivering)
+	return err
+}
+
+func (this *mysqlStore) Abort(txn xa.Txn) error {
+	return this.transit(txn.Xid, xa.StateDelivering, xa.StatePrepared)
+}
+
+func (this *mysqlStore) Rollback(appid, xid string) (txn xa.Txn, err error) {
+	var id int64
+	if id, err = xa.ParseXid(xid); err != nil {
+		return
+	}
+
+	if txn, err = this.get(id, appid, xa.StatePrepared); err != nil {
+		return
+	}
+
+	var affectedRows int64
+	affectedRows, _, err = this.mc.Exec(pool, table, 0, sqlRollback, id, appid, xa.StatePrepared)
+	if err == nil && affectedRows == 0 {
+		err = xa.ErrTxnNotFound
+	}
+
+	return
+}
+
+func (this *mysqlStore) Claim(owner string, age time.Duration) ([]xa.Txn, error) {
+	now := time.Now()
+	token := this.nextId()
+	if _, _, err := this.mc.Exec(pool, table, 0, sqlClaim, owner, now.Unix(), token,
+		now.Add(-age).Unix(), maxClaimBatch); err != nil {
+		return nil, err
+	}
+
+	rows, err := this.mc.Query(pool, table, 0, sqlClaimed, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txns []xa.Txn
+	for rows.Next() {
+		txn, err := scanTxn(rows)
+		if err != nil {
+			log.Error("xa[%s] %v", owner, err)
+			continue
+		}
+
+		txns = append(txns, txn)
+	}
+
+	return txns, rows.Err()
+}
+
+func (this *mysqlStore) get(id int64, appid string, state int) (txn xa.Txn, err error) {
+	rows, err := this.mc.Query(pool, table, 0, sqlSelect, id, appid, state)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = xa.ErrTxnNotFound
+		}
+		return
+	}
+
+	return scanTxn(rows)
+}
+
+func (this *mysqlStore) transit(id int64, from, to int) error {
+	affectedRows, _, err := this.mc.Exec(pool, table, 0, sqlTransit, to, time.Now().Unix(), id, from)
+	if err == nil && affectedRows == 0 {
+		err = xa.ErrTxnNotFound
+	}
+
+	return err
+}
+
+func (this *mysqlStore) insert(txn xa.Txn) (err error) {
+	_, _, err = this.mc.Exec(pool, table, 0, sqlInsert, txn.Xid, txn.Appid, txn.Cluster, txn.Topic,
+		txn.Key, txn.Payload, txn.Checkback, txn.Owner, txn.State, txn.Ctime, txn.Mtime)
+	return
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTxn(row scanner) (txn xa.Txn, err error) {
+	err = row.Scan(&txn.Xid, &txn.Appid, &txn.Cluster, &txn.Topic, &txn.Key, &txn.Payload,
+		&txn.Checkback, &txn.Owner, &txn.State, &txn.Ctime, &txn.Mtime)
+	return
+}
+
+func (this *mysqlStore) nextId() int64 {
+	for {
+		id, err := this.idgen.Next()
+		if err != nil {
+			if err == idgen.ErrorClockBackwards {
+				log.Warn("%s, sleep 50ms", err)
+
+				time.Sleep(time.Millisecond * 50)
+				continue
+			} else {
+				// should never happen
+				panic(err)
+			}
+		}
+
+		return id
+	}
+}
@@ -0,0 +1,53 @@
+// Package xa implements the prepared(transactional) message underlying storage.
+//
+// A prepared message is durably saved but invisible to consumers until the
+// producer commits it, after which it is released to the kafka topic.
+//
+// State machine of a prepared message:
+//
+//	Prepare -> prepared -- Commit --> delivering -- Delivered --> (deleted)
+//	             |    ^                    |
+//	             |    +------ Abort -------+
+//	             +-- Rollback --> (deleted)
+//
+// A message is deleted only after it is published, so a kateway crash while
+// delivering leaves it in delivering state, which will be redelivered by checkback.
+package xa
+
+import (
+	"time"
+)
+
+// Store is the backend storage layer for prepared messages.
+type Store interface {
+
+	// Name returns the underlying storage name.
+	Name() string
+
+	Start() error
+	Stop()
+
+	// Prepare durably saves a message that will not be delivered until committed.
+	Prepare(txn Txn) (xid string, err error)
+
+	// Commit marks a prepared message as delivering and returns it.
+	// If the transaction has already been decided, ErrTxnNotFound is returned.
+	Commit(appid, xid string) (txn Txn, err error)
+
+	// Delivered removes a delivering message after it is published.
+	Delivered(txn Txn) error
+
+	// Abort puts a delivering message whose publish failed back to prepared.
+	Abort(txn Txn) error
+
+	// Rollback removes a prepared message and returns it.
+	// If the transaction has already been decided, ErrTxnNotFound is returned.
+	Rollback(appid, xid string) (txn Txn, err error)
+
+	// Claim takes over the prepared and delivering messages that have not been
+	// touched for age, no matter which kateway accepted them, so that messages
+	// of a dead kateway are still checked back.
+	Claim(owner string, age time.Duration) ([]Txn, error)
+}
+
+var Default Store
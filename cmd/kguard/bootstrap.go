@@ -4,6 +4,9 @@ import (
 	// SOS
 	_ "github.com/funkygao/gafka/cmd/kguard/sos"
 
+	// remediation actions of alert playbooks
+	_ "github.com/funkygao/gafka/cmd/kguard/playbooks"
+
 	// internal watchers
 	_ "github.com/funkygao/gafka/cmd/kguard/watchers/actord"
 	_ "github.com/funkygao/gafka/cmd/kguard/watchers/anomaly"
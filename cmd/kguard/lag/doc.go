@@ -0,0 +1,15 @@
+// Package lag evaluates consumer group status from a sliding window of
+// committed offsets and lags, so that a draining backlog is not mistaken
+// for a stalled consumer.
+//
+// Rules are evaluated per partition when the window is full:
+//
+//  1. any zero lag in the window: OK
+//  2. committed offset decreases: REWIND
+//  3. committed offset never moves and lag is not zero:
+//     STOP if the consumer has not committed for longer than the window span, else STALL
+//  4. offset moves but lag never decreases: WARN
+//  5. otherwise: OK
+//
+// A group/topic takes the worst status of its partitions.
+package lag
@@ -0,0 +1,202 @@
+package lag
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultWindow = 10
+
+// Sample is a consumer partition snapshot.
+type Sample struct {
+	Offset   int64     `json:"offset"`    // committed offset
+	Lag      int64     `json:"lag"`       // newest offset - committed offset
+	CommitAt time.Time `json:"commit_at"` // when the offset is committed
+	At       time.Time `json:"at"`        // when the sample is taken
+}
+
+// Partition is a consumer group partition with its recent samples.
+type Partition struct {
+	Cluster   string   `json:"cluster"`
+	Group     string   `json:"group"`
+	Topic     string   `json:"topic"`
+	Partition string   `json:"partition"`
+	Status    Status   `json:"status"`
+	Samples   []Sample `json:"samples,omitempty"`
+}
+
+// GroupStatus is the worst status of all partitions of a group on a topic.
+type GroupStatus struct {
+	Cluster    string       `json:"cluster"`
+	Group      string       `json:"group"`
+	Topic      string       `json:"topic"`
+	Status     Status       `json:"status"`
+	TotalLag   int64        `json:"total_lag"`
+	Partitions []*Partition `json:"partitions"`
+}
+
+type partitionKey struct {
+	cluster, group, topic, partition string
+}
+
+// Evaluator keeps a sliding window of samples for each consumer partition.
+type Evaluator struct {
+	window int
+
+	mu         sync.RWMutex
+	partitions map[partitionKey]*Partition
+	round      map[partitionKey]struct{} // partitions recorded in the current round
+}
+
+var Default = New(defaultWindow)
+
+// New creates an evaluator that evaluates on the latest window samples.
+func New(window int) *Evaluator {
+	if window < 2 {
+		window = 2
+	}
+
+	return &Evaluator{
+		window:     window,
+		partitions: make(map[partitionKey]*Partition),
+		round:      make(map[partitionKey]struct{}),
+	}
+}
+
+// Record adds a sample of a consumer partition.
+func (this *Evaluator) Record(cluster, group, topic, partition string, s Sample) {
+	key := partitionKey{cluster, group, topic, partition}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	p, present := this.partitions[key]
+	if !present {
+		p = &Partition{Cluster: cluster, Group: group, Topic: topic, Partition: partition}
+		this.partitions[key] = p
+	}
+
+	p.Samples = append(p.Samples, s)
+	if len(p.Samples) > this.window {
+		p.Samples = p.Samples[len(p.Samples)-this.window:]
+	}
+	this.round[key] = struct{}{}
+}
+
+// EndRound evaluates all partitions, and forgets those not recorded since the last
+// round, e,g. the group went offline.
+func (this *Evaluator) EndRound(now time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for key, p := range this.partitions {
+		if _, present := this.round[key]; !present {
+			delete(this.partitions, key)
+			continue
+		}
+
+		if len(p.Samples) < this.window {
+			p.Status = StatusNotFound
+		} else {
+			p.Status = evaluate(p.Samples, now)
+		}
+	}
+	this.round = make(map[partitionKey]struct{})
+}
+
+// Groups returns status of the group/topics that match the filter, empty filter
+// matches all.
+func (this *Evaluator) Groups(cluster, group string) []GroupStatus {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	groups := make(map[partitionKey]*GroupStatus)
+	for key, p := range this.partitions {
+		if (cluster != "" && key.cluster != cluster) || (group != "" && key.group != group) {
+			continue
+		}
+
+		gkey := partitionKey{cluster: key.cluster, group: key.group, topic: key.topic}
+		g, present := groups[gkey]
+		if !present {
+			g = &GroupStatus{Cluster: key.cluster, Group: key.group, Topic: key.topic}
+			groups[gkey] = g
+		}
+
+		pc := *p
+		pc.Samples = append([]Sample(nil), p.Samples...)
+		g.Partitions = append(g.Partitions, &pc)
+		if p.Status > g.Status {
+			g.Status = p.Status
+		}
+		if len(p.Samples) > 0 {
+			g.TotalLag += p.Samples[len(p.Samples)-1].Lag
+		}
+	}
+
+	r := make([]GroupStatus, 0, len(groups))
+	for _, g := range groups {
+		sort.Sort(byPartition(g.Partitions))
+		r = append(r, *g)
+	}
+	sort.Sort(byGroup(r))
+	return r
+}
+
+// evaluate classifies a full window of samples.
+func evaluate(samples []Sample, now time.Time) Status {
+	first, last := samples[0], samples[len(samples)-1]
+
+	for _, s := range samples {
+		if s.Lag == 0 {
+			return StatusOk
+		}
+	}
+
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Offset < samples[i-1].Offset {
+			return StatusRewind
+		}
+	}
+
+	if first.Offset == last.Offset {
+		if now.Sub(last.CommitAt) > last.At.Sub(first.At) {
+			return StatusStop
+		}
+		return StatusStall
+	}
+
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Lag < samples[i-1].Lag {
+			// the backlog is draining
+			return StatusOk
+		}
+	}
+	return StatusWarn
+}
+
+type byPartition []*Partition
+
+func (b byPartition) Len() int      { return len(b) }
+func (b byPartition) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPartition) Less(i, j int) bool {
+	if len(b[i].Partition) != len(b[j].Partition) {
+		return len(b[i].Partition) < len(b[j].Partition)
+	}
+	return b[i].Partition < b[j].Partition
+}
+
+type byGroup []GroupStatus
+
+func (b byGroup) Len() int      { return len(b) }
+func (b byGroup) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byGroup) Less(i, j int) bool {
+	if b[i].Cluster != b[j].Cluster {
+		return b[i].Cluster < b[j].Cluster
+	}
+	if b[i].Group != b[j].Group {
+		return b[i].Group < b[j].Group
+	}
+	return b[i].Topic < b[j].Topic
+}
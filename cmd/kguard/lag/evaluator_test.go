@@ -0,0 +1,78 @@
+package lag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func window(t0 time.Time, offsets, lags []int64, commitAt time.Time) []Sample {
+	r := make([]Sample, len(offsets))
+	for i := range offsets {
+		r[i] = Sample{Offset: offsets[i], Lag: lags[i], CommitAt: commitAt, At: t0.Add(time.Duration(i) * time.Minute)}
+	}
+	return r
+}
+
+func TestEvaluate(t *testing.T) {
+	t0 := time.Now()
+	now := t0.Add(4 * time.Minute)
+	fixtures := []struct {
+		offsets, lags []int64
+		commitAt      time.Time
+		status        Status
+	}{
+		{[]int64{10, 20, 30, 40, 50}, []int64{5, 5, 0, 5, 5}, now, StatusOk},
+		{[]int64{10, 20, 30, 40, 50}, []int64{50, 40, 30, 20, 10}, now, StatusOk},
+		{[]int64{10, 20, 30, 40, 50}, []int64{50, 40, 60, 70, 80}, now, StatusOk},
+		{[]int64{10, 20, 30, 40, 50}, []int64{10, 10, 20, 30, 40}, now, StatusWarn},
+		{[]int64{10, 20, 5, 40, 50}, []int64{10, 10, 20, 30, 40}, now, StatusRewind},
+		{[]int64{10, 10, 10, 10, 10}, []int64{10, 10, 20, 30, 40}, t0, StatusStall},
+		{[]int64{10, 10, 10, 10, 10}, []int64{10, 10, 20, 30, 40}, t0.Add(-time.Hour), StatusStop},
+	}
+	for i, f := range fixtures {
+		assert.Equal(t, f.status, evaluate(window(t0, f.offsets, f.lags, f.commitAt), now), "fixture %d", i)
+	}
+}
+
+func TestEvaluatorWindow(t *testing.T) {
+	e := New(3)
+	t0 := time.Now()
+	for i := 0; i < 3; i++ {
+		e.Record("c", "g", "t", "0", Sample{Offset: 10, Lag: 5, CommitAt: t0, At: t0.Add(time.Duration(i) * time.Minute)})
+		e.Record("c", "g", "t", "1", Sample{Offset: int64(10 + i), Lag: 0, CommitAt: t0, At: t0.Add(time.Duration(i) * time.Minute)})
+		if i < 2 {
+			e.EndRound(t0)
+			assert.Equal(t, StatusNotFound, e.Groups("", "")[0].Status)
+		}
+	}
+	e.EndRound(t0.Add(time.Hour))
+
+	groups := e.Groups("c", "")
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, StatusStop, groups[0].Status)
+	assert.Equal(t, int64(5), groups[0].TotalLag)
+	assert.Equal(t, 2, len(groups[0].Partitions))
+	assert.Equal(t, "0", groups[0].Partitions[0].Partition)
+	assert.Equal(t, StatusOk, groups[0].Partitions[1].Status)
+	assert.Equal(t, 0, len(e.Groups("", "nonexist")))
+
+	// partition 0 not recorded in this round
+	e.Record("c", "g", "t", "1", Sample{Offset: 13, Lag: 0, CommitAt: t0, At: t0.Add(3 * time.Minute)})
+	e.EndRound(t0.Add(time.Hour))
+	groups = e.Groups("", "")
+	assert.Equal(t, 1, len(groups[0].Partitions))
+	assert.Equal(t, StatusOk, groups[0].Status)
+	assert.Equal(t, 3, len(groups[0].Partitions[0].Samples))
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, s := range []Status{StatusNotFound, StatusOk, StatusWarn, StatusRewind, StatusStall, StatusStop} {
+		status, ok := ParseStatus(s.String())
+		assert.Equal(t, true, ok)
+		assert.Equal(t, s, status)
+	}
+	_, ok := ParseStatus("blah")
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,43 @@
+package lag
+
+import (
+	"encoding/json"
+)
+
+type Status int
+
+const (
+	StatusNotFound Status = iota // window not full yet
+	StatusOk
+	StatusWarn
+	StatusRewind
+	StatusStall
+	StatusStop
+)
+
+var statusNames = map[Status]string{
+	StatusNotFound: "NOTFOUND",
+	StatusOk:       "OK",
+	StatusWarn:     "WARN",
+	StatusRewind:   "REWIND",
+	StatusStall:    "STALL",
+	StatusStop:     "STOP",
+}
+
+func (s Status) String() string {
+	return statusNames[s]
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ParseStatus returns false for unknown name.
+func ParseStatus(name string) (Status, bool) {
+	for s, n := range statusNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return StatusNotFound, false
+}
@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"fmt"
+)
+
+var (
+	registeredActions = make(map[string]Action)
+)
+
+// An Action is a remediation step that a playbook runs on alert.
+// In dry-run mode it must not change anything but report what it would do.
+type Action func(ctx Context, alert Alert, args map[string]string, dryRun bool) (result string, err error)
+
+func RegisterAction(name string, action Action) {
+	if _, present := registeredActions[name]; present {
+		panic(fmt.Sprintf("action[%s] cannot register twice", name))
+	}
+
+	registeredActions[name] = action
+}
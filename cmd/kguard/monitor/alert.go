@@ -1,14 +1,85 @@
 package monitor
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"net/http"
 
 	"github.com/funkygao/httprouter"
+	log "github.com/funkygao/log4go"
 )
 
-// POST /alertHook
-// so that we can auto-fix
+const (
+	AlertProblem = "PROBLEM"
+	AlertOk      = "OK"
+
+	HttpHeaderAlertToken = "X-Kguard-Token"
+)
+
+// Alert is the alert event that zabbix posts to kguard.
+type Alert struct {
+	Trigger   string `json:"trigger"` // the probe key, e,g. consumer.zombie
+	Status    string `json:"status"`  // PROBLEM | OK
+	Severity  string `json:"severity,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	Partition string `json:"partition,omitempty"`
+	Group     string `json:"group,omitempty"`
+}
+
+// Get returns the alert field by its json name, used to fill playbook args.
+func (a Alert) Get(field string) string {
+	switch field {
+	case "cluster":
+		return a.Cluster
+	case "topic":
+		return a.Topic
+	case "partition":
+		return a.Partition
+	case "group":
+		return a.Group
+	}
+	return ""
+}
+
+// POST /alertHook?dryrun=1
+// so that we can auto-fix, the caller must present the -alerttoken and
+// playbooks only touch the -alertclusters.
+// e,g.
+// curl -XPOST -H'X-Kguard-Token: secret' -d'{"trigger":"consumer.zombie","status":"PROBLEM","cluster":"foo"}' http://localhost/alertHook
 func (this *Monitor) alertHookHandler(w http.ResponseWriter, r *http.Request,
 	params httprouter.Params) {
+	token := r.Header.Get(HttpHeaderAlertToken)
+	if this.alertToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(this.alertToken)) != 1 {
+		log.Warn("alert hook from %s: invalid token", r.RemoteAddr)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if !this.leader.Get() {
+		// only the leader remediates, the standby might run with stale view
+		http.Error(w, "not leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	var alert Alert
+	if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+		log.Error("alert hook from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body.Close()
+
+	if alert.Trigger == "" || (alert.Status != AlertProblem && alert.Status != AlertOk) {
+		http.Error(w, "invalid trigger or status", http.StatusBadRequest)
+		return
+	}
+
+	log.Info("alert from %s %+v", r.RemoteAddr, alert)
 
+	results := this.playbooks.handle(this, alert, r.URL.Query().Get("dryrun") == "1")
+	b, _ := json.Marshal(results)
+	w.Header().Set("Content-Type", "application/json; charset=utf8")
+	w.Write(b)
 }
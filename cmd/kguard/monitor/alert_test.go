@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestAlertHookAuth(t *testing.T) {
+	m := &Monitor{alertToken: "s3cret"}
+	hook := func(token string) int {
+		r, _ := http.NewRequest("POST", "/alertHook", strings.NewReader(`{"trigger":"x","status":"PROBLEM","cluster":"c1"}`))
+		if token != "" {
+			r.Header.Set(HttpHeaderAlertToken, token)
+		}
+		w := httptest.NewRecorder()
+		m.alertHookHandler(w, r, nil)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, hook(""))
+	assert.Equal(t, http.StatusUnauthorized, hook("guess"))
+	assert.Equal(t, http.StatusServiceUnavailable, hook("s3cret")) // authenticated, but not leader
+
+	m.alertToken = ""
+	assert.Equal(t, http.StatusUnauthorized, hook(""))
+}
@@ -3,8 +3,10 @@ package monitor
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/funkygao/gafka/cmd/kguard/lag"
 	"github.com/funkygao/httprouter"
 	log "github.com/funkygao/log4go"
 )
@@ -96,3 +98,40 @@ func (this *Monitor) cgLagsHandler(w http.ResponseWriter, r *http.Request, param
 	b, _ := json.Marshal(res)
 	w.Write(b)
 }
+
+// GET /lags/status?cluster=xx&group=xx&status=xx
+// e,g.
+// curl http://localhost/lags/status?status=STALL
+func (this *Monitor) cgLagStatusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if !this.rl.Pour(r.RemoteAddr, 1) {
+		w.Header().Set("Connection", "close")
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	q := r.URL.Query()
+	var (
+		status   lag.Status
+		anyState = q.Get("status") == ""
+	)
+	if !anyState {
+		var ok bool
+		if status, ok = lag.ParseStatus(strings.ToUpper(q.Get("status"))); !ok {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+	}
+
+	res := make([]lag.GroupStatus, 0)
+	for _, g := range lag.Default.Groups(q.Get("cluster"), q.Get("group")) {
+		if !anyState && g.Status != status {
+			continue
+		}
+
+		res = append(res, g)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf8")
+	b, _ := json.Marshal(res)
+	w.Write(b)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/funkygao/gafka/ctx"
 	"github.com/funkygao/gafka/telemetry"
 	"github.com/funkygao/gafka/telemetry/influxdb"
+	"github.com/funkygao/gafka/telemetry/prometheus"
 	"github.com/funkygao/gafka/zk"
 	"github.com/funkygao/go-metrics"
 	"github.com/funkygao/golib/ratelimiter"
@@ -32,8 +33,15 @@ import (
 type Monitor struct {
 	influxdbAddr   string
 	influxdbDbName string
+	reporter       string
+	promAddr       string
 	apiAddr        string
 	externalDir    string
+	playbookFile   string
+	auditFile      string
+	alertToken     string
+	alertClusters  string
+	dryRun         bool
 
 	startedAt time.Time
 	leadAt    time.Time
@@ -52,6 +60,8 @@ type Monitor struct {
 	leader   sync2.AtomicBool
 
 	rl *ratelimiter.LeakyBuckets
+
+	playbooks *playbooks
 }
 
 func (this *Monitor) Init() {
@@ -66,13 +76,23 @@ func (this *Monitor) Init() {
 	flag.StringVar(&logFile, "log", "stdout", "log filename")
 	flag.StringVar(&zone, "z", "", "zone, required")
 	flag.StringVar(&this.apiAddr, "http", ":10025", "api http server addr")
-	flag.StringVar(&this.influxdbAddr, "influxAddr", "", "influxdb addr, required")
-	flag.StringVar(&this.influxdbDbName, "db", "", "influxdb db name, required")
+	flag.StringVar(&this.influxdbAddr, "influxAddr", "", "influxdb addr, required with influxdb reporter")
+	flag.StringVar(&this.influxdbDbName, "db", "", "influxdb db name, required with influxdb reporter")
+	flag.StringVar(&this.reporter, "reporter", "influxdb", "telemetry reporter <influxdb|prometheus>")
+	flag.StringVar(&this.promAddr, "promaddr", ":10026", "prometheus /metrics listen addr")
 	flag.StringVar(&this.externalDir, "confd", "", "external script config dir")
+	flag.StringVar(&this.playbookFile, "playbook", "", "alert remediation playbooks json file")
+	flag.StringVar(&this.auditFile, "audit", "audit/playbook.log", "remediation audit log filename")
+	flag.StringVar(&this.alertToken, "alerttoken", "", "shared secret that alert hook callers send in X-Kguard-Token, required with -playbook")
+	flag.StringVar(&this.alertClusters, "alertclusters", "", "comma separated clusters that playbooks can fix, required with -playbook")
+	flag.BoolVar(&this.dryRun, "dryrun", false, "playbooks only report what they would do")
 	flag.Parse()
 
-	if zone == "" || this.influxdbDbName == "" || this.influxdbAddr == "" {
-		panic("zone or influxdb empty, run help ")
+	if zone == "" {
+		panic("zone empty, run help ")
+	}
+	if this.reporter == "influxdb" && (this.influxdbDbName == "" || this.influxdbAddr == "") {
+		panic("influxdb empty, run help ")
 	}
 
 	ctx.LoadFromHome()
@@ -96,11 +116,42 @@ func (this *Monitor) Init() {
 		log.AddFilter("file", log.TRACE, filer)
 	}
 
-	rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", time.Minute)
-	if err != nil {
-		panic(err)
+	var (
+		books    []*Playbook
+		clusters []string
+	)
+	if this.playbookFile != "" {
+		if this.alertToken == "" || this.alertClusters == "" {
+			panic("playbook requires alerttoken and alertclusters, run help ")
+		}
+		clusters = strings.Split(this.alertClusters, ",")
+
+		var err error
+		if books, err = loadPlaybooks(this.playbookFile); err != nil {
+			panic(err)
+		}
+	}
+	this.playbooks = newPlaybooks(books, this.dryRun, clusters, newPlaybookAuditor(this.auditFile))
+	log.Info("%d playbooks loaded, dryrun=%v clusters=%+v", len(books), this.dryRun, clusters)
+
+	switch this.reporter {
+	case "influxdb":
+		rc, err := influxdb.NewConfig(this.influxdbAddr, this.influxdbDbName, "", "", time.Minute)
+		if err != nil {
+			panic(err)
+		}
+		telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
+
+	case "prometheus":
+		rc, err := prometheus.NewConfig(this.promAddr)
+		if err != nil {
+			panic(err)
+		}
+		telemetry.Default = prometheus.New(metrics.DefaultRegistry, rc)
+
+	default:
+		panic("invalid reporter: " + this.reporter)
 	}
-	telemetry.Default = influxdb.New(metrics.DefaultRegistry, rc)
 }
 
 func (this *Monitor) Stop() {
@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	defaultPlaybookMaxRuns = 1
+	defaultPlaybookWindow  = time.Hour
+)
+
+// Playbook is the remediation that ops used to do by hand on an alert.
+//
+// e,g.
+// [{"name":"zombie","trigger":"consumer.zombie","action":"reset_zombie_groups","max_runs":3,"window":"1h"}]
+type Playbook struct {
+	Name    string            `json:"name"`
+	Trigger string            `json:"trigger"`        // alert trigger, or prefix ending with *
+	Action  string            `json:"action"`         // registered action name
+	Args    map[string]string `json:"args,omitempty"` // $cluster etc is replaced with the alert field
+	DryRun  bool              `json:"dryrun,omitempty"`
+	MaxRuns int               `json:"max_runs,omitempty"` // within window
+	Window  string            `json:"window,omitempty"`
+
+	window time.Duration
+}
+
+func (this *Playbook) match(alert Alert) bool {
+	if strings.HasSuffix(this.Trigger, "*") {
+		return strings.HasPrefix(alert.Trigger, strings.TrimSuffix(this.Trigger, "*"))
+	}
+	return this.Trigger == alert.Trigger
+}
+
+// args merges the alert fields with playbook args, the latter wins.
+func (this *Playbook) args(alert Alert) map[string]string {
+	r := make(map[string]string)
+	for _, field := range []string{"cluster", "topic", "partition", "group"} {
+		if v := alert.Get(field); v != "" {
+			r[field] = v
+		}
+	}
+	for k, v := range this.Args {
+		if strings.HasPrefix(v, "$") {
+			v = alert.Get(v[1:])
+		}
+		r[k] = v
+	}
+	return r
+}
+
+func loadPlaybooks(fn string) ([]*Playbook, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var books []*Playbook
+	if err = json.Unmarshal(b, &books); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(books))
+	for _, pb := range books {
+		if pb.Name == "" || pb.Trigger == "" {
+			return nil, fmt.Errorf("playbook %+v: empty name or trigger", *pb)
+		}
+		if _, present := names[pb.Name]; present {
+			return nil, fmt.Errorf("playbook[%s] duplicated", pb.Name)
+		}
+		names[pb.Name] = struct{}{}
+
+		if _, present := registeredActions[pb.Action]; !present {
+			return nil, fmt.Errorf("playbook[%s] unknown action: %s", pb.Name, pb.Action)
+		}
+
+		if pb.MaxRuns <= 0 {
+			pb.MaxRuns = defaultPlaybookMaxRuns
+		}
+		pb.window = defaultPlaybookWindow
+		if pb.Window != "" {
+			if pb.window, err = time.ParseDuration(pb.Window); err != nil {
+				return nil, fmt.Errorf("playbook[%s] window: %v", pb.Name, err)
+			}
+		}
+	}
+
+	return books, nil
+}
+
+type playbookResult struct {
+	Playbook string `json:"playbook"`
+	Action   string `json:"action"`
+	DryRun   bool   `json:"dryrun"`
+	Skipped  string `json:"skipped,omitempty"`
+	Result   string `json:"result,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// playbooks runs the matched playbooks of alerts, with per playbook rate limit.
+type playbooks struct {
+	dryRun   bool
+	clusters map[string]struct{} // the only clusters that playbooks can touch
+	auditor  log.Logger
+
+	mu    sync.Mutex
+	books []*Playbook
+	runs  map[string][]time.Time // playbook name: recent run times
+}
+
+func newPlaybooks(books []*Playbook, dryRun bool, clusters []string, auditor log.Logger) *playbooks {
+	this := &playbooks{
+		books:    books,
+		dryRun:   dryRun,
+		clusters: make(map[string]struct{}, len(clusters)),
+		auditor:  auditor,
+		runs:     make(map[string][]time.Time),
+	}
+	for _, c := range clusters {
+		this.clusters[c] = struct{}{}
+	}
+	return this
+}
+
+// newPlaybookAuditor creates the audit logger for remediation actions.
+func newPlaybookAuditor(fn string) log.Logger {
+	auditor := log.NewDefaultLogger(log.TRACE)
+	auditor.DeleteFilter("stdout")
+
+	_ = os.MkdirAll(filepath.Dir(fn), os.ModePerm)
+	rotateEnabled, discardWhenDiskFull := true, false
+	filer := log.NewFileLogWriter(fn, rotateEnabled, discardWhenDiskFull, 0644)
+	if filer == nil {
+		panic("failed to open playbook audit log")
+	}
+	filer.SetFormat("[%d %T] [%L] (%S) %M")
+	filer.SetRotateDaily(true)
+	auditor.AddFilter("file", log.TRACE, filer)
+	return auditor
+}
+
+// allow checks the rate limit of a playbook, and records the run if allowed.
+// Dry runs are not limited because they change nothing.
+func (this *playbooks) allow(pb *Playbook, now time.Time, dryRun bool) bool {
+	if dryRun {
+		return true
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	recent := this.runs[pb.Name][:0]
+	for _, t := range this.runs[pb.Name] {
+		if now.Sub(t) < pb.window {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= pb.MaxRuns {
+		this.runs[pb.Name] = recent
+		return false
+	}
+
+	this.runs[pb.Name] = append(recent, now)
+	return true
+}
+
+func (this *playbooks) handle(ctx Context, alert Alert, dryRun bool) []playbookResult {
+	this.auditor.Info("alert %+v", alert)
+
+	results := make([]playbookResult, 0)
+	if alert.Status != AlertProblem {
+		// recovered, nothing to fix
+		return results
+	}
+
+	for _, pb := range this.books {
+		if !pb.match(alert) {
+			continue
+		}
+
+		r := playbookResult{
+			Playbook: pb.Name,
+			Action:   pb.Action,
+			DryRun:   dryRun || this.dryRun || pb.DryRun,
+		}
+		args := pb.args(alert)
+
+		if _, present := this.clusters[args["cluster"]]; !present {
+			r.Skipped = fmt.Sprintf("cluster %q not allowed", args["cluster"])
+			this.auditor.Warn("playbook[%s] %s %+v %s", pb.Name, pb.Action, args, r.Skipped)
+			results = append(results, r)
+			continue
+		}
+
+		if !this.allow(pb, time.Now(), r.DryRun) {
+			r.Skipped = fmt.Sprintf("rate limited: %d runs within %s", pb.MaxRuns, pb.window)
+			this.auditor.Warn("playbook[%s] %s %+v %s", pb.Name, pb.Action, args, r.Skipped)
+			results = append(results, r)
+			continue
+		}
+
+		result, err := runAction(registeredActions[pb.Action], ctx, alert, args, r.DryRun)
+		r.Result = result
+		if err != nil {
+			r.Error = err.Error()
+			this.auditor.Error("playbook[%s] %s %+v dryrun=%v: %s, %v", pb.Name, pb.Action, args, r.DryRun, result, err)
+		} else {
+			this.auditor.Info("playbook[%s] %s %+v dryrun=%v: %s", pb.Name, pb.Action, args, r.DryRun, result)
+		}
+
+		results = append(results, r)
+	}
+
+	return results
+}
+
+func runAction(action Action, ctx Context, alert Alert, args map[string]string, dryRun bool) (result string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+
+	return action(ctx, alert, args, dryRun)
+}
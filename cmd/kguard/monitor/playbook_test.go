@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	log "github.com/funkygao/log4go"
+)
+
+type fakeAction struct {
+	calls  int
+	dryRun bool
+	args   map[string]string
+}
+
+func (this *fakeAction) run(ctx Context, alert Alert, args map[string]string, dryRun bool) (string, error) {
+	this.calls++
+	this.dryRun = dryRun
+	this.args = args
+	if args["fail"] != "" {
+		return "", errors.New(args["fail"])
+	}
+	return "fixed", nil
+}
+
+func newTestPlaybooks(t *testing.T, config string, dryRun bool) *playbooks {
+	f, err := ioutil.TempFile("", "playbook")
+	assert.Equal(t, nil, err)
+	defer os.Remove(f.Name())
+	f.WriteString(config)
+	f.Close()
+
+	books, err := loadPlaybooks(f.Name())
+	assert.Equal(t, nil, err)
+
+	auditor := log.NewDefaultLogger(log.TRACE)
+	auditor.DeleteFilter("stdout")
+	return newPlaybooks(books, dryRun, []string{"c1"}, auditor)
+}
+
+func TestPlaybookMatchAndArgs(t *testing.T) {
+	pb := &Playbook{Trigger: "consumer.*", Args: map[string]string{"topic": "$group", "x": "y"}}
+	assert.Equal(t, true, pb.match(Alert{Trigger: "consumer.zombie"}))
+	assert.Equal(t, false, pb.match(Alert{Trigger: "partitions.dead"}))
+
+	pb.Trigger = "consumer.zombie"
+	assert.Equal(t, true, pb.match(Alert{Trigger: "consumer.zombie"}))
+	assert.Equal(t, false, pb.match(Alert{Trigger: "consumer.zombie2"}))
+
+	args := pb.args(Alert{Cluster: "c1", Topic: "t1", Group: "g1"})
+	assert.Equal(t, map[string]string{"cluster": "c1", "topic": "g1", "group": "g1", "x": "y"}, args)
+}
+
+func TestLoadPlaybooksInvalid(t *testing.T) {
+	RegisterAction("test_noop", func(Context, Alert, map[string]string, bool) (string, error) { return "", nil })
+
+	for _, config := range []string{
+		`[{"name":"a","trigger":"x","action":"no_such_action"}]`,
+		`[{"name":"a","trigger":"x","action":"test_noop"},{"name":"a","trigger":"y","action":"test_noop"}]`,
+		`[{"name":"a","trigger":"x","action":"test_noop","window":"1 hour"}]`,
+		`[{"trigger":"x","action":"test_noop"}]`,
+		`{}`,
+	} {
+		f, _ := ioutil.TempFile("", "playbook")
+		f.WriteString(config)
+		f.Close()
+		_, err := loadPlaybooks(f.Name())
+		os.Remove(f.Name())
+		assert.NotEqual(t, nil, err, config)
+	}
+}
+
+func TestPlaybooksHandle(t *testing.T) {
+	fake := &fakeAction{}
+	RegisterAction("test_fake", fake.run)
+	pbs := newTestPlaybooks(t, `[
+	{"name":"fix","trigger":"consumer.zombie","action":"test_fake","max_runs":2,"window":"1h"},
+	{"name":"preview","trigger":"consumer.*","action":"test_fake","dryrun":true}
+	]`, false)
+
+	// recovery alert runs nothing
+	results := pbs.handle(nil, Alert{Trigger: "consumer.zombie", Status: AlertOk}, false)
+	assert.Equal(t, 0, len(results))
+	assert.Equal(t, 0, fake.calls)
+
+	alert := Alert{Trigger: "consumer.zombie", Status: AlertProblem, Cluster: "c1"}
+	results = pbs.handle(nil, alert, false)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, playbookResult{Playbook: "fix", Action: "test_fake", Result: "fixed"}, results[0])
+	assert.Equal(t, playbookResult{Playbook: "preview", Action: "test_fake", DryRun: true, Result: "fixed"}, results[1])
+	assert.Equal(t, "c1", fake.args["cluster"])
+
+	// dry runs are not rate limited
+	for i := 0; i < 5; i++ {
+		pbs.handle(nil, alert, true)
+	}
+
+	// the 2nd real run is allowed, the 3rd is limited
+	results = pbs.handle(nil, alert, false)
+	assert.Equal(t, "", results[0].Skipped)
+	results = pbs.handle(nil, alert, false)
+	assert.NotEqual(t, "", results[0].Skipped)
+	assert.Equal(t, "", results[1].Skipped)
+
+	// clusters not allowed are never touched
+	calls := fake.calls
+	results = pbs.handle(nil, Alert{Trigger: "consumer.zombie", Status: AlertProblem, Cluster: "c2"}, false)
+	assert.Equal(t, 2, len(results))
+	assert.NotEqual(t, "", results[1].Skipped)
+	assert.Equal(t, calls, fake.calls)
+}
+
+func TestPlaybooksGlobalDryRun(t *testing.T) {
+	fake := &fakeAction{}
+	RegisterAction("test_global_dryrun", fake.run)
+	pbs := newTestPlaybooks(t, `[{"name":"fix","trigger":"x","action":"test_global_dryrun","args":{"fail":"boom"}}]`, true)
+
+	results := pbs.handle(nil, Alert{Trigger: "x", Status: AlertProblem, Cluster: "c1"}, false)
+	assert.Equal(t, true, fake.dryRun)
+	assert.Equal(t, "boom", results[0].Error)
+}
+
+func TestPlaybooksAllowWindow(t *testing.T) {
+	pbs := newPlaybooks(nil, false, nil, nil)
+	pb := &Playbook{Name: "p", MaxRuns: 1, window: time.Minute}
+	now := time.Now()
+	assert.Equal(t, true, pbs.allow(pb, now, false))
+	assert.Equal(t, false, pbs.allow(pb, now.Add(time.Second*59), false))
+	assert.Equal(t, true, pbs.allow(pb, now.Add(time.Minute), false))
+}
+
+func TestRunActionRecoversPanic(t *testing.T) {
+	_, err := runAction(func(Context, Alert, map[string]string, bool) (string, error) {
+		panic("oops")
+	}, nil, Alert{}, nil, false)
+	assert.Equal(t, "panic: oops", err.Error())
+}
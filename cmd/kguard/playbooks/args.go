@@ -0,0 +1,29 @@
+package playbooks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func requireArgs(args map[string]string, names ...string) error {
+	for _, name := range names {
+		if args[name] == "" {
+			return fmt.Errorf("%s required", name)
+		}
+	}
+	return nil
+}
+
+// parsePartitions parses partition ids separated by comma, e,g. 0,2
+func parsePartitions(s string) ([]int32, error) {
+	r := make([]int32, 0)
+	for _, p := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid partition: %s", p)
+		}
+		r = append(r, int32(id))
+	}
+	return r, nil
+}
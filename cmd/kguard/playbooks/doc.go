@@ -0,0 +1,3 @@
+// Package playbooks registers the built-in remediation actions that kguard
+// playbooks run on alert.
+package playbooks
@@ -0,0 +1,46 @@
+package playbooks
+
+import (
+	"fmt"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+)
+
+func init() {
+	monitor.RegisterAction("preferred_leader_election", preferredLeaderElection)
+}
+
+// preferredLeaderElection moves partition leadership of a topic back to the preferred
+// replicas, all partitions if partition is not specified.
+func preferredLeaderElection(ctx monitor.Context, alert monitor.Alert, args map[string]string, dryRun bool) (string, error) {
+	if err := requireArgs(args, "cluster", "topic"); err != nil {
+		return "", err
+	}
+
+	zkcluster := ctx.ZkZone().NewCluster(args["cluster"])
+	var (
+		partitions []int32
+		err        error
+	)
+	if args["partition"] != "" {
+		if partitions, err = parsePartitions(args["partition"]); err != nil {
+			return "", err
+		}
+	} else {
+		partitions = zkcluster.Partitions(args["topic"])
+	}
+
+	if len(partitions) == 0 {
+		return "", fmt.Errorf("%s has no partitions", args["topic"])
+	}
+
+	if dryRun {
+		return fmt.Sprintf("would elect preferred leader of %s%+v", args["topic"], partitions), nil
+	}
+
+	if err = zkcluster.PreferredReplicaElection(args["topic"], partitions); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("preferred leader election of %s%+v started", args["topic"], partitions), nil
+}
@@ -0,0 +1,51 @@
+package playbooks
+
+import (
+	"fmt"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	_ "github.com/funkygao/mysql"
+	"github.com/go-ozzo/ozzo-dbx"
+)
+
+func init() {
+	monitor.RegisterAction("disable_partition", disablePartition)
+}
+
+// disablePartition marks a dead partition so that kateway stops pub to it.
+func disablePartition(ctx monitor.Context, alert monitor.Alert, args map[string]string, dryRun bool) (string, error) {
+	if err := requireArgs(args, "cluster", "topic", "partition"); err != nil {
+		return "", err
+	}
+
+	partitions, err := parsePartitions(args["partition"])
+	if err != nil {
+		return "", err
+	}
+
+	if dryRun {
+		return fmt.Sprintf("would disable %s%+v", args["topic"], partitions), nil
+	}
+
+	dsn, err := ctx.ZkZone().KatewayMysqlDsn()
+	if err != nil {
+		return "", err
+	}
+
+	db, err := dbx.Open("mysql", dsn)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	for _, partitionId := range partitions {
+		if _, err = db.Insert("dead_partition", dbx.Params{
+			"KafkaTopic":  args["topic"],
+			"PartitionId": partitionId,
+		}).Execute(); err != nil {
+			return "", fmt.Errorf("%s/%d: %v", args["topic"], partitionId, err)
+		}
+	}
+
+	return fmt.Sprintf("disabled %s%+v", args["topic"], partitions), nil
+}
@@ -0,0 +1,54 @@
+package playbooks
+
+import (
+	"fmt"
+
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+)
+
+func init() {
+	monitor.RegisterAction("reset_zombie_groups", resetZombieGroups)
+}
+
+// resetZombieGroups resets the zombie consumer groups of a cluster, or only the
+// given group if it is a zombie. Groups that still own partitions are left alone.
+func resetZombieGroups(ctx monitor.Context, alert monitor.Alert, args map[string]string, dryRun bool) (string, error) {
+	if err := requireArgs(args, "cluster"); err != nil {
+		return "", err
+	}
+
+	zkcluster := ctx.ZkZone().NewCluster(args["cluster"])
+	zombies := zkcluster.ZombieConsumerGroups(false)
+	if group := args["group"]; group != "" {
+		found := false
+		for _, g := range zombies {
+			if g == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%s is not a zombie", group), nil
+		}
+		zombies = []string{group}
+	}
+
+	if len(zombies) == 0 {
+		return "no zombie groups", nil
+	}
+
+	if dryRun {
+		return fmt.Sprintf("would reset %+v", zombies), nil
+	}
+
+	if args["group"] == "" {
+		// outcome of each group is in kguard log
+		return fmt.Sprintf("autofix %+v", zkcluster.ZombieConsumerGroups(true)), nil
+	}
+
+	if err := zkcluster.ResetConsumerGroupIds(args["group"]); err != nil {
+		return "", fmt.Errorf("%s: %v", args["group"], err)
+	}
+
+	return fmt.Sprintf("reset %+v", zombies), nil
+}
@@ -0,0 +1,112 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/funkygao/log4go"
+)
+
+const (
+	formatInflux = "influx" // InfluxDB line protocol
+	formatJson   = "json"
+
+	defaultInterval = time.Minute
+	minInterval     = time.Second
+)
+
+// scriptConfig declares an external script, one json file for each script in confd.
+//
+// e,g. confd/f5.json
+// {"cmd":"/opt/kguard/f5_latency.sh", "args":["-v"], "interval":"30s", "timeout":"10s", "format":"influx"}
+type scriptConfig struct {
+	Name     string   `json:"-"` // config file name without ext
+	Cmd      string   `json:"cmd"`
+	Args     []string `json:"args,omitempty"`
+	Interval string   `json:"interval,omitempty"` // default 1m
+	Timeout  string   `json:"timeout,omitempty"`  // default interval, hung script is killed after timeout
+	Format   string   `json:"format,omitempty"`   // influx | json, default influx
+
+	interval, timeout time.Duration
+}
+
+func (this *scriptConfig) equals(that *scriptConfig) bool {
+	return reflect.DeepEqual(this, that)
+}
+
+func parseScriptConfig(name string, data []byte) (*scriptConfig, error) {
+	cf := &scriptConfig{}
+	if err := json.Unmarshal(data, cf); err != nil {
+		return nil, err
+	}
+
+	cf.Name = name
+	if cf.Cmd == "" {
+		return nil, fmt.Errorf("%s: empty cmd", name)
+	}
+
+	switch cf.Format {
+	case "":
+		cf.Format = formatInflux
+	case formatInflux, formatJson:
+	default:
+		return nil, fmt.Errorf("%s: invalid format %s", name, cf.Format)
+	}
+
+	var err error
+	cf.interval = defaultInterval
+	if cf.Interval != "" {
+		if cf.interval, err = time.ParseDuration(cf.Interval); err != nil {
+			return nil, fmt.Errorf("%s: interval %v", name, err)
+		}
+	}
+	if cf.interval < minInterval {
+		return nil, fmt.Errorf("%s: interval too short", name)
+	}
+
+	cf.timeout = cf.interval
+	if cf.Timeout != "" {
+		if cf.timeout, err = time.ParseDuration(cf.Timeout); err != nil {
+			return nil, fmt.Errorf("%s: timeout %v", name, err)
+		}
+	}
+	if cf.timeout <= 0 || cf.timeout > cf.interval {
+		// never overlap with the next run
+		cf.timeout = cf.interval
+	}
+
+	return cf, nil
+}
+
+// loadScriptConfigs loads all *.json in dir, bad config is skipped with error logged.
+func loadScriptConfigs(dir string) (map[string]*scriptConfig, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]*scriptConfig, len(files))
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			log.Error("external.exec %s: %v", fn, err)
+			continue
+		}
+
+		name := strings.TrimSuffix(filepath.Base(fn), ".json")
+		cf, err := parseScriptConfig(name, data)
+		if err != nil {
+			log.Error("external.exec %v", err)
+			continue
+		}
+
+		r[name] = cf
+	}
+
+	return r, nil
+}
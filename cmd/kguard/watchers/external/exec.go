@@ -1,27 +1,37 @@
 package external
 
 import (
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/funkygao/gafka/cmd/kguard/monitor"
-	//"github.com/funkygao/go-metrics"
-	//"github.com/fsnotify/fsnotify"
+	"github.com/funkygao/go-metrics"
 	log "github.com/funkygao/log4go"
 )
 
 func init() {
 	monitor.RegisterWatcher("external.exec", func() monitor.Watcher {
-		return &WatchExec{}
+		return &WatchExec{
+			Tick: time.Minute,
+		}
 	})
 }
 
 // WatchExec watches external scripts stdout and feeds into influxdb.
+//
+// Each script is declared by a json file in confd, see scriptConfig. The confd is
+// hot reloaded: added, changed and removed configs take effect without restart.
 type WatchExec struct {
 	Stop <-chan struct{}
+	Tick time.Duration // reload confd even without fs event in case of missed events
 	Wg   *sync.WaitGroup
 
 	confDir string
+	scripts map[string]*script
+
+	failures, timeouts metrics.Counter
 }
 
 func (this *WatchExec) Init(ctx monitor.Context) {
@@ -38,61 +48,88 @@ func (this *WatchExec) Run() {
 		return
 	}
 
-	ticker := time.NewTicker(time.Minute)
+	ticker := time.NewTicker(this.Tick)
 	defer ticker.Stop()
 
-	if err := this.watchConfigDir(); err != nil {
-		log.Error("%v", err)
-		return
+	scriptsN := metrics.NewRegisteredGauge("external.scripts", nil)
+	this.failures = metrics.NewRegisteredCounter("external.failures", nil)
+	this.timeouts = metrics.NewRegisteredCounter("external.timeouts", nil)
+	this.scripts = make(map[string]*script)
+
+	this.reload()
+	scriptsN.Update(int64(len(this.scripts)))
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(this.confDir)
+	}
+	if err != nil {
+		log.Error("external.exec inotify %s: %v, reload every %s", this.confDir, err, this.Tick)
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
 	}
 
+	// editors might write a file several times, reload after the events settle
+	var settle <-chan time.Time
 	for {
 		select {
 		case <-this.Stop:
+			for _, s := range this.scripts {
+				s.stop()
+			}
 			log.Info("external.exec stopped")
 			return
 
-		case <-ticker.C:
+		case err := <-errs:
+			log.Error("external.exec inotify %s: %v", this.confDir, err)
+
+		case event := <-events:
+			if filepath.Ext(event.Name) == ".json" {
+				log.Trace("external.exec %s", event)
+				settle = time.After(time.Second)
+			}
 
+		case <-settle:
+			settle = nil
+			this.reload()
+			scriptsN.Update(int64(len(this.scripts)))
+
+		case <-ticker.C:
+			this.reload()
+			scriptsN.Update(int64(len(this.scripts)))
 		}
 	}
 }
 
-func (this *WatchExec) watchConfigDir() error {
-	/*
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			return err
-		}
+// reload applies the confd: stops removed and changed scripts, then starts new and changed ones.
+func (this *WatchExec) reload() {
+	configs, err := loadScriptConfigs(this.confDir)
+	if err != nil {
+		log.Error("external.exec %s: %v", this.confDir, err)
+		return
+	}
 
-		err = watcher.Add(this.confDir)
-		if err != nil {
-			return err
+	for name, s := range this.scripts {
+		if cf, present := configs[name]; !present || !cf.equals(s.cf) {
+			log.Info("external.exec[%s] unloaded", name)
+			s.stop()
+			delete(this.scripts, name)
 		}
+	}
 
-		go func() {
-			for {
-				select {
-				case <-this.Stop:
-					watcher.Close()
-					return
-
-				case err := <-watcher.Errors:
-					log.Error("inotify %s: %v", this.confDir, err)
-
-				case event := <-watcher.Events:
-					if event.Op&fsnotify.Write == fsnotify.Write {
-						// file modified
-					}
-					if event.Op&fsnotify.Remove == fsnotify.Remove {
-						// file deleted
-					}
-					if event.Op&fsnotify.Create == fsnotify.Create {
-						// file added
-					}
-				}
-			}
-		}()*/
+	for name, cf := range configs {
+		if _, present := this.scripts[name]; present {
+			continue
+		}
 
-	return nil
+		log.Info("external.exec[%s] loaded: %s %v", name, cf.Cmd, cf.Args)
+		s := newScript(cf, this.failures, this.timeouts)
+		this.scripts[name] = s
+		s.start()
+	}
 }
@@ -0,0 +1,170 @@
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/funkygao/gafka/telemetry"
+)
+
+// point is a single metric value parsed from script output.
+type point struct {
+	name  string   // maybe tagged, see telemetry.Tag
+	tags  []string // names of the tags if tagged
+	value float64
+}
+
+func parseOutput(format string, out []byte) ([]point, error) {
+	switch format {
+	case formatJson:
+		return parseJson(out)
+	default:
+		return parseLineProtocol(out)
+	}
+}
+
+// parseLineProtocol parses InfluxDB line protocol:
+// measurement[,tag=v...] field=value[,field=value...] [timestamp]
+//
+// Each field becomes a metric named measurement.field, or measurement if the field
+// is named value. Up to 3 tags are supported because of telemetry.Tag. String
+// fields are ignored, timestamp is ignored because reporter stamps the time.
+func parseLineProtocol(out []byte) ([]point, error) {
+	points := make([]point, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid line: %s", line)
+		}
+
+		keys := strings.Split(parts[0], ",")
+		measurement := keys[0]
+		if measurement == "" {
+			return nil, fmt.Errorf("empty measurement: %s", line)
+		}
+		tag, tags, err := tagOf(keys[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %s", err, line)
+		}
+
+		for _, field := range strings.Split(parts[1], ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid field %s: %s", field, line)
+			}
+
+			v, ok, err := parseFieldValue(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid field %s: %s", field, line)
+			}
+			if !ok {
+				continue
+			}
+
+			name := measurement
+			if kv[0] != "value" {
+				name += "." + kv[0]
+			}
+			points = append(points, point{name: tag + name, tags: tags, value: v})
+		}
+	}
+
+	return points, scanner.Err()
+}
+
+// tagOf encodes tags sorted by key as metric name prefix, and returns the tag keys.
+func tagOf(tags []string) (string, []string, error) {
+	if len(tags) == 0 {
+		return "", nil, nil
+	}
+	if len(tags) > 3 {
+		return "", nil, fmt.Errorf("too many tags")
+	}
+
+	sort.Strings(tags)
+	names, values := make([]string, 3), make([]string, 3)
+	for i, t := range tags {
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return "", nil, fmt.Errorf("invalid tag %s", t)
+		}
+		names[i], values[i] = kv[0], strings.Replace(kv[1], ".", "_", -1)
+	}
+
+	return telemetry.Tag(values[0], values[1], values[2]), names, nil
+}
+
+// parseFieldValue returns ok=false for string field.
+func parseFieldValue(s string) (v float64, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return 0, false, nil
+
+	case s == "t" || s == "T" || s == "true" || s == "True" || s == "TRUE":
+		return 1, true, nil
+
+	case s == "f" || s == "F" || s == "false" || s == "False" || s == "FALSE":
+		return 0, true, nil
+
+	case strings.HasSuffix(s, "i"):
+		var n int64
+		n, err = strconv.ParseInt(strings.TrimSuffix(s, "i"), 10, 64)
+		return float64(n), err == nil, err
+	}
+
+	v, err = strconv.ParseFloat(s, 64)
+	return v, err == nil, err
+}
+
+// parseJson parses json object whose leaf values are numbers, nested keys are joined with dot.
+// e,g. {"f5":{"latency":12.5,"conns":100}} -> f5.latency=12.5 f5.conns=100
+func parseJson(out []byte) ([]point, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return nil, err
+	}
+
+	points := make([]point, 0)
+	flattenJson("", v, &points)
+	sort.Sort(byName(points))
+	return points, nil
+}
+
+func flattenJson(prefix string, v map[string]interface{}, points *[]point) {
+	for k, val := range v {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+
+		switch val := val.(type) {
+		case float64:
+			*points = append(*points, point{name: name, value: val})
+		case bool:
+			if val {
+				*points = append(*points, point{name: name, value: 1})
+			} else {
+				*points = append(*points, point{name: name, value: 0})
+			}
+		case map[string]interface{}:
+			flattenJson(name, val, points)
+		}
+	}
+}
+
+type byName []point
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].name < b[j].name }
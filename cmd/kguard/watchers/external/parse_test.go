@@ -0,0 +1,79 @@
+package external
+
+import (
+	"testing"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/telemetry"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	out := []byte(`
+# comment
+f5.latency value=12.5
+f5,host=lb1.corp,dc=bj conns=100i,up=t,desc="ok",rate=0.5 1465839830100400200
+`)
+	points, err := parseLineProtocol(out)
+	assert.Equal(t, nil, err)
+	tag, tags := telemetry.Tag("bj", "lb1_corp", ""), []string{"dc", "host", ""}
+	assert.Equal(t, []point{
+		{name: "f5.latency", value: 12.5},
+		{name: tag + "f5.conns", tags: tags, value: 100},
+		{name: tag + "f5.up", tags: tags, value: 1},
+		{name: tag + "f5.rate", tags: tags, value: 0.5},
+	}, points)
+}
+
+func TestParseLineProtocolInvalid(t *testing.T) {
+	for _, line := range []string{
+		"f5",
+		"f5 a=1 123 extra",
+		"f5 a",
+		"f5 a=abc",
+		"f5 =1",
+		"f5,host a=1",
+		"f5,a=1,b=2,c=3,d=4 x=1",
+		",host=a x=1",
+	} {
+		_, err := parseLineProtocol([]byte(line))
+		assert.NotEqual(t, nil, err, line)
+	}
+}
+
+func TestParseJson(t *testing.T) {
+	points, err := parseJson([]byte(`{"f5":{"latency":12.5,"conns":100,"up":true,"name":"lb1"},"ok":false}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []point{
+		{name: "f5.conns", value: 100},
+		{name: "f5.latency", value: 12.5},
+		{name: "f5.up", value: 1},
+		{name: "ok", value: 0},
+	}, points)
+
+	_, err = parseJson([]byte(`[1,2]`))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseScriptConfig(t *testing.T) {
+	cf, err := parseScriptConfig("f5", []byte(`{"cmd":"/bin/f5.sh","interval":"30s","timeout":"1m"}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "f5", cf.Name)
+	assert.Equal(t, formatInflux, cf.Format)
+	assert.Equal(t, cf.interval, cf.timeout) // timeout never exceeds interval
+
+	cf2, _ := parseScriptConfig("f5", []byte(`{"cmd":"/bin/f5.sh","interval":"30s","timeout":"1m"}`))
+	assert.Equal(t, true, cf.equals(cf2))
+	cf2, _ = parseScriptConfig("f5", []byte(`{"cmd":"/bin/f5.sh","args":["-v"],"interval":"30s"}`))
+	assert.Equal(t, false, cf.equals(cf2))
+
+	for _, data := range []string{
+		`{"interval":"30s"}`,
+		`{"cmd":"x","format":"xml"}`,
+		`{"cmd":"x","interval":"10ms"}`,
+		`{"cmd":"x","interval":"abc"}`,
+		`not json`,
+	} {
+		_, err = parseScriptConfig("x", []byte(data))
+		assert.NotEqual(t, nil, err, data)
+	}
+}
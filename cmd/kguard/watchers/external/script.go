@@ -0,0 +1,160 @@
+package external
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+var (
+	errTimeout = errors.New("timeout")
+	errStopped = errors.New("stopped")
+)
+
+// script runs an external script periodically and feeds its output into metrics registry.
+type script struct {
+	cf *scriptConfig
+
+	quit chan struct{}
+	done chan struct{}
+
+	failures, timeouts metrics.Counter
+
+	mu    sync.Mutex
+	names map[string]struct{} // registered metric names
+}
+
+func newScript(cf *scriptConfig, failures, timeouts metrics.Counter) *script {
+	return &script{
+		cf:       cf,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		failures: failures,
+		timeouts: timeouts,
+		names:    make(map[string]struct{}),
+	}
+}
+
+func (this *script) start() {
+	go this.run()
+}
+
+// stop stops the script, kills it if running, and unregisters its metrics.
+func (this *script) stop() {
+	close(this.quit)
+	<-this.done
+
+	this.mu.Lock()
+	for name := range this.names {
+		metrics.Unregister(name)
+	}
+	this.names = make(map[string]struct{})
+	this.mu.Unlock()
+}
+
+func (this *script) run() {
+	defer close(this.done)
+
+	log.Trace("external.exec[%s] started every %s", this.cf.Name, this.cf.interval)
+
+	ticker := time.NewTicker(this.cf.interval)
+	defer ticker.Stop()
+
+	for {
+		this.runOnce()
+
+		select {
+		case <-this.quit:
+			log.Trace("external.exec[%s] stopped", this.cf.Name)
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+func (this *script) runOnce() {
+	out, err := this.exec()
+	switch err {
+	case nil:
+	case errStopped:
+		return
+	case errTimeout:
+		log.Error("external.exec[%s] killed after %s", this.cf.Name, this.cf.timeout)
+		this.timeouts.Inc(1)
+		return
+	default:
+		log.Error("external.exec[%s] %v", this.cf.Name, err)
+		this.failures.Inc(1)
+		return
+	}
+
+	points, err := parseOutput(this.cf.Format, out)
+	if err != nil {
+		log.Error("external.exec[%s] output: %v", this.cf.Name, err)
+		this.failures.Inc(1)
+		return
+	}
+
+	this.mu.Lock()
+	for _, p := range points {
+		if p.tags != nil {
+			_, _, _, realname := telemetry.Untag(p.name)
+			telemetry.SetTagNames(realname, p.tags...)
+		}
+		metrics.GetOrRegisterGaugeFloat64(p.name, nil).Update(p.value)
+		this.names[p.name] = struct{}{}
+	}
+	this.mu.Unlock()
+}
+
+// exec runs the script and returns its stdout. The script with all its children
+// is killed if it runs longer than timeout.
+func (this *script) exec() ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(this.cf.Cmd, this.cf.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // so that we can kill the process group
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	timeout := time.NewTimer(this.cf.timeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, errors.New(err.Error() + ": " + msg)
+			}
+			return nil, err
+		}
+		return stdout.Bytes(), nil
+
+	case <-timeout.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-exited
+		return nil, errTimeout
+
+	case <-this.quit:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-exited
+		return nil, errStopped
+	}
+}
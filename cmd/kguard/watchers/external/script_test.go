@@ -0,0 +1,60 @@
+package external
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/go-metrics"
+)
+
+func newTestScript(t *testing.T, cmd string, timeout time.Duration) *script {
+	cf, err := parseScriptConfig("test", []byte(`{"cmd":"/bin/sh","interval":"1h"}`))
+	assert.Equal(t, nil, err)
+	cf.Args = []string{"-c", cmd}
+	cf.timeout = timeout
+	return newScript(cf, metrics.NewCounter(), metrics.NewCounter())
+}
+
+func TestScriptRunOnce(t *testing.T) {
+	s := newTestScript(t, "echo external_test.qps value=10; echo warning >&2", time.Second*5)
+	s.runOnce()
+	assert.Equal(t, int64(0), s.failures.Count())
+	assert.Equal(t, float64(10), metrics.GetOrRegisterGaugeFloat64("external_test.qps", nil).Value())
+
+	// metrics are unregistered on stop
+	s.start()
+	s.stop()
+	assert.Equal(t, nil, metrics.Get("external_test.qps"))
+}
+
+func TestScriptFailure(t *testing.T) {
+	s := newTestScript(t, "echo oops >&2; exit 3", time.Second*5)
+	s.runOnce()
+	assert.Equal(t, int64(1), s.failures.Count())
+
+	s = newTestScript(t, "echo not line protocol", time.Second*5)
+	s.runOnce()
+	assert.Equal(t, int64(1), s.failures.Count())
+}
+
+func TestScriptTimeoutKillsChildren(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "alive")
+
+	// the child outlives its parent shell if not killed with the process group
+	s := newTestScript(t, "(sleep 1; touch "+marker+") & sleep 10", time.Millisecond*100)
+	t0 := time.Now()
+	s.runOnce()
+	assert.Equal(t, true, time.Since(t0) < time.Second*5)
+	assert.Equal(t, int64(1), s.timeouts.Count())
+
+	time.Sleep(time.Millisecond * 1500)
+	_, err = os.Stat(marker)
+	assert.Equal(t, true, os.IsNotExist(err))
+}
@@ -21,6 +21,9 @@ func init() {
 			Tick: time.Minute,
 		}
 	})
+
+	telemetry.SetTagNames("consumer.lag", "cluster", "topic", "group")
+	telemetry.SetTagNames("consumer.qps", "cluster", "topic", "group")
 }
 
 // WatchConsumers monitors num of kafka online consumer groups over the time.
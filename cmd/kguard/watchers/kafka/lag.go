@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/cmd/kguard/lag"
+	"github.com/funkygao/gafka/cmd/kguard/monitor"
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/gafka/zk"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+func init() {
+	monitor.RegisterWatcher("kafka.lag", func() monitor.Watcher {
+		return &WatchLags{
+			Tick: time.Minute,
+		}
+	})
+
+	telemetry.SetTagNames("consumer.lag.status", "cluster", "topic", "group")
+}
+
+// WatchLags feeds consumer offsets and lags into the sliding window evaluator
+// and reports status of the consumer groups.
+type WatchLags struct {
+	Zkzone *zk.ZkZone
+	Stop   <-chan struct{}
+	Tick   time.Duration
+	Wg     *sync.WaitGroup
+
+	statusGauges map[string]metrics.Gauge
+}
+
+func (this *WatchLags) Init(ctx monitor.Context) {
+	this.Zkzone = ctx.ZkZone()
+	this.Stop = ctx.StopChan()
+	this.Wg = ctx.Inflight()
+	this.statusGauges = make(map[string]metrics.Gauge, 10)
+}
+
+func (this *WatchLags) Run() {
+	defer this.Wg.Done()
+
+	ticker := time.NewTicker(this.Tick)
+	defer ticker.Stop()
+
+	warns := metrics.NewRegisteredGauge("consumer.lag.warn", nil)
+	stalls := metrics.NewRegisteredGauge("consumer.lag.stall", nil)
+	stops := metrics.NewRegisteredGauge("consumer.lag.stop", nil)
+	rewinds := metrics.NewRegisteredGauge("consumer.lag.rewind", nil)
+	for {
+		select {
+		case <-this.Stop:
+			log.Info("kafka.lag stopped")
+			return
+
+		case <-ticker.C:
+			this.sample()
+			lag.Default.EndRound(time.Now())
+
+			counts := this.report()
+			warns.Update(counts[lag.StatusWarn])
+			stalls.Update(counts[lag.StatusStall])
+			stops.Update(counts[lag.StatusStop])
+			rewinds.Update(counts[lag.StatusRewind])
+		}
+	}
+}
+
+func (this *WatchLags) sample() {
+	now := time.Now()
+	this.Zkzone.ForSortedClusters(func(zkcluster *zk.ZkCluster) {
+		for group, consumers := range zkcluster.ConsumersByGroup("") {
+			for _, c := range consumers {
+				// offline groups are sampled too: their committed offsets stop
+				// while lag grows, which is exactly what STOP reports
+				lag.Default.Record(zkcluster.Name(), group, c.Topic, c.PartitionId, lag.Sample{
+					Offset:   c.ConsumerOffset,
+					Lag:      c.Lag,
+					CommitAt: c.Mtime.Time(),
+					At:       now,
+				})
+			}
+		}
+	})
+}
+
+// report updates the status gauge of each group/topic and returns num of groups of each status.
+func (this *WatchLags) report() map[lag.Status]int64 {
+	counts := make(map[lag.Status]int64)
+	alive := make(map[string]struct{})
+	for _, g := range lag.Default.Groups("", "") {
+		counts[g.Status]++
+
+		// cluster, topic, group
+		tag := telemetry.Tag(g.Cluster, strings.Replace(g.Topic, ".", "_", -1), strings.Replace(g.Group, ".", "_", -1))
+		if _, present := this.statusGauges[tag]; !present {
+			this.statusGauges[tag] = metrics.NewRegisteredGauge(tag+"consumer.lag.status", nil)
+		}
+		this.statusGauges[tag].Update(int64(g.Status))
+		alive[tag] = struct{}{}
+	}
+
+	for tag := range this.statusGauges {
+		if _, present := alive[tag]; !present {
+			metrics.Unregister(tag + "consumer.lag.status")
+			delete(this.statusGauges, tag)
+		}
+	}
+
+	return counts
+}
@@ -21,6 +21,8 @@ func init() {
 			Tick: time.Minute,
 		}
 	})
+
+	telemetry.SetTagNames("pub.qps", "cluster", "topic", "ver")
 }
 
 type partitionHistory struct {
@@ -22,6 +22,11 @@ func init() {
 			Tick: time.Minute,
 		}
 	})
+
+	for _, name := range []string{"redis.conns", "redis.blocked", "redis.mem.used", "redis.ops", "redis.rejected",
+		"redis.rx.kbps", "redis.tx.kbps", "redis.expired.keys", "redis.keys"} {
+		telemetry.SetTagNames(name, "host", "port", "ip")
+	}
 }
 
 // WatchRedisInfo watches registered redis instances with redis 'info' command.
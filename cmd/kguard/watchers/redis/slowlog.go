@@ -21,6 +21,8 @@ func init() {
 			Tick: time.Minute,
 		}
 	})
+
+	telemetry.SetTagNames("redis.slowlog", "host", "port", "ip")
 }
 
 // WatchSlowlog watches registered redis instances with redis 'slowlog' command.
@@ -28,3 +28,7 @@ func (this *dummy) Deregister(id string, oldData []byte) error {
 func (this *dummy) WatchInstances() ([]string, <-chan zklib.Event, error) {
 	return nil, nil, nil
 }
+
+func (this *dummy) InstanceData(instance string) ([]byte, error) {
+	return nil, nil
+}
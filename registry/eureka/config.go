@@ -0,0 +1,54 @@
+package eureka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Servers are eureka service urls, e,g. http://localhost:8761/eureka
+	Servers []string
+
+	// App is the eureka application name that all kateway instances of a zone register as.
+	App string
+
+	// RenewInterval is the heartbeat interval, eureka evicts an instance after 3 missed heartbeats.
+	RenewInterval time.Duration
+
+	// PollInterval is how often WatchInstances checks for instance changes.
+	PollInterval time.Duration
+
+	Timeout time.Duration
+}
+
+func DefaultConfig(zone string, servers ...string) *Config {
+	s := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if server = strings.TrimSpace(server); server != "" {
+			s = append(s, strings.TrimRight(server, "/"))
+		}
+	}
+
+	return &Config{
+		Servers:       s,
+		App:           strings.ToUpper("kateway-" + zone),
+		RenewInterval: time.Second * 30,
+		PollInterval:  time.Second * 5,
+		Timeout:       time.Second * 5,
+	}
+}
+
+func (this *Config) Validate() error {
+	if len(this.Servers) == 0 {
+		return fmt.Errorf("eureka: empty servers")
+	}
+	if this.App == "" {
+		return fmt.Errorf("eureka: empty app")
+	}
+	if this.RenewInterval <= 0 || this.PollInterval <= 0 {
+		return fmt.Errorf("eureka: invalid interval")
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+package eureka
+
+import (
+	"errors"
+)
+
+var (
+	ErrNoServerAvailable = errors.New("eureka: no server available")
+	ErrInstanceNotFound  = errors.New("eureka: instance not found")
+)
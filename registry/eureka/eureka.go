@@ -1,8 +1,17 @@
-package zk
+package eureka
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/funkygao/gafka/registry"
-	"github.com/funkygao/gafka/zk"
+	log "github.com/funkygao/log4go"
 	zklib "github.com/samuel/go-zookeeper/zk"
 )
 
@@ -11,24 +20,282 @@ import (
 //
 // register, renew, cancel, get is all eureka provides.
 type eureka struct {
+	cfg    *Config
+	client *http.Client
+
+	mu        sync.Mutex
+	leases    map[string]chan struct{} // instance id: heartbeat quit chan
+	instances map[string][]byte        // instance id: data, as of last WatchInstances
+	quit      chan struct{}            // closed when the last lease is cancelled, stops the watches
 }
 
-func New(*zk.ZkZone) registry.Backend {
-	return &eureka{}
+func New(cfg *Config) registry.Backend {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+
+	return &eureka{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		leases:    make(map[string]chan struct{}),
+		instances: make(map[string][]byte),
+		quit:      make(chan struct{}),
+	}
 }
 
 func (this *eureka) Name() string {
 	return "eureka"
 }
 
+// Register registers the instance and keeps renewing its lease until Deregister.
+// If eureka is not available now, the heartbeat will register it later on.
 func (this *eureka) Register(id string, data []byte) {
-	return
+	inst := newInstance(this.cfg.App, id, data, int(this.cfg.RenewInterval/time.Second))
+	if err := this.register(inst); err != nil {
+		log.Error("eureka register %s/%s: %v", this.cfg.App, id, err)
+	} else {
+		log.Trace("eureka registered %s/%s", this.cfg.App, id)
+	}
+
+	this.mu.Lock()
+	if quit, present := this.leases[id]; present {
+		// re-register with new data
+		close(quit)
+	}
+	quit := make(chan struct{})
+	this.leases[id] = quit
+	this.mu.Unlock()
+
+	go this.heartbeat(inst, quit)
 }
 
+// Deregister marks the instance OUT_OF_SERVICE so that watchers stop routing to it,
+// then cancels its lease.
 func (this *eureka) Deregister(id string, oldData []byte) error {
+	this.mu.Lock()
+	if quit, present := this.leases[id]; present {
+		close(quit)
+		delete(this.leases, id)
+	}
+	if len(this.leases) == 0 {
+		// shutdown
+		close(this.quit)
+		this.quit = make(chan struct{})
+	}
+	this.mu.Unlock()
+
+	path := fmt.Sprintf("/apps/%s/%s/status?value=%s", this.cfg.App, id, statusOutOfService)
+	if status, _, err := this.do("PUT", path, nil); err != nil {
+		log.Warn("eureka %s: %v", path, err)
+	} else if status != http.StatusOK {
+		log.Warn("eureka %s: %d", path, status)
+	}
+
+	path = fmt.Sprintf("/apps/%s/%s", this.cfg.App, id)
+	status, _, err := this.do("DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("eureka DELETE %s: %d", path, status)
+	}
+
 	return nil
 }
 
+// WatchInstances returns ids of all UP instances and a chan that fires once
+// when the instances change. The watch stops without firing once all the
+// registered instances are deregistered.
 func (this *eureka) WatchInstances() ([]string, <-chan zklib.Event, error) {
-	return nil, nil, nil
+	instances, err := this.fetch()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	this.mu.Lock()
+	this.instances = instances
+	quit := this.quit
+	this.mu.Unlock()
+
+	ch := make(chan zklib.Event, 1)
+	go this.watch(instances, ch, quit)
+
+	return sortedIds(instances), ch, nil
+}
+
+// InstanceData returns data of an instance returned by the last WatchInstances.
+func (this *eureka) InstanceData(id string) ([]byte, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	data, present := this.instances[id]
+	if !present {
+		return nil, ErrInstanceNotFound
+	}
+	return data, nil
+}
+
+func (this *eureka) watch(last map[string][]byte, ch chan<- zklib.Event, quit <-chan struct{}) {
+	ticker := time.NewTicker(this.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-ticker.C:
+		}
+
+		instances, err := this.fetch()
+		if err != nil {
+			log.Error("eureka watch %s: %v", this.cfg.App, err)
+			continue
+		}
+
+		if !sameInstances(last, instances) {
+			ch <- zklib.Event{
+				Type: zklib.EventNodeChildrenChanged,
+				Path: this.cfg.App,
+			}
+			return
+		}
+	}
+}
+
+func (this *eureka) heartbeat(inst instance, quit chan struct{}) {
+	ticker := time.NewTicker(this.cfg.RenewInterval)
+	defer ticker.Stop()
+
+	path := fmt.Sprintf("/apps/%s/%s", inst.App, inst.InstanceId)
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-ticker.C:
+			status, _, err := this.do("PUT", path, nil)
+			switch {
+			case err != nil:
+				log.Error("eureka renew %s: %v", path, err)
+
+			case status == http.StatusNotFound:
+				// lease expired or eureka restarted
+				log.Warn("eureka renew %s: not found, re-registering", path)
+				if err = this.register(inst); err != nil {
+					log.Error("eureka register %s: %v", path, err)
+				}
+
+			case status != http.StatusOK:
+				log.Error("eureka renew %s: %d", path, status)
+			}
+		}
+	}
+}
+
+func (this *eureka) register(inst instance) error {
+	body, err := json.Marshal(instanceEnvelope{Instance: inst})
+	if err != nil {
+		return err
+	}
+
+	status, _, err := this.do("POST", "/apps/"+inst.App, body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNoContent && status != http.StatusOK {
+		return fmt.Errorf("status %d", status)
+	}
+	return nil
+}
+
+// fetch returns data of all UP instances keyed by instance id.
+func (this *eureka) fetch() (map[string][]byte, error) {
+	status, body, err := this.do("GET", "/apps/"+this.cfg.App, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string][]byte)
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// no instance registered yet
+		return r, nil
+	default:
+		return nil, fmt.Errorf("eureka GET %s: %d", this.cfg.App, status)
+	}
+
+	var app applicationEnvelope
+	if err = json.Unmarshal(body, &app); err != nil {
+		return nil, err
+	}
+	instances, err := app.Application.instances()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inst := range instances {
+		if inst.Status != statusUp {
+			continue
+		}
+
+		r[inst.InstanceId] = []byte(inst.Metadata[metaKey])
+	}
+	return r, nil
+}
+
+// do sends the request to eureka servers in turn until one of them responds.
+func (this *eureka) do(method, path string, body []byte) (int, []byte, error) {
+	var lastErr error = ErrNoServerAvailable
+	for _, server := range this.cfg.Servers {
+		req, err := http.NewRequest(method, server+path, bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := this.client.Do(req)
+		if err != nil {
+			log.Debug("eureka %s %s%s: %v", method, server, path, err)
+			lastErr = err
+			continue
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return resp.StatusCode, b, nil
+	}
+
+	return 0, nil, lastErr
+}
+
+func sameInstances(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for id, data := range a {
+		if d, present := b[id]; !present || !bytes.Equal(d, data) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedIds(instances map[string][]byte) []string {
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
@@ -0,0 +1,244 @@
+package eureka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+// fakeEureka is an in-process eureka server that keeps a single app.
+type fakeEureka struct {
+	mu        sync.Mutex
+	instances map[string]instance
+	renews    map[string]int
+	calls     []string
+}
+
+func newFakeEureka() *fakeEureka {
+	return &fakeEureka{
+		instances: make(map[string]instance),
+		renews:    make(map[string]int),
+	}
+}
+
+func (this *fakeEureka) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.calls = append(this.calls, r.Method+" "+r.URL.Path)
+
+	// /eureka/apps/{app}[/{id}[/status]]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/eureka/apps/"), "/")
+	switch {
+	case r.Method == "POST" && len(parts) == 1:
+		var env instanceEnvelope
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &env); err != nil || env.Instance.App != parts[0] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		this.instances[env.Instance.InstanceId] = env.Instance
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == "GET" && len(parts) == 1:
+		if len(this.instances) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		instances := make([]instance, 0, len(this.instances))
+		for _, inst := range this.instances {
+			instances = append(instances, inst)
+		}
+		var raw []byte
+		if len(instances) == 1 {
+			// eureka renders a single instance as object
+			raw, _ = json.Marshal(instances[0])
+		} else {
+			raw, _ = json.Marshal(instances)
+		}
+		b, _ := json.Marshal(applicationEnvelope{Application: application{Name: parts[0], Instance: raw}})
+		w.Write(b)
+
+	case r.Method == "PUT" && len(parts) == 2:
+		if _, present := this.instances[parts[1]]; !present {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		this.renews[parts[1]]++
+
+	case r.Method == "PUT" && len(parts) == 3 && parts[2] == "status":
+		inst, present := this.instances[parts[1]]
+		if !present {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		inst.Status = r.URL.Query().Get("value")
+		this.instances[parts[1]] = inst
+
+	case r.Method == "DELETE" && len(parts) == 2:
+		if _, present := this.instances[parts[1]]; !present {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(this.instances, parts[1])
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (this *fakeEureka) evict(id string) {
+	this.mu.Lock()
+	delete(this.instances, id)
+	this.mu.Unlock()
+}
+
+func (this *fakeEureka) instance(id string) (instance, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	inst, present := this.instances[id]
+	return inst, present
+}
+
+func (this *fakeEureka) fetched() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	n := 0
+	for _, call := range this.calls {
+		if call == "GET /eureka/apps/test" {
+			n++
+		}
+	}
+	return n
+}
+
+func (this *fakeEureka) renewed(id string) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.renews[id]
+}
+
+func setupFake(t *testing.T) (*fakeEureka, *httptest.Server, *eureka) {
+	fake := newFakeEureka()
+	server := httptest.NewServer(fake)
+
+	// the 1st server is down, which should fail over to the 2nd
+	cf := DefaultConfig("test", "http://127.0.0.1:1/eureka", server.URL+"/eureka/")
+	cf.RenewInterval = time.Millisecond * 20
+	cf.PollInterval = time.Millisecond * 10
+	return fake, server, New(cf).(*eureka)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 2)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	cf := DefaultConfig("prod", "http://a/eureka/", " ", "http://b/eureka")
+	assert.Equal(t, "KATEWAY-PROD", cf.App)
+	assert.Equal(t, []string{"http://a/eureka", "http://b/eureka"}, cf.Servers)
+	assert.Equal(t, nil, cf.Validate())
+	assert.NotEqual(t, nil, DefaultConfig("prod", "").Validate())
+}
+
+func TestRegisterRenewAndDeregister(t *testing.T) {
+	fake, server, reg := setupFake(t)
+	defer server.Close()
+
+	data := []byte(`{"id":"1","host":"h1","ip":"10.1.1.1","pub":"10.1.1.1:9191"}`)
+	reg.Register("1", data)
+
+	inst, present := fake.instance("1")
+	assert.Equal(t, true, present)
+	assert.Equal(t, "KATEWAY-TEST", inst.App)
+	assert.Equal(t, "h1", inst.HostName)
+	assert.Equal(t, 9191, inst.Port.Port)
+	assert.Equal(t, statusUp, inst.Status)
+	assert.Equal(t, string(data), inst.Metadata[metaKey])
+
+	// heartbeat
+	waitFor(t, func() bool { return fake.renewed("1") >= 2 })
+
+	// eureka evicted me, heartbeat will register again
+	fake.evict("1")
+	waitFor(t, func() bool {
+		_, present := fake.instance("1")
+		return present
+	})
+
+	assert.Equal(t, nil, reg.Deregister("1", data))
+	_, present = fake.instance("1")
+	assert.Equal(t, false, present)
+
+	// status changed to OUT_OF_SERVICE before cancel
+	fake.mu.Lock()
+	calls := strings.Join(fake.calls, ",")
+	fake.mu.Unlock()
+	assert.Equal(t, true, strings.Contains(calls, "PUT /eureka/apps/KATEWAY-TEST/1/status,DELETE /eureka/apps/KATEWAY-TEST/1"))
+
+	// heartbeat stopped
+	n := fake.renewed("1")
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, n, fake.renewed("1"))
+	_, present = fake.instance("1")
+	assert.Equal(t, false, present)
+}
+
+func TestWatchInstances(t *testing.T) {
+	fake, server, reg := setupFake(t)
+	defer server.Close()
+
+	instances, ch, err := reg.WatchInstances()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(instances))
+
+	reg.Register("1", []byte(`{"id":"1"}`))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("instance change not watched")
+	}
+
+	reg.Register("2", []byte(`{"id":"2"}`))
+	instances, ch, err = reg.WatchInstances()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"1", "2"}, instances)
+	data, err := reg.InstanceData("2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"id":"2"}`, string(data))
+	_, err = reg.InstanceData("3")
+	assert.Equal(t, ErrInstanceNotFound, err)
+
+	// graceful shutdown: OUT_OF_SERVICE instance is not watched
+	assert.Equal(t, nil, reg.Deregister("1", nil))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("instance change not watched")
+	}
+
+	instances, _, err = reg.WatchInstances()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"2"}, instances)
+
+	// the last deregister stops polling
+	reg.Deregister("2", nil)
+	time.Sleep(time.Millisecond * 20)
+	fetched := fake.fetched()
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, fetched, fake.fetched())
+}
@@ -0,0 +1,111 @@
+package eureka
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+
+	"github.com/funkygao/gafka/zk"
+)
+
+const (
+	statusUp           = "UP"
+	statusOutOfService = "OUT_OF_SERVICE"
+
+	// metaKey is the instance metadata key where kateway instance data is kept.
+	metaKey = "kateway"
+)
+
+// instance is the eureka InstanceInfo on the wire.
+type instance struct {
+	InstanceId     string            `json:"instanceId"`
+	HostName       string            `json:"hostName"`
+	App            string            `json:"app"`
+	IpAddr         string            `json:"ipAddr"`
+	VipAddress     string            `json:"vipAddress"`
+	Status         string            `json:"status"`
+	Port           port              `json:"port"`
+	DataCenterInfo dataCenterInfo    `json:"dataCenterInfo"`
+	LeaseInfo      leaseInfo         `json:"leaseInfo"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+type port struct {
+	Port    int    `json:"$"`
+	Enabled string `json:"@enabled"`
+}
+
+type dataCenterInfo struct {
+	Class string `json:"@class"`
+	Name  string `json:"name"`
+}
+
+type leaseInfo struct {
+	RenewalIntervalInSecs int `json:"renewalIntervalInSecs"`
+	DurationInSecs        int `json:"durationInSecs"`
+}
+
+type instanceEnvelope struct {
+	Instance instance `json:"instance"`
+}
+
+type application struct {
+	Name string `json:"name"`
+
+	// Instance is an array, or an object if there is only 1 instance.
+	Instance json.RawMessage `json:"instance"`
+}
+
+type applicationEnvelope struct {
+	Application application `json:"application"`
+}
+
+func (this application) instances() ([]instance, error) {
+	if len(this.Instance) == 0 {
+		return nil, nil
+	}
+
+	var r []instance
+	if err := json.Unmarshal(this.Instance, &r); err == nil {
+		return r, nil
+	}
+
+	var one instance
+	if err := json.Unmarshal(this.Instance, &one); err != nil {
+		return nil, err
+	}
+	return []instance{one}, nil
+}
+
+// newInstance builds eureka instance from kateway registry data.
+func newInstance(app, id string, data []byte, renewInterval int) instance {
+	var meta zk.KatewayMeta
+	json.Unmarshal(data, &meta)
+
+	i := instance{
+		InstanceId: id,
+		HostName:   meta.Host,
+		App:        app,
+		IpAddr:     meta.Ip,
+		VipAddress: app,
+		Status:     statusUp,
+		DataCenterInfo: dataCenterInfo{
+			Class: "com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo",
+			Name:  "MyOwn",
+		},
+		LeaseInfo: leaseInfo{
+			RenewalIntervalInSecs: renewInterval,
+			DurationInSecs:        renewInterval * 3,
+		},
+		Metadata: map[string]string{metaKey: string(data)},
+	}
+	if i.HostName == "" {
+		i.HostName = i.IpAddr
+	}
+	if _, p, err := net.SplitHostPort(meta.PubAddr); err == nil {
+		i.Port.Port, _ = strconv.Atoi(p)
+		i.Port.Enabled = "true"
+	}
+
+	return i
+}
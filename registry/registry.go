@@ -9,8 +9,14 @@ type Backend interface {
 
 	Deregister(id string, data []byte) error
 
+	// WatchInstances returns all registered instances and a chan that fires
+	// once when they change.
 	WatchInstances() ([]string, <-chan zk.Event, error)
 
+	// InstanceData returns the data registered by an instance that
+	// WatchInstances returns.
+	InstanceData(instance string) ([]byte, error)
+
 	// Name of the registry backend.
 	Name() string
 }
@@ -130,3 +130,8 @@ func (this *zkreg) WatchInstances() ([]string, <-chan zklib.Event, error) {
 
 	return instancePaths, ch, nil
 }
+
+func (this *zkreg) InstanceData(instance string) ([]byte, error) {
+	data, _, err := this.zkzone.Conn().Get(instance)
+	return data, err
+}
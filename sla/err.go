@@ -9,4 +9,9 @@ var (
 	ErrEmptyArg         = errors.New("empty argument")
 	ErrNotNumber        = errors.New("not number")
 	ErrTooBigPartitions = errors.New("too big partitions")
+
+	ErrInvalidPartitions        = errors.New("invalid partitions")
+	ErrInvalidReplicas          = errors.New("invalid replicas")
+	ErrInvalidRetention         = errors.New("invalid retention")
+	ErrInvalidMinInsyncReplicas = errors.New("invalid min.insync.replicas")
 )
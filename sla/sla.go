@@ -54,13 +54,51 @@ func (this *TopicSla) IsDefault() bool {
 }
 
 func (this *TopicSla) Validate() error {
-	if this.Partitions > 20 {
+	if this.Partitions > maxPartitions {
 		return ErrTooBigPartitions
 	}
+	if this.Partitions < 1 {
+		return ErrInvalidPartitions
+	}
+	if this.Replicas < 1 || this.Replicas > maxReplicas {
+		return ErrInvalidReplicas
+	}
+	if this.RetentionHours <= 0 || this.RetentionHours > maxRetentionHours {
+		return ErrInvalidRetention
+	}
+	if this.RetentionBytes < defaultRetentionBytes {
+		return ErrInvalidRetention
+	}
+	if this.MinInsyncReplicas < 1 || this.MinInsyncReplicas > maxReplicas {
+		return ErrInvalidMinInsyncReplicas
+	}
 
 	return nil
 }
 
+// PartitionsAltered checks whether partitions differs from the default, which
+// means partitions should be added when altering a topic.
+func (this *TopicSla) PartitionsAltered() bool {
+	return this.Partitions != defaultPartitions
+}
+
+// TopicConfigs returns the non-default topic level configs keyed by kafka config name,
+// which will be written to zk:/config/topics/{topic}.
+func (this *TopicSla) TopicConfigs() map[string]string {
+	r := make(map[string]string)
+	if this.RetentionBytes != defaultRetentionBytes && this.RetentionBytes > 0 {
+		r["retention.bytes"] = strconv.Itoa(this.RetentionBytes)
+	}
+	if this.RetentionHours != defaultRetentionHours && this.RetentionHours > 0 && this.RetentionHours <= maxRetentionHours {
+		r["retention.ms"] = strconv.Itoa(int(this.RetentionHours * 1000 * 3600))
+	}
+	if this.MinInsyncReplicas != defaultMinInsyncReplicas {
+		r["min.insync.replicas"] = strconv.Itoa(this.MinInsyncReplicas)
+	}
+
+	return r
+}
+
 func (this *TopicSla) ParseRetentionHours(s string) error {
 	if len(s) == 0 {
 		return ErrEmptyArg
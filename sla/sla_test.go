@@ -61,3 +61,47 @@ func TestValidateShadowName(t *testing.T) {
 	assert.Equal(t, false, ValidateShadowName(""))
 	assert.Equal(t, false, ValidateShadowName("foo"))
 }
+
+func TestSlaValidate(t *testing.T) {
+	sla := DefaultSla()
+	assert.Equal(t, nil, sla.Validate())
+
+	sla.Partitions = 21
+	assert.Equal(t, ErrTooBigPartitions, sla.Validate())
+	sla.Partitions = 0
+	assert.Equal(t, ErrInvalidPartitions, sla.Validate())
+	sla.Partitions = 3
+
+	sla.Replicas = 4
+	assert.Equal(t, ErrInvalidReplicas, sla.Validate())
+	sla.Replicas = 3
+
+	sla.RetentionHours = -1
+	assert.Equal(t, ErrInvalidRetention, sla.Validate())
+	sla.RetentionHours = 1
+	sla.RetentionBytes = -2
+	assert.Equal(t, ErrInvalidRetention, sla.Validate())
+	sla.RetentionBytes = 1 << 30
+
+	sla.MinInsyncReplicas = 0
+	assert.Equal(t, ErrInvalidMinInsyncReplicas, sla.Validate())
+	sla.MinInsyncReplicas = 2
+	assert.Equal(t, nil, sla.Validate())
+}
+
+func TestSlaTopicConfigs(t *testing.T) {
+	sla := DefaultSla()
+	assert.Equal(t, 0, len(sla.TopicConfigs()))
+	assert.Equal(t, false, sla.PartitionsAltered())
+
+	sla.Partitions = 5
+	sla.RetentionHours = 2
+	sla.RetentionBytes = 10 << 20
+	sla.MinInsyncReplicas = 2
+	assert.Equal(t, true, sla.PartitionsAltered())
+	assert.Equal(t, map[string]string{
+		"retention.ms":        "7200000",
+		"retention.bytes":     "10485760",
+		"min.insync.replicas": "2",
+	}, sla.TopicConfigs())
+}
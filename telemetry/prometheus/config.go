@@ -0,0 +1,25 @@
+package prometheus
+
+import (
+	"errors"
+	"net"
+)
+
+type config struct {
+	addr string // listen addr of the /metrics endpoint
+	path string
+}
+
+func NewConfig(addr string) (*config, error) {
+	if addr == "" {
+		return nil, errors.New("empty prometheus listen addr")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+
+	return &config{
+		addr: addr,
+		path: "/metrics",
+	}, nil
+}
@@ -0,0 +1,200 @@
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+	typeSummary = "summary"
+)
+
+type sample struct {
+	suffix   string // e,g. _sum, _count
+	labels   string // rendered label pairs of the series without braces
+	quantile string
+	value    float64
+}
+
+type family struct {
+	name, typ string
+	samples   []sample
+}
+
+type samples []sample
+
+func (s samples) Len() int           { return len(s) }
+func (s samples) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s samples) Less(i, j int) bool { return s[i].labels < s[j].labels }
+
+// export renders all the registry metrics in the prometheus text exposition format.
+//
+// Tagged metric names are converted to labels named by telemetry.TagNames so that
+// the same metric of different topics falls into a single family. The host is left
+// to the instance label attached by prometheus on scrape.
+func (this *runner) export(buf *bytes.Buffer) {
+	families := make(map[string]*family)
+	add := func(name, typ string, s sample) {
+		f, present := families[name]
+		if !present {
+			f = &family{name: name, typ: typ}
+			families[name] = f
+		} else if f.typ != typ {
+			// the same name registered as different metric types, keep the first seen
+			return
+		}
+
+		f.samples = append(f.samples, s)
+	}
+
+	this.reg.Each(func(name string, i interface{}) {
+		if strings.HasPrefix(name, "_") {
+			// in-mem only private metrics
+			return
+		}
+
+		appid, topic, ver, realname := telemetry.Untag(name)
+		labels := renderLabels(telemetry.TagNames(realname), appid, topic, ver)
+		metricName := sanitizeName(realname)
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			// go-metrics counter can be decremented, e,g. connection counter,
+			// so it is not necessarily a prometheus counter
+			add(metricName, typeGauge, sample{labels: labels, value: float64(m.Count())})
+
+		case metrics.Gauge:
+			add(metricName, typeGauge, sample{labels: labels, value: float64(m.Value())})
+
+		case metrics.GaugeFloat64:
+			add(metricName, typeGauge, sample{labels: labels, value: m.Value()})
+
+		case metrics.Meter:
+			ms := m.Snapshot()
+			add(metricName+"_total", typeCounter, sample{labels: labels, value: float64(ms.Count())})
+			add(metricName+"_rate1m", typeGauge, sample{labels: labels, value: ms.Rate1()})
+
+		case metrics.Histogram:
+			h := m.Snapshot()
+			ps := h.Percentiles(quantiles)
+			for idx, q := range quantiles {
+				add(metricName, typeSummary, sample{labels: labels, quantile: formatFloat(q), value: ps[idx]})
+			}
+			add(metricName, typeSummary, sample{suffix: "_sum", labels: labels, value: float64(h.Sum())})
+			add(metricName, typeSummary, sample{suffix: "_count", labels: labels, value: float64(h.Count())})
+
+		case metrics.Timer:
+			// go-metrics timer is in nanoseconds, prometheus prefers seconds
+			t := m.Snapshot()
+			ps := t.Percentiles(quantiles)
+			metricName += "_seconds"
+			for idx, q := range quantiles {
+				add(metricName, typeSummary, sample{labels: labels, quantile: formatFloat(q), value: ps[idx] / float64(time.Second)})
+			}
+			add(metricName, typeSummary, sample{suffix: "_sum", labels: labels, value: float64(t.Sum()) / float64(time.Second)})
+			add(metricName, typeSummary, sample{suffix: "_count", labels: labels, value: float64(t.Count())})
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := families[name]
+		sort.Stable(samples(f.samples))
+
+		buf.WriteString("# TYPE ")
+		buf.WriteString(f.name)
+		buf.WriteByte(' ')
+		buf.WriteString(f.typ)
+		buf.WriteByte('\n')
+		for _, s := range f.samples {
+			buf.WriteString(f.name)
+			buf.WriteString(s.suffix)
+			switch {
+			case s.quantile != "" && s.labels != "":
+				buf.WriteString("{" + s.labels + `,quantile="` + s.quantile + `"}`)
+			case s.quantile != "":
+				buf.WriteString(`{quantile="` + s.quantile + `"}`)
+			case s.labels != "":
+				buf.WriteString("{" + s.labels + "}")
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(formatFloat(s.value))
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// renderLabels renders the tag values as label pairs, tags without name are skipped.
+func renderLabels(names []string, values ...string) string {
+	if values[0] == "" {
+		// not tagged
+		return ""
+	}
+
+	pairs := make([]string, 0, len(values))
+	for i, v := range values {
+		if i >= len(names) || names[i] == "" {
+			continue
+		}
+
+		pairs = append(pairs, sanitizeLabelName(names[i])+`="`+escapeLabelValue(v)+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// sanitizeName converts metric name like pub.qps to a valid prometheus metric name: pub_qps.
+func sanitizeName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == ':' ||
+			(c >= '0' && c <= '9' && i > 0) {
+			continue
+		}
+
+		b[i] = '_'
+	}
+
+	return string(b)
+}
+
+// sanitizeLabelName is sanitizeName without colon which is reserved for metric names.
+func sanitizeLabelName(name string) string {
+	return strings.Replace(sanitizeName(name), ":", "_", -1)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,119 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+)
+
+func createRunner(reg metrics.Registry) *runner {
+	cf, _ := NewConfig(":9100")
+	return New(reg, cf).(*runner)
+}
+
+func TestNewConfig(t *testing.T) {
+	_, err := NewConfig("")
+	assert.NotEqual(t, nil, err)
+	_, err = NewConfig("9100")
+	assert.NotEqual(t, nil, err)
+	cf, err := NewConfig(":9100")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/metrics", cf.path)
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "pub_qps", sanitizeName("pub.qps"))
+	assert.Equal(t, "sub_lag_ms", sanitizeName("sub-lag.ms"))
+	assert.Equal(t, "_x", sanitizeName("9x"))
+	assert.Equal(t, "a:b_c", sanitizeName("a:b c"))
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabelValue("a\"b\\c\nd"))
+}
+
+func TestExportTaggedAsLabels(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredCounter(telemetry.Tag("app1", "orders", "v1")+"pub.ok", reg).Inc(5)
+	metrics.NewRegisteredCounter(telemetry.Tag("app2", "users", "v2")+"pub.ok", reg).Inc(2)
+	metrics.NewRegisteredGauge("pub.conns", reg).Update(8)
+	metrics.NewRegisteredGaugeFloat64("_private", reg).Update(1)
+
+	var buf bytes.Buffer
+	createRunner(reg).export(&buf)
+	assert.Equal(t, `# TYPE pub_conns gauge
+pub_conns 8
+# TYPE pub_ok gauge
+pub_ok{appid="app1",topic="orders",ver="v1"} 5
+pub_ok{appid="app2",topic="users",ver="v2"} 2
+`, buf.String())
+}
+
+func TestExportTagNames(t *testing.T) {
+	telemetry.SetTagNames("consumer.lag", "cluster", "topic", "group")
+	telemetry.SetTagNames("f5.conns", "dc", "host", "")
+
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge(telemetry.Tag("c1", "orders", "g1")+"consumer.lag", reg).Update(3)
+	metrics.NewRegisteredGauge(telemetry.Tag("bj", "lb1", "")+"f5.conns", reg).Update(9)
+
+	var buf bytes.Buffer
+	createRunner(reg).export(&buf)
+	assert.Equal(t, `# TYPE consumer_lag gauge
+consumer_lag{cluster="c1",topic="orders",group="g1"} 3
+# TYPE f5_conns gauge
+f5_conns{dc="bj",host="lb1"} 9
+`, buf.String())
+}
+
+func TestExportSummary(t *testing.T) {
+	reg := metrics.NewRegistry()
+	h := metrics.NewRegisteredHistogram("pub.msgsize", reg, metrics.NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		h.Update(i * 10)
+	}
+	tm := metrics.NewRegisteredTimer(telemetry.Tag("app1", "orders", "v1")+"pub.latency", reg)
+	tm.Update(time.Second)
+	tm.Update(time.Second * 3)
+
+	var buf bytes.Buffer
+	createRunner(reg).export(&buf)
+	out := buf.String()
+
+	assert.Equal(t, true, strings.Contains(out, "# TYPE pub_msgsize summary\n"))
+	assert.Equal(t, true, strings.Contains(out, `pub_msgsize{quantile="0.5"} 25`+"\n"))
+	assert.Equal(t, true, strings.Contains(out, "pub_msgsize_sum 100\n"))
+	assert.Equal(t, true, strings.Contains(out, "pub_msgsize_count 4\n"))
+
+	assert.Equal(t, true, strings.Contains(out, "# TYPE pub_latency_seconds summary\n"))
+	assert.Equal(t, true, strings.Contains(out, `pub_latency_seconds{appid="app1",topic="orders",ver="v1",quantile="0.5"} 2`+"\n"))
+	assert.Equal(t, true, strings.Contains(out, `pub_latency_seconds_sum{appid="app1",topic="orders",ver="v1"} 4`+"\n"))
+	assert.Equal(t, true, strings.Contains(out, `pub_latency_seconds_count{appid="app1",topic="orders",ver="v1"} 2`+"\n"))
+}
+
+func TestExportMeter(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredMeter("sub.qps", reg).Mark(3)
+
+	var buf bytes.Buffer
+	createRunner(reg).export(&buf)
+	out := buf.String()
+	assert.Equal(t, true, strings.Contains(out, "# TYPE sub_qps_total counter\nsub_qps_total 3\n"))
+	assert.Equal(t, true, strings.Contains(out, "# TYPE sub_qps_rate1m gauge\n"))
+}
+
+func TestServeHTTP(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.NewRegisteredGauge("pub.conns", reg).Update(1)
+
+	rec := httptest.NewRecorder()
+	createRunner(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE pub_conns gauge\npub_conns 1\n", rec.Body.String())
+}
@@ -0,0 +1,94 @@
+package prometheus
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/funkygao/gafka/telemetry"
+	"github.com/funkygao/go-metrics"
+	log "github.com/funkygao/log4go"
+)
+
+var _ telemetry.Reporter = &runner{}
+
+type runner struct {
+	cf  *config
+	reg metrics.Registry
+
+	bufPool sync.Pool
+
+	quiting, quit chan struct{}
+}
+
+// New creates a Prometheus reporter which serves the metrics from the given registry
+// on /metrics in the text exposition format, waiting for prometheus to scrape.
+func New(r metrics.Registry, cf *config) telemetry.Reporter {
+	this := &runner{
+		reg:     r,
+		cf:      cf,
+		quiting: make(chan struct{}),
+		quit:    make(chan struct{}),
+	}
+	this.bufPool.New = func() interface{} {
+		return new(bytes.Buffer)
+	}
+
+	return this
+}
+
+func (*runner) Name() string {
+	return "prometheus"
+}
+
+func (this *runner) Stop() {
+	close(this.quiting)
+	<-this.quit
+}
+
+func (this *runner) Start() error {
+	defer close(this.quit)
+
+	ln, err := net.Listen("tcp", this.cf.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(this.cf.path, this)
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  time.Second * 10,
+		WriteTimeout: time.Second * 30,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(ln)
+	}()
+	log.Info("prometheus exposing metrics on %s%s", ln.Addr(), this.cf.path)
+
+	select {
+	case <-this.quiting:
+		ln.Close()
+		<-errCh
+		return nil
+
+	case err = <-errCh:
+		return err
+	}
+}
+
+// ServeHTTP renders a snapshot of the registry on each scrape.
+func (this *runner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := this.bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer this.bufPool.Put(buf)
+
+	this.export(buf)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
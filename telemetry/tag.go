@@ -31,6 +31,35 @@ func Untag(name string) (appid, topic, ver, realname string) {
 	return
 }
 
+var (
+	tagNamesMu sync.RWMutex
+	tagNames   = make(map[string][]string) // realname: names of the tags
+)
+
+// DefaultTagNames are what the tags stand for in kateway metrics.
+var DefaultTagNames = []string{"appid", "topic", "ver"}
+
+// SetTagNames declares what the tags of metric realname stand for, e,g. cluster/topic/group,
+// so that reporters with named labels are able to name them. An empty name means the tag
+// is not used.
+func SetTagNames(realname string, names ...string) {
+	tagNamesMu.Lock()
+	tagNames[realname] = names
+	tagNamesMu.Unlock()
+}
+
+// TagNames returns the tag names of metric realname, DefaultTagNames if not declared.
+func TagNames(realname string) []string {
+	tagNamesMu.RLock()
+	names, present := tagNames[realname]
+	tagNamesMu.RUnlock()
+	if !present {
+		return DefaultTagNames
+	}
+
+	return names
+}
+
 // TODO replace '.' with '_'
 func Tag(appid, topic, ver string) string {
 	tagBuf := make([]byte, 4+len(appid)+len(topic)+len(ver))
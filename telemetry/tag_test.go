@@ -24,6 +24,12 @@ func TestTag(t *testing.T) {
 	assert.Equal(t, "{appid.topic.ver}", Tag("appid", "topic", "ver"))
 }
 
+func TestTagNames(t *testing.T) {
+	assert.Equal(t, DefaultTagNames, TagNames("pub.ok"))
+	SetTagNames("consumer.lag", "cluster", "topic", "group")
+	assert.Equal(t, []string{"cluster", "topic", "group"}, TagNames("consumer.lag"))
+}
+
 // 186 ns/op
 func BenchmarkUntag(b *testing.B) {
 	for i := 0; i < b.N; i++ {
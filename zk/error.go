@@ -5,7 +5,25 @@ import (
 )
 
 var (
-	ErrDupConnect      = errors.New("connect while being connected")
-	ErrClaimedByOthers = errors.New("claimed by others")
-	ErrNotClaimed      = errors.New("release non-claimed")
+	ErrDupConnect         = errors.New("connect while being connected")
+	ErrClaimedByOthers    = errors.New("claimed by others")
+	ErrInvalidPriority    = errors.New("invalid priority")
+	ErrNotClaimed         = errors.New("release non-claimed")
+	ErrElectionInProgress = errors.New("preferred replica election in progress")
+	ErrReassignInProgress = errors.New("partition reassignment in progress")
+	ErrGroupHasOwners     = errors.New("consumer group still owns partitions")
+
+	ErrNoMessageTime = errors.New("newest message carries no publish time")
+
+	ErrInvalidTopicName       = errors.New("invalid topic name")
+	ErrTopicExists            = errors.New("topic already exists")
+	ErrTopicNotFound          = errors.New("topic not found")
+	ErrTopicDeleting          = errors.New("topic is marked for deletion")
+	ErrNotEnoughBrokers       = errors.New("replicas larger than available brokers")
+	ErrNothingToAlter         = errors.New("no alter topic configs")
+	ErrPartitionsNotIncreased = errors.New("partitions can only be increased")
+	ErrMinIsrExceedsReplicas  = errors.New("min.insync.replicas larger than replicas")
+	ErrBrokerNotFound         = errors.New("broker not found")
+	ErrDupBroker              = errors.New("duplicated broker")
+	ErrRackSpreadBroken       = errors.New("replicas not spread across racks")
 )
@@ -151,6 +151,7 @@ type BrokerZnode struct {
 	Host      string   `json:"host"`
 	Port      int      `json:"port"`
 	Version   int      `json:"version"`
+	Rack      string   `json:"rack"` // since kafka 0.10
 }
 
 func newBrokerZnode(id string) *BrokerZnode {
@@ -180,6 +181,16 @@ func (b *BrokerZnode) from(zkData []byte) error {
 	return json.Unmarshal(zkData, b)
 }
 
+// Domain returns the failure domain of the broker: its rack if configured,
+// otherwise its host because brokers on the same host fail together.
+func (b *BrokerZnode) Domain() string {
+	if b.Rack != "" {
+		return b.Rack
+	}
+
+	return b.Host
+}
+
 func (b *BrokerZnode) Addr() string {
 	return fmt.Sprintf("%s:%d", b.Host, b.Port)
 }
@@ -50,3 +50,12 @@ func TestWebhook(t *testing.T) {
 	hook.Endpoints = []string{"http://localhost:9876"}
 	t.Logf("%s", string(hook.Bytes()))
 }
+
+func TestBrokerZnodeDomain(t *testing.T) {
+	var b BrokerZnode
+	b.from([]byte(`{"jmx_port":-1,"timestamp":"1447157138058","host":"192.168.3.5","version":3,"port":9092,"rack":"r1"}`))
+	assert.Equal(t, "r1", b.Domain())
+
+	b.Rack = ""
+	assert.Equal(t, "192.168.3.5", b.Domain())
+}
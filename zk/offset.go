@@ -0,0 +1,167 @@
+package zk
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// maxUntimedProbes bounds the messages probed backward for the publish time of a
+// message without one.
+const maxUntimedProbes = 100
+
+// ParseOffsetTime parses the time for OffsetsAtTime: RFC3339, local time
+// like 2006-01-02T15:04 or 2006-01-02T15:04:05, or unix seconds.
+func ParseOffsetTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+// MessageTimeFunc extracts the publish time embedded in a message.
+// ok is false if the message carries no publish time.
+type MessageTimeFunc func(msg []byte) (t time.Time, ok bool)
+
+// OffsetsAtTime returns offset of the first message published at or after t for
+// each partition of the topic. A partition whose messages are all older than t
+// gets its newest offset.
+//
+// Publish times are searched with binary search, a message without publish time
+// takes that of the message right before it: see searchOffsetAtTime.
+func (this *ZkCluster) OffsetsAtTime(topic string, t time.Time, msgTime MessageTimeFunc) (map[int32]int64, error) {
+	kfk, err := sarama.NewClient(this.BrokerList(), sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer kfk.Close()
+
+	partitions, err := kfk.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(kfk)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	r := make(map[int32]int64, len(partitions))
+	for _, partitionID := range partitions {
+		oldestOffset, err := kfk.GetOffset(topic, partitionID, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+
+		latestOffset, err := kfk.GetOffset(topic, partitionID, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		pid := partitionID
+		offset, err := searchOffsetAtTime(oldestOffset, latestOffset, t, func(offset int64) (int64, time.Time, bool, error) {
+			return fetchMessageTime(consumer, topic, pid, offset, msgTime)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		r[partitionID] = offset
+	}
+
+	return r, nil
+}
+
+// searchOffsetAtTime finds within [oldest, newest) the first offset whose publish time
+// is not before t. at fetches the message at or right after an offset.
+//
+// Messages without publish time, e,g. published before kateway -pubts is turned on or not
+// through kateway, take the publish time of the closest message with one before them, and
+// are regarded older than t if there is none within maxUntimedProbes.
+// It fails with ErrNoMessageTime if the newest message has no publish time.
+func searchOffsetAtTime(oldest, newest int64, t time.Time,
+	at func(offset int64) (actualOffset int64, ts time.Time, ok bool, err error)) (int64, error) {
+	if oldest >= newest {
+		return newest, nil
+	}
+
+	if _, _, ok, err := at(newest - 1); err != nil {
+		return -1, err
+	} else if !ok {
+		return -1, ErrNoMessageTime
+	}
+
+	lo, hi := oldest, newest
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		actualOffset, ts, ok, err := at(mid)
+		if err != nil {
+			return -1, err
+		}
+
+		if !ok {
+			// messages before lo are all older than t
+			if ts, ok, err = prevMessageTime(lo, mid, at); err != nil {
+				return -1, err
+			}
+		}
+
+		if ok && !ts.Before(t) {
+			hi = mid
+		} else {
+			// offsets between mid and actualOffset don't exist
+			lo = actualOffset + 1
+		}
+	}
+
+	return lo, nil
+}
+
+// prevMessageTime returns the publish time of the closest message with one within
+// [lo, offset), ok is false if not found within maxUntimedProbes.
+func prevMessageTime(lo, offset int64,
+	at func(offset int64) (actualOffset int64, ts time.Time, ok bool, err error)) (time.Time, bool, error) {
+	for o, probes := offset-1, 0; o >= lo && probes < maxUntimedProbes; o, probes = o-1, probes+1 {
+		actualOffset, ts, ok, err := at(o)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if ok && actualOffset < offset {
+			return ts, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+func fetchMessageTime(consumer sarama.Consumer, topic string, partitionID int32, offset int64,
+	msgTime MessageTimeFunc) (int64, time.Time, bool, error) {
+	p, err := consumer.ConsumePartition(topic, partitionID, offset)
+	if err != nil {
+		return -1, time.Time{}, false, err
+	}
+	defer p.Close()
+
+	select {
+	case msg := <-p.Messages():
+		ts, ok := msgTime(msg.Value)
+		return msg.Offset, ts, ok, nil
+
+	case <-time.After(time.Second * 10):
+		return -1, time.Time{}, false, fmt.Errorf("%s#%d fetch offset %d timeout", topic, partitionID, offset)
+	}
+}
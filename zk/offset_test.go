@@ -0,0 +1,94 @@
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funkygao/assert"
+)
+
+func TestSearchOffsetAtTime(t *testing.T) {
+	base := time.Now()
+	// offset 100~199, offset 100~109 carries no publish time, offset 150~159 compacted
+	at := func(offset int64) (int64, time.Time, bool, error) {
+		if offset >= 150 && offset < 160 {
+			offset = 160
+		}
+		if offset < 110 {
+			return offset, time.Time{}, false, nil
+		}
+		return offset, base.Add(time.Duration(offset) * time.Second), true, nil
+	}
+
+	for _, fixture := range []struct {
+		t        time.Time
+		expected int64
+	}{
+		{base, 110},
+		{base.Add(120 * time.Second), 120},
+		{base.Add(120*time.Second + time.Millisecond), 121},
+		{base.Add(155 * time.Second), 150},
+		{base.Add(199 * time.Second), 199},
+		{base.Add(time.Hour), 200},
+	} {
+		offset, err := searchOffsetAtTime(100, 200, fixture.t, at)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, fixture.expected, offset)
+	}
+
+	offset, err := searchOffsetAtTime(200, 200, base, at)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(200), offset)
+}
+
+func TestSearchOffsetAtTimeMixed(t *testing.T) {
+	base := time.Now()
+	at := func(untimed func(int64) bool) func(int64) (int64, time.Time, bool, error) {
+		return func(offset int64) (int64, time.Time, bool, error) {
+			if untimed(offset) {
+				return offset, time.Time{}, false, nil
+			}
+			return offset, base.Add(time.Duration(offset) * time.Second), true, nil
+		}
+	}
+
+	// publish time turned off since offset 190
+	_, err := searchOffsetAtTime(100, 200, base, at(func(o int64) bool { return o >= 190 }))
+	assert.Equal(t, ErrNoMessageTime, err)
+
+	// turned off while publishing 130~139: they take the publish time of 129
+	offset, err := searchOffsetAtTime(100, 200, base.Add(135*time.Second), at(func(o int64) bool { return o >= 130 && o < 140 }))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(140), offset)
+	offset, err = searchOffsetAtTime(100, 200, base.Add(129*time.Second), at(func(o int64) bool { return o >= 130 && o < 140 }))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(129), offset)
+
+	// every 7th message published without time, e,g. by xa or actord
+	untimed := func(o int64) bool { return o%7 == 0 }
+	for _, expected := range []int64{101, 120, 170, 199} {
+		offset, err = searchOffsetAtTime(100, 200, base.Add(time.Duration(expected)*time.Second), at(untimed))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, expected, offset)
+	}
+	offset, err = searchOffsetAtTime(100, 200, base.Add(140*time.Second), at(untimed))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(141), offset)
+}
+
+func TestParseOffsetTime(t *testing.T) {
+	tm, err := ParseOffsetTime("2026-10-01T08:00")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 8, 0, 0, 0, time.Local).Unix(), tm.Unix())
+
+	tm, err = ParseOffsetTime("2026-10-01T08:00:00Z")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1790841600), tm.Unix())
+
+	tm, err = ParseOffsetTime("1790841600")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1790841600), tm.Unix())
+
+	_, err = ParseOffsetTime("yesterday")
+	assert.NotEqual(t, nil, err)
+}
@@ -1,11 +1,26 @@
 package zk
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/samuel/go-zookeeper/zk"
 )
 
+// Priority classes of an app, job queues of higher class weigh more in assignment.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// JobQueueStat is the load of a job queue reported by its executor.
+type JobQueueStat struct {
+	Backlog int64   `json:"backlog"`  // jobs in the real time table
+	DueRate float64 `json:"due_rate"` // due jobs per second
+	Mtime   int64   `json:"mtime"`    // unix seconds of the report
+}
+
 type Orchestrator struct {
 	*ZkZone
 }
@@ -96,6 +111,108 @@ func (this *Orchestrator) ReleaseResource(actorId, root, resource string) error
 	return this.conn.Delete(path, -1)
 }
 
+// UpdateJobQueueStat saves the load of a job queue.
+func (this *Orchestrator) UpdateJobQueueStat(jobQueue string, stat JobQueueStat) error {
+	this.connectIfNeccessary()
+
+	data, _ := json.Marshal(stat)
+	path := fmt.Sprintf("%s/%s", PubsubJobQueueStats, jobQueue)
+	this.ensureParentDirExists(path)
+	err := this.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		return this.setZnode(path, data)
+	}
+	return err
+}
+
+// JobQueueStats returns {jobQueue: stat} of all reported job queues.
+func (this *Orchestrator) JobQueueStats() map[string]JobQueueStat {
+	r := make(map[string]JobQueueStat)
+	for jobQueue, zdata := range this.ChildrenWithData(PubsubJobQueueStats) {
+		var stat JobQueueStat
+		if err := json.Unmarshal(zdata.Data(), &stat); err == nil {
+			r[jobQueue] = stat
+		}
+	}
+	return r
+}
+
+// JobWeights returns the job queue weights snapshot that all actors assign job queues by.
+func (this *Orchestrator) JobWeights() (map[string]float64, error) {
+	this.connectIfNeccessary()
+
+	data, _, err := this.conn.Get(PubsubJobWeights)
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseJobWeights(data)
+}
+
+// WatchJobWeights is JobWeights with a watch that fires when a new snapshot is published.
+func (this *Orchestrator) WatchJobWeights() (map[string]float64, <-chan zk.Event, error) {
+	this.connectIfNeccessary()
+
+	data, _, c, err := this.conn.GetW(PubsubJobWeights)
+	if err == zk.ErrNoNode {
+		// watch its creation
+		_, _, c, err = this.conn.ExistsW(PubsubJobWeights)
+		return nil, c, err
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	weights, err := parseJobWeights(data)
+	return weights, c, err
+}
+
+func parseJobWeights(data []byte) (map[string]float64, error) {
+	var weights map[string]float64
+	err := json.Unmarshal(data, &weights)
+	return weights, err
+}
+
+// SetJobWeights publishes a new job queue weights snapshot, which triggers rebalance of job queues.
+func (this *Orchestrator) SetJobWeights(weights map[string]float64) error {
+	this.connectIfNeccessary()
+
+	data, _ := json.Marshal(weights)
+	err := this.CreatePermenantZnode(PubsubJobWeights, data)
+	if err == zk.ErrNodeExists {
+		return this.setZnode(PubsubJobWeights, data)
+	}
+	return err
+}
+
+// AppPriorities returns {appid: priority class} of apps whose priority is not normal.
+func (this *Orchestrator) AppPriorities() map[string]string {
+	r := make(map[string]string)
+	for appid, zdata := range this.ChildrenWithData(PubsubAppPriorities) {
+		r[appid] = string(zdata.Data())
+	}
+	return r
+}
+
+// SetAppPriority sets the priority class of an app.
+func (this *Orchestrator) SetAppPriority(appid, priority string) error {
+	switch priority {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+	default:
+		return ErrInvalidPriority
+	}
+
+	this.connectIfNeccessary()
+
+	path := fmt.Sprintf("%s/%s", PubsubAppPriorities, appid)
+	err := this.CreatePermenantZnode(path, []byte(priority))
+	if err == zk.ErrNodeExists {
+		return this.setZnode(path, []byte(priority))
+	}
+	return err
+}
+
 type ActorList []string
 
 func (this ActorList) Len() int {
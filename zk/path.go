@@ -11,6 +11,7 @@ const (
 	KatewayIdsRoot     = "/_kateway/ids"
 	katewayMetricsRoot = "/_kateway/metrics"
 	KatewayMysqlPath   = "/_kateway/mysql"
+	KatewaySubFilters  = "/_kateway/subfilters"
 
 	PubsubJobConfig      = "/_kateway/orchestrator/jobconfig"
 	PubsubJobQueues      = "/_kateway/orchestrator/jobs"
@@ -19,6 +20,9 @@ const (
 	PubsubWebhooks       = "/_kateway/orchestrator/webhooks"
 	PubsubWebhooksOff    = "/_kateway/orchestrator/webhooks_off"
 	PubsubWebhookOwners  = "/_kateway/orchestrator/actors/webhook_owners"
+	PubsubJobQueueStats  = "/_kateway/orchestrator/jobstats"
+	PubsubJobWeights     = "/_kateway/orchestrator/jobweights"
+	PubsubAppPriorities  = "/_kateway/orchestrator/priorities"
 	//PubsubActorRebalance = "/_kateway/orchestrator/rebalance"
 
 	KguardLeaderPath = "_kguard/leader"
@@ -33,6 +37,8 @@ const (
 	TopicConfigPath         = "/config/topics"
 	EntityConfigPath        = "/config"
 	DeleteTopicsPath        = "/admin/delete_topics"
+	PreferredReplicaPath    = "/admin/preferred_replica_election"
+	ReassignPartitionsPath  = "/admin/reassign_partitions"
 
 	RedisMonPath     = "/redis"
 	RedisClusterRoot = "/rediscluster"
@@ -123,6 +129,10 @@ func (this *ZkCluster) consumerGroupOffsetOfTopicPartitionPath(group, topic, par
 	return this.consumerGroupOffsetOfTopicPath(group, topic) + "/" + partition
 }
 
+func (this *ZkCluster) consumerGroupOwnersPath(group string) string {
+	return this.ConsumerGroupRoot(group) + "/owners"
+}
+
 func (this *ZkCluster) consumerGroupOwnerOfTopicPath(group, topic string) string {
-	return this.ConsumerGroupRoot(group) + "/owners/" + topic
+	return this.consumerGroupOwnersPath(group) + "/" + topic
 }
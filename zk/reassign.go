@@ -0,0 +1,111 @@
+package zk
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	log "github.com/funkygao/log4go"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// PartitionReplicas is the replica assignment of a topic partition, the first
+// replica is the preferred leader.
+type PartitionReplicas struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Replicas  []int32 `json:"replicas"`
+}
+
+// reassignment is the zk:/admin/reassign_partitions znode data.
+type reassignment struct {
+	Version    int                 `json:"version"`
+	Partitions []PartitionReplicas `json:"partitions"`
+}
+
+// ReplicaAssignment returns the replica assignment of each partition of a topic.
+func (this *ZkCluster) ReplicaAssignment(topic string) (map[int32][]int32, error) {
+	this.zone.connectIfNeccessary()
+
+	data, _, err := this.zone.conn.Get(this.topicPath(topic))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			err = ErrTopicNotFound
+		}
+		return nil, err
+	}
+
+	var assignment topicAssignment
+	if err = json.Unmarshal(data, &assignment); err != nil {
+		return nil, err
+	}
+
+	r := make(map[int32][]int32, len(assignment.Partitions))
+	for p, replicas := range assignment.Partitions {
+		partitionId, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		r[int32(partitionId)] = replicas
+	}
+	return r, nil
+}
+
+// ReassignPartitions asks the controller to move the partitions to the new replicas
+// the same way kafka-reassign-partitions.sh does.
+//
+// The controller removes each partition from the znode once its new replicas
+// are in sync, and the znode itself after all are done.
+func (this *ZkCluster) ReassignPartitions(partitions []PartitionReplicas) error {
+	data, err := json.Marshal(reassignment{Version: 1, Partitions: partitions})
+	if err != nil {
+		return err
+	}
+
+	path := this.path + ReassignPartitionsPath
+	this.zone.connectIfNeccessary()
+	if err = this.zone.ensureParentDirExists(path); err != nil {
+		return err
+	}
+
+	err = this.zone.createZnode(path, data)
+	if err == zk.ErrNodeExists {
+		return ErrReassignInProgress
+	}
+	if err == nil {
+		log.Info("cluster[%s] reassigning %d partitions", this.name, len(partitions))
+	}
+	return err
+}
+
+// ReassigningPartitions returns the partitions whose reassignment is not completed yet.
+func (this *ZkCluster) ReassigningPartitions() ([]PartitionReplicas, error) {
+	this.zone.connectIfNeccessary()
+
+	data, _, err := this.zone.conn.Get(this.path + ReassignPartitionsPath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var v reassignment
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(partitionReplicasSlice(v.Partitions))
+	return v.Partitions, nil
+}
+
+type partitionReplicasSlice []PartitionReplicas
+
+func (s partitionReplicasSlice) Len() int      { return len(s) }
+func (s partitionReplicasSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s partitionReplicasSlice) Less(i, j int) bool {
+	if s[i].Topic != s[j].Topic {
+		return s[i].Topic < s[j].Topic
+	}
+	return s[i].Partition < s[j].Partition
+}
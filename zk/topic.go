@@ -0,0 +1,552 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/funkygao/gafka/sla"
+	log "github.com/funkygao/log4go"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	maxTopicNameLen = 255
+
+	// kafka 0.8.2 TopicConfigManager watches this sequential znode prefix.
+	topicConfigChangePrefix = "config_change_"
+)
+
+var (
+	legalTopicName = regexp.MustCompile(`^[a-zA-Z0-9\._\-]+$`)
+
+	rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// TopicError records a failed topic administration and the cause.
+type TopicError struct {
+	Op    string // create|delete|alter|scale
+	Topic string
+	Err   error
+}
+
+func (this *TopicError) Error() string {
+	return fmt.Sprintf("%s topic[%s]: %v", this.Op, this.Topic, this.Err)
+}
+
+// IsTopicError checks whether err is a TopicError caused by cause.
+func IsTopicError(err error, cause error) bool {
+	te, ok := err.(*TopicError)
+	return ok && te.Err == cause
+}
+
+// topicAssignment is the zk:/brokers/topics/{topic} znode data.
+type topicAssignment struct {
+	Version    int                `json:"version"`
+	Partitions map[string][]int32 `json:"partitions"`
+}
+
+// topicConfig is the zk:/config/topics/{topic} znode data.
+type topicConfig struct {
+	Version int               `json:"version"`
+	Config  map[string]string `json:"config"`
+}
+
+func validateTopicName(topic string) error {
+	if len(topic) == 0 || len(topic) > maxTopicNameLen || topic == "." || topic == ".." ||
+		!legalTopicName.MatchString(topic) {
+		return ErrInvalidTopicName
+	}
+
+	return nil
+}
+
+func (this *ZkCluster) topicPath(topic string) string {
+	return fmt.Sprintf("%s/%s", this.topicsRoot(), topic)
+}
+
+func (this *ZkCluster) deleteTopicPath(topic string) string {
+	return fmt.Sprintf("%s%s/%s", this.path, DeleteTopicsPath, topic)
+}
+
+// AddTopic creates a topic by writing its configs and replica assignment znodes
+// in one zk transaction, the controller will then create the partitions.
+func (this *ZkCluster) AddTopic(topic string, ts *sla.TopicSla) error {
+	const op = "create"
+
+	if err := validateTopicName(topic); err != nil {
+		return &TopicError{op, topic, err}
+	}
+	if err := ts.Validate(); err != nil {
+		return &TopicError{op, topic, err}
+	}
+	if ts.MinInsyncReplicas > ts.Replicas {
+		return &TopicError{op, topic, ErrMinIsrExceedsReplicas}
+	}
+
+	this.zone.connectIfNeccessary()
+
+	if exists, _, err := this.zone.conn.Exists(this.topicPath(topic)); err != nil {
+		return &TopicError{op, topic, err}
+	} else if exists {
+		return &TopicError{op, topic, ErrTopicExists}
+	}
+
+	brokerIds := this.sortedBrokerIds()
+	if ts.Replicas > len(brokerIds) {
+		return &TopicError{op, topic, ErrNotEnoughBrokers}
+	}
+
+	assignment := assignReplicas(brokerIds, ts.Partitions, ts.Replicas,
+		rnd.Intn(len(brokerIds)), rnd.Intn(len(brokerIds)), 0)
+
+	configPath := this.GetTopicConfigPath(topic)
+	for _, path := range []string{configPath, this.topicPath(topic)} {
+		if err := this.zone.ensureParentDirExists(path); err != nil {
+			return &TopicError{op, topic, err}
+		}
+	}
+
+	// the broker creates the log with the configs, and a topic that failed to be
+	// created must not leave configs behind
+	acl := zk.WorldACL(zk.PermAll)
+	configData, _ := json.Marshal(topicConfig{Version: 1, Config: ts.TopicConfigs()})
+	var configOp interface{} = &zk.CreateRequest{Path: configPath, Data: configData, Acl: acl}
+	if exists, _, err := this.zone.conn.Exists(configPath); err != nil {
+		return &TopicError{op, topic, err}
+	} else if exists {
+		// left over by a deleted topic
+		configOp = &zk.SetDataRequest{Path: configPath, Data: configData, Version: -1}
+	}
+
+	data, _ := json.Marshal(topicAssignment{Version: 1, Partitions: assignment})
+	if _, err := this.zone.conn.Multi(configOp,
+		&zk.CreateRequest{Path: this.topicPath(topic), Data: data, Acl: acl}); err != nil {
+		if err == zk.ErrNodeExists {
+			err = ErrTopicExists
+		}
+		return &TopicError{op, topic, err}
+	}
+
+	log.Info("cluster[%s] topic[%s] created: %s", this.name, topic, string(data))
+	return nil
+}
+
+// DeleteTopic marks a topic for deletion, which the controller carries out if
+// delete.topic.enable is on.
+func (this *ZkCluster) DeleteTopic(topic string) error {
+	const op = "delete"
+
+	if err := validateTopicName(topic); err != nil {
+		return &TopicError{op, topic, err}
+	}
+
+	this.zone.connectIfNeccessary()
+
+	if exists, _, err := this.zone.conn.Exists(this.topicPath(topic)); err != nil {
+		return &TopicError{op, topic, err}
+	} else if !exists {
+		return &TopicError{op, topic, ErrTopicNotFound}
+	}
+
+	if err := this.zone.CreatePermenantZnode(this.deleteTopicPath(topic), nil); err != nil {
+		if err == zk.ErrNodeExists {
+			err = ErrTopicDeleting
+		}
+		return &TopicError{op, topic, err}
+	}
+
+	log.Info("cluster[%s] topic[%s] marked for deletion", this.name, topic)
+	return nil
+}
+
+// AlterTopic merges the non-default topic configs of ts into the topic's configs
+// and adds partitions if ts.Partitions is not the default.
+func (this *ZkCluster) AlterTopic(topic string, ts *sla.TopicSla) error {
+	const op = "alter"
+
+	if err := validateTopicName(topic); err != nil {
+		return &TopicError{op, topic, err}
+	}
+	if err := ts.Validate(); err != nil {
+		return &TopicError{op, topic, err}
+	}
+
+	configs := ts.TopicConfigs()
+	if len(configs) == 0 && !ts.PartitionsAltered() {
+		return &TopicError{op, topic, ErrNothingToAlter}
+	}
+
+	this.zone.connectIfNeccessary()
+
+	data, stat, err := this.zone.conn.Get(this.topicPath(topic))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			err = ErrTopicNotFound
+		}
+		return &TopicError{op, topic, err}
+	}
+
+	var assignment topicAssignment
+	if err = json.Unmarshal(data, &assignment); err != nil {
+		return &TopicError{op, topic, err}
+	}
+
+	if len(assignment.Partitions["0"]) < ts.MinInsyncReplicas {
+		return &TopicError{op, topic, ErrMinIsrExceedsReplicas}
+	}
+
+	var newAssignment map[string][]int32
+	if ts.PartitionsAltered() {
+		if newAssignment, err = this.addPartitions(assignment.Partitions, ts.Partitions); err != nil {
+			return &TopicError{op, topic, err}
+		}
+	}
+
+	// all checks passed, now write
+	if len(configs) > 0 {
+		if err = this.writeTopicConfig(topic, configs, true); err != nil {
+			return &TopicError{op, topic, err}
+		}
+
+		log.Info("cluster[%s] topic[%s] configs altered: %+v", this.name, topic, configs)
+	}
+
+	if newAssignment != nil {
+		data, _ = json.Marshal(topicAssignment{Version: 1, Partitions: newAssignment})
+		if _, err = this.zone.conn.Set(this.topicPath(topic), data, stat.Version); err != nil {
+			return &TopicError{op, topic, err}
+		}
+
+		log.Info("cluster[%s] topic[%s] partitions altered: %s", this.name, topic, string(data))
+	}
+
+	return nil
+}
+
+// addPartitions returns the assignment after adding partitions to the existing assignment.
+func (this *ZkCluster) addPartitions(existing map[string][]int32, partitions int) (map[string][]int32, error) {
+	if partitions <= len(existing) {
+		return nil, ErrPartitionsNotIncreased
+	}
+
+	brokerIds := this.sortedBrokerIds()
+	replicas := existing["0"]
+	if len(replicas) > len(brokerIds) {
+		return nil, ErrNotEnoughBrokers
+	}
+
+	// follow the existing assignment like kafka does
+	startIndex := -1
+	for i, id := range brokerIds {
+		if len(replicas) > 0 && id == replicas[0] {
+			startIndex = i
+			break
+		}
+	}
+	if startIndex < 0 {
+		startIndex = rnd.Intn(len(brokerIds))
+	}
+
+	r := assignReplicas(brokerIds, partitions-len(existing), len(replicas),
+		startIndex, startIndex, len(existing))
+	for p, replicas := range existing {
+		r[p] = replicas
+	}
+
+	return r, nil
+}
+
+// TopicScale is the plan of adding partitions to a topic on chosen brokers.
+type TopicScale struct {
+	Topic    string
+	Existing int                // number of existing partitions
+	Added    map[string][]int32 // partition id => replicas
+
+	assignment map[string][]int32
+	version    int32
+}
+
+// PlanScale plans adding partitions to topic with replicas placed on brokerIds only
+// and leaders spread across them. Replicas of each new partition are spread across
+// as many racks as the cluster has, up to the replication factor.
+func (this *ZkCluster) PlanScale(topic string, partitions int, brokerIds []int32) (*TopicScale, error) {
+	const op = "scale"
+
+	if err := validateTopicName(topic); err != nil {
+		return nil, &TopicError{op, topic, err}
+	}
+	if partitions < 1 {
+		return nil, &TopicError{op, topic, ErrPartitionsNotIncreased}
+	}
+
+	this.zone.connectIfNeccessary()
+
+	data, stat, err := this.zone.conn.Get(this.topicPath(topic))
+	if err != nil {
+		if err == zk.ErrNoNode {
+			err = ErrTopicNotFound
+		}
+		return nil, &TopicError{op, topic, err}
+	}
+
+	var assignment topicAssignment
+	if err = json.Unmarshal(data, &assignment); err != nil {
+		return nil, &TopicError{op, topic, err}
+	}
+
+	ts := sla.DefaultSla()
+	ts.Partitions = len(assignment.Partitions) + partitions
+	if err = ts.Validate(); err != nil {
+		return nil, &TopicError{op, topic, err}
+	}
+
+	domains := make(map[int32]string)
+	for id, broker := range this.Brokers() {
+		if brokerId, err := strconv.Atoi(id); err == nil {
+			domains[int32(brokerId)] = broker.Domain()
+		}
+	}
+
+	added, err := scaleAssignment(len(assignment.Partitions), partitions,
+		len(assignment.Partitions["0"]), brokerIds, domains)
+	if err != nil {
+		return nil, &TopicError{op, topic, err}
+	}
+
+	return &TopicScale{
+		Topic:      topic,
+		Existing:   len(assignment.Partitions),
+		Added:      added,
+		assignment: assignment.Partitions,
+		version:    stat.Version,
+	}, nil
+}
+
+// Scale applies the plan, it fails if the topic changed since planned.
+func (this *ZkCluster) Scale(plan *TopicScale) error {
+	r := make(map[string][]int32, len(plan.assignment)+len(plan.Added))
+	for p, replicas := range plan.assignment {
+		r[p] = replicas
+	}
+	for p, replicas := range plan.Added {
+		r[p] = replicas
+	}
+
+	this.zone.connectIfNeccessary()
+
+	data, _ := json.Marshal(topicAssignment{Version: 1, Partitions: r})
+	if _, err := this.zone.conn.Set(this.topicPath(plan.Topic), data, plan.version); err != nil {
+		return &TopicError{"scale", plan.Topic, err}
+	}
+
+	log.Info("cluster[%s] topic[%s] scaled: %s", this.name, plan.Topic, string(data))
+	return nil
+}
+
+// scaleAssignment assigns replicas of the new partitions to brokerIds, domains is the
+// failure domain of all live brokers in the cluster.
+func scaleAssignment(existing, partitions, replicas int, brokerIds []int32,
+	domains map[int32]string) (map[string][]int32, error) {
+	seen := make(map[int32]bool, len(brokerIds))
+	brokerDomains := make(map[string]bool)
+	for _, id := range brokerIds {
+		domain, present := domains[id]
+		if !present {
+			return nil, ErrBrokerNotFound
+		}
+		if seen[id] {
+			return nil, ErrDupBroker
+		}
+
+		seen[id] = true
+		brokerDomains[domain] = true
+	}
+	if replicas > len(brokerIds) {
+		return nil, ErrNotEnoughBrokers
+	}
+
+	clusterDomains := make(map[string]bool)
+	for _, domain := range domains {
+		clusterDomains[domain] = true
+	}
+	spread := replicas
+	if len(clusterDomains) < spread {
+		spread = len(clusterDomains)
+	}
+	if len(brokerDomains) < spread {
+		return nil, ErrRackSpreadBroken
+	}
+
+	return assignReplicasRackAware(rackAlternated(brokerIds, domains), domains,
+		partitions, replicas, existing), nil
+}
+
+// rackAlternated orders brokers so that adjacent brokers are in different failure
+// domains as much as possible, e,g. a1 b1 c1 a2 b2 a3.
+func rackAlternated(brokerIds []int32, domains map[int32]string) []int32 {
+	byDomain := make(map[string][]int32)
+	var names []string
+	for _, id := range brokerIds {
+		domain := domains[id]
+		if _, present := byDomain[domain]; !present {
+			names = append(names, domain)
+		}
+		byDomain[domain] = append(byDomain[domain], id)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sort.Sort(int32Slice(byDomain[name]))
+	}
+
+	r := make([]int32, 0, len(brokerIds))
+	for i := 0; len(r) < len(brokerIds); i++ {
+		for _, name := range names {
+			if i < len(byDomain[name]) {
+				r = append(r, byDomain[name][i])
+			}
+		}
+	}
+	return r
+}
+
+// assignReplicasRackAware puts the leader of each partition on the brokers in turn, and
+// picks followers after the leader with a shift that changes every n partitions like
+// assignReplicas, skipping brokers whose failure domain already has a replica until
+// every domain has one.
+func assignReplicasRackAware(brokerIds []int32, domains map[int32]string,
+	partitions, replicas, startPartition int) map[string][]int32 {
+	n := len(brokerIds)
+	allDomains := make(map[string]bool)
+	for _, id := range brokerIds {
+		allDomains[domains[id]] = true
+	}
+
+	r := make(map[string][]int32, partitions)
+	for i := 0; i < partitions; i++ {
+		leader := i % n
+		replicaList := []int32{brokerIds[leader]}
+		used := map[int32]bool{brokerIds[leader]: true}
+		usedDomains := map[string]bool{domains[brokerIds[leader]]: true}
+
+		shift := 0
+		if n > 1 {
+			shift = (i / n) % (n - 1)
+		}
+		for k := 0; len(replicaList) < replicas && k < 2*n; k++ {
+			id := brokerIds[(leader+1+shift+k)%n]
+			if used[id] {
+				continue
+			}
+			// the first pass only takes brokers in new failure domains
+			if k < n && usedDomains[domains[id]] && len(usedDomains) < len(allDomains) {
+				continue
+			}
+
+			replicaList = append(replicaList, id)
+			used[id] = true
+			usedDomains[domains[id]] = true
+		}
+
+		r[strconv.Itoa(startPartition+i)] = replicaList
+	}
+
+	return r
+}
+
+// writeTopicConfig writes the topic configs and notifies brokers of the change.
+func (this *ZkCluster) writeTopicConfig(topic string, configs map[string]string, merge bool) error {
+	path := this.GetTopicConfigPath(topic)
+	cf := topicConfig{Version: 1, Config: make(map[string]string)}
+	data, stat, err := this.zone.conn.Get(path)
+	switch err {
+	case nil:
+		if merge {
+			if err = json.Unmarshal(data, &cf); err != nil {
+				return err
+			}
+			if cf.Config == nil {
+				cf.Config = make(map[string]string)
+			}
+		}
+
+	case zk.ErrNoNode:
+		stat = nil
+
+	default:
+		return err
+	}
+
+	for k, v := range configs {
+		cf.Config[k] = v
+	}
+
+	data, _ = json.Marshal(cf)
+	if stat == nil {
+		err = this.zone.CreatePermenantZnode(path, data)
+	} else {
+		_, err = this.zone.conn.Set(path, data, stat.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 0.8.2 broker reads topic name from the change notification
+	notification, _ := json.Marshal(topic)
+	changePath := fmt.Sprintf("%s%s/%s", this.path, EntityConfigChangesPath, topicConfigChangePrefix)
+	if err = this.zone.ensureParentDirExists(changePath); err != nil {
+		return err
+	}
+	_, err = this.zone.conn.Create(changePath, notification, zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+func (this *ZkCluster) sortedBrokerIds() []int32 {
+	r := make([]int32, 0)
+	for id := range this.Brokers() {
+		if brokerId, err := strconv.Atoi(id); err == nil {
+			r = append(r, int32(brokerId))
+		}
+	}
+	sort.Sort(int32Slice(r))
+	return r
+}
+
+// assignReplicas spreads partition leaders and followers evenly across brokers,
+// it is a port of kafka 0.8.2 AdminUtils.assignReplicasToBrokers.
+//
+// The leader of partition p is on brokerIds[(p + startIndex) % n], and each
+// follower is shifted from the leader by a distance that changes every n partitions.
+func assignReplicas(brokerIds []int32, partitions, replicas int,
+	startIndex, replicaShift, startPartition int) map[string][]int32 {
+	n := len(brokerIds)
+	r := make(map[string][]int32, partitions)
+	partitionId := startPartition
+	for i := 0; i < partitions; i++ {
+		if partitionId > 0 && partitionId%n == 0 {
+			replicaShift++
+		}
+
+		firstReplicaIndex := (partitionId + startIndex) % n
+		replicaList := []int32{brokerIds[firstReplicaIndex]}
+		for j := 0; j < replicas-1; j++ {
+			shift := 1 + (replicaShift+j)%(n-1)
+			replicaList = append(replicaList, brokerIds[(firstReplicaIndex+shift)%n])
+		}
+
+		r[strconv.Itoa(partitionId)] = replicaList
+		partitionId++
+	}
+
+	return r
+}
+
+type int32Slice []int32
+
+func (s int32Slice) Len() int           { return len(s) }
+func (s int32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,119 @@
+package zk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/funkygao/assert"
+)
+
+func TestValidateTopicName(t *testing.T) {
+	for _, topic := range []string{"foo", "app1.foo.v1", "a_b-c", strings.Repeat("x", 255)} {
+		assert.Equal(t, nil, validateTopicName(topic))
+	}
+	for _, topic := range []string{"", ".", "..", "foo bar", "foo/bar", "foo*", strings.Repeat("x", 256)} {
+		assert.Equal(t, ErrInvalidTopicName, validateTopicName(topic))
+	}
+}
+
+func TestAssignReplicas(t *testing.T) {
+	// the same case as kafka AdminTest.testReplicaAssignment
+	expected := map[string][]int32{
+		"0": {0, 1, 2},
+		"1": {1, 2, 3},
+		"2": {2, 3, 4},
+		"3": {3, 4, 0},
+		"4": {4, 0, 1},
+		"5": {0, 2, 3},
+		"6": {1, 3, 4},
+		"7": {2, 4, 0},
+		"8": {3, 0, 1},
+		"9": {4, 1, 2},
+	}
+	assert.Equal(t, expected, assignReplicas([]int32{0, 1, 2, 3, 4}, 10, 3, 0, 0, 0))
+
+	// adding partitions continues the leader pattern
+	added := assignReplicas([]int32{0, 1, 2, 3, 4}, 4, 3, 0, 0, 6)
+	assert.Equal(t, 4, len(added))
+	for p, replicas := range added {
+		assert.Equal(t, expected[p][0], replicas[0])
+	}
+	assert.Equal(t, []int32{1, 2, 3}, added["6"])
+
+	// every partition has distinct replicas
+	for p, replicas := range assignReplicas([]int32{10, 20, 30}, 7, 3, 2, 1, 0) {
+		seen := make(map[int32]bool)
+		for _, id := range replicas {
+			assert.Equal(t, false, seen[id], p)
+			seen[id] = true
+		}
+	}
+
+	assert.Equal(t, map[string][]int32{"0": {7}, "1": {7}}, assignReplicas([]int32{7}, 2, 1, 0, 0, 0))
+}
+
+func TestTopicAssignmentZnode(t *testing.T) {
+	data, _ := json.Marshal(topicAssignment{Version: 1, Partitions: assignReplicas([]int32{1, 2}, 2, 2, 0, 0, 0)})
+	assert.Equal(t, `{"version":1,"partitions":{"0":[1,2],"1":[2,1]}}`, string(data))
+
+	data, _ = json.Marshal(topicConfig{Version: 1, Config: map[string]string{}})
+	assert.Equal(t, `{"version":1,"config":{}}`, string(data))
+}
+
+func TestTopicError(t *testing.T) {
+	err := error(&TopicError{"create", "foo", ErrTopicExists})
+	assert.Equal(t, "create topic[foo]: topic already exists", err.Error())
+	assert.Equal(t, true, IsTopicError(err, ErrTopicExists))
+	assert.Equal(t, false, IsTopicError(err, ErrTopicNotFound))
+	assert.Equal(t, false, IsTopicError(ErrTopicExists, ErrTopicExists))
+}
+
+func TestScaleAssignment(t *testing.T) {
+	// brokers 1,2 in rack a, 3,4 in rack b, 5 in rack c
+	domains := map[int32]string{1: "a", 2: "a", 3: "b", 4: "b", 5: "c"}
+
+	added, err := scaleAssignment(3, 4, 2, []int32{1, 2, 3, 4}, domains)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(added))
+	leaders := make(map[int32]int)
+	for p, replicas := range added {
+		assert.Equal(t, 2, len(replicas), p)
+		assert.NotEqual(t, domains[replicas[0]], domains[replicas[1]])
+		leaders[replicas[0]]++
+	}
+	assert.Equal(t, 4, len(leaders)) // leaders spread across the chosen brokers
+	for _, p := range []string{"3", "4", "5", "6"} {
+		_, present := added[p]
+		assert.Equal(t, true, present)
+	}
+
+	// 3 replicas across the 3 racks
+	added, err = scaleAssignment(0, 5, 3, []int32{1, 2, 3, 4, 5}, domains)
+	assert.Equal(t, nil, err)
+	for p, replicas := range added {
+		seen := make(map[string]bool)
+		for _, id := range replicas {
+			seen[domains[id]] = true
+		}
+		assert.Equal(t, 3, len(seen), p)
+	}
+
+	_, err = scaleAssignment(1, 1, 2, []int32{1, 2}, domains)
+	assert.Equal(t, ErrRackSpreadBroken, err)
+	_, err = scaleAssignment(1, 1, 2, []int32{1, 9}, domains)
+	assert.Equal(t, ErrBrokerNotFound, err)
+	_, err = scaleAssignment(1, 1, 2, []int32{1, 1}, domains)
+	assert.Equal(t, ErrDupBroker, err)
+	_, err = scaleAssignment(1, 1, 3, []int32{1, 3}, domains)
+	assert.Equal(t, ErrNotEnoughBrokers, err)
+
+	// single rack cluster can't break the spread
+	_, err = scaleAssignment(1, 2, 2, []int32{1, 2}, map[int32]string{1: "a", 2: "a"})
+	assert.Equal(t, nil, err)
+}
+
+func TestRackAlternated(t *testing.T) {
+	domains := map[int32]string{1: "a", 2: "a", 3: "a", 4: "b", 5: "b", 6: "c"}
+	assert.Equal(t, []int32{1, 4, 6, 2, 5, 3}, rackAlternated([]int32{3, 2, 1, 6, 5, 4}, domains))
+}
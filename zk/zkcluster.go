@@ -1,7 +1,6 @@
 package zk
 
 import (
-	"bufio"
 	"bytes"
 	"container/list"
 	"encoding/binary"
@@ -15,8 +14,6 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/funkygao/gafka/ctx"
-	"github.com/funkygao/gafka/sla"
-	"github.com/funkygao/golib/pipestream"
 	log "github.com/funkygao/log4go"
 	"github.com/samuel/go-zookeeper/zk"
 )
@@ -214,6 +211,10 @@ func (this *ZkCluster) UnregisterBroker(id int) error {
 	return this.zone.setZnode(this.ClusterInfoPath(), data)
 }
 
+// ZombieConsumerGroups returns the groups that have consumers registered but
+// some subscribed topic not owned by any consumer.
+// If autofix, the zombie groups that own no partition at all are reset, the others
+// are left alone because some of their consumers are alive.
 func (this *ZkCluster) ZombieConsumerGroups(autofix bool) (groups []string) {
 	groupMap := make(map[string]struct{})
 	for group, cz := range this.ConsumerGroups() {
@@ -230,9 +231,75 @@ func (this *ZkCluster) ZombieConsumerGroups(autofix bool) (groups []string) {
 	}
 	sort.Strings(groups)
 
+	if autofix {
+		for _, group := range groups {
+			switch err := this.ResetConsumerGroupIds(group); err {
+			case nil:
+				log.Info("cluster[%s] zombie group[%s] reset", this.name, group)
+
+			case ErrGroupHasOwners:
+				log.Warn("cluster[%s] zombie group[%s] not reset: %v", this.name, group, err)
+
+			default:
+				log.Error("cluster[%s] reset zombie group[%s]: %v", this.name, group, err)
+			}
+		}
+	}
+
 	return
 }
 
+// ResetConsumerGroupIds removes the registered consumer ids of a group that owns
+// no partition at all, which triggers a clean rebalance when its consumers re-register.
+// If the group still owns any partition, its consumers are alive and ErrGroupHasOwners
+// is returned without touching anything.
+func (this *ZkCluster) ResetConsumerGroupIds(group string) error {
+	this.zone.connectIfNeccessary()
+
+	for _, topic := range this.zone.children(this.consumerGroupOwnersPath(group)) {
+		if len(this.OwnersOfGroupByTopic(group, topic)) > 0 {
+			return ErrGroupHasOwners
+		}
+	}
+
+	for _, id := range this.zone.children(this.consumerGroupIdsPath(group)) {
+		err := this.zone.conn.Delete(this.consumerGroupIdsPath(group)+"/"+id, -1)
+		if err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PreferredReplicaElection asks the controller to move leadership of the topic
+// partitions back to their preferred replicas.
+func (this *ZkCluster) PreferredReplicaElection(topic string, partitions []int32) error {
+	type partitionMeta struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+	}
+	v := struct {
+		Version    int             `json:"version"`
+		Partitions []partitionMeta `json:"partitions"`
+	}{Version: 1}
+	for _, p := range partitions {
+		v.Partitions = append(v.Partitions, partitionMeta{Topic: topic, Partition: p})
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	this.zone.connectIfNeccessary()
+	err = this.zone.createZnode(this.path+PreferredReplicaPath, data)
+	if err == zk.ErrNodeExists {
+		return ErrElectionInProgress
+	}
+	return err
+}
+
 func (this *ZkCluster) TailMessage(topic string, partitionID int32, lastN int) ([][]byte, error) {
 	kfk, err := sarama.NewClient(this.BrokerList(), sarama.NewConfig())
 	if err != nil {
@@ -558,96 +625,6 @@ func (this *ZkCluster) Broker(id int) (b *BrokerZnode) {
 	return
 }
 
-func (this *ZkCluster) AddTopic(topic string, ts *sla.TopicSla) (output []string, err error) {
-	zkAddrs := this.ZkConnectAddr()
-	args := []string{
-		fmt.Sprintf("--zookeeper %s", zkAddrs),
-		fmt.Sprintf("--create"),
-		fmt.Sprintf("--topic %s", topic),
-	}
-	args = append(args, ts.DumpForCreateTopic()...)
-	cmd := pipestream.New(fmt.Sprintf("%s/bin/kafka-topics.sh", ctx.KafkaHome()), args...)
-	if err = cmd.Open(); err != nil {
-		return
-	}
-	defer cmd.Close()
-
-	scanner := bufio.NewScanner(cmd.Reader())
-	scanner.Split(bufio.ScanLines)
-
-	output = make([]string, 0)
-	for scanner.Scan() {
-		output = append(output, scanner.Text())
-	}
-	if err = scanner.Err(); err != nil {
-		return
-	}
-
-	return
-}
-
-func (this *ZkCluster) DeleteTopic(topic string) (output []string, err error) {
-	zkAddrs := this.ZkConnectAddr()
-	args := []string{
-		fmt.Sprintf("--zookeeper %s", zkAddrs),
-		fmt.Sprintf("--delete"),
-		fmt.Sprintf("--topic %s", topic),
-	}
-	cmd := pipestream.New(fmt.Sprintf("%s/bin/kafka-topics.sh", ctx.KafkaHome()), args...)
-	if err = cmd.Open(); err != nil {
-		return
-	}
-	defer cmd.Close()
-
-	scanner := bufio.NewScanner(cmd.Reader())
-	scanner.Split(bufio.ScanLines)
-
-	output = make([]string, 0)
-	for scanner.Scan() {
-		output = append(output, scanner.Text())
-	}
-	if err = scanner.Err(); err != nil {
-		return
-	}
-
-	return
-}
-
-func (this *ZkCluster) AlterTopic(topic string, ts *sla.TopicSla) (output []string, err error) {
-	zkAddrs := this.ZkConnectAddr()
-	args := []string{
-		fmt.Sprintf("--zookeeper %s", zkAddrs),
-		fmt.Sprintf("--alter"),
-		fmt.Sprintf("--topic %s", topic),
-	}
-	configs := ts.DumpForAlterTopic()
-	if len(configs) == 0 {
-		err = errors.New("no alter topic configs")
-		return
-	}
-
-	args = append(args, configs...)
-	cmd := pipestream.New(fmt.Sprintf("%s/bin/kafka-topics.sh", ctx.KafkaHome()),
-		args...)
-	if err = cmd.Open(); err != nil {
-		return
-	}
-	defer cmd.Close()
-
-	scanner := bufio.NewScanner(cmd.Reader())
-	scanner.Split(bufio.ScanLines)
-
-	output = make([]string, 0)
-	for scanner.Scan() {
-		output = append(output, scanner.Text())
-	}
-	if err = scanner.Err(); err != nil {
-		return
-	}
-
-	return
-}
-
 func (this *ZkCluster) TotalConsumerOffsets(topicPattern string) (total int64) {
 	// /$cluster/consumers/$group/offsets/$topic/0
 	root := this.consumerGroupsRoot()
@@ -295,6 +295,66 @@ func (this *Orchestrator) WebhookInfo(topic string) (*WebhookMeta, error) {
 	return hook, err
 }
 
+// CreateOrUpdateSubFilter attaches a filter expression to a consumer group on a topic.
+func (this *ZkZone) CreateOrUpdateSubFilter(group, topic, filter string) error {
+	this.connectIfNeccessary()
+
+	path := fmt.Sprintf("%s/%s/%s", KatewaySubFilters, group, topic)
+	this.ensureParentDirExists(path)
+
+	err := this.createZnode(path, []byte(filter))
+	if err == zk.ErrNodeExists {
+		err = this.setZnode(path, []byte(filter))
+	}
+	if err != nil {
+		return err
+	}
+
+	return this.notifySubFilterChange(group)
+}
+
+// SubFilter returns the filter expression of a consumer group on a topic, empty if none.
+func (this *ZkZone) SubFilter(group, topic string) (string, error) {
+	this.connectIfNeccessary()
+
+	path := fmt.Sprintf("%s/%s/%s", KatewaySubFilters, group, topic)
+	data, _, err := this.conn.Get(path)
+	if err == zk.ErrNoNode {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// DeleteSubFilters removes all the filters of a consumer group.
+func (this *ZkZone) DeleteSubFilters(group string) error {
+	if err := this.DeleteRecursive(fmt.Sprintf("%s/%s", KatewaySubFilters, group)); err != nil {
+		return err
+	}
+
+	return this.notifySubFilterChange(group)
+}
+
+// WatchSubFilters returns a watch that fires on the next change of any sub filter.
+func (this *ZkZone) WatchSubFilters() (<-chan zk.Event, error) {
+	this.connectIfNeccessary()
+
+	_, _, c, err := this.conn.GetW(KatewaySubFilters)
+	if err == zk.ErrNoNode {
+		// watch its creation
+		_, _, c, err = this.conn.ExistsW(KatewaySubFilters)
+	}
+	return c, err
+}
+
+// notifySubFilterChange writes the changed group to the sub filters root to fire the watches.
+func (this *ZkZone) notifySubFilterChange(group string) error {
+	err := this.setZnode(KatewaySubFilters, []byte(group))
+	if err == zk.ErrNoNode {
+		err = this.CreatePermenantZnode(KatewaySubFilters, []byte(group))
+	}
+	return err
+}
+
 func (this *ZkZone) LoadKatewayMetrics(katewayId string, key string) ([]byte, error) {
 	this.connectIfNeccessary()
 